@@ -0,0 +1,135 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAnalyticsPeriod = 30 * 24 * time.Hour
+	maxAnalyticsPeriod     = 366 * 24 * time.Hour
+	analyticsTopLimit      = 10
+)
+
+// @Summary Get gallery analytics
+// @Description Aggregates how clients used the shared gallery: unique visitors, opens, views, downloads, orders, the
+// @Description most viewed photos and a daily time series. Defaults to the last 30 days.
+// @Tags galleries
+// @Accept */*
+// @Produce json
+// @Param galleryId path string true "Gallery ID" example:"671442a11fd0c5eb46b5a3fa"
+// @Param from query string false "Start of the period (RFC3339)"
+// @Param to query string false "End of the period (RFC3339)"
+// @Success 200 {object} domain.GalleryAnalytics
+// @Failure 400 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/galleries/{galleryId}/analytics [get]
+func (a *api) getGalleryAnalyticsHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+
+	to := time.Now().UTC()
+	if s := ctx.Query("to"); s != "" {
+		if to, err = time.Parse(time.RFC3339, s); err != nil {
+			return BadRequest(ctx, err)
+		}
+	}
+	from := to.Add(-defaultAnalyticsPeriod)
+	if s := ctx.Query("from"); s != "" {
+		if from, err = time.Parse(time.RFC3339, s); err != nil {
+			return BadRequest(ctx, err)
+		}
+	}
+	if !from.Before(to) || to.Sub(from) > maxAnalyticsPeriod {
+		return BadRequest(ctx, errors.New("invalid analytics period"))
+	}
+
+	exists, err := a.galleryRepo.GalleryExists(ctx.Context(), galleryId, workspaceId)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to fetch gallery")
+	}
+	if !exists {
+		return NotFound(ctx, errors.New("gallery not found"))
+	}
+
+	analytics, err := a.accessEventRepo.GetGalleryAnalytics(ctx.Context(), galleryId, workspaceId, from.UTC(), to.UTC(), analyticsTopLimit)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to compute analytics")
+	}
+
+	return ctx.JSON(analytics)
+}
+
+// recordAccessEvent stores a client event of the gallery, failures are only logged as they must not break the request
+func (a *api) recordAccessEvent(ctx *fiber.Ctx, gallery domain.GalleryDB, eventType domain.AccessEventType, photoId *primitive.ObjectID) {
+	userAgent := ctx.Get(fiber.HeaderUserAgent)
+	event := domain.AccessEventDB{
+		GalleryID:   gallery.ID,
+		UserId:      gallery.UserId,
+		WorkspaceID: gallery.WorkspaceID,
+		Type:        eventType,
+		PhotoID:     photoId,
+		VisitorID:   visitorId(ctx.IP(), userAgent),
+		UserAgent:   coarseUserAgent(userAgent),
+		ClientEmail: sessionClientEmail(ctx),
+	}
+	if link, ok := ctx.Locals("shareLink").(domain.ShareLinkDB); ok {
+		event.ShareLinkID = &link.ID
+	}
+
+	if err := a.accessEventRepo.RecordEvent(ctx.Context(), &event); err != nil {
+		log.Printf("Failed to record %s event: %v", eventType, err)
+	}
+}
+
+func visitorId(ip, userAgent string) string {
+	sum := sha256.Sum256([]byte(ip + "|" + userAgent))
+	return hex.EncodeToString(sum[:8])
+}
+
+// coarseUserAgent reduces a user agent to its browser family and operating system, the order of checks matters as
+// most browsers claim to be several others
+func coarseUserAgent(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	browser := "Other"
+	switch {
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "opr/"):
+		browser = "Opera"
+	case strings.Contains(ua, "firefox/") || strings.Contains(ua, "fxios/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "chrome/") || strings.Contains(ua, "crios/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "safari/"):
+		browser = "Safari"
+	}
+
+	platform := "Other"
+	switch {
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad"):
+		platform = "iOS"
+	case strings.Contains(ua, "android"):
+		platform = "Android"
+	case strings.Contains(ua, "windows"):
+		platform = "Windows"
+	case strings.Contains(ua, "mac os"):
+		platform = "macOS"
+	case strings.Contains(ua, "linux"):
+		platform = "Linux"
+	}
+
+	return browser + " on " + platform
+}
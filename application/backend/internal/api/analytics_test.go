@@ -0,0 +1,27 @@
+package api
+
+import "testing"
+
+func TestCoarseUserAgent(t *testing.T) {
+	cases := map[string]string{
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1": "Safari on iOS",
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36":                   "Chrome on Android",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.2478.51":       "Edge on Windows",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14.4; rv:125.0) Gecko/20100101 Firefox/125.0":                                                     "Firefox on macOS",
+		"curl/8.4.0": "Other on Other",
+	}
+	for userAgent, expected := range cases {
+		if got := coarseUserAgent(userAgent); got != expected {
+			t.Errorf("Expected %q for %s, got %q", expected, userAgent, got)
+		}
+	}
+}
+
+func TestVisitorId(t *testing.T) {
+	if visitorId("10.0.0.1", "ua") != visitorId("10.0.0.1", "ua") {
+		t.Error("Expected visitor ID to be stable")
+	}
+	if visitorId("10.0.0.1", "ua") == visitorId("10.0.0.2", "ua") {
+		t.Error("Expected different addresses to be different visitors")
+	}
+}
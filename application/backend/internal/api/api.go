@@ -1,105 +1,293 @@
 package api
 
 import (
+	"context"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/swagger"
 	"github.com/michalK00/halftone/internal/domain"
 	"github.com/michalK00/halftone/internal/fcm"
+	"github.com/michalK00/halftone/internal/identity"
+	"github.com/michalK00/halftone/internal/jobs"
+	"github.com/michalK00/halftone/internal/mail"
 	"github.com/michalK00/halftone/internal/middleware"
 	"github.com/michalK00/halftone/internal/repository"
+	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/mongo"
 	"os"
+	"time"
 )
 
 type api struct {
-	collectionRepo domain.CollectionRepository
-	galleryRepo    domain.GalleryRepository
-	photoRepo      domain.PhotoRepository
-	orderRepo      domain.OrderRepository
-	jobRepo        domain.JobRepository
-	fcmService     fcm.Service
+	collectionRepo         domain.CollectionRepository
+	galleryRepo            domain.GalleryRepository
+	photoRepo              domain.PhotoRepository
+	orderRepo              domain.OrderRepository
+	jobRepo                domain.JobRepository
+	couponRepo             domain.CouponRepository
+	orderMessageRepo       domain.OrderMessageRepository
+	selectionRepo          domain.SelectionRepository
+	photoCommentRepo       domain.PhotoCommentRepository
+	shareLinkRepo          domain.ShareLinkRepository
+	accessEventRepo        domain.AccessEventRepository
+	clientVerificationRepo domain.ClientVerificationRepository
+	workspaceRepo          domain.WorkspaceRepository
+	apiKeyRepo             domain.ApiKeyRepository
+	pushSubscriptionRepo   domain.PushSubscriptionRepository
+	notificationRepo       domain.NotificationRepository
+	notifier               *jobs.Notifier
+	eventBroker            domain.EventBroker
+	eventTicketRepo        domain.EventTicketRepository
+	rateLimitStorage       fiber.Storage
+	identity               identity.Provider
+	verifier               identity.Verifier
+	fcmService             fcm.Service
+	mailer                 mail.Mailer
 }
 
-func NewApi(db *mongo.Database) *api {
+func NewApi(db *mongo.Database, rdb *redis.Client) *api {
 	collectionRepo := repository.NewMongoCollection(db)
 	galleryRepo := repository.NewMongoGallery(db)
 	photoRepo := repository.NewMongoPhoto(db)
 	orderRepo := repository.NewMongoOrder(db)
 	jobRepo := repository.NewMongoJob(db)
+	couponRepo := repository.NewMongoCoupon(db)
+	orderMessageRepo := repository.NewMongoOrderMessage(db)
+	selectionRepo := repository.NewMongoSelection(db)
+	photoCommentRepo := repository.NewMongoPhotoComment(db)
+	shareLinkRepo := repository.NewMongoShareLink(db)
+	accessEventRepo := repository.NewMongoAccessEvent(db)
+	clientVerificationRepo := repository.NewMongoClientVerification(db)
+	workspaceRepo := repository.NewMongoWorkspace(db)
+	apiKeyRepo := repository.NewMongoApiKey(db)
+	pushSubscriptionRepo := repository.NewMongoPushSubscription(db)
+	notificationRepo := repository.NewMongoNotification(db)
 	jsonCredentials, err := fcm.GetCredentialsJSON()
 	if err != nil {
 		panic("Failed to get Firebase credentials: " + err.Error())
 	}
-	fcmService, err := fcm.NewService(os.Getenv("FCM_PROJECT_ID"), jsonCredentials)
+	fcmService, err := fcm.NewService(os.Getenv("FCM_PROJECT_ID"), jsonCredentials, pushSubscriptionRepo)
 	if err != nil {
 		panic("Failed to initialize FCM service: " + err.Error())
 	}
+	mailer, err := mail.NewFromEnv()
+	if err != nil {
+		panic("Failed to initialize mailer: " + err.Error())
+	}
+	identityProvider, err := identity.NewFromEnv(repository.NewMongoLocalUser(db))
+	if err != nil {
+		panic("Failed to initialize identity provider: " + err.Error())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	verifier, err := identity.NewVerifierFromEnv(ctx, identityProvider)
+	if err != nil {
+		panic("Failed to initialize token validator: " + err.Error())
+	}
 
 	return &api{
-		collectionRepo: collectionRepo,
-		galleryRepo:    galleryRepo,
-		photoRepo:      photoRepo,
-		orderRepo:      orderRepo,
-		jobRepo:        jobRepo,
-		fcmService:     *fcmService,
+		collectionRepo:         collectionRepo,
+		galleryRepo:            galleryRepo,
+		photoRepo:              photoRepo,
+		orderRepo:              orderRepo,
+		jobRepo:                jobRepo,
+		couponRepo:             couponRepo,
+		orderMessageRepo:       orderMessageRepo,
+		selectionRepo:          selectionRepo,
+		photoCommentRepo:       photoCommentRepo,
+		shareLinkRepo:          shareLinkRepo,
+		accessEventRepo:        accessEventRepo,
+		clientVerificationRepo: clientVerificationRepo,
+		workspaceRepo:          workspaceRepo,
+		apiKeyRepo:             apiKeyRepo,
+		pushSubscriptionRepo:   pushSubscriptionRepo,
+		notificationRepo:       notificationRepo,
+		notifier:               jobs.NewNotifier(notificationRepo, jobRepo),
+		eventBroker:            repository.NewRedisEventBroker(rdb),
+		eventTicketRepo:        repository.NewRedisEventTicket(rdb),
+		rateLimitStorage:       repository.NewRedisStorage(rdb, "rate_limit:"),
+		identity:               identityProvider,
+		verifier:               verifier,
+		fcmService:             *fcmService,
+		mailer:                 mailer,
 	}
 }
 
 func (a *api) Routes(app *fiber.App) {
+	// account endpoints operate on the identity provider's own tokens, the API accepts tokens of the configured validator
+	protectedByIdentity := middleware.Protected(a.identity)
+
+	app.Get("/.well-known/jwks.json", a.JWKS)
 
 	auth := app.Group("/api/v1/auth")
 	auth.Post("/signup", a.SignUp)
 	auth.Post("/signin", a.SignIn)
+	auth.Post("/respond-to-challenge", a.RespondToChallenge)
 	auth.Post("/verify", a.VerifyAccount)
 	auth.Post("/refresh-token", a.RefreshToken)
+	auth.Post("/forgot-password", a.ForgotPassword)
+	auth.Post("/confirm-forgot-password", a.ConfirmForgotPassword)
+	auth.Post("/resend-code", a.ResendCode)
+	auth.Post("/revoke", a.RevokeToken)
+	auth.Post("/change-password", protectedByIdentity, a.ChangePassword)
+	auth.Get("/me", protectedByIdentity, a.Me)
+	auth.Post("/sign-out", protectedByIdentity, a.SignOut)
+	auth.Post("/mfa/totp/associate", protectedByIdentity, a.AssociateTOTP)
+	auth.Post("/mfa/totp/verify", protectedByIdentity, a.VerifyTOTP)
+	auth.Delete("/mfa/totp", protectedByIdentity, a.DisableTOTP)
 
 	public := app.Group("/api/v1")
 	public.Get("/qr", a.generateQrHandler)
 
-	//client endpoints protected by middleware that checks if an access token was sent and if it matches the one stored in the accessed db
-	client := app.Group("/api/v1/client/galleries/:galleryId", middleware.AuthenticateClient(a.galleryRepo))
-	client.Get("", a.clientGetGalleryHandler)
-	client.Post("", a.clientCreateOrderHandler)
-	client.Get("/photos", a.clientGetGalleryPhotosHandler)
-	client.Get("/photos/:photoId", a.clientGetPhotoHandler)
+	// unlocking a protected share has to be registered before the client group, whose middleware requires a valid token
+	app.Post("/api/v1/client/galleries/:galleryId/unlock", middleware.UnlockRateLimiter(a.rateLimitStorage), a.clientUnlockGalleryHandler)
+	// verifying the client email as well, these accept tokens of links requiring it before the client is identified
+	unverifiedClient := middleware.AuthenticateUnverifiedClient(a.galleryRepo, a.shareLinkRepo)
+	app.Post("/api/v1/client/galleries/:galleryId/identify", middleware.IdentifyRateLimiter(a.rateLimitStorage), unverifiedClient, a.clientIdentifyHandler)
+	app.Post("/api/v1/client/galleries/:galleryId/verify", middleware.UnlockRateLimiter(a.rateLimitStorage), unverifiedClient, a.clientVerifyHandler)
+
+	//client endpoints protected by middleware that resolves the sent token to a share link or the gallery access token, routes check the permissions it grants
+	client := app.Group("/api/v1/client/galleries/:galleryId", middleware.AuthenticateClient(a.galleryRepo, a.shareLinkRepo))
+	canView := middleware.RequireSharePermission(domain.PermissionView)
+	canOrder := middleware.RequireSharePermission(domain.PermissionOrder)
+	canComment := middleware.RequireSharePermission(domain.PermissionComment)
+	canDownload := middleware.RequireSharePermission(domain.PermissionDownload)
+	client.Get("", canView, a.clientGetGalleryHandler)
+	client.Post("", canOrder, a.clientCreateOrderHandler)
+	client.Get("/photos", canView, a.clientGetGalleryPhotosHandler)
+	client.Get("/download", canDownload, a.clientDownloadGalleryHandler)
+	client.Get("/photos/:photoId", canView, a.clientGetPhotoHandler)
+	client.Get("/photos/:photoId/download", canDownload, a.clientDownloadPhotoHandler)
+	client.Get("/photos/:photoId/comments", canView, a.clientGetPhotoCommentsHandler)
+	client.Post("/photos/:photoId/comments", canComment, a.clientCreatePhotoCommentHandler)
+	client.Get("/selection", canView, a.clientGetSelectionHandler)
+	client.Put("/selection/photos/:photoId", canView, a.clientSelectPhotoHandler)
+	client.Delete("/selection/photos/:photoId", canView, a.clientDeselectPhotoHandler)
+	client.Post("/selection/submit", canView, a.clientSubmitSelectionHandler)
+	client.Get("/orders/:orderId/messages", canOrder, a.clientGetOrderMessagesHandler)
+	client.Post("/orders/:orderId/messages", canOrder, a.clientCreateOrderMessageHandler)
+	client.Put("/orders/:orderId/messages/read", canOrder, a.clientMarkOrderMessagesReadHandler)
 
-	protected := app.Group("/api/v1", middleware.Protected())
+	// workspace endpoints are registered before the protected group, whose middleware requires membership of the workspace
+	// selected by the header, and check the role of the user in the workspace from the path
+	workspaces := app.Group("/api/v1/workspaces", middleware.Protected(a.verifier))
+	workspaces.Get("", a.getWorkspacesHandler)
+	workspaces.Post("", a.createWorkspaceHandler)
+	workspaces.Get("/invitations", a.getWorkspaceInvitationsHandler)
+	workspaces.Post("/:workspaceId/invitations/accept", a.acceptWorkspaceInvitationHandler)
+	workspaces.Get("/:workspaceId", a.getWorkspaceHandler)
+	workspaces.Put("/:workspaceId", a.renameWorkspaceHandler)
+	workspaces.Delete("/:workspaceId", a.deleteWorkspaceHandler)
+	workspaces.Post("/:workspaceId/invitations", a.inviteWorkspaceMemberHandler)
+	workspaces.Delete("/:workspaceId/invitations/:email", a.cancelWorkspaceInvitationHandler)
+	workspaces.Put("/:workspaceId/members/:userId", a.updateWorkspaceMemberHandler)
+	workspaces.Delete("/:workspaceId/members/:userId", a.removeWorkspaceMemberHandler)
 
-	protected.Post("/push/subscribe", a.SubscribeToPush)
-	protected.Post("/push/send", a.SendPushMessage)
+	// API keys are managed with tokens only, so a leaked key can not be used to create more keys
+	apiKeys := app.Group("/api/v1/api-keys", middleware.Protected(a.verifier))
+	apiKeys.Get("", a.getApiKeysHandler)
+	apiKeys.Post("", a.createApiKeyHandler)
+	apiKeys.Put("/:keyId/revoke", a.revokeApiKeyHandler)
 
-	protected.Get("/collections", a.getCollectionsHandler)
-	protected.Post("/collections", a.createCollectionHandler)
-	protected.Get("/collections/:collectionId", a.getCollectionHandler)
-	protected.Put("/collections/:collectionId", a.updateCollectionHandler)
-	protected.Delete("/collections/:collectionId", a.deleteCollectionHandler)
+	// browsers open the event stream with a ticket as they can not send headers, other requests fall through to the
+	// protected route
+	app.Get("/api/v1/events", a.eventTicketStreamHandler)
 
-	protected.Get("/collections/:collectionId/galleries", a.getGalleriesHandler)
-	protected.Get("/collections/:collectionId/galleryCount", a.getGalleryCountHandler)
-	protected.Post("/collections/:collectionId/galleries", a.createGalleryHandler)
+	// notifications belong to the user rather than a workspace
+	notifications := app.Group("/api/v1/notifications", middleware.Protected(a.verifier))
+	notifications.Get("", a.getNotificationsHandler)
+	notifications.Put("/read", a.markNotificationsReadHandler)
+	notifications.Put("/unread", a.markNotificationsUnreadHandler)
+	notifications.Get("/preferences", a.getNotificationPreferencesHandler)
+	notifications.Put("/preferences", a.updateNotificationPreferencesHandler)
+
+	// push devices belong to the user as well and are managed with tokens only, messages can only be sent to members of
+	// the selected workspace
+	push := app.Group("/api/v1/push", middleware.Protected(a.verifier))
+	push.Post("/subscribe", a.SubscribeToPush)
+	push.Post("/unsubscribe", a.UnsubscribeFromPush)
+	push.Get("/subscriptions", a.GetPushSubscriptions)
+	push.Delete("/subscriptions/:subscriptionId", a.DeletePushSubscription)
+	push.Post("/send", middleware.Workspace(a.workspaceRepo), a.SendPushMessage)
+
+	// photographer endpoints accept tokens and API keys and work in the workspace selected by the X-Workspace-ID header,
+	// routes check the role of the user in it and the scope of the API key
+	protected := app.Group("/api/v1", middleware.ProtectedOrApiKey(a.verifier, a.apiKeyRepo), middleware.Workspace(a.workspaceRepo))
+	isViewer := middleware.RequireWorkspaceRole(domain.RoleViewer)
+	isEditor := middleware.RequireWorkspaceRole(domain.RoleEditor)
+	isAdmin := middleware.RequireWorkspaceRole(domain.RoleAdmin)
+	canUpload := middleware.RequireUploadAccess()
+	canFindUploadTarget := middleware.RequireUploadTargetAccess()
+
+	protected.Get("/events", isViewer, a.eventStreamHandler)
+	protected.Post("/events/tickets", isViewer, a.createEventTicketHandler)
+
+	protected.Get("/collections", canFindUploadTarget, a.getCollectionsHandler)
+	protected.Post("/collections", isEditor, a.createCollectionHandler)
+	protected.Get("/collections/:collectionId", canFindUploadTarget, a.getCollectionHandler)
+	protected.Put("/collections/:collectionId", isEditor, a.updateCollectionHandler)
+	protected.Delete("/collections/:collectionId", isAdmin, a.deleteCollectionHandler)
+
+	protected.Get("/collections/:collectionId/galleries", canFindUploadTarget, a.getGalleriesHandler)
+	protected.Get("/collections/:collectionId/galleryCount", isViewer, a.getGalleryCountHandler)
+	protected.Post("/collections/:collectionId/galleries", isEditor, a.createGalleryHandler)
 	//protected.Post("/:collectionId/galleries/batch")
 	//protected.Delete("/:collectionId/galleries/batch")
-	protected.Get("/galleries/:galleryId", a.getGalleryHandler)
-	protected.Put("/galleries/:galleryId", a.updateGalleryHandler)
-	protected.Delete("/galleries/:galleryId", a.deleteGalleryHandler)
+	protected.Get("/galleries/:galleryId", canFindUploadTarget, a.getGalleryHandler)
+	protected.Put("/galleries/:galleryId", isEditor, a.updateGalleryHandler)
+	protected.Delete("/galleries/:galleryId", isAdmin, a.deleteGalleryHandler)
+	protected.Put("/galleries/:galleryId/pricing", isEditor, a.updateGalleryPricingHandler)
+	protected.Put("/galleries/:galleryId/proofing", isEditor, a.updateGalleryProofingHandler)
+	protected.Put("/galleries/:galleryId/cover", isEditor, a.updateGalleryCoverHandler)
+	protected.Put("/galleries/:galleryId/sort", isEditor, a.updateGallerySortHandler)
+	protected.Put("/galleries/:galleryId/sections", isEditor, a.updateGallerySectionsHandler)
+	protected.Get("/galleries/:galleryId/selections", isViewer, a.getSelectionsHandler)
+	protected.Get("/galleries/:galleryId/selections/export", isViewer, a.exportSelectionHandler)
 
-	protected.Post("/galleries/:galleryId/sharing/share", a.shareGalleryHandler)
-	protected.Put("/galleries/:galleryId/sharing/reschedule", a.rescheduleGallerySharingHandler)
-	protected.Put("/galleries/:galleryId/sharing/stop", a.stopSharingGalleryHandler)
+	protected.Post("/galleries/:galleryId/sharing/share", isEditor, a.shareGalleryHandler)
+	protected.Put("/galleries/:galleryId/sharing/reschedule", isEditor, a.rescheduleGallerySharingHandler)
+	protected.Put("/galleries/:galleryId/sharing/stop", isEditor, a.stopSharingGalleryHandler)
+	protected.Put("/galleries/:galleryId/sharing/password", isEditor, a.setSharingPasswordHandler)
+	protected.Get("/galleries/:galleryId/links", isViewer, a.getShareLinksHandler)
+	protected.Post("/galleries/:galleryId/links", isEditor, a.createShareLinkHandler)
+	protected.Put("/galleries/:galleryId/links/:linkId", isEditor, a.updateShareLinkHandler)
+	protected.Put("/galleries/:galleryId/links/:linkId/revoke", isEditor, a.revokeShareLinkHandler)
+	protected.Put("/galleries/:galleryId/links/:linkId/password", isEditor, a.setShareLinkPasswordHandler)
 
-	protected.Get("/galleries/:galleryId/photos", a.getPhotosHandler)
-	protected.Post("/galleries/:galleryId/photos", a.uploadPhotosHandler)
+	protected.Get("/galleries/:galleryId/photos", isViewer, a.getPhotosHandler)
+	protected.Post("/galleries/:galleryId/photos", canUpload, a.uploadPhotosHandler)
+	protected.Put("/galleries/:galleryId/photos/order", isEditor, a.reorderPhotosHandler)
+	protected.Put("/galleries/:galleryId/photos/section", isEditor, a.assignPhotoSectionHandler)
+	protected.Put("/galleries/:galleryId/photos/visibility", isEditor, a.updatePhotosVisibilityHandler)
 	//protected.Delete("/galleries/:galleryId/photos")
 	//protected.Get("/photos/:photoId")
-	protected.Put("/photos/:photoId/confirm", a.confirmPhotoUploadHandler)
-	protected.Delete("/photos/:photoId", a.deletePhotoHandler)
+	protected.Put("/photos/:photoId/confirm", canUpload, a.confirmPhotoUploadHandler)
+	protected.Put("/photos/:photoId/visibility", isEditor, a.updatePhotoVisibilityHandler)
+	protected.Delete("/photos/:photoId", isAdmin, a.deletePhotoHandler)
+	protected.Get("/photos/:photoId/comments", isViewer, a.getPhotoCommentsHandler)
+	protected.Post("/photos/:photoId/comments", isEditor, a.createPhotoCommentHandler)
+	protected.Get("/galleries/:galleryId/comments", isViewer, a.getGalleryCommentsHandler)
+	protected.Get("/galleries/:galleryId/analytics", isViewer, a.getGalleryAnalyticsHandler)
 
 	// user endpoints to browse and handle client orders
-	protected.Get("/orders", a.getOrdersHandler)
-	protected.Get("/orders/:orderId", a.getOrderHandler)
-	protected.Put("/orders/:orderId", a.updateOrderHandler)
-	protected.Delete("/orders/:orderId", a.deleteOrderHandler)
+	protected.Get("/orders", isViewer, a.getOrdersHandler)
+	protected.Get("/orders/:orderId", isViewer, a.getOrderHandler)
+	protected.Put("/orders/:orderId", isEditor, a.updateOrderHandler)
+	protected.Delete("/orders/:orderId", isAdmin, a.deleteOrderHandler)
+	protected.Post("/orders/:orderId/export", isEditor, a.exportOrderHandler)
+	protected.Get("/orders/:orderId/export", isViewer, a.getOrderExportHandler)
+	protected.Get("/orders/:orderId/messages", isViewer, a.getOrderMessagesHandler)
+	protected.Post("/orders/:orderId/messages", isEditor, a.createOrderMessageHandler)
+	protected.Put("/orders/:orderId/messages/read", isEditor, a.markOrderMessagesReadHandler)
+
+	protected.Get("/coupons", isViewer, a.getCouponsHandler)
+	protected.Post("/coupons", isAdmin, a.createCouponHandler)
+	protected.Delete("/coupons/:couponId", isAdmin, a.deleteCouponHandler)
+
+}
 
+// Close ends the open event streams, it is called before shutting the server down as they never finish on their own
+func (a *api) Close() error {
+	return a.eventBroker.Close()
 }
 
 func (a *api) Server() *fiber.App {
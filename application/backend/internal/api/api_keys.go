@@ -0,0 +1,116 @@
+package api
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type createApiKeyRequest struct {
+	Name  string             `json:"name" example:"Tethering workstation"`
+	Scope domain.ApiKeyScope `json:"scope" example:"upload"`
+}
+
+type createApiKeyResponse struct {
+	domain.ApiKeyDB
+	// Key is only returned when the key is created
+	Key string `json:"key" example:"hft_Xq3bT0d5..."`
+}
+
+// @Summary Get API keys
+// @Description Gets the personal API keys of the user, including revoked ones
+// @Tags api-keys
+// @Accept */*
+// @Produce json
+// @Success 200 {array} domain.ApiKeyDB
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/api-keys [get]
+func (a *api) getApiKeysHandler(ctx *fiber.Ctx) error {
+	userId := ctx.Locals("userId").(string)
+
+	keys, err := a.apiKeyRepo.GetApiKeys(ctx.Context(), userId)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to fetch API keys")
+	}
+
+	return ctx.JSON(keys)
+}
+
+// @Summary Create API key
+// @Description Creates a personal API key for scripts, sent as "Authorization: ApiKey <key>". Read keys can only read,
+// @Description upload keys can only upload photos and list collections and galleries, and full keys can do everything
+// @Description the user can. The key is only returned once.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param request body createApiKeyRequest true "API key to create"
+// @Success 201 {object} createApiKeyResponse
+// @Failure 400 {object} fiber.Map
+// @Failure 409 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/api-keys [post]
+func (a *api) createApiKeyHandler(ctx *fiber.Ctx) error {
+	userId := ctx.Locals("userId").(string)
+
+	var req createApiKeyRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+	name, err := domain.NormalizeApiKeyName(req.Name)
+	if err != nil {
+		return BadRequest(ctx, err)
+	}
+	if !req.Scope.Valid() {
+		return BadRequest(ctx, domain.ErrInvalidKeyScope)
+	}
+
+	key, err := domain.GenerateApiKey()
+	if err != nil {
+		return ServerError(ctx, err, "Failed to generate API key")
+	}
+	apiKey := domain.ApiKeyDB{
+		UserId:  userId,
+		Name:    name,
+		Hint:    domain.ApiKeyHint(key),
+		KeyHash: domain.HashApiKey(key),
+		Scope:   req.Scope,
+	}
+	if err := a.apiKeyRepo.CreateApiKey(ctx.Context(), &apiKey); err != nil {
+		if errors.Is(err, domain.ErrApiKeyLimitReached) {
+			return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "API key limit reached"})
+		}
+		return ServerError(ctx, err, "Failed to create API key")
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(createApiKeyResponse{ApiKeyDB: apiKey, Key: key})
+}
+
+// @Summary Revoke API key
+// @Description Revokes a personal API key, requests made with it are rejected right away
+// @Tags api-keys
+// @Accept */*
+// @Produce json
+// @Param keyId path string true "API key ID"
+// @Success 200 {object} domain.ApiKeyDB
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/api-keys/{keyId}/revoke [put]
+func (a *api) revokeApiKeyHandler(ctx *fiber.Ctx) error {
+	userId := ctx.Locals("userId").(string)
+	keyId, err := primitive.ObjectIDFromHex(ctx.Params("keyId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+
+	key, err := a.apiKeyRepo.RevokeApiKey(ctx.Context(), keyId, userId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return NotFound(ctx, err)
+		}
+		return ServerError(ctx, err, "Failed to revoke API key")
+	}
+
+	return ctx.JSON(key)
+}
@@ -2,9 +2,14 @@ package api
 
 import (
 	"github.com/gofiber/fiber/v2"
-	awsClient "github.com/michalK00/halftone/platform/cloud/aws"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/michalK00/halftone/internal/identity"
+	"strings"
 )
 
+// totpIssuer names the account in authenticator apps
+const totpIssuer = "Halftone"
+
 func (a *api) SignUp(c *fiber.Ctx) error {
 	var input struct {
 		Email    string `json:"email"`
@@ -16,16 +21,8 @@ func (a *api) SignUp(c *fiber.Ctx) error {
 		})
 	}
 
-	client, err := awsClient.GetClient()
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get aws client"})
-	}
-
-	_, err = client.Cognito.SignUp(c.Context(), input.Email, input.Password, map[string]string{})
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	if err := a.identity.SignUp(c.Context(), input.Email, input.Password); err != nil {
+		return authErrorResponse(c, err)
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
@@ -44,25 +41,57 @@ func (a *api) SignIn(c *fiber.Ctx) error {
 			"error": "Invalid input",
 		})
 	}
-	client, err := awsClient.GetClient()
+
+	tokens, err := a.identity.SignIn(c.Context(), input.Email, input.Password)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get aws client",
-		})
+		return authErrorResponse(c, err)
 	}
 
-	resp, err := client.Cognito.InitiateAuth(c.Context(), input.Email, input.Password)
-	if err != nil {
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"id_token":      tokens.IDToken,
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
+
+// RespondToChallenge completes a sign in that answered with challenge_required, e.g. with the authenticator app code.
+// Setting up an authenticator app during sign in takes two calls, the first without a code answers with the secret.
+func (a *api) RespondToChallenge(c *fiber.Ctx) error {
+	var input struct {
+		Email       string `json:"email"`
+		Challenge   string `json:"challenge"`
+		Session     string `json:"session"`
+		Code        string `json:"code"`
+		NewPassword string `json:"new_password"`
+		MFAType     string `json:"mfa_type"`
+		DeviceName  string `json:"device_name"`
+	}
+
+	if err := c.BodyParser(&input); err != nil || input.Challenge == "" || input.Session == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
+			"error": "Invalid input",
 		})
 	}
 
+	tokens, err := a.identity.RespondToChallenge(c.Context(), identity.ChallengeResponse{
+		Name:        input.Challenge,
+		Session:     input.Session,
+		Email:       input.Email,
+		Code:        input.Code,
+		NewPassword: input.NewPassword,
+		MFAType:     input.MFAType,
+		DeviceName:  input.DeviceName,
+	})
+	if err != nil {
+		return authErrorResponse(c, err)
+	}
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"id_token":      *resp.AuthenticationResult.IdToken,
-		"access_token":  *resp.AuthenticationResult.AccessToken,
-		"refresh_token": *resp.AuthenticationResult.RefreshToken,
-		"expires_in":    resp.AuthenticationResult.ExpiresIn,
+		"id_token":      tokens.IDToken,
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 	})
 }
 
@@ -78,52 +107,279 @@ func (a *api) VerifyAccount(c *fiber.Ctx) error {
 		})
 	}
 
-	client, err := awsClient.GetClient()
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get aws client",
+	if err := a.identity.ConfirmSignUp(c.Context(), input.Email, input.Code); err != nil {
+		return authErrorResponse(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Account verified successfully",
+	})
+}
+
+func (a *api) RefreshToken(c *fiber.Ctx) error {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
 		})
 	}
-	_, err = client.Cognito.ConfirmSignUp(c.Context(), input.Email, input.Code)
+
+	tokens, err := a.identity.Refresh(c.Context(), input.RefreshToken)
 	if err != nil {
+		return authErrorResponse(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"id_token":     tokens.IDToken,
+		"access_token": tokens.AccessToken,
+		"expires_in":   tokens.ExpiresIn,
+	})
+}
+
+func (a *api) ForgotPassword(c *fiber.Ctx) error {
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := c.BodyParser(&input); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
+			"error": "Invalid input",
 		})
 	}
 
+	if err := a.identity.ForgotPassword(c.Context(), input.Email); err != nil {
+		return authErrorResponse(c, err)
+	}
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message": "Account verified successfully",
+		"message": "Password reset code sent. Please check your email.",
 	})
 }
 
-func (a *api) RefreshToken(c *fiber.Ctx) error {
+func (a *api) ConfirmForgotPassword(c *fiber.Ctx) error {
 	var input struct {
-		RefreshToken string `json:"refresh_token"`
+		Email    string `json:"email"`
+		Code     string `json:"code"`
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	if err := a.identity.ConfirmForgotPassword(c.Context(), input.Email, input.Code, input.Password); err != nil {
+		return authErrorResponse(c, err)
 	}
 
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Password reset successfully",
+	})
+}
+
+func (a *api) ResendCode(c *fiber.Ctx) error {
+	var input struct {
+		Email string `json:"email"`
+	}
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid input",
 		})
 	}
 
-	client, err := awsClient.GetClient()
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get aws client",
+	if err := a.identity.ResendCode(c.Context(), input.Email); err != nil {
+		return authErrorResponse(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Verification code sent. Please check your email.",
+	})
+}
+
+func (a *api) ChangePassword(c *fiber.Ctx) error {
+	var input struct {
+		OldPassword string `json:"old_password"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
 		})
 	}
+	accessToken, ok := bearerAccessToken(c)
+	if !ok {
+		return accessTokenRequired(c)
+	}
+
+	if err := a.identity.ChangePassword(c.Context(), accessToken, input.OldPassword, input.NewPassword); err != nil {
+		return authErrorResponse(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Password changed successfully",
+	})
+}
+
+type userProfileResponse struct {
+	Username     string            `json:"username"`
+	Attributes   map[string]string `json:"attributes"`
+	PreferredMFA string            `json:"preferred_mfa,omitempty"`
+}
 
-	resp, err := client.Cognito.RefreshToken(c.Context(), input.RefreshToken)
+func (a *api) Me(c *fiber.Ctx) error {
+	accessToken, ok := bearerAccessToken(c)
+	if !ok {
+		return accessTokenRequired(c)
+	}
+
+	user, err := a.identity.GetUser(c.Context(), accessToken)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": err.Error(),
+		return authErrorResponse(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(userProfileResponse{
+		Username:     user.Username,
+		Attributes:   user.Attributes,
+		PreferredMFA: user.PreferredMFA,
+	})
+}
+
+// SignOut signs the user out of all devices by invalidating their refresh tokens
+func (a *api) SignOut(c *fiber.Ctx) error {
+	accessToken, ok := bearerAccessToken(c)
+	if !ok {
+		return accessTokenRequired(c)
+	}
+
+	if err := a.identity.SignOut(c.Context(), accessToken); err != nil {
+		return authErrorResponse(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Signed out successfully",
+	})
+}
+
+// AssociateTOTP starts setting up an authenticator app, the returned URI can be shown as a QR code
+func (a *api) AssociateTOTP(c *fiber.Ctx) error {
+	accessToken, ok := bearerAccessToken(c)
+	if !ok {
+		return accessTokenRequired(c)
+	}
+
+	// Authenticator apps list the account by its email
+	user, err := a.identity.GetUser(c.Context(), accessToken)
+	if err != nil {
+		return authErrorResponse(c, err)
+	}
+	account := user.Attributes["email"]
+	if account == "" {
+		account = user.Username
+	}
+
+	secret, err := a.identity.AssociateTOTP(c.Context(), accessToken)
+	if err != nil {
+		return authErrorResponse(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"secret_code": secret,
+		"uri":         identity.TOTPURI(totpIssuer, account, secret),
+	})
+}
+
+// VerifyTOTP completes the setup with a code of the authenticator app, which is required when signing in from now on
+func (a *api) VerifyTOTP(c *fiber.Ctx) error {
+	var input struct {
+		Code       string `json:"code"`
+		DeviceName string `json:"device_name"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+	accessToken, ok := bearerAccessToken(c)
+	if !ok {
+		return accessTokenRequired(c)
+	}
+
+	if err := a.identity.VerifyTOTP(c.Context(), accessToken, input.Code, input.DeviceName); err != nil {
+		return authErrorResponse(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Two-factor authentication enabled",
+	})
+}
+
+func (a *api) DisableTOTP(c *fiber.Ctx) error {
+	accessToken, ok := bearerAccessToken(c)
+	if !ok {
+		return accessTokenRequired(c)
+	}
+
+	if err := a.identity.DisableTOTP(c.Context(), accessToken); err != nil {
+		return authErrorResponse(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// RevokeToken signs a single device out by revoking its refresh token
+func (a *api) RevokeToken(c *fiber.Ctx) error {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
 		})
 	}
 
+	if err := a.identity.RevokeToken(c.Context(), input.RefreshToken); err != nil {
+		return authErrorResponse(c, err)
+	}
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"id_token":     *resp.AuthenticationResult.IdToken,
-		"access_token": *resp.AuthenticationResult.AccessToken,
-		"expires_in":   resp.AuthenticationResult.ExpiresIn,
+		"message": "Token revoked successfully",
+	})
+}
+
+// @Summary Get token signing keys
+// @Description Gets the public keys tokens of the identity provider are signed with, in the JWKS format
+// @Tags auth
+// @Produce json
+// @Success 200 {object} identity.JSONWebKeySet
+// @Failure 500 {object} fiber.Map
+// @Router /.well-known/jwks.json [get]
+func (a *api) JWKS(c *fiber.Ctx) error {
+	jwks, err := a.identity.JWKS(c.Context())
+	if err != nil {
+		return ServerError(c, err, "Failed to fetch signing keys")
+	}
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=3600")
+	return c.JSON(jwks)
+}
+
+// bearerAccessToken returns the bearer token validated by the Protected middleware if it is an access token, which
+// the identity provider requires for operations on the signed in user
+func bearerAccessToken(c *fiber.Ctx) (string, bool) {
+	claims, ok := c.Locals("claims").(jwt.MapClaims)
+	if !ok || claims["token_use"] != "access" {
+		return "", false
+	}
+	return strings.TrimPrefix(c.Get("Authorization"), "Bearer "), true
+}
+
+func accessTokenRequired(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error": "Access token required",
+		"code":  "access_token_required",
 	})
 }
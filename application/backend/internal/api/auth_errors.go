@@ -0,0 +1,70 @@
+package api
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/identity"
+	"log"
+)
+
+// authError is how an identity provider error is reported to clients, Code is stable so the frontend can branch on it
+type authError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+// mapAuthError translates identity provider errors to an authError, unknown errors are reported without their details
+func mapAuthError(err error) authError {
+	switch {
+	case errors.Is(err, identity.ErrUserExists):
+		return authError{fiber.StatusConflict, "username_exists", "An account with this email already exists"}
+	case errors.Is(err, identity.ErrInvalidPassword):
+		return authError{fiber.StatusBadRequest, "invalid_password", "Password does not meet the requirements"}
+	case errors.Is(err, identity.ErrInvalidParameter):
+		return authError{fiber.StatusBadRequest, "invalid_parameter", "Invalid request"}
+	case errors.Is(err, identity.ErrCodeMismatch):
+		return authError{fiber.StatusBadRequest, "code_mismatch", "Invalid verification code"}
+	case errors.Is(err, identity.ErrCodeExpired):
+		return authError{fiber.StatusBadRequest, "code_expired", "Verification code has expired"}
+	case errors.Is(err, identity.ErrNotAuthorized):
+		return authError{fiber.StatusUnauthorized, "not_authorized", "Incorrect credentials or expired token"}
+	case errors.Is(err, identity.ErrUserNotConfirmed):
+		return authError{fiber.StatusForbidden, "user_not_confirmed", "Account is not verified"}
+	case errors.Is(err, identity.ErrPasswordResetRequired):
+		return authError{fiber.StatusForbidden, "password_reset_required", "Password has to be reset"}
+	case errors.Is(err, identity.ErrUserNotFound):
+		return authError{fiber.StatusNotFound, "user_not_found", "Account not found"}
+	case errors.Is(err, identity.ErrTooManyRequests):
+		return authError{fiber.StatusTooManyRequests, "too_many_requests", "Too many attempts, try again later"}
+	case errors.Is(err, identity.ErrCodeDeliveryFailed):
+		return authError{fiber.StatusBadGateway, "code_delivery_failed", "Failed to send the verification code"}
+	default:
+		return authError{fiber.StatusInternalServerError, "auth_error", "Authentication failed"}
+	}
+}
+
+func authErrorResponse(c *fiber.Ctx, err error) error {
+	var challenge *identity.ChallengeError
+	if errors.As(err, &challenge) {
+		response := fiber.Map{
+			"error":     "Additional authentication step required",
+			"code":      "challenge_required",
+			"challenge": challenge.Name,
+			"session":   challenge.Session,
+		}
+		if challenge.SecretCode != "" {
+			response["secret_code"] = challenge.SecretCode
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(response)
+	}
+
+	mapped := mapAuthError(err)
+	if mapped.Status == fiber.StatusInternalServerError {
+		log.Printf("Identity provider error: %v", err)
+	}
+	return c.Status(mapped.Status).JSON(fiber.Map{
+		"error": mapped.Message,
+		"code":  mapped.Code,
+	})
+}
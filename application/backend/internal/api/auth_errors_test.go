@@ -0,0 +1,37 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/identity"
+	"testing"
+)
+
+func TestMapAuthError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{identity.ErrUserExists, fiber.StatusConflict, "username_exists"},
+		{identity.ErrCodeMismatch, fiber.StatusBadRequest, "code_mismatch"},
+		{identity.ErrCodeExpired, fiber.StatusBadRequest, "code_expired"},
+		{identity.ErrNotAuthorized, fiber.StatusUnauthorized, "not_authorized"},
+		{identity.ErrUserNotConfirmed, fiber.StatusForbidden, "user_not_confirmed"},
+		{identity.ErrTooManyRequests, fiber.StatusTooManyRequests, "too_many_requests"},
+		// Providers wrap the sentinel errors with their own details
+		{fmt.Errorf("%w: %w", identity.ErrInvalidPassword, errors.New("InvalidPasswordException")), fiber.StatusBadRequest, "invalid_password"},
+		{errors.New("connection reset"), fiber.StatusInternalServerError, "auth_error"},
+	}
+
+	for _, tt := range tests {
+		got := mapAuthError(tt.err)
+		if got.Status != tt.status || got.Code != tt.code {
+			t.Errorf("mapAuthError(%v) = %d %s, want %d %s", tt.err, got.Status, got.Code, tt.status, tt.code)
+		}
+		if got.Message == "" {
+			t.Errorf("mapAuthError(%v) has no message", tt.err)
+		}
+	}
+}
@@ -6,20 +6,35 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/michalK00/halftone/internal/aws"
 	"github.com/michalK00/halftone/internal/domain"
-	"github.com/michalK00/halftone/internal/fcm"
+	"github.com/michalK00/halftone/internal/mail"
+	"github.com/michalK00/halftone/internal/middleware"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"time"
 )
 
+type clientGalleryResponse struct {
+	domain.GalleryDB
+	Permissions domain.SharePermissions `json:"permissions"`
+	// CoverUrl points to the client version of the cover photo
+	CoverUrl string `json:"coverUrl,omitempty"`
+	// SessionToken replaces the share token of links with a usage limit, which can not be used once it is reached
+	SessionToken     string     `json:"sessionToken,omitempty"`
+	SessionExpiresAt *time.Time `json:"sessionExpiresAt,omitempty"`
+}
+
 // @Summary Get gallery information (client access)
-// @Description Gets gallery information for clients with valid access token
+// @Description Gets gallery information for clients with valid access token, opening the gallery with a share link
+// @Description counts towards its usage limit. Links with a usage limit are exchanged for a session token then, as they
+// @Description can not be used anymore once the limit is reached.
 // @Tags client
 // @Accept json
 // @Produce json
 // @Param galleryId path string true "Gallery ID"
 // @Param Authorization header string true "Access token" example:"Bearer your-access-token"
-// @Success 200 {object} domain.GalleryDB
+// @Success 200 {object} clientGalleryResponse
 // @Failure 401 {object} fiber.Map
+// @Failure 403 {object} fiber.Map
 // @Failure 404 {object} fiber.Map
 // @Failure 500 {object} fiber.Map
 // @Router /api/v1/client/galleries/{galleryId} [get]
@@ -32,11 +47,60 @@ func (a *api) clientGetGalleryHandler(ctx *fiber.Ctx) error {
 	// Gallery is already validated and stored in context by middleware
 	gallery := ctx.Locals("gallery").(domain.GalleryDB)
 
+	res := clientGalleryResponse{
+		Permissions: clientPermissions(ctx),
+	}
+	if link, ok := ctx.Locals("shareLink").(domain.ShareLinkDB); ok {
+		if err := a.shareLinkRepo.UseShareLink(ctx.Context(), link.ID); err != nil {
+			if errors.Is(err, domain.ErrShareLinkExhausted) {
+				return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Share link usage limit reached"})
+			}
+			return ServerError(ctx, err, "Failed to use share link")
+		}
+		if link.MaxUses > 0 {
+			email, _ := ctx.Locals("clientEmail").(string)
+			sessionToken, expiresAt, err := middleware.IssueClientSession(gallery, &link, email)
+			if err != nil {
+				return ServerError(ctx, err, "Failed to create session")
+			}
+			res.SessionToken = sessionToken
+			res.SessionExpiresAt = &expiresAt
+		}
+	}
+
+	a.recordAccessEvent(ctx, gallery, domain.EventGalleryOpened, nil)
+	// galleries are opened often, the photographer is told once a day at most
+	a.notify(ctx.Context(), &domain.NotificationDB{
+		UserId:      gallery.UserId,
+		WorkspaceID: gallery.WorkspaceID,
+		Type:        domain.NotificationGalleryViewed,
+		Title:       "Gallery viewed",
+		Body:        fmt.Sprintf("%s was opened by a client", gallery.Name),
+		Data: map[string]string{
+			"galleryId": gallery.ID.Hex(),
+		},
+		Key: fmt.Sprintf("%s:%s:%s", domain.NotificationGalleryViewed, gallery.ID.Hex(), time.Now().UTC().Format(time.DateOnly)),
+	})
+
 	// Remove sensitive information before sending to client
 	gallery.UserId = ""
+	gallery.WorkspaceID = primitive.NilObjectID
 	gallery.Sharing.AccessToken = ""
+	gallery.Sharing.SharingUrl = ""
+
+	res.GalleryDB = gallery
+	if gallery.CoverPhotoID != nil {
+		// A cover that is no longer shared is left out
+		cover, err := a.photoRepo.GetSharedPhotoById(ctx.Context(), *gallery.CoverPhotoID)
+		if err == nil && cover.GalleryId == gallery.ID {
+			res.CoverUrl, _ = aws.GetObjectUrl(cover.ClientObjectKey)
+		}
+		if res.CoverUrl == "" {
+			res.CoverPhotoID = nil
+		}
+	}
 
-	return ctx.JSON(gallery)
+	return ctx.JSON(res)
 }
 
 // @Summary Create order (client access)
@@ -72,17 +136,21 @@ func (a *api) clientCreateOrderHandler(ctx *fiber.Ctx) error {
 		return BadRequest(ctx, err)
 	}
 
-	// Convert photo IDs
-	photoIds := make([]primitive.ObjectID, len(req.PhotoIDs))
-	for i, photoIdStr := range req.PhotoIDs {
-		photoId, err := primitive.ObjectIDFromHex(photoIdStr)
-		if err != nil {
-			return BadRequest(ctx, errors.New("invalid photo ID"))
+	orderPhotos, err := orderPhotosFromRequest(req)
+	if err != nil {
+		return BadRequest(ctx, err)
+	}
+	// The same photo can be ordered as several products, verify each one once
+	photoIds := make([]primitive.ObjectID, 0, len(orderPhotos))
+	seen := make(map[primitive.ObjectID]bool, len(orderPhotos))
+	for _, photo := range orderPhotos {
+		if !seen[photo.PhotoID] {
+			seen[photo.PhotoID] = true
+			photoIds = append(photoIds, photo.PhotoID)
 		}
-		photoIds[i] = photoId
 	}
 
-	validPhotos, err := a.photoRepo.VerifyPhotosInGallery(ctx.Context(), galleryId, photoIds)
+	validPhotos, err := a.photoRepo.VerifySharedPhotosInGallery(ctx.Context(), galleryId, photoIds)
 	if err != nil {
 		return ServerError(ctx, err, "Failed to verify photos")
 	}
@@ -90,48 +158,131 @@ func (a *api) clientCreateOrderHandler(ctx *fiber.Ctx) error {
 		return BadRequest(ctx, errors.New("some photos do not belong to this gallery"))
 	}
 
-	// Create order
-	orderId, err := a.orderRepo.CreateOrder(ctx.Context(), galleryId, req.ClientEmail, req.Comment, photoIds)
-	if err != nil {
-		return ServerError(ctx, err, "Failed to create order")
+	// Gallery is already validated and stored in context by middleware
+	gallery := ctx.Locals("gallery").(domain.GalleryDB)
+
+	var coupon *domain.CouponDB
+	if req.CouponCode != "" {
+		c, err := a.couponRepo.GetCouponByCode(ctx.Context(), req.CouponCode, gallery.WorkspaceID)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return BadRequest(ctx, errors.New("invalid coupon code"))
+			}
+			return ServerError(ctx, err, "Failed to fetch coupon")
+		}
+		if err := c.Validate(galleryId, time.Now().UTC()); err != nil {
+			return BadRequest(ctx, err)
+		}
+		coupon = &c
 	}
 
-	gallery, err := a.galleryRepo.GetGalleryByID(ctx.Context(), galleryId)
+	totals, err := domain.PriceOrder(gallery.Pricing, orderPhotos, coupon)
 	if err != nil {
-		return ServerError(ctx, err, "Failed to fetch gallery")
+		return BadRequest(ctx, err)
 	}
 
-	msgReq := &fcm.SendMessageRequest{
-		Message: &fcm.PushMessage{
-			Title: "New order",
-			Body:  fmt.Sprintf("You have 1 new order"),
-		},
-		UserIDs: []string{gallery.UserId},
+	order := domain.OrderDB{
+		GalleryID:    galleryId,
+		CollectionID: gallery.CollectionId,
+		UserId:       gallery.UserId,
+		WorkspaceID:  gallery.WorkspaceID,
+		ClientEmail:  req.ClientEmail,
+		Comment:      req.Comment,
+		Photos:       orderPhotos,
+		OrderTotals:  totals,
+	}
+	if email := sessionClientEmail(ctx); email != "" {
+		order.ClientEmail = email
+		order.ClientVerified = true
+	}
+	if coupon != nil {
+		if err := a.couponRepo.RedeemCoupon(ctx.Context(), coupon.ID); err != nil {
+			if errors.Is(err, domain.ErrCouponExhausted) {
+				return BadRequest(ctx, err)
+			}
+			return ServerError(ctx, err, "Failed to redeem coupon")
+		}
+		order.CouponCode = coupon.Code
 	}
 
-	err = a.fcmService.SendMessage(msgReq)
+	// Create order
+	orderId, err := a.orderRepo.CreateOrder(ctx.Context(), &order)
 	if err != nil {
-		fmt.Printf("Failed to send push notification: %v\n", err)
+		if coupon != nil {
+			_ = a.couponRepo.ReleaseCoupon(ctx.Context(), coupon.ID)
+		}
+		return ServerError(ctx, err, "Failed to create order")
 	}
 
+	a.sendOrderEmail(ctx.Context(), mail.TemplateOrderReceived, order, gallery)
+	a.recordAccessEvent(ctx, gallery, domain.EventOrderPlaced, nil)
+
+	a.publish(ctx.Context(), domain.EventOrderCreated, order.WorkspaceID, order)
+	a.notify(ctx.Context(), &domain.NotificationDB{
+		UserId:      gallery.UserId,
+		WorkspaceID: gallery.WorkspaceID,
+		Type:        domain.NotificationNewOrder,
+		Title:       "New order",
+		Body:        fmt.Sprintf("New order of %d photos in %s", len(order.Photos), gallery.Name),
+		Data: map[string]string{
+			"galleryId": gallery.ID.Hex(),
+			"orderId":   orderId,
+		},
+	})
+
 	return ctx.Status(fiber.StatusCreated).JSON(createOrderResponse{
-		ID: orderId,
+		ID:          orderId,
+		OrderTotals: totals,
 	})
 }
 
+func orderPhotosFromRequest(req createOrderRequest) ([]domain.OrderPhoto, error) {
+	photos := make([]domain.OrderPhoto, 0, len(req.PhotoIDs)+len(req.Items))
+	for _, photoIdStr := range req.PhotoIDs {
+		photoId, err := primitive.ObjectIDFromHex(photoIdStr)
+		if err != nil {
+			return nil, errors.New("invalid photo ID")
+		}
+		photos = append(photos, domain.OrderPhoto{PhotoID: photoId, Quantity: 1})
+	}
+	for _, item := range req.Items {
+		photoId, err := primitive.ObjectIDFromHex(item.PhotoID)
+		if err != nil {
+			return nil, errors.New("invalid photo ID")
+		}
+		if item.Quantity < 0 || item.Quantity > domain.MaxOrderQuantity {
+			return nil, domain.ErrInvalidQuantity
+		}
+		photos = append(photos, domain.OrderPhoto{PhotoID: photoId, Product: item.Product, Quantity: item.Quantity})
+	}
+	if len(photos) == 0 {
+		return nil, errors.New("no photos provided")
+	}
+	return photos, nil
+}
+
 type clientPhotoResponse struct {
-	ID               primitive.ObjectID `bson:"_id" json:"id"`
-	OriginalFilename string             `bson:"originalFilename" json:"originalFilename"`
-	Url              string             `bson:"url" json:"url"`
-	ThumbnailUrl     string             `bson:"thumbnailUrl" json:"thumbnailUrl"`
+	ID               primitive.ObjectID  `bson:"_id" json:"id"`
+	OriginalFilename string              `bson:"originalFilename" json:"originalFilename"`
+	Url              string              `bson:"url" json:"url"`
+	ThumbnailUrl     string              `bson:"thumbnailUrl" json:"thumbnailUrl"`
+	SectionID        *primitive.ObjectID `bson:"sectionId,omitempty" json:"sectionId,omitempty"`
+	// DownloadUrl points to the original file when the share link allows downloads
+	DownloadUrl string `bson:"downloadUrl,omitempty" json:"downloadUrl,omitempty"`
 }
 
 // @Summary Get gallery photos (client access)
-// @Description Gets all photos in a gallery for clients with valid access token
+// @Description Gets a page of photos in a gallery for clients with valid access token, in the order set by the
+// @Description photographer
 // @Tags client
 // @Accept json
 // @Produce json
 // @Param galleryId path string true "Gallery ID"
+// @Param section query string false "Only photos of the section"
+// @Param limit query int false "Page size" default(100) maximum(500)
+// @Param cursor query string false "Cursor from the X-Next-Cursor header of the previous page"
+// @Header 200 {string} X-Next-Cursor "Cursor of the next page, absent on the last page"
+// @Header 200 {int} X-Total-Count "Number of photos on all pages"
 // @Param Authorization header string true "Access token" example:"Bearer your-access-token"
 // @Success 200 {array} domain.PhotoDB
 // @Failure 401 {object} fiber.Map
@@ -144,29 +295,46 @@ func (a *api) clientGetGalleryPhotosHandler(ctx *fiber.Ctx) error {
 		return NotFound(ctx, err)
 	}
 
-	photos, err := a.photoRepo.GetSharedPhotosByGallery(ctx.Context(), galleryId)
+	filter, err := photoFilterFromQuery(ctx, ctx.Locals("gallery").(domain.GalleryDB))
+	if err != nil {
+		return BadRequest(ctx, err)
+	}
+	page, err := a.photoRepo.GetSharedPhotosByGallery(ctx.Context(), galleryId, filter)
 	if err != nil {
 		return ServerError(ctx, err, "Failed to fetch photos")
 	}
+	photos := page.Photos
 
-	clientPhotos := make([]clientPhotoResponse, len(photos))
-	for index, photo := range photos {
-		url, err := aws.GetObjectUrl(photo.ObjectKey)
-		if err != nil {
-			return ServerError(ctx, err, "Failed to get url")
-		}
-		thumbnailUrl, err := aws.GetObjectUrl(photo.ThumbnailObjectKey)
-		if err != nil {
-			thumbnailUrl = ""
+	// Sign the urls of the whole page at once, originals only when the share link allows downloads
+	canDownload := clientPermissions(ctx).Download
+	keys := make([]string, 0, 3*len(photos))
+	for _, photo := range photos {
+		downloadKey := ""
+		if canDownload {
+			downloadKey = photo.ObjectKey
 		}
-		clientPhotos[index] = clientPhotoResponse{
+		keys = append(keys, photo.ClientObjectKey, photo.ThumbnailObjectKey, downloadKey)
+	}
+	urls, err := aws.GetObjectUrls(ctx.Context(), keys)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to get url")
+	}
+
+	clientPhotos := make([]clientPhotoResponse, len(photos))
+	for i, photo := range photos {
+		clientPhotos[i] = clientPhotoResponse{
 			ID:               photo.ID,
 			OriginalFilename: photo.OriginalFilename,
-			Url:              url,
-			ThumbnailUrl:     thumbnailUrl,
+			Url:              urls[3*i],
+			ThumbnailUrl:     urls[3*i+1],
+			SectionID:        photo.SectionID,
+			DownloadUrl:      urls[3*i+2],
 		}
 	}
 
+	if err := setPhotoPageHeaders(ctx, page); err != nil {
+		return ServerError(ctx, err, "Failed to fetch photos")
+	}
 	return ctx.JSON(clientPhotos)
 }
 
@@ -221,7 +389,16 @@ func (a *api) clientGetPhotoHandler(ctx *fiber.Ctx) error {
 		OriginalFilename: photo.OriginalFilename,
 		Url:              url,
 		ThumbnailUrl:     thumbnailUrl,
+		SectionID:        photo.SectionID,
 	}
+	if clientPermissions(ctx).Download {
+		clientPhoto.DownloadUrl, err = aws.GetObjectUrl(photo.ObjectKey)
+		if err != nil {
+			return ServerError(ctx, err, "Failed to get url")
+		}
+	}
+
+	a.recordAccessEvent(ctx, ctx.Locals("gallery").(domain.GalleryDB), domain.EventPhotoViewed, &photo.ID)
 
 	return ctx.JSON(clientPhoto)
 }
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/archive"
+	"github.com/michalK00/halftone/internal/aws"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// downloadTimeout bounds how long streaming a single archive may take
+const downloadTimeout = time.Hour
+
+var unsafeFilenameChars = regexp.MustCompile(`[^\pL\pN._ -]+`)
+
+// @Summary Download gallery (client access)
+// @Description Streams a ZIP archive of the shared photos of the gallery, of the given photos or of the client's
+// @Description selection. Requires a share link allowing downloads.
+// @Tags client
+// @Accept */*
+// @Produce application/zip
+// @Param galleryId path string true "Gallery ID"
+// @Param Authorization header string true "Bearer {access_token}"
+// @Param photoIds query string false "Comma separated photo IDs"
+// @Param selection query bool false "Download the photos selected by the client identified with X-Client-Email"
+// @Param X-Client-Email header string false "Client email, required with selection unless the session has a verified email"
+// @Param resolution query string false "Resolution of the photos" Enums(client,original) default(client)
+// @Success 200 {file} file
+// @Failure 400 {object} fiber.Map
+// @Failure 401 {object} fiber.Map
+// @Failure 403 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/client/galleries/{galleryId}/download [get]
+func (a *api) clientDownloadGalleryHandler(ctx *fiber.Ctx) error {
+	gallery := ctx.Locals("gallery").(domain.GalleryDB)
+
+	var original bool
+	switch ctx.Query("resolution", "client") {
+	case "client":
+	case "original":
+		original = true
+	default:
+		return BadRequest(ctx, errors.New("invalid resolution"))
+	}
+
+	photoIds, err := a.downloadPhotoIds(ctx, gallery)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return NotFound(ctx, err)
+		}
+		return BadRequest(ctx, err)
+	}
+
+	page, err := a.photoRepo.GetSharedPhotosByGallery(ctx.Context(), gallery.ID, domain.PhotoFilter{Sort: gallery.SortOrder})
+	if err != nil {
+		return ServerError(ctx, err, "Failed to fetch photos")
+	}
+	photos := filterPhotos(page.Photos, photoIds)
+	if len(photos) == 0 {
+		return NotFound(ctx, errors.New("no photos to download"))
+	}
+	entries := downloadEntries(photos, original)
+
+	a.recordAccessEvent(ctx, gallery, domain.EventArchiveDownloaded, nil)
+	if err := a.galleryRepo.CountDownload(ctx.Context(), gallery.ID); err != nil {
+		log.Printf("Failed to count download: %v", err)
+	}
+	if link, ok := ctx.Locals("shareLink").(domain.ShareLinkDB); ok {
+		if err := a.shareLinkRepo.CountDownload(ctx.Context(), link.ID); err != nil {
+			log.Printf("Failed to count download: %v", err)
+		}
+	}
+
+	ctx.Set(fiber.HeaderContentType, "application/zip")
+	ctx.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.zip"`, archiveName(gallery.Name)))
+	// The fiber context must not be used once the handler returned, the archive is written by fasthttp afterwards
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		streamCtx, cancel := context.WithTimeout(context.Background(), downloadTimeout)
+		defer cancel()
+		if err := archive.Write(streamCtx, w, entries, aws.GetObject); err != nil {
+			log.Printf("Failed to stream gallery %s: %v", gallery.ID.Hex(), err)
+		}
+		_ = w.Flush()
+	})
+	return nil
+}
+
+// @Summary Download photo (client access)
+// @Description Redirects to a presigned url of the original file. Requires a share link allowing downloads.
+// @Tags client
+// @Accept */*
+// @Param galleryId path string true "Gallery ID"
+// @Param photoId path string true "Photo ID"
+// @Param Authorization header string true "Bearer {access_token}"
+// @Success 302
+// @Failure 401 {object} fiber.Map
+// @Failure 403 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/client/galleries/{galleryId}/photos/{photoId}/download [get]
+func (a *api) clientDownloadPhotoHandler(ctx *fiber.Ctx) error {
+	gallery := ctx.Locals("gallery").(domain.GalleryDB)
+	photo, ok, err := a.galleryPhoto(ctx)
+	if !ok {
+		return err
+	}
+
+	url, err := aws.GetObjectUrl(photo.ObjectKey)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to get url")
+	}
+
+	a.recordAccessEvent(ctx, gallery, domain.EventPhotoDownloaded, &photo.ID)
+	return ctx.Redirect(url, fiber.StatusFound)
+}
+
+// downloadPhotoIds returns the photos requested for download, nil means all shared photos of the gallery
+func (a *api) downloadPhotoIds(ctx *fiber.Ctx, gallery domain.GalleryDB) ([]primitive.ObjectID, error) {
+	if ctx.QueryBool("selection") {
+		clientEmail, err := requestClientEmail(ctx)
+		if err != nil {
+			return nil, err
+		}
+		selection, err := a.selectionRepo.GetSelection(ctx.Context(), gallery.ID, clientEmail)
+		if err != nil {
+			return nil, err
+		}
+		return selection.PhotoIDs, nil
+	}
+
+	if ctx.Query("photoIds") == "" {
+		return nil, nil
+	}
+	var photoIds []primitive.ObjectID
+	for _, photoIdStr := range strings.Split(ctx.Query("photoIds"), ",") {
+		photoId, err := primitive.ObjectIDFromHex(strings.TrimSpace(photoIdStr))
+		if err != nil {
+			return nil, errors.New("invalid photo ID")
+		}
+		photoIds = append(photoIds, photoId)
+	}
+	return photoIds, nil
+}
+
+func filterPhotos(photos []domain.PhotoDB, photoIds []primitive.ObjectID) []domain.PhotoDB {
+	if photoIds == nil {
+		return photos
+	}
+	wanted := make(map[primitive.ObjectID]bool, len(photoIds))
+	for _, photoId := range photoIds {
+		wanted[photoId] = true
+	}
+	filtered := make([]domain.PhotoDB, 0, len(photoIds))
+	for _, photo := range photos {
+		if wanted[photo.ID] {
+			filtered = append(filtered, photo)
+		}
+	}
+	return filtered
+}
+
+// downloadEntries names the files after their original filename, keeping the extension of the stored rendition
+func downloadEntries(photos []domain.PhotoDB, original bool) []archive.Entry {
+	entries := make([]archive.Entry, 0, len(photos))
+	used := make(map[string]bool, len(photos))
+	for _, photo := range photos {
+		key := photo.ClientObjectKey
+		if original || key == "" {
+			key = photo.ObjectKey
+		}
+
+		base := strings.TrimSuffix(path.Base(photo.OriginalFilename), path.Ext(photo.OriginalFilename))
+		if base == "" || base == "." || base == "/" {
+			base = photo.ID.Hex()
+		}
+		name := base + path.Ext(key)
+		if used[strings.ToLower(name)] {
+			name = base + "_" + photo.ID.Hex() + path.Ext(key)
+		}
+		used[strings.ToLower(name)] = true
+
+		entries = append(entries, archive.Entry{Name: name, Key: key})
+	}
+	return entries
+}
+
+func archiveName(galleryName string) string {
+	name := strings.TrimSpace(unsafeFilenameChars.ReplaceAllString(galleryName, ""))
+	if name == "" {
+		return "gallery"
+	}
+	return name
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+func TestDownloadEntries(t *testing.T) {
+	first := domain.PhotoDB{ID: primitive.NewObjectID(), OriginalFilename: "IMG_0001.CR3", ObjectKey: "c/g/photos/1.CR3", ClientObjectKey: "c/g/client/1.jpg"}
+	second := domain.PhotoDB{ID: primitive.NewObjectID(), OriginalFilename: "img_0001.cr3", ObjectKey: "c/g/photos/2.CR3", ClientObjectKey: "c/g/client/2.jpg"}
+
+	entries := downloadEntries([]domain.PhotoDB{first, second}, false)
+	if entries[0].Name != "IMG_0001.jpg" || entries[0].Key != first.ClientObjectKey {
+		t.Errorf("Unexpected client entry: %+v", entries[0])
+	}
+	if entries[1].Name != "img_0001_"+second.ID.Hex()+".jpg" {
+		t.Errorf("Expected colliding name to be suffixed with the photo ID, got %s", entries[1].Name)
+	}
+
+	entries = downloadEntries([]domain.PhotoDB{first}, true)
+	if entries[0].Name != "IMG_0001.CR3" || entries[0].Key != first.ObjectKey {
+		t.Errorf("Unexpected original entry: %+v", entries[0])
+	}
+}
+
+func TestArchiveName(t *testing.T) {
+	if name := archiveName(`Anna & Tom "Wedding"`); name != "Anna  Tom Wedding" {
+		t.Errorf("Unexpected archive name %q", name)
+	}
+	if name := archiveName("///"); name != "gallery" {
+		t.Errorf("Expected fallback name, got %q", name)
+	}
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/domain"
+	"github.com/michalK00/halftone/internal/mail"
+	"github.com/michalK00/halftone/internal/middleware"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/url"
+	"os"
+	"time"
+)
+
+type identifyClientRequest struct {
+	Email string `json:"email" example:"client@example.com"`
+}
+
+type identifyClientResponse struct {
+	VerificationId string `json:"verificationId"`
+}
+
+type verifyClientRequest struct {
+	VerificationId string `json:"verificationId"`
+	// Code is the one-time code from the email, Key the key from its magic link, one of them is required
+	Code string `json:"code,omitempty" example:"042117"`
+	Key  string `json:"key,omitempty"`
+}
+
+type verifyClientResponse struct {
+	// SessionToken replaces the share token in the Authorization header of client requests
+	SessionToken string    `json:"sessionToken"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	Email        string    `json:"email"`
+}
+
+// @Summary Identify client (client access)
+// @Description Emails a one-time code and a magic link confirming the client's address. Requests are rate limited.
+// @Tags client
+// @Accept json
+// @Produce json
+// @Param galleryId path string true "Gallery ID"
+// @Param request body identifyClientRequest true "Client email"
+// @Success 202 {object} identifyClientResponse
+// @Failure 400 {object} fiber.Map
+// @Failure 401 {object} fiber.Map
+// @Failure 429 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/client/galleries/{galleryId}/identify [post]
+func (a *api) clientIdentifyHandler(ctx *fiber.Ctx) error {
+	gallery := ctx.Locals("gallery").(domain.GalleryDB)
+
+	var req identifyClientRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+	email, err := normalizeClientEmail(req.Email)
+	if err != nil {
+		return BadRequest(ctx, err)
+	}
+
+	code, err := domain.GenerateVerificationCode()
+	if err != nil {
+		return ServerError(ctx, err, "Failed to generate code")
+	}
+	key, err := domain.GenerateAccessToken()
+	if err != nil {
+		return ServerError(ctx, err, "Failed to generate code")
+	}
+
+	verification := domain.ClientVerificationDB{
+		GalleryID: gallery.ID,
+		Email:     email,
+		CodeHash:  domain.HashVerificationSecret(code),
+		KeyHash:   domain.HashVerificationSecret(key),
+	}
+	if link, ok := ctx.Locals("shareLink").(domain.ShareLinkDB); ok {
+		verification.LinkID = &link.ID
+	}
+	if err := a.clientVerificationRepo.CreateVerification(ctx.Context(), &verification); err != nil {
+		return ServerError(ctx, err, "Failed to create verification")
+	}
+
+	msg, err := mail.Render(mail.TemplateClientVerification, "Confirm your email", []string{email}, mail.ClientVerificationData{
+		GalleryName:      gallery.Name,
+		Code:             code,
+		Link:             verificationUrl(gallery.ID, verification.ID, key),
+		ExpiresInMinutes: int(domain.ClientVerificationLifetime / time.Minute),
+	})
+	if err != nil {
+		return ServerError(ctx, err, "Failed to render verification email")
+	}
+	if err := a.mailer.Send(ctx.Context(), msg); err != nil {
+		return ServerError(ctx, err, "Failed to send verification email")
+	}
+
+	return ctx.Status(fiber.StatusAccepted).JSON(identifyClientResponse{VerificationId: verification.ID.Hex()})
+}
+
+// @Summary Verify client (client access)
+// @Description Exchanges the one-time code or magic link key for a client session carrying the verified email.
+// @Description Failed attempts are rate limited.
+// @Tags client
+// @Accept json
+// @Produce json
+// @Param galleryId path string true "Gallery ID"
+// @Param request body verifyClientRequest true "Verification"
+// @Success 200 {object} verifyClientResponse
+// @Failure 400 {object} fiber.Map
+// @Failure 401 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 410 {object} fiber.Map
+// @Failure 429 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/client/galleries/{galleryId}/verify [post]
+func (a *api) clientVerifyHandler(ctx *fiber.Ctx) error {
+	gallery := ctx.Locals("gallery").(domain.GalleryDB)
+
+	var req verifyClientRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+	verificationId, err := primitive.ObjectIDFromHex(req.VerificationId)
+	if err != nil {
+		return BadRequest(ctx, errors.New("invalid verification id"))
+	}
+	if req.Code == "" && req.Key == "" {
+		return BadRequest(ctx, errors.New("code or key is required"))
+	}
+
+	verification, err := a.clientVerificationRepo.GetVerification(ctx.Context(), verificationId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return NotFound(ctx, err)
+		}
+		return ServerError(ctx, err, "Failed to fetch verification")
+	}
+	var link *domain.ShareLinkDB
+	var linkId *primitive.ObjectID
+	if l, ok := ctx.Locals("shareLink").(domain.ShareLinkDB); ok {
+		link, linkId = &l, &l.ID
+	}
+	if verification.GalleryID != gallery.ID || !sameLink(verification.LinkID, linkId) {
+		return NotFound(ctx, errors.New("verification not found"))
+	}
+	if !verification.Usable(time.Now().UTC()) {
+		return ctx.Status(fiber.StatusGone).JSON(fiber.Map{"message": "Verification expired, request a new code"})
+	}
+
+	if !matchesVerification(verification, req.Code, req.Key) {
+		if err := a.clientVerificationRepo.FailVerification(ctx.Context(), verification.ID); err != nil {
+			return ServerError(ctx, err, "Failed to update verification")
+		}
+		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid code"})
+	}
+	if err := a.clientVerificationRepo.CompleteVerification(ctx.Context(), verification.ID); err != nil {
+		if errors.Is(err, domain.ErrVerificationUnavailable) {
+			return ctx.Status(fiber.StatusGone).JSON(fiber.Map{"message": "Verification expired, request a new code"})
+		}
+		return ServerError(ctx, err, "Failed to update verification")
+	}
+
+	sessionToken, expiresAt, err := middleware.IssueClientSession(gallery, link, verification.Email)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to create session")
+	}
+
+	return ctx.JSON(verifyClientResponse{
+		SessionToken: sessionToken,
+		ExpiresAt:    expiresAt,
+		Email:        verification.Email,
+	})
+}
+
+// matchesVerification compares the code or magic link key with the stored hashes in constant time
+func matchesVerification(verification domain.ClientVerificationDB, code, key string) bool {
+	if code != "" {
+		return subtle.ConstantTimeCompare([]byte(domain.HashVerificationSecret(code)), []byte(verification.CodeHash)) == 1
+	}
+	return subtle.ConstantTimeCompare([]byte(domain.HashVerificationSecret(key)), []byte(verification.KeyHash)) == 1
+}
+
+func sameLink(a, b *primitive.ObjectID) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func verificationUrl(galleryId, verificationId primitive.ObjectID, key string) string {
+	return fmt.Sprintf("%s/galleries/%s/verify?verification=%s&key=%s",
+		os.Getenv("FRONTEND_ORIGIN"), galleryId.Hex(), verificationId.Hex(), url.QueryEscape(key))
+}
+
+// sessionClientEmail returns the email the client verified for their session, empty when they did not
+func sessionClientEmail(ctx *fiber.Ctx) string {
+	email, _ := ctx.Locals("clientEmail").(string)
+	return email
+}
+
+// requestClientEmail identifies the client by the email verified for their session, falling back to the
+// X-Client-Email header
+func requestClientEmail(ctx *fiber.Ctx) (string, error) {
+	if email := sessionClientEmail(ctx); email != "" {
+		return email, nil
+	}
+	return normalizeClientEmail(ctx.Get(clientEmailHeader))
+}
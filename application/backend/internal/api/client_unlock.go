@@ -0,0 +1,83 @@
+package api
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/domain"
+	"github.com/michalK00/halftone/internal/middleware"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+type unlockGalleryRequest struct {
+	// Token is the share link token or gallery access token from the shared url
+	Token    string `json:"token" example:"xJ3k...="`
+	Password string `json:"password" example:"1234"`
+}
+
+type unlockGalleryResponse struct {
+	// SessionToken replaces the share token in the Authorization header of client requests
+	SessionToken string    `json:"sessionToken"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// @Summary Unlock gallery (client access)
+// @Description Exchanges a share token and the password or PIN protecting it for a short-lived client session token.
+// @Description Failed attempts are rate limited.
+// @Tags client
+// @Accept json
+// @Produce json
+// @Param galleryId path string true "Gallery ID"
+// @Param request body unlockGalleryRequest true "Share token and password"
+// @Success 200 {object} unlockGalleryResponse
+// @Failure 400 {object} fiber.Map
+// @Failure 401 {object} fiber.Map
+// @Failure 403 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 429 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/client/galleries/{galleryId}/unlock [post]
+func (a *api) clientUnlockGalleryHandler(ctx *fiber.Ctx) error {
+	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+	var req unlockGalleryRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+	if req.Token == "" {
+		return BadRequest(ctx, errors.New("token is required"))
+	}
+
+	gallery, err := a.galleryRepo.GetGalleryByID(ctx.Context(), galleryId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return NotFound(ctx, err)
+		}
+		return ServerError(ctx, err, "Failed to fetch gallery")
+	}
+
+	access, err := middleware.ResolveShareToken(ctx.Context(), a.shareLinkRepo, gallery, req.Token)
+	if err != nil {
+		var shareErr *middleware.ShareError
+		if errors.As(err, &shareErr) {
+			return ctx.Status(shareErr.Status).JSON(fiber.Map{"message": shareErr.Message})
+		}
+		return ServerError(ctx, err, "Failed to fetch share link")
+	}
+	if access.PasswordHash != "" && !domain.CheckSharePassword(access.PasswordHash, req.Password) {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid password"})
+	}
+
+	sessionToken, expiresAt, err := middleware.IssueClientSession(gallery, access.Link, "")
+	if err != nil {
+		return ServerError(ctx, err, "Failed to create session")
+	}
+
+	return ctx.JSON(unlockGalleryResponse{
+		SessionToken: sessionToken,
+		ExpiresAt:    expiresAt,
+	})
+}
@@ -29,13 +29,14 @@ type createCollectionResponse struct {
 func (a *api) createCollectionHandler(ctx *fiber.Ctx) error {
 
 	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
 
 	var req createCollectionRequest
 	if err := ctx.BodyParser(&req); err != nil {
 		return BadRequest(ctx, err)
 	}
 
-	id, err := a.collectionRepo.CreateCollection(ctx.Context(), req.Name, userId)
+	id, err := a.collectionRepo.CreateCollection(ctx.Context(), req.Name, workspaceId, userId)
 	if err != nil {
 		return ServerError(ctx, err, "Failed to create collection")
 	}
@@ -56,9 +57,9 @@ func (a *api) createCollectionHandler(ctx *fiber.Ctx) error {
 // @Router /api/v1/collections [get]
 func (a *api) getCollectionsHandler(ctx *fiber.Ctx) error {
 
-	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
 
-	collections, err := a.collectionRepo.GetCollections(ctx.Context(), userId)
+	collections, err := a.collectionRepo.GetCollections(ctx.Context(), workspaceId)
 	if err != nil {
 		return ServerError(ctx, err, "Failed to get collections")
 	}
@@ -78,14 +79,14 @@ func (a *api) getCollectionsHandler(ctx *fiber.Ctx) error {
 // @Router /api/v1/collections/{collectionId} [get]
 func (a *api) getCollectionHandler(ctx *fiber.Ctx) error {
 
-	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
 
 	collectionId, err := primitive.ObjectIDFromHex(ctx.Params("collectionId"))
 	if err != nil {
 		return NotFound(ctx, err)
 	}
 
-	collection, err := a.collectionRepo.GetCollection(ctx.Context(), collectionId, userId)
+	collection, err := a.collectionRepo.GetCollection(ctx.Context(), collectionId, workspaceId)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return NotFound(ctx, err)
@@ -115,7 +116,7 @@ type updateCollectionRequest struct {
 // @Router /api/v1/collections/{collectionId} [put]
 func (a *api) updateCollectionHandler(ctx *fiber.Ctx) error {
 
-	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
 
 	collectionId, err := primitive.ObjectIDFromHex(ctx.Params("collectionId"))
 	if err != nil {
@@ -128,7 +129,7 @@ func (a *api) updateCollectionHandler(ctx *fiber.Ctx) error {
 		return BadRequest(ctx, err)
 	}
 
-	collection, err := a.collectionRepo.UpdateCollection(ctx.Context(), collectionId, req.Name, userId)
+	collection, err := a.collectionRepo.UpdateCollection(ctx.Context(), collectionId, req.Name, workspaceId)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return NotFound(ctx, err)
@@ -151,14 +152,14 @@ func (a *api) updateCollectionHandler(ctx *fiber.Ctx) error {
 // @Router /api/v1/collections/{collectionId} [delete]
 func (a *api) deleteCollectionHandler(ctx *fiber.Ctx) error {
 
-	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
 
 	collectionId, err := primitive.ObjectIDFromHex(ctx.Params("collectionId"))
 	if err != nil {
 		return ctx.SendStatus(fiber.StatusNoContent)
 	}
 
-	err = a.collectionRepo.DeleteCollection(ctx.Context(), collectionId, userId)
+	err = a.collectionRepo.DeleteCollection(ctx.Context(), collectionId, workspaceId)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return ctx.SendStatus(fiber.StatusNoContent)
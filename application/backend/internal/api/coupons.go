@@ -0,0 +1,144 @@
+package api
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+type createCouponRequest struct {
+	Code      string            `json:"code" example:"SUMMER10"`
+	Type      domain.CouponType `json:"type" example:"percentage"`
+	Value     int64             `json:"value" example:"10"`
+	GalleryId string            `json:"galleryId,omitempty" example:"671442a11fd0c5eb46b5a3fa"`
+	// example: "2024-12-31T23:59:59Z"
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+	MaxUses   int64     `json:"maxUses" example:"50"`
+}
+
+type createCouponResponse struct {
+	ID string `json:"id"`
+}
+
+// @Summary Get coupons
+// @Description Gets all discount coupons of the authenticated user
+// @Tags coupons
+// @Accept */*
+// @Produce json
+// @Success 200 {array} domain.CouponDB
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/coupons [get]
+func (a *api) getCouponsHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+
+	coupons, err := a.couponRepo.GetCoupons(ctx.Context(), workspaceId)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to fetch coupons")
+	}
+
+	return ctx.JSON(coupons)
+}
+
+// @Summary Create coupon
+// @Description Creates a percentage or fixed amount coupon, optionally limited to one gallery
+// @Tags coupons
+// @Accept json
+// @Produce json
+// @Param request body createCouponRequest true "Coupon to create"
+// @Success 201 {object} createCouponResponse
+// @Failure 400 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 409 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/coupons [post]
+func (a *api) createCouponHandler(ctx *fiber.Ctx) error {
+	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+
+	var req createCouponRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+
+	if domain.NormalizeCouponCode(req.Code) == "" {
+		return BadRequest(ctx, errors.New("coupon code is required"))
+	}
+	switch req.Type {
+	case domain.CouponTypePercentage:
+		if req.Value < 1 || req.Value > 100 {
+			return BadRequest(ctx, errors.New("percentage must be between 1 and 100"))
+		}
+	case domain.CouponTypeFixed:
+		if req.Value < 1 {
+			return BadRequest(ctx, errors.New("fixed amount must be positive"))
+		}
+	default:
+		return BadRequest(ctx, errors.New("invalid coupon type"))
+	}
+	if req.MaxUses < 0 {
+		return BadRequest(ctx, errors.New("max uses can not be negative"))
+	}
+
+	coupon := domain.CouponDB{
+		UserId:      userId,
+		WorkspaceID: workspaceId,
+		Code:        req.Code,
+		Type:        req.Type,
+		Value:       req.Value,
+		ExpiresAt:   req.ExpiresAt,
+		MaxUses:     req.MaxUses,
+	}
+	if req.GalleryId != "" {
+		galleryId, err := primitive.ObjectIDFromHex(req.GalleryId)
+		if err != nil {
+			return BadRequest(ctx, err)
+		}
+		exists, err := a.galleryRepo.GalleryExists(ctx.Context(), galleryId, workspaceId)
+		if err != nil {
+			return ServerError(ctx, err, "Failed to check if gallery exists")
+		}
+		if !exists {
+			return NotFound(ctx, errors.New("gallery does not exist"))
+		}
+		coupon.GalleryId = &galleryId
+	}
+
+	id, err := a.couponRepo.CreateCoupon(ctx.Context(), &coupon)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Coupon code already exists"})
+		}
+		return ServerError(ctx, err, "Failed to create coupon")
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(createCouponResponse{
+		ID: id,
+	})
+}
+
+// @Summary Delete coupon
+// @Description Deletes a coupon, orders that already used it keep their discount
+// @Tags coupons
+// @Accept */*
+// @Produce json
+// @Param couponId path string true "Coupon ID"
+// @Success 204
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/coupons/{couponId} [delete]
+func (a *api) deleteCouponHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	couponId, err := primitive.ObjectIDFromHex(ctx.Params("couponId"))
+	if err != nil {
+		return ctx.SendStatus(fiber.StatusNoContent)
+	}
+
+	err = a.couponRepo.DeleteCoupon(ctx.Context(), couponId, workspaceId)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to delete coupon")
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
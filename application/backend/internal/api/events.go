@@ -0,0 +1,134 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/domain"
+	"github.com/michalK00/halftone/internal/stream"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+	"time"
+)
+
+type createEventTicketResponse struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// publish announces a change to the dashboards of the workspace, failures are only logged so they never fail the
+// request
+func (a *api) publish(ctx context.Context, eventType domain.EventType, workspaceId primitive.ObjectID, data any) {
+	event, err := domain.NewEvent(eventType, workspaceId, data)
+	if err == nil {
+		err = a.eventBroker.Publish(ctx, event)
+	}
+	if err != nil {
+		log.Printf("Failed to publish %s event: %v", eventType, err)
+	}
+}
+
+// @Summary Stream events
+// @Description Streams photo.processed, order.created, order.updated and comment.created events of the workspace as
+// @Description Server-Sent Events, or as WebSocket text messages when the request asks to upgrade. Browsers, which can
+// @Description not send headers with EventSource or WebSocket, pass a ticket from /api/v1/events/tickets instead.
+// @Tags events
+// @Accept */*
+// @Produce text/event-stream
+// @Param ticket query string false "Ticket opening the stream without headers"
+// @Success 200 {object} domain.Event
+// @Failure 401 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/events [get]
+func (a *api) eventStreamHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+
+	if websocket.IsWebSocketUpgrade(ctx) {
+		return websocket.New(func(conn *websocket.Conn) {
+			a.serveEventWebSocket(conn, workspaceId)
+		})(ctx)
+	}
+
+	// the stream outlives the request context, it ends when the client goes away or the broker is closed
+	streamCtx, cancel := context.WithCancel(context.Background())
+	events, err := a.eventBroker.Subscribe(streamCtx, workspaceId)
+	if err != nil {
+		cancel()
+		return ServerError(ctx, err, "Failed to subscribe to events")
+	}
+
+	ctx.Set(fiber.HeaderContentType, "text/event-stream")
+	ctx.Set(fiber.HeaderCacheControl, "no-cache")
+	ctx.Set(fiber.HeaderConnection, "keep-alive")
+	// keeps proxies such as nginx from buffering the stream
+	ctx.Set("X-Accel-Buffering", "no")
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		stream.ServeSSE(w, events)
+	})
+	return nil
+}
+
+// serveEventWebSocket streams the events after the upgrade, subscribing can only fail with a close message by then
+func (a *api) serveEventWebSocket(conn *websocket.Conn, workspaceId primitive.ObjectID) {
+	streamCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := a.eventBroker.Subscribe(streamCtx, workspaceId)
+	if err != nil {
+		log.Printf("Failed to subscribe to events: %v", err)
+		stream.CloseWebSocket(conn, websocket.CloseInternalServerErr)
+		return
+	}
+	stream.ServeWebSocket(conn, events)
+}
+
+// eventTicketStreamHandler opens the event stream of requests with a ticket, other requests fall through to the
+// protected route
+func (a *api) eventTicketStreamHandler(ctx *fiber.Ctx) error {
+	token := ctx.Query("ticket")
+	if token == "" {
+		return ctx.Next()
+	}
+
+	ticket, err := a.eventTicketRepo.RedeemEventTicket(ctx.Context(), token)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidEventTicket) {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": err.Error()})
+		}
+		return ServerError(ctx, err, "Failed to check event ticket")
+	}
+
+	ctx.Locals("userId", ticket.UserId)
+	ctx.Locals("workspaceId", ticket.WorkspaceID)
+	return a.eventStreamHandler(ctx)
+}
+
+// @Summary Create event stream ticket
+// @Description Creates a ticket to open the event stream of the workspace from a browser, it can be used once within
+// @Description 30 seconds
+// @Tags events
+// @Accept */*
+// @Produce json
+// @Success 201 {object} createEventTicketResponse
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/events/tickets [post]
+func (a *api) createEventTicketHandler(ctx *fiber.Ctx) error {
+	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+
+	ticket, err := a.eventTicketRepo.CreateEventTicket(ctx.Context(), domain.EventTicket{
+		UserId:      userId,
+		WorkspaceID: workspaceId,
+	})
+	if err != nil {
+		return ServerError(ctx, err, "Failed to create event ticket")
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(createEventTicketResponse{
+		Ticket:    ticket,
+		ExpiresAt: time.Now().UTC().Add(domain.EventTicketLifetime),
+	})
+}
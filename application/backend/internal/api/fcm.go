@@ -1,10 +1,14 @@
 package api
 
 import (
+	"errors"
 	"log"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/domain"
 	"github.com/michalK00/halftone/internal/fcm"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func (a *api) SubscribeToPush(ctx *fiber.Ctx) error {
@@ -20,22 +24,102 @@ func (a *api) SubscribeToPush(ctx *fiber.Ctx) error {
 	if req.Token == "" {
 		return ctx.Status(400).JSON(fiber.Map{
 			"success": false,
-			"error":   "Token and UserID are required",
+			"error":   "Token is required",
 		})
 	}
 
-	// Subscribe user
-	if err := a.fcmService.Subscribe(ctx, &req); err != nil {
-		log.Printf("Error subscribing user %s: %v", ctx.Locals("userId"), err)
+	userId := ctx.Locals("userId").(string)
+	subscription, err := a.fcmService.Subscribe(ctx.Context(), userId, &req)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidDeviceLabel) {
+			return ctx.Status(400).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		log.Printf("Error subscribing user %s: %v", userId, err)
 		return ctx.Status(500).JSON(fiber.Map{
 			"success": false,
 			"error":   "Failed to subscribe to push notifications",
 		})
 	}
 
+	return ctx.JSON(fiber.Map{
+		"success":      true,
+		"message":      "Successfully subscribed to push notifications",
+		"subscription": subscription,
+	})
+}
+
+// UnsubscribeFromPush removes the device token sent by the device, e.g. when signing out on it
+func (a *api) UnsubscribeFromPush(ctx *fiber.Ctx) error {
+	var req fcm.SubscriptionRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(400).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+	if req.Token == "" {
+		return ctx.Status(400).JSON(fiber.Map{
+			"success": false,
+			"error":   "Token is required",
+		})
+	}
+
+	userId := ctx.Locals("userId").(string)
+	if err := a.pushSubscriptionRepo.DeletePushSubscriptionByToken(ctx.Context(), req.Token, userId); err != nil {
+		return pushSubscriptionError(ctx, userId, err)
+	}
+
 	return ctx.JSON(fiber.Map{
 		"success": true,
-		"message": "Successfully subscribed to push notifications",
+		"message": "Successfully unsubscribed from push notifications",
+	})
+}
+
+// GetPushSubscriptions lists the devices of the user registered for push notifications
+func (a *api) GetPushSubscriptions(ctx *fiber.Ctx) error {
+	userId := ctx.Locals("userId").(string)
+
+	subscriptions, err := a.pushSubscriptionRepo.GetPushSubscriptions(ctx.Context(), userId)
+	if err != nil {
+		log.Printf("Error fetching push subscriptions of user %s: %v", userId, err)
+		return ctx.Status(500).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to fetch push subscriptions",
+		})
+	}
+
+	return ctx.JSON(subscriptions)
+}
+
+// DeletePushSubscription removes a device of the user from another device, e.g. one that was lost
+func (a *api) DeletePushSubscription(ctx *fiber.Ctx) error {
+	userId := ctx.Locals("userId").(string)
+	subscriptionId, err := primitive.ObjectIDFromHex(ctx.Params("subscriptionId"))
+	if err != nil {
+		return pushSubscriptionError(ctx, userId, mongo.ErrNoDocuments)
+	}
+
+	if err := a.pushSubscriptionRepo.DeletePushSubscription(ctx.Context(), subscriptionId, userId); err != nil {
+		return pushSubscriptionError(ctx, userId, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+func pushSubscriptionError(ctx *fiber.Ctx, userId string, err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ctx.Status(404).JSON(fiber.Map{
+			"success": false,
+			"error":   "Push subscription not found",
+		})
+	}
+	log.Printf("Error unsubscribing user %s: %v", userId, err)
+	return ctx.Status(500).JSON(fiber.Map{
+		"success": false,
+		"error":   "Failed to unsubscribe from push notifications",
 	})
 }
 
@@ -70,7 +154,17 @@ func (a *api) SendPushMessage(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := a.fcmService.SendMessage(&req); err != nil {
+	workspace := c.Locals("workspace").(domain.WorkspaceDB)
+	for _, userId := range req.UserIDs {
+		if _, ok := workspace.Role(userId); !ok {
+			return c.Status(403).JSON(fiber.Map{
+				"success": false,
+				"error":   "Messages can only be sent to members of the workspace",
+			})
+		}
+	}
+
+	if err := a.fcmService.SendMessage(c.Context(), &req); err != nil {
 		log.Printf("Error sending push message: %v", err)
 		return c.Status(500).JSON(fiber.Map{
 			"success": false,
@@ -31,13 +31,13 @@ type updateGalleryRequest struct {
 // @Router /api/v1/collections/{collectionId}/galleries [get]
 func (a *api) getGalleriesHandler(ctx *fiber.Ctx) error {
 
-	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
 	collectionId, err := primitive.ObjectIDFromHex(ctx.Params("collectionId"))
 	if err != nil {
 		return NotFound(ctx, err)
 	}
 
-	galleries, err := a.galleryRepo.GetGalleries(ctx.Context(), collectionId, userId)
+	galleries, err := a.galleryRepo.GetGalleries(ctx.Context(), collectionId, workspaceId)
 	if err != nil {
 		return ServerError(ctx, err, "Failed to fetch galleries")
 	}
@@ -56,12 +56,12 @@ func (a *api) getGalleriesHandler(ctx *fiber.Ctx) error {
 // @Failure 500 {object} fiber.Map "Server error"
 // @Router /api/v1/collections/{collectionId}/galleryCount [get]
 func (a *api) getGalleryCountHandler(ctx *fiber.Ctx) error {
-	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
 	collectionId, err := primitive.ObjectIDFromHex(ctx.Params("collectionId"))
 	if err != nil {
 		return NotFound(ctx, err)
 	}
-	count, err := a.galleryRepo.CollectionGalleryCount(ctx.Context(), collectionId, userId)
+	count, err := a.galleryRepo.CollectionGalleryCount(ctx.Context(), collectionId, workspaceId)
 	if err != nil {
 		return ServerError(ctx, err, "Failed to fetch gallery count")
 	}
@@ -82,13 +82,14 @@ func (a *api) getGalleryCountHandler(ctx *fiber.Ctx) error {
 func (a *api) createGalleryHandler(ctx *fiber.Ctx) error {
 
 	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
 
 	collectionId, err := primitive.ObjectIDFromHex(ctx.Params("collectionId"))
 	if err != nil {
 		return NotFound(ctx, err)
 	}
 
-	exists, err := a.collectionRepo.CollectionExists(ctx.Context(), collectionId, userId)
+	exists, err := a.collectionRepo.CollectionExists(ctx.Context(), collectionId, workspaceId)
 	if err != nil {
 		return ServerError(ctx, err, "Failed to check if collection exists")
 	}
@@ -101,7 +102,7 @@ func (a *api) createGalleryHandler(ctx *fiber.Ctx) error {
 		return BadRequest(ctx, err)
 	}
 
-	id, err := a.galleryRepo.CreateGallery(ctx.Context(), collectionId, req.Name, userId)
+	id, err := a.galleryRepo.CreateGallery(ctx.Context(), collectionId, req.Name, workspaceId, userId)
 	if err != nil {
 		return ServerError(ctx, err, "Failed to create galleries")
 	}
@@ -122,12 +123,12 @@ func (a *api) createGalleryHandler(ctx *fiber.Ctx) error {
 // @Failure 500 {object} fiber.Map
 // @Router /api/v1/galleries/{galleryId} [get]
 func (a *api) getGalleryHandler(ctx *fiber.Ctx) error {
-	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
 	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
 	if err != nil {
 		return NotFound(ctx, err)
 	}
-	gallery, err := a.galleryRepo.GetGallery(ctx.Context(), galleryId, userId)
+	gallery, err := a.galleryRepo.GetGallery(ctx.Context(), galleryId, workspaceId)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return NotFound(ctx, err)
@@ -150,7 +151,7 @@ func (a *api) getGalleryHandler(ctx *fiber.Ctx) error {
 // @Failure 500 {object} fiber.Map
 // @Router /api/v1/galleries/{galleryId} [put]
 func (a *api) updateGalleryHandler(ctx *fiber.Ctx) error {
-	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
 	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
 	if err != nil {
 		return NotFound(ctx, err)
@@ -160,7 +161,7 @@ func (a *api) updateGalleryHandler(ctx *fiber.Ctx) error {
 		return BadRequest(ctx, err)
 	}
 
-	gallery, err := a.galleryRepo.UpdateGallery(ctx.Context(), galleryId, userId,
+	gallery, err := a.galleryRepo.UpdateGallery(ctx.Context(), galleryId, workspaceId,
 		domain.WithName(req.Name),
 	)
 	if err != nil {
@@ -182,13 +183,13 @@ func (a *api) updateGalleryHandler(ctx *fiber.Ctx) error {
 // @Failure 500 {object} fiber.Map
 // @Router /api/v1/galleries/{galleryId} [delete]
 func (a *api) deleteGalleryHandler(ctx *fiber.Ctx) error {
-	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
 
 	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
 	if err != nil {
 		return ctx.SendStatus(fiber.StatusNoContent)
 	}
-	err = a.galleryRepo.DeleteGallery(ctx.Context(), galleryId, userId)
+	err = a.galleryRepo.DeleteGallery(ctx.Context(), galleryId, workspaceId)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return ctx.SendStatus(fiber.StatusNoContent)
@@ -197,3 +198,42 @@ func (a *api) deleteGalleryHandler(ctx *fiber.Ctx) error {
 	}
 	return ctx.SendStatus(fiber.StatusNoContent)
 }
+
+// @Summary Update gallery pricing
+// @Description Sets the products clients can order from the gallery and the allowances included with the package
+// @Tags galleries
+// @Accept json
+// @Produce json
+// @Param galleryId path string true "Gallery ID" example:"671442a11fd0c5eb46b5a3fa"
+// @Param request body domain.Pricing true "Gallery pricing"
+// @Success 200 {object} domain.GalleryDB
+// @Failure 400 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/galleries/{galleryId}/pricing [put]
+func (a *api) updateGalleryPricingHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+	var req domain.Pricing
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+	if err := req.Validate(); err != nil {
+		return BadRequest(ctx, err)
+	}
+	if req.Products == nil {
+		req.Products = make([]domain.Product, 0)
+	}
+
+	gallery, err := a.galleryRepo.UpdateGallery(ctx.Context(), galleryId, workspaceId, domain.WithPricing(req))
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return NotFound(ctx, err)
+		}
+		return ServerError(ctx, err, "Failed to update gallery pricing")
+	}
+	return ctx.Status(fiber.StatusOK).JSON(gallery)
+}
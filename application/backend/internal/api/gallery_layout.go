@@ -0,0 +1,322 @@
+package api
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"strconv"
+)
+
+type galleryCoverRequest struct {
+	// PhotoID of the cover, empty removes the cover
+	PhotoID string `json:"photoId" example:"671442a11fd0c5eb46b5a3fb"`
+}
+
+type gallerySortRequest struct {
+	SortOrder domain.PhotoSortOrder `json:"sortOrder" example:"manual"`
+}
+
+type gallerySectionsRequest struct {
+	// Sections in the order clients see them, sections without an ID are created and missing ones are removed
+	Sections []domain.GallerySection `json:"sections"`
+}
+
+type photoOrderRequest struct {
+	// PhotoIDs in their new order, photos left out go after them
+	PhotoIDs []string `json:"photoIds"`
+}
+
+type photoSectionRequest struct {
+	// SectionID to move the photos to, empty removes them from their section
+	SectionID string   `json:"sectionId" example:"671442a11fd0c5eb46b5a3fc"`
+	PhotoIDs  []string `json:"photoIds"`
+}
+
+type photoSectionResponse struct {
+	Updated int64 `json:"updated"`
+}
+
+// @Summary Set gallery cover
+// @Description Sets the photo shown as the cover of the gallery
+// @Tags galleries
+// @Accept json
+// @Produce json
+// @Param galleryId path string true "Gallery ID" example:"671442a11fd0c5eb46b5a3fa"
+// @Param request body galleryCoverRequest true "Cover photo"
+// @Success 200 {object} domain.GalleryDB
+// @Failure 400 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/galleries/{galleryId}/cover [put]
+func (a *api) updateGalleryCoverHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+	var req galleryCoverRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+
+	var coverId *primitive.ObjectID
+	if req.PhotoID != "" {
+		photoId, err := primitive.ObjectIDFromHex(req.PhotoID)
+		if err != nil {
+			return BadRequest(ctx, errors.New("invalid photo ID"))
+		}
+		photo, err := a.photoRepo.GetPhoto(ctx.Context(), photoId, workspaceId)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return BadRequest(ctx, errors.New("photo does not belong to this gallery"))
+			}
+			return ServerError(ctx, err, "Failed to fetch photo")
+		}
+		if photo.GalleryId != galleryId {
+			return BadRequest(ctx, errors.New("photo does not belong to this gallery"))
+		}
+		coverId = &photo.ID
+	}
+
+	return a.updateGalleryLayout(ctx, galleryId, workspaceId, domain.WithCoverPhoto(coverId))
+}
+
+// @Summary Set gallery sort order
+// @Description Sets how photos are ordered for the photographer and clients
+// @Tags galleries
+// @Accept json
+// @Produce json
+// @Param galleryId path string true "Gallery ID" example:"671442a11fd0c5eb46b5a3fa"
+// @Param request body gallerySortRequest true "Sort order, empty sorts by upload time"
+// @Success 200 {object} domain.GalleryDB
+// @Failure 400 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/galleries/{galleryId}/sort [put]
+func (a *api) updateGallerySortHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+	var req gallerySortRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+	if !req.SortOrder.Valid() {
+		return BadRequest(ctx, errors.New("invalid sort order"))
+	}
+
+	return a.updateGalleryLayout(ctx, galleryId, workspaceId, domain.WithSortOrder(req.SortOrder))
+}
+
+// @Summary Update gallery sections
+// @Description Replaces the sections of the gallery, photos of removed sections are left without a section
+// @Tags galleries
+// @Accept json
+// @Produce json
+// @Param galleryId path string true "Gallery ID" example:"671442a11fd0c5eb46b5a3fa"
+// @Param request body gallerySectionsRequest true "Sections"
+// @Success 200 {object} domain.GalleryDB
+// @Failure 400 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/galleries/{galleryId}/sections [put]
+func (a *api) updateGallerySectionsHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+	var req gallerySectionsRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+	gallery, err := a.galleryRepo.GetGallery(ctx.Context(), galleryId, workspaceId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return NotFound(ctx, err)
+		}
+		return ServerError(ctx, err, "Failed to fetch gallery")
+	}
+	for _, section := range req.Sections {
+		if !section.ID.IsZero() && !gallery.HasSection(section.ID) {
+			return BadRequest(ctx, errors.New("unknown section"))
+		}
+	}
+	sections, err := domain.NormalizeSections(req.Sections)
+	if err != nil {
+		return BadRequest(ctx, err)
+	}
+	keep := make([]primitive.ObjectID, len(sections))
+	for i, section := range sections {
+		keep[i] = section.ID
+	}
+
+	if err := a.photoRepo.ClearSections(ctx.Context(), galleryId, workspaceId, keep); err != nil {
+		return ServerError(ctx, err, "Failed to update photo sections")
+	}
+	return a.updateGalleryLayout(ctx, galleryId, workspaceId, domain.WithSections(sections))
+}
+
+// @Summary Reorder gallery photos
+// @Description Sets the manual order of the gallery photos, used when the gallery is sorted manually
+// @Tags photos
+// @Accept json
+// @Produce json
+// @Param galleryId path string true "Gallery ID" example:"671442a11fd0c5eb46b5a3fa"
+// @Param request body photoOrderRequest true "Photo order"
+// @Success 204
+// @Failure 400 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/galleries/{galleryId}/photos/order [put]
+func (a *api) reorderPhotosHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+	var req photoOrderRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+	photoIds, err := galleryPhotoIds(req.PhotoIDs)
+	if err != nil {
+		return BadRequest(ctx, err)
+	}
+	if exists, err := a.galleryRepo.GalleryExists(ctx.Context(), galleryId, workspaceId); err != nil {
+		return ServerError(ctx, err, "Failed to fetch gallery")
+	} else if !exists {
+		return NotFound(ctx, errors.New("gallery not found"))
+	}
+
+	if err := a.photoRepo.ReorderPhotos(ctx.Context(), galleryId, workspaceId, photoIds); err != nil {
+		return ServerError(ctx, err, "Failed to reorder photos")
+	}
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// @Summary Assign photos to a section
+// @Description Moves photos of the gallery to one of its sections
+// @Tags photos
+// @Accept json
+// @Produce json
+// @Param galleryId path string true "Gallery ID" example:"671442a11fd0c5eb46b5a3fa"
+// @Param request body photoSectionRequest true "Section and photos"
+// @Success 200 {object} photoSectionResponse
+// @Failure 400 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/galleries/{galleryId}/photos/section [put]
+func (a *api) assignPhotoSectionHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+	var req photoSectionRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+	photoIds, err := galleryPhotoIds(req.PhotoIDs)
+	if err != nil {
+		return BadRequest(ctx, err)
+	}
+	if len(photoIds) == 0 {
+		return BadRequest(ctx, errors.New("no photos provided"))
+	}
+
+	gallery, err := a.galleryRepo.GetGallery(ctx.Context(), galleryId, workspaceId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return NotFound(ctx, err)
+		}
+		return ServerError(ctx, err, "Failed to fetch gallery")
+	}
+	var sectionId *primitive.ObjectID
+	if req.SectionID != "" {
+		id, err := primitive.ObjectIDFromHex(req.SectionID)
+		if err != nil || !gallery.HasSection(id) {
+			return BadRequest(ctx, errors.New("unknown section"))
+		}
+		sectionId = &id
+	}
+
+	updated, err := a.photoRepo.AssignSection(ctx.Context(), galleryId, workspaceId, photoIds, sectionId)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to update photo sections")
+	}
+	return ctx.JSON(photoSectionResponse{Updated: updated})
+}
+
+func (a *api) updateGalleryLayout(ctx *fiber.Ctx, galleryId primitive.ObjectID, workspaceId primitive.ObjectID, opt domain.GalleryUpdateOption) error {
+	gallery, err := a.galleryRepo.UpdateGallery(ctx.Context(), galleryId, workspaceId, opt)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return NotFound(ctx, err)
+		}
+		return ServerError(ctx, err, "Failed to update gallery")
+	}
+	return ctx.JSON(gallery)
+}
+
+const (
+	defaultPhotosPageSize = 100
+	maxPhotosPageSize     = 500
+)
+
+// photoFilterFromQuery reads the section photos are narrowed down to and the requested page, photos are sorted in the
+// gallery sort order
+func photoFilterFromQuery(ctx *fiber.Ctx, gallery domain.GalleryDB) (domain.PhotoFilter, error) {
+	filter := domain.PhotoFilter{Sort: gallery.SortOrder, Limit: defaultPhotosPageSize}
+	if limit := ctx.QueryInt("limit", defaultPhotosPageSize); limit > 0 {
+		filter.Limit = int64(min(limit, maxPhotosPageSize))
+	}
+	if cursor := ctx.Query("cursor"); cursor != "" {
+		c, err := domain.DecodeCursor(cursor, domain.PhotoDB{}.SortValue(filter.Sort))
+		if err != nil {
+			return domain.PhotoFilter{}, err
+		}
+		filter.Cursor = &c
+	}
+	if section := ctx.Query("section"); section != "" {
+		sectionId, err := primitive.ObjectIDFromHex(section)
+		if err != nil || !gallery.HasSection(sectionId) {
+			return domain.PhotoFilter{}, errors.New("unknown section")
+		}
+		filter.SectionID = &sectionId
+	}
+	return filter, nil
+}
+
+func galleryPhotoIds(ids []string) ([]primitive.ObjectID, error) {
+	photoIds := make([]primitive.ObjectID, 0, len(ids))
+	seen := make(map[primitive.ObjectID]bool, len(ids))
+	for _, id := range ids {
+		photoId, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, errors.New("invalid photo ID")
+		}
+		if seen[photoId] {
+			return nil, errors.New("duplicate photo ID")
+		}
+		seen[photoId] = true
+		photoIds = append(photoIds, photoId)
+	}
+	return photoIds, nil
+}
+
+func setPhotoPageHeaders(ctx *fiber.Ctx, page domain.PhotoPage) error {
+	if page.NextCursor != nil {
+		cursor, err := page.NextCursor.Encode()
+		if err != nil {
+			return err
+		}
+		ctx.Set("X-Next-Cursor", cursor)
+	}
+	ctx.Set("X-Total-Count", strconv.FormatInt(page.Total, 10))
+	return nil
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+)
+
+const (
+	defaultNotificationsPageSize = 50
+	maxNotificationsPageSize     = 200
+)
+
+type markNotificationsRequest struct {
+	// IDs of the notifications to mark, all notifications of the user are marked when it is empty
+	IDs []string `json:"ids"`
+}
+
+type markNotificationsResponse struct {
+	Updated int64 `json:"updated"`
+}
+
+type updateNotificationPreferencesRequest struct {
+	Channels map[domain.NotificationType]domain.NotificationChannel `json:"channels"`
+}
+
+// notify stores the notification in the inbox of the photographer and queues its delivery, failures are only logged
+// so they never fail the request
+func (a *api) notify(ctx context.Context, notification *domain.NotificationDB) {
+	if err := a.notifier.Notify(ctx, notification); err != nil {
+		log.Printf("Failed to create %s notification: %v", notification.Type, err)
+	}
+}
+
+// @Summary Get notifications
+// @Description Gets the notifications of the user, newest first, with the number of unread ones
+// @Tags notifications
+// @Accept */*
+// @Produce json
+// @Param unread query bool false "Only unread notifications"
+// @Param before query string false "Next from the previous page"
+// @Param limit query int false "Page size"
+// @Success 200 {object} domain.NotificationPage
+// @Failure 400 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/notifications [get]
+func (a *api) getNotificationsHandler(ctx *fiber.Ctx) error {
+	userId := ctx.Locals("userId").(string)
+
+	filter := domain.NotificationFilter{UnreadOnly: ctx.QueryBool("unread"), Limit: defaultNotificationsPageSize}
+	if limit := ctx.QueryInt("limit", defaultNotificationsPageSize); limit > 0 {
+		filter.Limit = int64(min(limit, maxNotificationsPageSize))
+	}
+	if before := ctx.Query("before"); before != "" {
+		beforeId, err := primitive.ObjectIDFromHex(before)
+		if err != nil {
+			return BadRequest(ctx, err)
+		}
+		filter.Before = beforeId
+	}
+
+	page, err := a.notificationRepo.GetNotifications(ctx.Context(), userId, filter)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to fetch notifications")
+	}
+
+	return ctx.JSON(page)
+}
+
+// @Summary Mark notifications read
+// @Description Marks the notifications as read, all notifications of the user when no IDs are sent
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param request body markNotificationsRequest true "Notifications to mark"
+// @Success 200 {object} markNotificationsResponse
+// @Failure 400 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/notifications/read [put]
+func (a *api) markNotificationsReadHandler(ctx *fiber.Ctx) error {
+	return a.markNotifications(ctx, true)
+}
+
+// @Summary Mark notifications unread
+// @Description Marks the notifications as unread again, all notifications of the user when no IDs are sent
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param request body markNotificationsRequest true "Notifications to mark"
+// @Success 200 {object} markNotificationsResponse
+// @Failure 400 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/notifications/unread [put]
+func (a *api) markNotificationsUnreadHandler(ctx *fiber.Ctx) error {
+	return a.markNotifications(ctx, false)
+}
+
+func (a *api) markNotifications(ctx *fiber.Ctx, read bool) error {
+	userId := ctx.Locals("userId").(string)
+
+	var req markNotificationsRequest
+	if len(ctx.Body()) > 0 {
+		if err := ctx.BodyParser(&req); err != nil {
+			return BadRequest(ctx, err)
+		}
+	}
+	ids := make([]primitive.ObjectID, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		notificationId, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return BadRequest(ctx, errors.New("invalid notification ID"))
+		}
+		ids = append(ids, notificationId)
+	}
+
+	updated, err := a.notificationRepo.MarkNotificationsRead(ctx.Context(), userId, ids, read)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to update notifications")
+	}
+
+	return ctx.JSON(markNotificationsResponse{Updated: updated})
+}
+
+// @Summary Get notification preferences
+// @Description Gets the channel every notification type is delivered over besides the inbox: push, email or none
+// @Tags notifications
+// @Accept */*
+// @Produce json
+// @Success 200 {object} domain.NotificationPreferencesDB
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/notifications/preferences [get]
+func (a *api) getNotificationPreferencesHandler(ctx *fiber.Ctx) error {
+	userId := ctx.Locals("userId").(string)
+
+	preferences, err := a.notificationRepo.GetNotificationPreferences(ctx.Context(), userId)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to fetch notification preferences")
+	}
+	// email notifications go to the address of the token, it is recorded whenever it changes
+	if email, ok := userEmail(ctx); ok && email != preferences.Email {
+		preferences, err = a.notificationRepo.UpdateNotificationPreferences(ctx.Context(), userId, nil, email)
+		if err != nil {
+			return ServerError(ctx, err, "Failed to fetch notification preferences")
+		}
+	}
+
+	return ctx.JSON(preferences.WithDefaults())
+}
+
+// @Summary Update notification preferences
+// @Description Sets the channel of the sent notification types, the other types keep their channel. Email
+// @Description notifications are sent to the verified email of the token.
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param request body updateNotificationPreferencesRequest true "Channels by notification type"
+// @Success 200 {object} domain.NotificationPreferencesDB
+// @Failure 400 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/notifications/preferences [put]
+func (a *api) updateNotificationPreferencesHandler(ctx *fiber.Ctx) error {
+	userId := ctx.Locals("userId").(string)
+
+	var req updateNotificationPreferencesRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+	if err := domain.ValidateChannels(req.Channels); err != nil {
+		return BadRequest(ctx, err)
+	}
+
+	email, _ := userEmail(ctx)
+	preferences, err := a.notificationRepo.UpdateNotificationPreferences(ctx.Context(), userId, req.Channels, email)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to update notification preferences")
+	}
+
+	return ctx.JSON(preferences.WithDefaults())
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"github.com/michalK00/halftone/internal/domain"
+	"github.com/michalK00/halftone/internal/mail"
+	"log"
+	"strings"
+)
+
+var orderEmailSubjects = map[mail.Template]string{
+	mail.TemplateOrderReceived:       "We received your order",
+	mail.TemplateOrderStatusChanged:  "Your order was updated",
+	mail.TemplateOrderReadyForPickup: "Your order is ready for pickup",
+	mail.TemplateOrderShipped:        "Your order has shipped",
+}
+
+func statusEmailTemplate(status domain.OrderStatus) mail.Template {
+	switch status {
+	case domain.OrderStatusReadyForPickup:
+		return mail.TemplateOrderReadyForPickup
+	case domain.OrderStatusShipped:
+		return mail.TemplateOrderShipped
+	default:
+		return mail.TemplateOrderStatusChanged
+	}
+}
+
+// sendOrderEmail queues an email notifying the client about their order, so a slow mail server does not hold up the
+// request. Failures are only logged so they never fail the request.
+func (a *api) sendOrderEmail(ctx context.Context, tmpl mail.Template, order domain.OrderDB, gallery domain.GalleryDB) {
+	if order.ClientEmail == "" {
+		return
+	}
+
+	data := mail.OrderEmailData{
+		OrderId:     order.ID.Hex(),
+		GalleryName: gallery.Name,
+		Status:      strings.ReplaceAll(string(order.Status), "_", " "),
+		Comment:     order.Comment,
+		PhotoCount:  len(order.Photos),
+	}
+	if gallery.Sharing.SharingEnabled {
+		data.GalleryUrl = gallery.Sharing.SharingUrl
+	}
+	if order.Total > 0 {
+		data.Total = domain.FormatAmount(order.Total, order.Currency)
+	}
+
+	msg, err := mail.Render(tmpl, orderEmailSubjects[tmpl], []string{order.ClientEmail}, data)
+	if err != nil {
+		log.Printf("Failed to render %s email: %v", tmpl, err)
+		return
+	}
+	job, err := domain.NewEmailJob(domain.EmailPayload{
+		To:      msg.To,
+		Subject: msg.Subject,
+		Text:    msg.Text,
+		HTML:    msg.HTML,
+	})
+	if err == nil {
+		_, err = a.jobRepo.CreateJob(ctx, job)
+	}
+	if err != nil {
+		log.Printf("Failed to queue %s email: %v", tmpl, err)
+	}
+}
@@ -0,0 +1,306 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxOrderMessageLength = 5000
+
+type createOrderMessageRequest struct {
+	Body     string   `json:"body" example:"Could the second photo be printed in black and white?"`
+	PhotoIDs []string `json:"photoIds" example:"[\"671442a11fd0c5eb46b5a3fa\"]"`
+}
+
+type createOrderMessageResponse struct {
+	ID string `json:"id"`
+}
+
+type markOrderMessagesReadResponse struct {
+	Updated int64 `json:"updated"`
+}
+
+// @Summary Get order messages
+// @Description Gets the conversation with the client about an order, oldest message first
+// @Tags orders
+// @Accept */*
+// @Produce json
+// @Param orderId path string true "Order ID"
+// @Success 200 {array} domain.OrderMessageDB
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/orders/{orderId}/messages [get]
+func (a *api) getOrderMessagesHandler(ctx *fiber.Ctx) error {
+	order, ok, err := a.ownedOrder(ctx)
+	if !ok {
+		return err
+	}
+
+	messages, err := a.orderMessageRepo.GetMessages(ctx.Context(), order.ID)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to fetch messages")
+	}
+
+	return ctx.JSON(messages)
+}
+
+// @Summary Send order message
+// @Description Sends a message to the client about an order, optionally referencing photos of the gallery
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param orderId path string true "Order ID"
+// @Param request body createOrderMessageRequest true "Message"
+// @Success 201 {object} createOrderMessageResponse
+// @Failure 400 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/orders/{orderId}/messages [post]
+func (a *api) createOrderMessageHandler(ctx *fiber.Ctx) error {
+	order, ok, err := a.ownedOrder(ctx)
+	if !ok {
+		return err
+	}
+
+	message, ok, err := a.createOrderMessage(ctx, order, domain.MessageAuthorPhotographer)
+	if !ok {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(createOrderMessageResponse{ID: message.ID.Hex()})
+}
+
+// @Summary Mark order messages as read
+// @Description Marks all client messages of an order as read
+// @Tags orders
+// @Accept */*
+// @Produce json
+// @Param orderId path string true "Order ID"
+// @Success 200 {object} markOrderMessagesReadResponse
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/orders/{orderId}/messages/read [put]
+func (a *api) markOrderMessagesReadHandler(ctx *fiber.Ctx) error {
+	order, ok, err := a.ownedOrder(ctx)
+	if !ok {
+		return err
+	}
+
+	updated, err := a.orderMessageRepo.MarkMessagesRead(ctx.Context(), order.ID, domain.MessageAuthorPhotographer)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to mark messages as read")
+	}
+
+	return ctx.JSON(markOrderMessagesReadResponse{Updated: updated})
+}
+
+// @Summary Get order messages (client access)
+// @Description Gets the conversation with the photographer about an order placed in the gallery
+// @Tags client
+// @Accept */*
+// @Produce json
+// @Param galleryId path string true "Gallery ID"
+// @Param orderId path string true "Order ID"
+// @Param Authorization header string true "Bearer {access_token}"
+// @Param X-Client-Email header string false "Email the order was placed with, required unless the session has a verified email"
+// @Success 200 {array} domain.OrderMessageDB
+// @Failure 401 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/client/galleries/{galleryId}/orders/{orderId}/messages [get]
+func (a *api) clientGetOrderMessagesHandler(ctx *fiber.Ctx) error {
+	order, ok, err := a.galleryOrder(ctx)
+	if !ok {
+		return err
+	}
+
+	messages, err := a.orderMessageRepo.GetMessages(ctx.Context(), order.ID)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to fetch messages")
+	}
+
+	return ctx.JSON(messages)
+}
+
+// @Summary Send order message (client access)
+// @Description Sends a message to the photographer about an order, the photographer is notified with a push message
+// @Tags client
+// @Accept json
+// @Produce json
+// @Param galleryId path string true "Gallery ID"
+// @Param orderId path string true "Order ID"
+// @Param Authorization header string true "Bearer {access_token}"
+// @Param X-Client-Email header string false "Email the order was placed with, required unless the session has a verified email"
+// @Param request body createOrderMessageRequest true "Message"
+// @Success 201 {object} createOrderMessageResponse
+// @Failure 400 {object} fiber.Map
+// @Failure 401 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/client/galleries/{galleryId}/orders/{orderId}/messages [post]
+func (a *api) clientCreateOrderMessageHandler(ctx *fiber.Ctx) error {
+	order, ok, err := a.galleryOrder(ctx)
+	if !ok {
+		return err
+	}
+
+	message, ok, err := a.createOrderMessage(ctx, order, domain.MessageAuthorClient)
+	if !ok {
+		return err
+	}
+
+	a.notify(ctx.Context(), &domain.NotificationDB{
+		UserId:      order.UserId,
+		WorkspaceID: order.WorkspaceID,
+		Type:        domain.NotificationOrderMessage,
+		Title:       "New message",
+		Body:        fmt.Sprintf("%s replied about their order", order.ClientEmail),
+		Data: map[string]string{
+			"orderId": order.ID.Hex(),
+		},
+	})
+
+	return ctx.Status(fiber.StatusCreated).JSON(createOrderMessageResponse{ID: message.ID.Hex()})
+}
+
+// @Summary Mark order messages as read (client access)
+// @Description Marks all photographer messages of an order as read
+// @Tags client
+// @Accept */*
+// @Produce json
+// @Param galleryId path string true "Gallery ID"
+// @Param orderId path string true "Order ID"
+// @Param Authorization header string true "Bearer {access_token}"
+// @Param X-Client-Email header string false "Email the order was placed with, required unless the session has a verified email"
+// @Success 200 {object} markOrderMessagesReadResponse
+// @Failure 401 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/client/galleries/{galleryId}/orders/{orderId}/messages/read [put]
+func (a *api) clientMarkOrderMessagesReadHandler(ctx *fiber.Ctx) error {
+	order, ok, err := a.galleryOrder(ctx)
+	if !ok {
+		return err
+	}
+
+	updated, err := a.orderMessageRepo.MarkMessagesRead(ctx.Context(), order.ID, domain.MessageAuthorClient)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to mark messages as read")
+	}
+
+	return ctx.JSON(markOrderMessagesReadResponse{Updated: updated})
+}
+
+// ownedOrder loads the order from the path if it belongs to the authenticated user. When ok is false the response has
+// already been written and err is what the handler should return.
+func (a *api) ownedOrder(ctx *fiber.Ctx) (domain.OrderDB, bool, error) {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	orderId, err := primitive.ObjectIDFromHex(ctx.Params("orderId"))
+	if err != nil {
+		return domain.OrderDB{}, false, NotFound(ctx, err)
+	}
+
+	order, err := a.orderRepo.GetOrder(ctx.Context(), orderId, workspaceId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return domain.OrderDB{}, false, NotFound(ctx, err)
+		}
+		return domain.OrderDB{}, false, ServerError(ctx, err, "Failed to fetch order")
+	}
+	return order, true, nil
+}
+
+// galleryOrder loads the order from the path if it was placed in the gallery the client is authenticated for by the
+// client identified by the request, ok and err behave like in ownedOrder.
+func (a *api) galleryOrder(ctx *fiber.Ctx) (domain.OrderDB, bool, error) {
+	gallery := ctx.Locals("gallery").(domain.GalleryDB)
+	orderId, err := primitive.ObjectIDFromHex(ctx.Params("orderId"))
+	if err != nil {
+		return domain.OrderDB{}, false, NotFound(ctx, err)
+	}
+
+	order, err := a.orderRepo.GetOrderByID(ctx.Context(), orderId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return domain.OrderDB{}, false, NotFound(ctx, err)
+		}
+		return domain.OrderDB{}, false, ServerError(ctx, err, "Failed to fetch order")
+	}
+	if order.GalleryID != gallery.ID {
+		return domain.OrderDB{}, false, NotFound(ctx, errors.New("order does not belong to this gallery"))
+	}
+	// Anyone with the link can guess order IDs, so only the client who placed the order gets to see it
+	if !clientPlacedOrder(ctx, order) {
+		return domain.OrderDB{}, false, NotFound(ctx, errors.New("order does not belong to this client"))
+	}
+	return order, true, nil
+}
+
+// clientPlacedOrder reports whether the order was placed by the client identified by the request. Links requiring a
+// verified email only match orders placed with the email verified for the session.
+func clientPlacedOrder(ctx *fiber.Ctx, order domain.OrderDB) bool {
+	if link, ok := ctx.Locals("shareLink").(domain.ShareLinkDB); ok && link.RequireEmail {
+		email := sessionClientEmail(ctx)
+		return email != "" && order.ClientVerified && strings.EqualFold(email, order.ClientEmail)
+	}
+	email, err := requestClientEmail(ctx)
+	return err == nil && strings.EqualFold(email, strings.TrimSpace(order.ClientEmail))
+}
+
+func (a *api) createOrderMessage(ctx *fiber.Ctx, order domain.OrderDB, author domain.MessageAuthor) (domain.OrderMessageDB, bool, error) {
+	var req createOrderMessageRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return domain.OrderMessageDB{}, false, BadRequest(ctx, err)
+	}
+
+	body := strings.TrimSpace(req.Body)
+	if body == "" || utf8.RuneCountInString(body) > maxOrderMessageLength {
+		return domain.OrderMessageDB{}, false, BadRequest(ctx, errors.New("invalid message body"))
+	}
+
+	photoIds := make([]primitive.ObjectID, 0, len(req.PhotoIDs))
+	seen := make(map[primitive.ObjectID]bool, len(req.PhotoIDs))
+	for _, photoIdStr := range req.PhotoIDs {
+		photoId, err := primitive.ObjectIDFromHex(photoIdStr)
+		if err != nil {
+			return domain.OrderMessageDB{}, false, BadRequest(ctx, errors.New("invalid photo ID"))
+		}
+		if !seen[photoId] {
+			seen[photoId] = true
+			photoIds = append(photoIds, photoId)
+		}
+	}
+	if len(photoIds) > 0 {
+		verify := a.photoRepo.VerifyPhotosInGallery
+		if author == domain.MessageAuthorClient {
+			// Clients can only reference the photos shared with them
+			verify = a.photoRepo.VerifySharedPhotosInGallery
+		}
+		valid, err := verify(ctx.Context(), order.GalleryID, photoIds)
+		if err != nil {
+			return domain.OrderMessageDB{}, false, ServerError(ctx, err, "Failed to verify photos")
+		}
+		if !valid {
+			return domain.OrderMessageDB{}, false, BadRequest(ctx, errors.New("some photos do not belong to this gallery"))
+		}
+	}
+
+	message := domain.OrderMessageDB{
+		OrderID:   order.ID,
+		GalleryID: order.GalleryID,
+		UserId:    order.UserId,
+		Author:    author,
+		Body:      body,
+		PhotoIDs:  photoIds,
+	}
+	if _, err := a.orderMessageRepo.CreateMessage(ctx.Context(), &message); err != nil {
+		return domain.OrderMessageDB{}, false, ServerError(ctx, err, "Failed to send message")
+	}
+	return message, true, nil
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/domain"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientPlacedOrder(t *testing.T) {
+	order := domain.OrderDB{ClientEmail: "anna@example.com"}
+	verified := domain.OrderDB{ClientEmail: "anna@example.com", ClientVerified: true}
+
+	tests := []struct {
+		name         string
+		order        domain.OrderDB
+		requireEmail bool
+		sessionEmail string
+		header       string
+		want         bool
+	}{
+		{"header matches", order, false, "", "Anna@Example.com", true},
+		{"header of another client", order, false, "", "tom@example.com", false},
+		{"no identity", order, false, "", "", false},
+		{"session email matches", verified, false, "anna@example.com", "", true},
+		{"session email overrides header", order, false, "tom@example.com", "anna@example.com", false},
+		{"verified link ignores header", verified, true, "", "anna@example.com", false},
+		{"verified link matches session email", verified, true, "anna@example.com", "", true},
+		{"verified link needs verified order", order, true, "anna@example.com", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				ctx.Locals("shareLink", domain.ShareLinkDB{RequireEmail: tt.requireEmail})
+				if tt.sessionEmail != "" {
+					ctx.Locals("clientEmail", tt.sessionEmail)
+				}
+				if got := clientPlacedOrder(ctx, tt.order); got != tt.want {
+					t.Errorf("clientPlacedOrder() = %v, want %v", got, tt.want)
+				}
+				return nil
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				req.Header.Set(clientEmailHeader, tt.header)
+			}
+			if _, err := app.Test(req); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
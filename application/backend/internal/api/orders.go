@@ -1,45 +1,196 @@
 package api
 
 import (
+	"bytes"
+	"encoding/csv"
 	"errors"
 	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/aws"
+	"github.com/michalK00/halftone/internal/csvutil"
 	"github.com/michalK00/halftone/internal/domain"
+	"github.com/michalK00/halftone/internal/jobs"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type createOrderRequest struct {
-	ClientEmail string   `json:"clientEmail" validate:"required,email" example:"client@example.com"`
-	Comment     string   `json:"comment" example:"Please print all photos in 10x15cm format"`
-	PhotoIDs    []string `json:"photoIds" validate:"required,min=1" example:"[\"671442a11fd0c5eb46b5a3fa\"]"`
+	ClientEmail string `json:"clientEmail" validate:"required,email" example:"client@example.com"`
+	Comment     string `json:"comment" example:"Please print all photos in 10x15cm format"`
+	// PhotoIDs orders one piece of each photo, use Items to choose products and quantities
+	PhotoIDs   []string           `json:"photoIds" example:"[\"671442a11fd0c5eb46b5a3fa\"]"`
+	Items      []orderItemRequest `json:"items"`
+	CouponCode string             `json:"couponCode,omitempty" example:"SUMMER10"`
+}
+
+type orderItemRequest struct {
+	PhotoID  string `json:"photoId" example:"671442a11fd0c5eb46b5a3fa"`
+	Product  string `json:"product" example:"print-10x15"`
+	Quantity int    `json:"quantity" example:"2"`
 }
 
 type createOrderResponse struct {
 	ID string `json:"id"`
+	domain.OrderTotals
 }
 
 type updateOrderRequest struct {
-	Status  string `json:"status,omitempty" example:"completed"`
+	Status  string `json:"status,omitempty" example:"completed" enums:"pending,ready_for_pickup,shipped,completed"`
 	Comment string `json:"comment,omitempty" example:"Updated comment"`
 }
 
+const (
+	defaultOrdersPageSize = 50
+	maxOrdersPageSize     = 200
+)
+
 // @Summary Get all orders
-// @Description Gets all orders for galleries owned by the authenticated user
+// @Description Gets orders for galleries owned by the authenticated user, newest first. The cursor of the next page is
+// @Description returned in the X-Next-Cursor header, format=csv exports every matching order instead.
 // @Tags orders
 // @Accept json
-// @Produce json
+// @Produce json,text/csv
+// @Param status query string false "Order status" Enums(pending,ready_for_pickup,shipped,completed)
+// @Param galleryId query string false "Gallery ID"
+// @Param collectionId query string false "Collection ID"
+// @Param clientEmail query string false "Client email"
+// @Param from query string false "Created at or after (RFC3339)"
+// @Param to query string false "Created before (RFC3339)"
+// @Param q query string false "Search in order comments"
+// @Param limit query int false "Page size, at most 200" default(50)
+// @Param cursor query string false "Cursor from the X-Next-Cursor header of the previous page"
+// @Param format query string false "Response format" Enums(json,csv)
 // @Success 200 {array} domain.OrderDB
+// @Header 200 {string} X-Next-Cursor "Cursor of the next page, absent on the last page"
+// @Failure 400 {object} fiber.Map
 // @Failure 500 {object} fiber.Map
 // @Router /api/v1/orders [get]
 func (a *api) getOrdersHandler(ctx *fiber.Ctx) error {
-	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+
+	filter, err := orderFilterFromQuery(ctx)
+	if err != nil {
+		return BadRequest(ctx, err)
+	}
 
-	orders, err := a.orderRepo.GetOrders(ctx.Context(), userId)
+	if ctx.Query("format") == "csv" {
+		return a.exportOrdersCSV(ctx, workspaceId, filter)
+	}
+
+	page, err := a.orderRepo.GetOrders(ctx.Context(), workspaceId, filter)
 	if err != nil {
 		return ServerError(ctx, err, "Failed to fetch orders")
 	}
+	if page.NextCursor != nil {
+		cursor, err := page.NextCursor.Encode()
+		if err != nil {
+			return ServerError(ctx, err, "Failed to fetch orders")
+		}
+		ctx.Set("X-Next-Cursor", cursor)
+	}
 
-	return ctx.JSON(orders)
+	return ctx.JSON(page.Orders)
+}
+
+func orderFilterFromQuery(ctx *fiber.Ctx) (domain.OrderFilter, error) {
+	filter := domain.OrderFilter{
+		ClientEmail: strings.TrimSpace(ctx.Query("clientEmail")),
+		Query:       strings.TrimSpace(ctx.Query("q")),
+		Limit:       defaultOrdersPageSize,
+	}
+
+	if status := ctx.Query("status"); status != "" {
+		filter.Status = domain.OrderStatus(status)
+		if !filter.Status.Valid() {
+			return domain.OrderFilter{}, errors.New("invalid status")
+		}
+	}
+	if galleryId := ctx.Query("galleryId"); galleryId != "" {
+		id, err := primitive.ObjectIDFromHex(galleryId)
+		if err != nil {
+			return domain.OrderFilter{}, err
+		}
+		filter.GalleryID = id
+	}
+	if collectionId := ctx.Query("collectionId"); collectionId != "" {
+		id, err := primitive.ObjectIDFromHex(collectionId)
+		if err != nil {
+			return domain.OrderFilter{}, err
+		}
+		filter.CollectionID = id
+	}
+	if from := ctx.Query("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return domain.OrderFilter{}, err
+		}
+		filter.From = t
+	}
+	if to := ctx.Query("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return domain.OrderFilter{}, err
+		}
+		filter.To = t
+	}
+	if limit := ctx.QueryInt("limit", defaultOrdersPageSize); limit > 0 {
+		filter.Limit = int64(min(limit, maxOrdersPageSize))
+	}
+	if cursor := ctx.Query("cursor"); cursor != "" {
+		c, err := domain.DecodeCursor(cursor, time.Time{})
+		if err != nil {
+			return domain.OrderFilter{}, err
+		}
+		filter.Cursor = &c
+	}
+
+	return filter, nil
+}
+
+// exportOrdersCSV writes every order matching the filter, fetching them page by page
+func (a *api) exportOrdersCSV(ctx *fiber.Ctx, workspaceId primitive.ObjectID, filter domain.OrderFilter) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"id", "created_at", "status", "gallery_id", "collection_id", "client_email", "photos", "currency", "subtotal", "total", "coupon", "comment"})
+
+	filter.Limit = maxOrdersPageSize
+	for {
+		page, err := a.orderRepo.GetOrders(ctx.Context(), workspaceId, filter)
+		if err != nil {
+			return ServerError(ctx, err, "Failed to export orders")
+		}
+		for _, order := range page.Orders {
+			_ = w.Write([]string{
+				order.ID.Hex(),
+				order.CreatedAt.UTC().Format(time.RFC3339),
+				string(order.Status),
+				order.GalleryID.Hex(),
+				order.CollectionID.Hex(),
+				csvutil.Cell(order.ClientEmail),
+				strconv.Itoa(len(order.Photos)),
+				order.Currency,
+				strconv.FormatInt(order.Subtotal, 10),
+				strconv.FormatInt(order.Total, 10),
+				csvutil.Cell(order.CouponCode),
+				csvutil.Cell(order.Comment),
+			})
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		filter.Cursor = page.NextCursor
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return ServerError(ctx, err, "Failed to export orders")
+	}
+
+	ctx.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	ctx.Set(fiber.HeaderContentDisposition, `attachment; filename="orders.csv"`)
+	return ctx.Send(buf.Bytes())
 }
 
 // @Summary Get order by ID
@@ -53,13 +204,13 @@ func (a *api) getOrdersHandler(ctx *fiber.Ctx) error {
 // @Failure 500 {object} fiber.Map
 // @Router /api/v1/orders/{orderId} [get]
 func (a *api) getOrderHandler(ctx *fiber.Ctx) error {
-	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
 	orderId, err := primitive.ObjectIDFromHex(ctx.Params("orderId"))
 	if err != nil {
 		return NotFound(ctx, err)
 	}
 
-	order, err := a.orderRepo.GetOrder(ctx.Context(), orderId, userId)
+	order, err := a.orderRepo.GetOrder(ctx.Context(), orderId, workspaceId)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return NotFound(ctx, err)
@@ -71,7 +222,7 @@ func (a *api) getOrderHandler(ctx *fiber.Ctx) error {
 }
 
 // @Summary Update order
-// @Description Updates an order's status or comment
+// @Description Updates an order's status or comment, the client is notified by email when the status changes
 // @Tags orders
 // @Accept json
 // @Produce json
@@ -83,7 +234,7 @@ func (a *api) getOrderHandler(ctx *fiber.Ctx) error {
 // @Failure 500 {object} fiber.Map
 // @Router /api/v1/orders/{orderId} [put]
 func (a *api) updateOrderHandler(ctx *fiber.Ctx) error {
-	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
 	orderId, err := primitive.ObjectIDFromHex(ctx.Params("orderId"))
 	if err != nil {
 		return NotFound(ctx, err)
@@ -99,7 +250,7 @@ func (a *api) updateOrderHandler(ctx *fiber.Ctx) error {
 	if req.Status != "" {
 		// Validate status
 		status := domain.OrderStatus(req.Status)
-		if status != domain.OrderStatusPending && status != domain.OrderStatusCompleted {
+		if !status.Valid() {
 			return BadRequest(ctx, errors.New("invalid status"))
 		}
 		updateOpts = append(updateOpts, domain.WithOrderStatus(status))
@@ -113,7 +264,15 @@ func (a *api) updateOrderHandler(ctx *fiber.Ctx) error {
 		return BadRequest(ctx, errors.New("no fields to update"))
 	}
 
-	order, err := a.orderRepo.UpdateOrder(ctx.Context(), orderId, userId, updateOpts...)
+	previous, err := a.orderRepo.GetOrder(ctx.Context(), orderId, workspaceId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return NotFound(ctx, err)
+		}
+		return ServerError(ctx, err, "Failed to fetch order")
+	}
+
+	order, err := a.orderRepo.UpdateOrder(ctx.Context(), orderId, workspaceId, updateOpts...)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return NotFound(ctx, err)
@@ -121,6 +280,17 @@ func (a *api) updateOrderHandler(ctx *fiber.Ctx) error {
 		return ServerError(ctx, err, "Failed to update order")
 	}
 
+	a.publish(ctx.Context(), domain.EventOrderUpdated, workspaceId, order)
+
+	if order.Status != previous.Status {
+		gallery, err := a.galleryRepo.GetGallery(ctx.Context(), order.GalleryID, workspaceId)
+		if err != nil {
+			log.Printf("Failed to fetch gallery for order email: %v", err)
+		} else {
+			a.sendOrderEmail(ctx.Context(), statusEmailTemplate(order.Status), order, gallery)
+		}
+	}
+
 	return ctx.JSON(order)
 }
 
@@ -134,19 +304,132 @@ func (a *api) updateOrderHandler(ctx *fiber.Ctx) error {
 // @Failure 500 {object} fiber.Map
 // @Router /api/v1/orders/{orderId} [delete]
 func (a *api) deleteOrderHandler(ctx *fiber.Ctx) error {
-	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
 	orderId, err := primitive.ObjectIDFromHex(ctx.Params("orderId"))
 	if err != nil {
 		return ctx.SendStatus(fiber.StatusNoContent)
 	}
 
-	err = a.orderRepo.DeleteOrder(ctx.Context(), orderId, userId)
+	err = a.orderRepo.DeleteOrder(ctx.Context(), orderId, workspaceId)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return ctx.SendStatus(fiber.StatusNoContent)
 		}
 		return ServerError(ctx, err, "Failed to delete order")
 	}
+	if err := a.orderMessageRepo.DeleteMessages(ctx.Context(), orderId); err != nil {
+		return ServerError(ctx, err, "Failed to delete order messages")
+	}
 
 	return ctx.SendStatus(fiber.StatusNoContent)
 }
+
+type orderExportResponse struct {
+	Status      domain.OrderExportStatus `json:"status" example:"ready"`
+	RequestedAt time.Time                `json:"requestedAt"`
+	CompletedAt *time.Time               `json:"completedAt,omitempty"`
+	Url         string                   `json:"url,omitempty"`
+}
+
+// @Summary Export order for print lab
+// @Description Schedules building a ZIP of the ordered originals grouped by product, with a CSV and JSON manifest. A push notification is sent when it is ready.
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param orderId path string true "Order ID"
+// @Success 202 {object} orderExportResponse
+// @Failure 404 {object} fiber.Map
+// @Failure 409 {object} fiber.Map "Order not accepted yet or export already in progress"
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/orders/{orderId}/export [post]
+func (a *api) exportOrderHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	orderId, err := primitive.ObjectIDFromHex(ctx.Params("orderId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+
+	order, err := a.orderRepo.GetOrder(ctx.Context(), orderId, workspaceId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return NotFound(ctx, err)
+		}
+		return ServerError(ctx, err, "Failed to fetch order")
+	}
+	if !order.Status.Exportable() {
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Only accepted orders can be exported"})
+	}
+
+	job, err := domain.NewOrderExportJob(domain.OrderExportPayload{OrderId: orderId})
+	if err != nil {
+		return ServerError(ctx, err, "Failed to create export job")
+	}
+	export := domain.OrderExport{
+		Status:      domain.OrderExportPending,
+		JobID:       job.ID,
+		RequestedAt: job.CreatedAt,
+	}
+	// Mark the export as pending first so concurrent requests can't both schedule one
+	if err := a.orderRepo.StartOrderExport(ctx.Context(), orderId, workspaceId, export); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Export already in progress"})
+		}
+		return ServerError(ctx, err, "Failed to update order")
+	}
+	if _, err := a.jobRepo.CreateJob(ctx.Context(), job); err != nil {
+		now := time.Now().UTC()
+		export.Status = domain.OrderExportFailed
+		export.Error = "Failed to schedule export"
+		export.CompletedAt = &now
+		_ = a.orderRepo.UpdateOrderExport(ctx.Context(), orderId, export)
+		return ServerError(ctx, err, "Failed to schedule export")
+	}
+
+	return ctx.Status(fiber.StatusAccepted).JSON(orderExportResponse{
+		Status:      export.Status,
+		RequestedAt: export.RequestedAt,
+	})
+}
+
+// @Summary Get order export
+// @Description Gets the status of the print lab export and a download link once it is ready
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param orderId path string true "Order ID"
+// @Success 200 {object} orderExportResponse
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/orders/{orderId}/export [get]
+func (a *api) getOrderExportHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	orderId, err := primitive.ObjectIDFromHex(ctx.Params("orderId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+
+	order, err := a.orderRepo.GetOrder(ctx.Context(), orderId, workspaceId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return NotFound(ctx, err)
+		}
+		return ServerError(ctx, err, "Failed to fetch order")
+	}
+	if order.Export == nil {
+		return NotFound(ctx, errors.New("order was not exported"))
+	}
+
+	res := orderExportResponse{
+		Status:      order.Export.Status,
+		RequestedAt: order.Export.RequestedAt,
+		CompletedAt: order.Export.CompletedAt,
+	}
+	if order.Export.Status == domain.OrderExportReady {
+		res.Url, err = aws.GetObjectUrlWithLifetime(order.Export.ObjectKey, jobs.ExportLinkLifetime)
+		if err != nil {
+			return ServerError(ctx, err, "Failed to get export url")
+		}
+	}
+
+	return ctx.JSON(res)
+}
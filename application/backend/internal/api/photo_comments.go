@@ -0,0 +1,271 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxPhotoCommentLength = 2000
+
+type createPhotoCommentRequest struct {
+	Body string `json:"body" example:"Please remove the sign in the background"`
+	// ParentID replies to an existing comment of the photo
+	ParentID string      `json:"parentId,omitempty" example:"671442a11fd0c5eb46b5a3fa"`
+	Pin      *domain.Pin `json:"pin,omitempty"`
+}
+
+type createPhotoCommentResponse struct {
+	ID string `json:"id"`
+}
+
+// @Summary Get photo comments
+// @Description Gets client comments and replies on a photo, oldest first
+// @Tags photos
+// @Accept */*
+// @Produce json
+// @Param photoId path string true "Photo ID"
+// @Success 200 {array} domain.PhotoCommentDB
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/photos/{photoId}/comments [get]
+func (a *api) getPhotoCommentsHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	photoId, err := primitive.ObjectIDFromHex(ctx.Params("photoId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+
+	exists, err := a.photoRepo.PhotoExists(ctx.Context(), photoId, workspaceId)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to fetch photo")
+	}
+	if !exists {
+		return NotFound(ctx, errors.New("photo not found"))
+	}
+
+	comments, err := a.photoCommentRepo.GetComments(ctx.Context(), photoId)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to fetch comments")
+	}
+
+	return ctx.JSON(comments)
+}
+
+// @Summary Comment on photo
+// @Description Adds a comment to a photo, usually a reply to a client comment
+// @Tags photos
+// @Accept json
+// @Produce json
+// @Param photoId path string true "Photo ID"
+// @Param request body createPhotoCommentRequest true "Comment"
+// @Success 201 {object} createPhotoCommentResponse
+// @Failure 400 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/photos/{photoId}/comments [post]
+func (a *api) createPhotoCommentHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	photoId, err := primitive.ObjectIDFromHex(ctx.Params("photoId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+
+	photo, err := a.photoRepo.GetPhoto(ctx.Context(), photoId, workspaceId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return NotFound(ctx, err)
+		}
+		return ServerError(ctx, err, "Failed to fetch photo")
+	}
+
+	comment := domain.PhotoCommentDB{Author: domain.MessageAuthorPhotographer}
+	if ok, err := a.createPhotoComment(ctx, photo, &comment); !ok {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(createPhotoCommentResponse{ID: comment.ID.Hex()})
+}
+
+// @Summary Get gallery comments
+// @Description Gets all comments on photos of the gallery, oldest first
+// @Tags galleries
+// @Accept */*
+// @Produce json
+// @Param galleryId path string true "Gallery ID" example:"671442a11fd0c5eb46b5a3fa"
+// @Success 200 {array} domain.PhotoCommentDB
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/galleries/{galleryId}/comments [get]
+func (a *api) getGalleryCommentsHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+
+	comments, err := a.photoCommentRepo.GetGalleryComments(ctx.Context(), galleryId, workspaceId)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to fetch comments")
+	}
+
+	return ctx.JSON(comments)
+}
+
+// @Summary Get photo comments (client access)
+// @Description Gets comments on a photo of the gallery, oldest first
+// @Tags client
+// @Accept */*
+// @Produce json
+// @Param galleryId path string true "Gallery ID"
+// @Param photoId path string true "Photo ID"
+// @Param Authorization header string true "Bearer {access_token}"
+// @Success 200 {array} domain.PhotoCommentDB
+// @Failure 401 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/client/galleries/{galleryId}/photos/{photoId}/comments [get]
+func (a *api) clientGetPhotoCommentsHandler(ctx *fiber.Ctx) error {
+	photo, ok, err := a.galleryPhoto(ctx)
+	if !ok {
+		return err
+	}
+
+	comments, err := a.photoCommentRepo.GetComments(ctx.Context(), photo.ID)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to fetch comments")
+	}
+
+	return ctx.JSON(comments)
+}
+
+// @Summary Comment on photo (client access)
+// @Description Adds a comment or retouch request to a photo, optionally pinned to a point of the image
+// @Tags client
+// @Accept json
+// @Produce json
+// @Param galleryId path string true "Gallery ID"
+// @Param photoId path string true "Photo ID"
+// @Param Authorization header string true "Bearer {access_token}"
+// @Param X-Client-Email header string false "Client email, ignored when the session has a verified email"
+// @Param request body createPhotoCommentRequest true "Comment"
+// @Success 201 {object} createPhotoCommentResponse
+// @Failure 400 {object} fiber.Map
+// @Failure 401 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/client/galleries/{galleryId}/photos/{photoId}/comments [post]
+func (a *api) clientCreatePhotoCommentHandler(ctx *fiber.Ctx) error {
+	photo, ok, err := a.galleryPhoto(ctx)
+	if !ok {
+		return err
+	}
+
+	comment := domain.PhotoCommentDB{Author: domain.MessageAuthorClient, ClientEmail: sessionClientEmail(ctx)}
+	if header := ctx.Get(clientEmailHeader); comment.ClientEmail == "" && header != "" {
+		comment.ClientEmail, err = normalizeClientEmail(header)
+		if err != nil {
+			return BadRequest(ctx, err)
+		}
+	}
+	if ok, err := a.createPhotoComment(ctx, photo, &comment); !ok {
+		return err
+	}
+
+	from := "A client"
+	if comment.ClientEmail != "" {
+		from = comment.ClientEmail
+	}
+	a.notify(ctx.Context(), &domain.NotificationDB{
+		UserId:      photo.UserId,
+		WorkspaceID: photo.WorkspaceID,
+		Type:        domain.NotificationComment,
+		Title:       "New comment",
+		Body:        fmt.Sprintf("%s commented on %s", from, photo.OriginalFilename),
+		Data: map[string]string{
+			"galleryId": photo.GalleryId.Hex(),
+			"photoId":   photo.ID.Hex(),
+		},
+	})
+
+	return ctx.Status(fiber.StatusCreated).JSON(createPhotoCommentResponse{ID: comment.ID.Hex()})
+}
+
+// galleryPhoto loads the shared photo from the path if it belongs to the gallery the client is authenticated for, ok
+// and err behave like in ownedOrder.
+func (a *api) galleryPhoto(ctx *fiber.Ctx) (domain.PhotoDB, bool, error) {
+	gallery := ctx.Locals("gallery").(domain.GalleryDB)
+	photoId, err := primitive.ObjectIDFromHex(ctx.Params("photoId"))
+	if err != nil {
+		return domain.PhotoDB{}, false, NotFound(ctx, err)
+	}
+
+	photo, err := a.photoRepo.GetSharedPhotoById(ctx.Context(), photoId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return domain.PhotoDB{}, false, NotFound(ctx, err)
+		}
+		return domain.PhotoDB{}, false, ServerError(ctx, err, "Failed to fetch photo")
+	}
+	if photo.GalleryId != gallery.ID {
+		return domain.PhotoDB{}, false, NotFound(ctx, errors.New("photo not found in this gallery"))
+	}
+	return photo, true, nil
+}
+
+// createPhotoComment fills the comment from the request body and stores it, the author has to be set by the caller
+func (a *api) createPhotoComment(ctx *fiber.Ctx, photo domain.PhotoDB, comment *domain.PhotoCommentDB) (bool, error) {
+	var req createPhotoCommentRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return false, BadRequest(ctx, err)
+	}
+
+	body := strings.TrimSpace(req.Body)
+	if body == "" || utf8.RuneCountInString(body) > maxPhotoCommentLength {
+		return false, BadRequest(ctx, errors.New("invalid comment body"))
+	}
+	if req.Pin != nil {
+		if err := req.Pin.Validate(); err != nil {
+			return false, BadRequest(ctx, err)
+		}
+	}
+
+	if req.ParentID != "" {
+		parentId, err := primitive.ObjectIDFromHex(req.ParentID)
+		if err != nil {
+			return false, BadRequest(ctx, errors.New("invalid parent ID"))
+		}
+		parent, err := a.photoCommentRepo.GetComment(ctx.Context(), parentId)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return false, BadRequest(ctx, err)
+			}
+			return false, ServerError(ctx, err, "Failed to fetch comment")
+		}
+		if parent.PhotoID != photo.ID {
+			return false, BadRequest(ctx, errors.New("parent comment belongs to another photo"))
+		}
+		// Threads are one level deep, replies to a reply join the thread of its parent
+		if parent.ParentID != nil {
+			parentId = *parent.ParentID
+		}
+		comment.ParentID = &parentId
+	}
+
+	comment.PhotoID = photo.ID
+	comment.GalleryID = photo.GalleryId
+	comment.UserId = photo.UserId
+	comment.WorkspaceID = photo.WorkspaceID
+	comment.Body = body
+	comment.Pin = req.Pin
+	if _, err := a.photoCommentRepo.CreateComment(ctx.Context(), comment); err != nil {
+		return false, ServerError(ctx, err, "Failed to create comment")
+	}
+	a.publish(ctx.Context(), domain.EventCommentCreated, comment.WorkspaceID, comment)
+	return true, nil
+}
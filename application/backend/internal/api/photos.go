@@ -2,12 +2,14 @@ package api
 
 import (
 	"errors"
+	"fmt"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/gofiber/fiber/v2"
 	"github.com/michalK00/halftone/internal/aws"
 	"github.com/michalK00/halftone/internal/domain"
 	awsClient "github.com/michalK00/halftone/platform/cloud/aws"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"log"
 	"os"
 	"path"
@@ -15,8 +17,13 @@ import (
 	"time"
 )
 
+// photoProcessingCheckDelay is how long after the upload the previews are first looked for
+const photoProcessingCheckDelay = 10 * time.Second
+
 type photoUploadRequest struct {
 	OriginalFilename string `json:"originalFilename"`
+	// CapturedAt is when the photo was taken, read from its metadata before uploading
+	CapturedAt time.Time `json:"capturedAt,omitempty" example:"2024-06-15T14:30:00Z"`
 }
 
 type photoUploadResponse struct {
@@ -44,11 +51,12 @@ var photoPutObjectConditions = []interface{}{
 // @Router /api/v1/galleries/{galleryId}/photos [post]
 func (a *api) uploadPhotosHandler(ctx *fiber.Ctx) error {
 	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
 	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
 	if err != nil {
 		return NotFound(ctx, err)
 	}
-	gallery, err := a.galleryRepo.GetGallery(ctx.Context(), galleryId, userId)
+	gallery, err := a.galleryRepo.GetGallery(ctx.Context(), galleryId, workspaceId)
 	if err != nil {
 		return ServerError(ctx, err, "Server error while retrieving gallery")
 	}
@@ -65,14 +73,16 @@ func (a *api) uploadPhotosHandler(ctx *fiber.Ctx) error {
 	}
 
 	filenames := make([]string, len(req))
+	newPhotos := make([]domain.NewPhoto, len(req))
 	for i, photo := range req {
 		if photo.OriginalFilename == "" {
 			return BadRequest(ctx, errors.New("empty filename provided"))
 		}
 		filenames[i] = photo.OriginalFilename
+		newPhotos[i] = domain.NewPhoto{OriginalFilename: photo.OriginalFilename, CapturedAt: photo.CapturedAt}
 	}
 
-	photoIds, err := a.photoRepo.CreatePhotos(ctx.Context(), gallery.CollectionId, galleryId, filenames, userId)
+	photoIds, err := a.photoRepo.CreatePhotos(ctx.Context(), gallery.CollectionId, galleryId, newPhotos, workspaceId, userId)
 	if err != nil {
 		return ServerError(ctx, err, "Server error while uploading photos")
 	}
@@ -88,7 +98,7 @@ func (a *api) uploadPhotosHandler(ctx *fiber.Ctx) error {
 
 		postReq, err := aws.PostObjectRequest(objectPath, photoPutObjectConditions)
 		if err != nil {
-			_ = a.photoRepo.DeletePhotos(ctx.Context(), photoIds, userId)
+			_ = a.photoRepo.DeletePhotos(ctx.Context(), photoIds, workspaceId)
 			return ServerError(ctx, err, "Failed to get presigned request")
 		}
 
@@ -121,13 +131,13 @@ type PhotoUploadPayload struct {
 // @Failure 500 {object} fiber.Map "Server error while confirming upload"
 // @Router /api/v1/photos/{photoId}/confirm [put]
 func (a *api) confirmPhotoUploadHandler(ctx *fiber.Ctx) error {
-	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
 	photoId, err := primitive.ObjectIDFromHex(ctx.Params("photoId"))
 	if err != nil {
 		return NotFound(ctx, err)
 	}
 
-	photo, err := a.photoRepo.GetPhoto(ctx.Context(), photoId, userId)
+	photo, err := a.photoRepo.GetPhoto(ctx.Context(), photoId, workspaceId)
 	if err != nil {
 		return NotFound(ctx, err)
 	}
@@ -135,7 +145,7 @@ func (a *api) confirmPhotoUploadHandler(ctx *fiber.Ctx) error {
 	if _, err := aws.ObjectExists(photo.ObjectKey); err != nil {
 		return NotFound(ctx, err)
 	}
-	photo, err = a.photoRepo.UpdatePhoto(ctx.Context(), photoId, domain.PhotoStatus(1), userId)
+	photo, err = a.photoRepo.UpdatePhoto(ctx.Context(), photoId, domain.PhotoStatus(1), workspaceId)
 	if err != nil {
 		return ServerError(ctx, err, "Failed to confirm photo upload")
 	}
@@ -161,29 +171,75 @@ func (a *api) confirmPhotoUploadHandler(ctx *fiber.Ctx) error {
 	message, err := client.SQS.SendLambdaPayload(ctx.Context(), lambdaPayload)
 	if err != nil {
 		log.Printf("Failed to trigger photo processing: %v", err)
+		a.notify(ctx.Context(), &domain.NotificationDB{
+			UserId:      photo.UserId,
+			WorkspaceID: photo.WorkspaceID,
+			Type:        domain.NotificationProcessingFailed,
+			Title:       "Photo processing failed",
+			Body:        fmt.Sprintf("Previews of %s could not be created", photo.OriginalFilename),
+			Data: map[string]string{
+				"galleryId": photo.GalleryId.Hex(),
+				"photoId":   photo.ID.Hex(),
+			},
+		})
 		return err
 	}
 	log.Printf("Photo processing triggered. MessageID: %s", *message.MessageId)
 
+	// the dashboards learn about the previews from the job checking for them
+	job, err := domain.NewPhotoProcessingJob(domain.PhotoProcessingPayload{
+		PhotoId:     photo.ID,
+		WorkspaceId: photo.WorkspaceID,
+	}, time.Now().UTC().Add(photoProcessingCheckDelay))
+	if err == nil {
+		_, err = a.jobRepo.CreateJob(ctx.Context(), job)
+	}
+	if err != nil {
+		log.Printf("Failed to schedule photo processing check: %v", err)
+	}
+
 	return ctx.Status(fiber.StatusOK).JSON(photo)
 }
 
 type getPhotoResponse struct {
-	Id               string             `json:"id"`
-	OriginalFilename string             `json:"originalFilename"`
-	Url              string             `json:"url"`
-	ThumbnailUrl     string             `json:"thumbnailUrl"`
-	Status           domain.PhotoStatus `json:"status"`
-	UpdatedAt        time.Time          `json:"updatedAt"`
-	CreatedAt        time.Time          `json:"createdAt"`
+	Id               string              `json:"id"`
+	OriginalFilename string              `json:"originalFilename"`
+	Url              string              `json:"url"`
+	ThumbnailUrl     string              `json:"thumbnailUrl"`
+	Status           domain.PhotoStatus  `json:"status"`
+	UpdatedAt        time.Time           `json:"updatedAt"`
+	CreatedAt        time.Time           `json:"createdAt"`
+	CapturedAt       time.Time           `json:"capturedAt"`
+	SectionID        *primitive.ObjectID `json:"sectionId,omitempty"`
+	VisibleToClient  bool                `json:"visibleToClient"`
+}
+
+type photoVisibilityRequest struct {
+	Visible bool `json:"visible"`
+}
+
+type photosVisibilityRequest struct {
+	PhotoIDs []string `json:"photoIds"`
+	Visible  bool     `json:"visible"`
+}
+
+type photosVisibilityResponse struct {
+	Updated int64 `json:"updated"`
 }
 
 // @Summary Get gallery photos
-// @Description Retrieves all photos from a specific gallery, including their signed URLs
+// @Description Retrieves a page of photos from a specific gallery in the gallery sort order, including their signed URLs
 // @Tags photos
 // @Accept json
 // @Produce json
 // @Param galleryId path string true "Gallery ID (MongoDB ObjectID)" format(objectid)
+// @Param section query string false "Only photos of the section"
+// @Param sort query string false "Overrides the gallery sort order" Enums(manual, capturedAt, filename)
+// @Param visible query bool false "Only photos shown to or hidden from clients"
+// @Param limit query int false "Page size" default(100) maximum(500)
+// @Param cursor query string false "Cursor from the X-Next-Cursor header of the previous page"
+// @Header 200 {string} X-Next-Cursor "Cursor of the next page, absent on the last page"
+// @Header 200 {int} X-Total-Count "Number of photos on all pages"
 // @Success 200 {array} getPhotoResponse "Array of photos with signed URLs"
 // @Failure 404 {object} fiber.Map "Gallery not found or invalid ID"
 // @Failure 500 {object} fiber.Map "Server error while retrieving photos"
@@ -191,44 +247,75 @@ type getPhotoResponse struct {
 // @Response 200 {object} getPhotoResponse
 // TODO add thumbnail logic
 func (a *api) getPhotosHandler(ctx *fiber.Ctx) error {
-	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
 	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
 	if err != nil {
 		return NotFound(ctx, err)
 	}
-	photos, err := a.photoRepo.GetPhotos(ctx.Context(), galleryId, userId)
+	gallery, err := a.galleryRepo.GetGallery(ctx.Context(), galleryId, workspaceId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return NotFound(ctx, err)
+		}
+		return ServerError(ctx, err, "Failed to get gallery")
+	}
+	filter, err := photoFilterFromQuery(ctx, gallery)
+	if err != nil {
+		return BadRequest(ctx, err)
+	}
+	if sort := domain.PhotoSortOrder(ctx.Query("sort")); sort != "" {
+		if !sort.Valid() {
+			return BadRequest(ctx, errors.New("invalid sort order"))
+		}
+		filter.Sort = sort
+	}
+	if visible := ctx.Query("visible"); visible != "" {
+		v := ctx.QueryBool("visible")
+		filter.VisibleToClient = &v
+	}
+	page, err := a.photoRepo.GetPhotos(ctx.Context(), galleryId, workspaceId, filter)
 	if err != nil {
 		return ServerError(ctx, err, "Failed to get photos")
 	}
+	photos := page.Photos
 
-	res := make([]getPhotoResponse, len(photos))
+	// Sign the urls of the whole page at once, thumbnails are only signed once they were generated
+	thumbnailKeys := make([]string, len(photos))
 	for i, photo := range photos {
-		exists, err := aws.ObjectExists(photo.ThumbnailObjectKey)
-
-		url, err := aws.GetObjectUrl(photo.ObjectKey)
-		if err != nil {
-			return ServerError(ctx, err, "Failed to get photo url")
-		}
-
-		var thumbnailUrl string
-		if exists {
-			thumbnailUrl, err = aws.GetObjectUrl(photo.ThumbnailObjectKey)
-			if err != nil {
-				return ServerError(ctx, err, "Failed to get thumbnail url")
-			}
+		thumbnailKeys[i] = photo.ThumbnailObjectKey
+	}
+	thumbnailExists := aws.ObjectsExist(ctx.Context(), thumbnailKeys)
+	keys := make([]string, 0, 2*len(photos))
+	for i, photo := range photos {
+		if !thumbnailExists[i] {
+			thumbnailKeys[i] = ""
 		}
+		keys = append(keys, photo.ObjectKey, thumbnailKeys[i])
+	}
+	urls, err := aws.GetObjectUrls(ctx.Context(), keys)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to get photo url")
+	}
 
+	res := make([]getPhotoResponse, len(photos))
+	for i, photo := range photos {
 		res[i] = getPhotoResponse{
 			Id:               photo.ID.Hex(),
 			OriginalFilename: photo.OriginalFilename,
-			Url:              url,
-			ThumbnailUrl:     thumbnailUrl,
+			Url:              urls[2*i],
+			ThumbnailUrl:     urls[2*i+1],
 			Status:           photo.Status,
 			UpdatedAt:        photo.UpdatedAt,
 			CreatedAt:        photo.CreatedAt,
+			CapturedAt:       photo.CapturedAt,
+			SectionID:        photo.SectionID,
+			VisibleToClient:  photo.VisibleToClient,
 		}
 	}
 
+	if err := setPhotoPageHeaders(ctx, page); err != nil {
+		return ServerError(ctx, err, "Failed to get photos")
+	}
 	return ctx.Status(fiber.StatusOK).JSON(res)
 }
 
@@ -243,15 +330,88 @@ func (a *api) getPhotosHandler(ctx *fiber.Ctx) error {
 // @Failure 500 {object} fiber.Map "Server error while deleting photo"
 // @Router /api/v1/photos/{photoId} [delete]
 func (a *api) deletePhotoHandler(ctx *fiber.Ctx) error {
-	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
 	photoId, err := primitive.ObjectIDFromHex(ctx.Params("photoId"))
 	if err != nil {
 		return NotFound(ctx, err)
 	}
 
-	err = a.photoRepo.SoftDeletePhoto(ctx.Context(), photoId, userId)
+	err = a.photoRepo.SoftDeletePhoto(ctx.Context(), photoId, workspaceId)
 	if err != nil {
 		return ServerError(ctx, err, "Failed to delete photo")
 	}
 	return ctx.Status(fiber.StatusOK).JSON(nil)
 }
+
+// @Summary Set photo visibility
+// @Description Shows a photo to clients or hides it from them, hidden photos stay in the gallery for the photographer
+// @Tags photos
+// @Accept json
+// @Produce json
+// @Param photoId path string true "Photo ID (MongoDB ObjectID)" format(objectid)
+// @Param request body photoVisibilityRequest true "Visibility"
+// @Success 204
+// @Failure 400 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/photos/{photoId}/visibility [put]
+func (a *api) updatePhotoVisibilityHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	photoId, err := primitive.ObjectIDFromHex(ctx.Params("photoId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+	var req photoVisibilityRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+
+	photo, err := a.photoRepo.GetPhoto(ctx.Context(), photoId, workspaceId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return NotFound(ctx, err)
+		}
+		return ServerError(ctx, err, "Failed to fetch photo")
+	}
+	if _, err := a.photoRepo.SetPhotosVisibility(ctx.Context(), photo.GalleryId, workspaceId, []primitive.ObjectID{photo.ID}, req.Visible); err != nil {
+		return ServerError(ctx, err, "Failed to update photo visibility")
+	}
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// @Summary Set visibility of gallery photos
+// @Description Shows photos of the gallery to clients or hides them from them
+// @Tags photos
+// @Accept json
+// @Produce json
+// @Param galleryId path string true "Gallery ID (MongoDB ObjectID)" format(objectid)
+// @Param request body photosVisibilityRequest true "Photos and visibility"
+// @Success 200 {object} photosVisibilityResponse
+// @Failure 400 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/galleries/{galleryId}/photos/visibility [put]
+func (a *api) updatePhotosVisibilityHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+	var req photosVisibilityRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+	photoIds, err := galleryPhotoIds(req.PhotoIDs)
+	if err != nil {
+		return BadRequest(ctx, err)
+	}
+	if len(photoIds) == 0 {
+		return BadRequest(ctx, errors.New("no photos provided"))
+	}
+
+	updated, err := a.photoRepo.SetPhotosVisibility(ctx.Context(), galleryId, workspaceId, photoIds, req.Visible)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to update photo visibility")
+	}
+	return ctx.JSON(photosVisibilityResponse{Updated: updated})
+}
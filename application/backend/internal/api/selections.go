@@ -0,0 +1,339 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	netmail "net/mail"
+	"path"
+	"strings"
+)
+
+// clientEmailHeader identifies the client making a selection when their session has no verified email, several people
+// choosing photos with the same share token can only be told apart by the email they entered
+const clientEmailHeader = "X-Client-Email"
+
+// @Summary Update gallery proofing
+// @Description Sets how many photos clients have to select in the gallery, 0 means no limit
+// @Tags galleries
+// @Accept json
+// @Produce json
+// @Param galleryId path string true "Gallery ID" example:"671442a11fd0c5eb46b5a3fa"
+// @Param request body domain.Proofing true "Selection limits"
+// @Success 200 {object} domain.GalleryDB
+// @Failure 400 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/galleries/{galleryId}/proofing [put]
+func (a *api) updateGalleryProofingHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+	var req domain.Proofing
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+	if err := req.Validate(); err != nil {
+		return BadRequest(ctx, err)
+	}
+
+	gallery, err := a.galleryRepo.UpdateGallery(ctx.Context(), galleryId, workspaceId, domain.WithProofing(req))
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return NotFound(ctx, err)
+		}
+		return ServerError(ctx, err, "Failed to update gallery proofing")
+	}
+	return ctx.Status(fiber.StatusOK).JSON(gallery)
+}
+
+// @Summary Get gallery selections
+// @Description Gets the photos each client selected in the gallery
+// @Tags galleries
+// @Accept */*
+// @Produce json
+// @Param galleryId path string true "Gallery ID" example:"671442a11fd0c5eb46b5a3fa"
+// @Success 200 {array} domain.SelectionDB
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/galleries/{galleryId}/selections [get]
+func (a *api) getSelectionsHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+
+	selections, err := a.selectionRepo.GetSelections(ctx.Context(), galleryId, workspaceId)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to fetch selections")
+	}
+
+	return ctx.JSON(selections)
+}
+
+// @Summary Export gallery selection
+// @Description Exports the filenames of the photos a client selected, without extensions, so they can be pasted into
+// @Description a Lightroom or Capture One filename search and match both the raw files and the exported ones
+// @Tags galleries
+// @Accept */*
+// @Produce plain
+// @Param galleryId path string true "Gallery ID" example:"671442a11fd0c5eb46b5a3fa"
+// @Param clientEmail query string true "Client email"
+// @Param separator query string false "Separator of filenames" Enums(comma,newline) default(comma)
+// @Success 200 {string} string "IMG_0001, IMG_0002"
+// @Failure 400 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/galleries/{galleryId}/selections/export [get]
+func (a *api) exportSelectionHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+	clientEmail, err := normalizeClientEmail(ctx.Query("clientEmail"))
+	if err != nil {
+		return BadRequest(ctx, err)
+	}
+
+	separator := ", "
+	switch ctx.Query("separator", "comma") {
+	case "comma":
+	case "newline":
+		separator = "\n"
+	default:
+		return BadRequest(ctx, errors.New("invalid separator"))
+	}
+
+	selection, err := a.selectionRepo.GetSelection(ctx.Context(), galleryId, clientEmail)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return NotFound(ctx, err)
+		}
+		return ServerError(ctx, err, "Failed to fetch selection")
+	}
+	if selection.WorkspaceID != workspaceId {
+		return NotFound(ctx, errors.New("selection not found"))
+	}
+
+	photos, err := a.photoRepo.GetPhotosByIds(ctx.Context(), selection.PhotoIDs, workspaceId)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to fetch photos")
+	}
+
+	ctx.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+	return ctx.SendString(strings.Join(selectionFilenames(selection, photos), separator))
+}
+
+// @Summary Get selection (client access)
+// @Description Gets the photos the client selected in the gallery
+// @Tags client
+// @Accept */*
+// @Produce json
+// @Param galleryId path string true "Gallery ID"
+// @Param Authorization header string true "Bearer {access_token}"
+// @Param X-Client-Email header string false "Client email, required unless the session has a verified email"
+// @Success 200 {object} domain.SelectionDB
+// @Failure 400 {object} fiber.Map
+// @Failure 401 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/client/galleries/{galleryId}/selection [get]
+func (a *api) clientGetSelectionHandler(ctx *fiber.Ctx) error {
+	gallery := ctx.Locals("gallery").(domain.GalleryDB)
+	clientEmail, err := requestClientEmail(ctx)
+	if err != nil {
+		return BadRequest(ctx, err)
+	}
+
+	selection, err := a.selectionRepo.GetSelection(ctx.Context(), gallery.ID, clientEmail)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return ServerError(ctx, err, "Failed to fetch selection")
+		}
+		// Nothing selected yet
+		selection = domain.SelectionDB{
+			GalleryID:   gallery.ID,
+			ClientEmail: clientEmail,
+			PhotoIDs:    make([]primitive.ObjectID, 0),
+		}
+	}
+
+	return ctx.JSON(selection)
+}
+
+// @Summary Select photo (client access)
+// @Description Adds a photo to the client's selection
+// @Tags client
+// @Accept */*
+// @Produce json
+// @Param galleryId path string true "Gallery ID"
+// @Param photoId path string true "Photo ID"
+// @Param Authorization header string true "Bearer {access_token}"
+// @Param X-Client-Email header string false "Client email, required unless the session has a verified email"
+// @Success 200 {object} domain.SelectionDB
+// @Failure 400 {object} fiber.Map
+// @Failure 401 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 409 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/client/galleries/{galleryId}/selection/photos/{photoId} [put]
+func (a *api) clientSelectPhotoHandler(ctx *fiber.Ctx) error {
+	gallery := ctx.Locals("gallery").(domain.GalleryDB)
+	clientEmail, err := requestClientEmail(ctx)
+	if err != nil {
+		return BadRequest(ctx, err)
+	}
+	photoId, err := primitive.ObjectIDFromHex(ctx.Params("photoId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+
+	photo, err := a.photoRepo.GetSharedPhotoById(ctx.Context(), photoId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return NotFound(ctx, err)
+		}
+		return ServerError(ctx, err, "Failed to fetch photo")
+	}
+	if photo.GalleryId != gallery.ID {
+		return NotFound(ctx, errors.New("photo not found in this gallery"))
+	}
+
+	selection, err := a.selectionRepo.AddPhoto(ctx.Context(), gallery, clientEmail, photoId)
+	if err != nil {
+		return selectionError(ctx, err)
+	}
+
+	return ctx.JSON(selection)
+}
+
+// @Summary Deselect photo (client access)
+// @Description Removes a photo from the client's selection
+// @Tags client
+// @Accept */*
+// @Produce json
+// @Param galleryId path string true "Gallery ID"
+// @Param photoId path string true "Photo ID"
+// @Param Authorization header string true "Bearer {access_token}"
+// @Param X-Client-Email header string false "Client email, required unless the session has a verified email"
+// @Success 200 {object} domain.SelectionDB
+// @Failure 400 {object} fiber.Map
+// @Failure 401 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 409 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/client/galleries/{galleryId}/selection/photos/{photoId} [delete]
+func (a *api) clientDeselectPhotoHandler(ctx *fiber.Ctx) error {
+	gallery := ctx.Locals("gallery").(domain.GalleryDB)
+	clientEmail, err := requestClientEmail(ctx)
+	if err != nil {
+		return BadRequest(ctx, err)
+	}
+	photoId, err := primitive.ObjectIDFromHex(ctx.Params("photoId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+
+	selection, err := a.selectionRepo.RemovePhoto(ctx.Context(), gallery.ID, clientEmail, photoId)
+	if err != nil {
+		return selectionError(ctx, err)
+	}
+
+	return ctx.JSON(selection)
+}
+
+// @Summary Submit selection (client access)
+// @Description Confirms the client's selection, it has to satisfy the gallery selection limits and can not be changed afterwards
+// @Tags client
+// @Accept */*
+// @Produce json
+// @Param galleryId path string true "Gallery ID"
+// @Param Authorization header string true "Bearer {access_token}"
+// @Param X-Client-Email header string false "Client email, required unless the session has a verified email"
+// @Success 200 {object} domain.SelectionDB
+// @Failure 400 {object} fiber.Map
+// @Failure 401 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 409 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/client/galleries/{galleryId}/selection/submit [post]
+func (a *api) clientSubmitSelectionHandler(ctx *fiber.Ctx) error {
+	gallery := ctx.Locals("gallery").(domain.GalleryDB)
+	clientEmail, err := requestClientEmail(ctx)
+	if err != nil {
+		return BadRequest(ctx, err)
+	}
+
+	selection, err := a.selectionRepo.GetSelection(ctx.Context(), gallery.ID, clientEmail)
+	if err != nil {
+		return selectionError(ctx, err)
+	}
+	if err := gallery.Proofing.CheckSelection(len(selection.PhotoIDs)); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	selection, err = a.selectionRepo.SubmitSelection(ctx.Context(), gallery.ID, clientEmail)
+	if err != nil {
+		return selectionError(ctx, err)
+	}
+
+	a.notify(ctx.Context(), &domain.NotificationDB{
+		UserId:      gallery.UserId,
+		WorkspaceID: gallery.WorkspaceID,
+		Type:        domain.NotificationSelectionSubmitted,
+		Title:       "Selection submitted",
+		Body:        fmt.Sprintf("%s selected %d photos in %s", clientEmail, len(selection.PhotoIDs), gallery.Name),
+		Data: map[string]string{
+			"galleryId": gallery.ID.Hex(),
+		},
+	})
+
+	return ctx.JSON(selection)
+}
+
+func normalizeClientEmail(email string) (string, error) {
+	address, err := netmail.ParseAddress(strings.TrimSpace(email))
+	if err != nil {
+		return "", errors.New("invalid client email")
+	}
+	return strings.ToLower(address.Address), nil
+}
+
+func selectionError(ctx *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return NotFound(ctx, err)
+	case errors.Is(err, domain.ErrSelectionSubmitted):
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Selection was already submitted"})
+	case errors.Is(err, domain.ErrSelectionLimitReached):
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Selection limit reached"})
+	default:
+		return ServerError(ctx, err, "Failed to update selection")
+	}
+}
+
+// selectionFilenames returns the original filenames without extension in the order the photos were selected
+func selectionFilenames(selection domain.SelectionDB, photos []domain.PhotoDB) []string {
+	byId := make(map[primitive.ObjectID]domain.PhotoDB, len(photos))
+	for _, photo := range photos {
+		byId[photo.ID] = photo
+	}
+
+	filenames := make([]string, 0, len(selection.PhotoIDs))
+	for _, photoId := range selection.PhotoIDs {
+		photo, ok := byId[photoId]
+		if !ok {
+			// Deleted after it was selected
+			continue
+		}
+		name := path.Base(photo.OriginalFilename)
+		filenames = append(filenames, strings.TrimSuffix(name, path.Ext(name)))
+	}
+	return filenames
+}
@@ -5,13 +5,14 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/michalK00/halftone/internal/domain"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"os"
 	"time"
 )
 
 type shareGalleryRequest struct {
 	// example: "2024-12-31T23:59:59Z"
 	SharingExpiry time.Time `json:"sharingExpiry"`
+	// Password optionally protects the gallery with a password or PIN
+	Password string `json:"password,omitempty" example:"1234"`
 }
 
 type shareGalleryResponse struct {
@@ -35,7 +36,7 @@ type shareGalleryResponse struct {
 // @Failure 500 {object} map[string]string "Server error"
 // @Router /api/v1/galleries/{galleryId}/sharing/share [post]
 func (a *api) shareGalleryHandler(ctx *fiber.Ctx) error {
-	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
 	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
 	if err != nil {
 		return NotFound(ctx, err)
@@ -48,7 +49,7 @@ func (a *api) shareGalleryHandler(ctx *fiber.Ctx) error {
 		return BadRequest(ctx, fmt.Errorf("sharing expiry date invalid"))
 	}
 
-	gallery, err := a.galleryRepo.GetGallery(ctx.Context(), galleryId, userId)
+	gallery, err := a.galleryRepo.GetGallery(ctx.Context(), galleryId, workspaceId)
 	if err != nil {
 		return NotFound(ctx, err)
 	}
@@ -56,14 +57,23 @@ func (a *api) shareGalleryHandler(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusMethodNotAllowed).JSON(fiber.Map{"message": "Sharing already active"})
 	}
 
+	var passwordHash string
+	if req.Password != "" {
+		passwordHash, err = domain.HashSharePassword(req.Password)
+		if err != nil {
+			return BadRequest(ctx, err)
+		}
+	}
+
 	accessToken, err := domain.GenerateAccessToken()
 
-	_, err = a.galleryRepo.UpdateGallery(ctx.Context(), galleryId, userId,
+	_, err = a.galleryRepo.UpdateGallery(ctx.Context(), galleryId, workspaceId,
 		domain.WithSharing(domain.Sharing{
 			SharingEnabled:    true,
 			SharingExpiryDate: req.SharingExpiry,
 			AccessToken:       accessToken,
-			SharingUrl:        fmt.Sprintf("%s/galleries/%s?token=%s", os.Getenv("FRONTEND_ORIGIN"), galleryId.Hex(), accessToken),
+			SharingUrl:        shareUrl(galleryId, accessToken),
+			PasswordHash:      passwordHash,
 		}),
 	)
 	if err != nil {
@@ -73,7 +83,7 @@ func (a *api) shareGalleryHandler(ctx *fiber.Ctx) error {
 	return ctx.Status(fiber.StatusOK).JSON(shareGalleryResponse{
 		GalleryId:     galleryId.Hex(),
 		AccessToken:   accessToken,
-		ShareUrl:      fmt.Sprintf("%s/galleries/%s?token=%s", os.Getenv("FRONTEND_ORIGIN"), galleryId.Hex(), accessToken),
+		ShareUrl:      shareUrl(galleryId, accessToken),
 		SharingExpiry: req.SharingExpiry,
 	})
 }
@@ -96,7 +106,7 @@ type rescheduleGallerySharingRequest struct {
 // @Failure 500 {object} map[string]string "Server error"
 // @Router /api/v1/galleries/{galleryId}/sharing/reschedule [put]
 func (a *api) rescheduleGallerySharingHandler(ctx *fiber.Ctx) error {
-	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
 	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
 	if err != nil {
 		return NotFound(ctx, err)
@@ -109,7 +119,7 @@ func (a *api) rescheduleGallerySharingHandler(ctx *fiber.Ctx) error {
 		return BadRequest(ctx, fmt.Errorf("sharing expiry date invalid"))
 	}
 
-	gallery, err := a.galleryRepo.GetGallery(ctx.Context(), galleryId, userId)
+	gallery, err := a.galleryRepo.GetGallery(ctx.Context(), galleryId, workspaceId)
 	if err != nil {
 		return NotFound(ctx, err)
 	}
@@ -117,12 +127,13 @@ func (a *api) rescheduleGallerySharingHandler(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusMethodNotAllowed).JSON(fiber.Map{"message": "Sharing already inactive"})
 	}
 
-	_, err = a.galleryRepo.UpdateGallery(ctx.Context(), galleryId, userId, domain.WithSharing(
+	_, err = a.galleryRepo.UpdateGallery(ctx.Context(), galleryId, workspaceId, domain.WithSharing(
 		domain.Sharing{
 			SharingEnabled:    true,
 			SharingExpiryDate: req.SharingExpiry,
 			AccessToken:       gallery.Sharing.AccessToken,
-			SharingUrl:        fmt.Sprintf("%s/galleries/%s?token=%s", os.Getenv("FRONTEND_ORIGIN"), galleryId.Hex(), gallery.Sharing.AccessToken),
+			SharingUrl:        shareUrl(galleryId, gallery.Sharing.AccessToken),
+			PasswordHash:      gallery.Sharing.PasswordHash,
 		}))
 	if err != nil {
 		return ServerError(ctx, err, "Failed to update gallery")
@@ -131,7 +142,7 @@ func (a *api) rescheduleGallerySharingHandler(ctx *fiber.Ctx) error {
 	return ctx.Status(fiber.StatusOK).JSON(shareGalleryResponse{
 		GalleryId:     galleryId.Hex(),
 		AccessToken:   gallery.Sharing.AccessToken,
-		ShareUrl:      fmt.Sprintf("%s/galleries/%s?token=%s", os.Getenv("FRONTEND_ORIGIN"), galleryId.Hex(), gallery.Sharing.AccessToken),
+		ShareUrl:      shareUrl(galleryId, gallery.Sharing.AccessToken),
 		SharingExpiry: req.SharingExpiry,
 	})
 }
@@ -148,12 +159,12 @@ func (a *api) rescheduleGallerySharingHandler(ctx *fiber.Ctx) error {
 // @Failure 500 {object} map[string]string "Server error"
 // @Router /api/v1/galleries/{galleryId}/sharing/stop [put]
 func (a *api) stopSharingGalleryHandler(ctx *fiber.Ctx) error {
-	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
 	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
 	if err != nil {
 		return NotFound(ctx, err)
 	}
-	gallery, err := a.galleryRepo.GetGallery(ctx.Context(), galleryId, userId)
+	gallery, err := a.galleryRepo.GetGallery(ctx.Context(), galleryId, workspaceId)
 	if err != nil {
 		return NotFound(ctx, err)
 	}
@@ -162,7 +173,7 @@ func (a *api) stopSharingGalleryHandler(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusMethodNotAllowed).JSON(fiber.Map{"message": "Sharing already inactive"})
 	}
 
-	gallery, err = a.galleryRepo.UpdateGallery(ctx.Context(), galleryId, userId, domain.WithSharing(
+	gallery, err = a.galleryRepo.UpdateGallery(ctx.Context(), galleryId, workspaceId, domain.WithSharing(
 		domain.Sharing{
 			SharingEnabled:    false,
 			SharingExpiryDate: time.Time{},
@@ -174,6 +185,55 @@ func (a *api) stopSharingGalleryHandler(ctx *fiber.Ctx) error {
 	return ctx.Status(fiber.StatusOK).JSON(gallery)
 }
 
+// @Summary Set gallery sharing password
+// @Description Protects the shared gallery with a password or PIN, an empty password removes the protection
+// @Tags gallery sharing
+// @Accept json
+// @Produce json
+// @Param galleryId path string true "Gallery ID" format(objectId)
+// @Param request body sharePasswordRequest true "Password"
+// @Success 200 {object} domain.GalleryDB
+// @Failure 400 {object} map[string]string "Invalid password"
+// @Failure 404 {object} map[string]string "Gallery not found"
+// @Failure 405 {object} map[string]string "Sharing inactive"
+// @Failure 500 {object} map[string]string "Server error"
+// @Router /api/v1/galleries/{galleryId}/sharing/password [put]
+func (a *api) setSharingPasswordHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+	var req sharePasswordRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+
+	gallery, err := a.galleryRepo.GetGallery(ctx.Context(), galleryId, workspaceId)
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+	if sharingExpiryDatePastDue(gallery.Sharing.SharingExpiryDate) {
+		return ctx.Status(fiber.StatusMethodNotAllowed).JSON(fiber.Map{"message": "Sharing inactive"})
+	}
+
+	sharing := gallery.Sharing
+	sharing.PasswordHash = ""
+	if req.Password != "" {
+		sharing.PasswordHash, err = domain.HashSharePassword(req.Password)
+		if err != nil {
+			return BadRequest(ctx, err)
+		}
+	}
+
+	gallery, err = a.galleryRepo.UpdateGallery(ctx.Context(), galleryId, workspaceId, domain.WithSharing(sharing))
+	if err != nil {
+		return ServerError(ctx, err, "Failed to update gallery")
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(gallery)
+}
+
 func validateSharingExpiryDate(expiryDate time.Time) bool {
 	return !expiryDate.IsZero() && !expiryDate.Before(time.Now().UTC())
 }
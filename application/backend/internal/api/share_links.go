@@ -0,0 +1,280 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"os"
+	"strings"
+	"time"
+)
+
+type shareLinkRequest struct {
+	Label       string                  `json:"label" example:"Wedding guests"`
+	Permissions domain.SharePermissions `json:"permissions"`
+	// example: "2024-12-31T23:59:59Z"
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+	MaxUses   int64     `json:"maxUses" example:"100"`
+	// RequireEmail makes clients verify their email with a one-time code or magic link
+	RequireEmail bool `json:"requireEmail"`
+	// Password protects a new link with a password or PIN, use the password endpoint to change it later
+	Password string `json:"password,omitempty" example:"1234"`
+}
+
+type sharePasswordRequest struct {
+	// Password or PIN, empty removes the protection
+	Password string `json:"password" example:"1234"`
+}
+
+// @Summary Get share links
+// @Description Gets all share links of a gallery, including revoked ones
+// @Tags gallery sharing
+// @Accept */*
+// @Produce json
+// @Param galleryId path string true "Gallery ID" example:"671442a11fd0c5eb46b5a3fa"
+// @Success 200 {array} domain.ShareLinkDB
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/galleries/{galleryId}/links [get]
+func (a *api) getShareLinksHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+
+	links, err := a.shareLinkRepo.GetShareLinks(ctx.Context(), galleryId, workspaceId)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to fetch share links")
+	}
+
+	return ctx.JSON(links)
+}
+
+// @Summary Create share link
+// @Description Creates a named link to the gallery with its own permissions, expiry and usage limit
+// @Tags gallery sharing
+// @Accept json
+// @Produce json
+// @Param galleryId path string true "Gallery ID" example:"671442a11fd0c5eb46b5a3fa"
+// @Param request body shareLinkRequest true "Share link"
+// @Success 201 {object} domain.ShareLinkDB
+// @Failure 400 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/galleries/{galleryId}/links [post]
+func (a *api) createShareLinkHandler(ctx *fiber.Ctx) error {
+	userId := ctx.Locals("userId").(string)
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+
+	var req shareLinkRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+	if err := req.validate(); err != nil {
+		return BadRequest(ctx, err)
+	}
+
+	exists, err := a.galleryRepo.GalleryExists(ctx.Context(), galleryId, workspaceId)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to fetch gallery")
+	}
+	if !exists {
+		return NotFound(ctx, errors.New("gallery not found"))
+	}
+
+	token, err := domain.GenerateAccessToken()
+	if err != nil {
+		return ServerError(ctx, err, "Failed to generate token")
+	}
+	var passwordHash string
+	if req.Password != "" {
+		passwordHash, err = domain.HashSharePassword(req.Password)
+		if err != nil {
+			return BadRequest(ctx, err)
+		}
+	}
+	link := domain.ShareLinkDB{
+		GalleryID:    galleryId,
+		UserId:       userId,
+		WorkspaceID:  workspaceId,
+		Label:        strings.TrimSpace(req.Label),
+		Token:        token,
+		Url:          shareUrl(galleryId, token),
+		Permissions:  req.Permissions,
+		ExpiresAt:    req.ExpiresAt,
+		MaxUses:      req.MaxUses,
+		PasswordHash: passwordHash,
+		Protected:    passwordHash != "",
+		RequireEmail: req.RequireEmail,
+	}
+	if _, err := a.shareLinkRepo.CreateShareLink(ctx.Context(), &link); err != nil {
+		return ServerError(ctx, err, "Failed to create share link")
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(link)
+}
+
+// @Summary Update share link
+// @Description Updates the label, permissions, expiry, usage limit and email requirement of a share link
+// @Tags gallery sharing
+// @Accept json
+// @Produce json
+// @Param galleryId path string true "Gallery ID" example:"671442a11fd0c5eb46b5a3fa"
+// @Param linkId path string true "Share link ID"
+// @Param request body shareLinkRequest true "Share link"
+// @Success 200 {object} domain.ShareLinkDB
+// @Failure 400 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/galleries/{galleryId}/links/{linkId} [put]
+func (a *api) updateShareLinkHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	link, ok, err := a.ownedShareLink(ctx, workspaceId)
+	if !ok {
+		return err
+	}
+
+	var req shareLinkRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+	if err := req.validate(); err != nil {
+		return BadRequest(ctx, err)
+	}
+
+	link, err = a.shareLinkRepo.UpdateShareLink(ctx.Context(), link.ID, workspaceId,
+		domain.WithShareLinkLabel(strings.TrimSpace(req.Label)),
+		domain.WithShareLinkPermissions(req.Permissions),
+		domain.WithShareLinkExpiry(req.ExpiresAt),
+		domain.WithShareLinkMaxUses(req.MaxUses),
+		domain.WithShareLinkRequireEmail(req.RequireEmail),
+	)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to update share link")
+	}
+
+	return ctx.JSON(link)
+}
+
+// @Summary Revoke share link
+// @Description Immediately stops access through the link, other links of the gallery keep working
+// @Tags gallery sharing
+// @Accept */*
+// @Produce json
+// @Param galleryId path string true "Gallery ID" example:"671442a11fd0c5eb46b5a3fa"
+// @Param linkId path string true "Share link ID"
+// @Success 200 {object} domain.ShareLinkDB
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/galleries/{galleryId}/links/{linkId}/revoke [put]
+func (a *api) revokeShareLinkHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	link, ok, err := a.ownedShareLink(ctx, workspaceId)
+	if !ok {
+		return err
+	}
+
+	link, err = a.shareLinkRepo.RevokeShareLink(ctx.Context(), link.ID, workspaceId)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to revoke share link")
+	}
+
+	return ctx.JSON(link)
+}
+
+// @Summary Set share link password
+// @Description Protects the link with a password or PIN, clients have to unlock the gallery before accessing it.
+// @Description An empty password removes the protection.
+// @Tags gallery sharing
+// @Accept json
+// @Produce json
+// @Param galleryId path string true "Gallery ID" example:"671442a11fd0c5eb46b5a3fa"
+// @Param linkId path string true "Share link ID"
+// @Param request body sharePasswordRequest true "Password"
+// @Success 200 {object} domain.ShareLinkDB
+// @Failure 400 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/galleries/{galleryId}/links/{linkId}/password [put]
+func (a *api) setShareLinkPasswordHandler(ctx *fiber.Ctx) error {
+	workspaceId := ctx.Locals("workspaceId").(primitive.ObjectID)
+	link, ok, err := a.ownedShareLink(ctx, workspaceId)
+	if !ok {
+		return err
+	}
+
+	var req sharePasswordRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+	var passwordHash string
+	if req.Password != "" {
+		passwordHash, err = domain.HashSharePassword(req.Password)
+		if err != nil {
+			return BadRequest(ctx, err)
+		}
+	}
+
+	link, err = a.shareLinkRepo.UpdateShareLink(ctx.Context(), link.ID, workspaceId, domain.WithShareLinkPassword(passwordHash))
+	if err != nil {
+		return ServerError(ctx, err, "Failed to update share link")
+	}
+
+	return ctx.JSON(link)
+}
+
+// ownedShareLink loads the share link from the path if it belongs to the gallery and the user, ok and err behave like
+// in ownedOrder.
+func (a *api) ownedShareLink(ctx *fiber.Ctx, workspaceId primitive.ObjectID) (domain.ShareLinkDB, bool, error) {
+	galleryId, err := primitive.ObjectIDFromHex(ctx.Params("galleryId"))
+	if err != nil {
+		return domain.ShareLinkDB{}, false, NotFound(ctx, err)
+	}
+	linkId, err := primitive.ObjectIDFromHex(ctx.Params("linkId"))
+	if err != nil {
+		return domain.ShareLinkDB{}, false, NotFound(ctx, err)
+	}
+
+	link, err := a.shareLinkRepo.GetShareLink(ctx.Context(), linkId, workspaceId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return domain.ShareLinkDB{}, false, NotFound(ctx, err)
+		}
+		return domain.ShareLinkDB{}, false, ServerError(ctx, err, "Failed to fetch share link")
+	}
+	if link.GalleryID != galleryId {
+		return domain.ShareLinkDB{}, false, NotFound(ctx, errors.New("share link not found in this gallery"))
+	}
+	return link, true, nil
+}
+
+func (r shareLinkRequest) validate() error {
+	if strings.TrimSpace(r.Label) == "" {
+		return errors.New("label is required")
+	}
+	if !r.ExpiresAt.IsZero() && !validateSharingExpiryDate(r.ExpiresAt) {
+		return errors.New("expiry date invalid")
+	}
+	if r.MaxUses < 0 {
+		return errors.New("max uses can not be negative")
+	}
+	return nil
+}
+
+func shareUrl(galleryId primitive.ObjectID, token string) string {
+	return fmt.Sprintf("%s/galleries/%s?token=%s", os.Getenv("FRONTEND_ORIGIN"), galleryId.Hex(), token)
+}
+
+// clientPermissions returns the permissions of the share link the client authenticated with
+func clientPermissions(ctx *fiber.Ctx) domain.SharePermissions {
+	permissions, _ := ctx.Locals("permissions").(domain.SharePermissions)
+	return permissions
+}
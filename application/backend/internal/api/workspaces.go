@@ -0,0 +1,492 @@
+package api
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/url"
+	"time"
+)
+
+type workspaceRequest struct {
+	Name string `json:"name" example:"Studio North"`
+}
+
+type inviteWorkspaceMemberRequest struct {
+	Email string               `json:"email" example:"editor@example.com"`
+	Role  domain.WorkspaceRole `json:"role" example:"editor"`
+}
+
+type updateWorkspaceMemberRequest struct {
+	Role domain.WorkspaceRole `json:"role" example:"admin"`
+}
+
+// @Summary Get workspaces
+// @Description Gets the workspaces the user is a member of, the personal workspace first
+// @Tags workspaces
+// @Accept */*
+// @Produce json
+// @Success 200 {array} domain.WorkspaceDB
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/workspaces [get]
+func (a *api) getWorkspacesHandler(ctx *fiber.Ctx) error {
+	userId := ctx.Locals("userId").(string)
+
+	// Make sure the personal workspace is listed before the user created any data
+	if _, err := a.workspaceRepo.GetPersonalWorkspace(ctx.Context(), userId); err != nil {
+		return ServerError(ctx, err, "Failed to fetch workspaces")
+	}
+	workspaces, err := a.workspaceRepo.GetWorkspaces(ctx.Context(), userId)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to fetch workspaces")
+	}
+
+	return ctx.JSON(workspaces)
+}
+
+// @Summary Create workspace
+// @Description Creates a workspace shared with the members invited to it, the user becomes its owner
+// @Tags workspaces
+// @Accept json
+// @Produce json
+// @Param request body workspaceRequest true "Workspace to create"
+// @Success 201 {object} domain.WorkspaceDB
+// @Failure 400 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/workspaces [post]
+func (a *api) createWorkspaceHandler(ctx *fiber.Ctx) error {
+	userId := ctx.Locals("userId").(string)
+
+	var req workspaceRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+	name, err := domain.NormalizeWorkspaceName(req.Name)
+	if err != nil {
+		return BadRequest(ctx, err)
+	}
+
+	email, _ := userEmail(ctx)
+	workspace, err := a.workspaceRepo.CreateWorkspace(ctx.Context(), name, userId, email)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to create workspace")
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(workspace)
+}
+
+// @Summary Get workspace
+// @Description Gets a workspace with its members and pending invitations
+// @Tags workspaces
+// @Accept */*
+// @Produce json
+// @Param workspaceId path string true "Workspace ID"
+// @Success 200 {object} domain.WorkspaceDB
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/workspaces/{workspaceId} [get]
+func (a *api) getWorkspaceHandler(ctx *fiber.Ctx) error {
+	workspace, ok, err := a.memberWorkspace(ctx, domain.RoleViewer)
+	if !ok {
+		return err
+	}
+
+	return ctx.JSON(workspace)
+}
+
+// @Summary Rename workspace
+// @Description Renames a workspace, requires the owner role
+// @Tags workspaces
+// @Accept json
+// @Produce json
+// @Param workspaceId path string true "Workspace ID"
+// @Param request body workspaceRequest true "New name"
+// @Success 200 {object} domain.WorkspaceDB
+// @Failure 400 {object} fiber.Map
+// @Failure 403 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/workspaces/{workspaceId} [put]
+func (a *api) renameWorkspaceHandler(ctx *fiber.Ctx) error {
+	workspace, ok, err := a.memberWorkspace(ctx, domain.RoleOwner)
+	if !ok {
+		return err
+	}
+
+	var req workspaceRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+	name, err := domain.NormalizeWorkspaceName(req.Name)
+	if err != nil {
+		return BadRequest(ctx, err)
+	}
+
+	workspace, err = a.workspaceRepo.RenameWorkspace(ctx.Context(), workspace.ID, name)
+	if err != nil {
+		return workspaceError(ctx, err)
+	}
+
+	return ctx.JSON(workspace)
+}
+
+// @Summary Delete workspace
+// @Description Deletes a shared workspace once its collections and coupons were deleted, requires the owner role
+// @Tags workspaces
+// @Accept */*
+// @Produce json
+// @Param workspaceId path string true "Workspace ID"
+// @Success 204
+// @Failure 403 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 409 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/workspaces/{workspaceId} [delete]
+func (a *api) deleteWorkspaceHandler(ctx *fiber.Ctx) error {
+	workspace, ok, err := a.memberWorkspace(ctx, domain.RoleOwner)
+	if !ok {
+		return err
+	}
+	if workspace.Personal {
+		return workspaceError(ctx, domain.ErrPersonalWorkspace)
+	}
+
+	collections, err := a.collectionRepo.GetCollections(ctx.Context(), workspace.ID)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to fetch collections")
+	}
+	coupons, err := a.couponRepo.GetCoupons(ctx.Context(), workspace.ID)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to fetch coupons")
+	}
+	if len(collections) > 0 || len(coupons) > 0 {
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Workspace still has collections or coupons"})
+	}
+
+	if err := a.workspaceRepo.DeleteWorkspace(ctx.Context(), workspace.ID); err != nil {
+		return workspaceError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// @Summary Invite workspace member
+// @Description Invites an email to the workspace with a role, inviting it again replaces the role. Requires the admin
+// @Description role, only owners can invite owners.
+// @Tags workspaces
+// @Accept json
+// @Produce json
+// @Param workspaceId path string true "Workspace ID"
+// @Param request body inviteWorkspaceMemberRequest true "Invitation"
+// @Success 201 {object} domain.WorkspaceDB
+// @Failure 400 {object} fiber.Map
+// @Failure 403 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 409 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/workspaces/{workspaceId}/invitations [post]
+func (a *api) inviteWorkspaceMemberHandler(ctx *fiber.Ctx) error {
+	userId := ctx.Locals("userId").(string)
+	workspace, ok, err := a.memberWorkspace(ctx, domain.RoleAdmin)
+	if !ok {
+		return err
+	}
+	if workspace.Personal {
+		return workspaceError(ctx, domain.ErrPersonalWorkspace)
+	}
+
+	var req inviteWorkspaceMemberRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+	email, err := normalizeClientEmail(req.Email)
+	if err != nil {
+		return BadRequest(ctx, err)
+	}
+	if ok, err := canGrantRole(ctx, workspace, req.Role); !ok {
+		return err
+	}
+
+	workspace, err = a.workspaceRepo.InviteMember(ctx.Context(), workspace.ID, domain.WorkspaceInvitation{
+		Email:     email,
+		Role:      req.Role,
+		InvitedBy: userId,
+		InvitedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return workspaceError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(workspace)
+}
+
+// @Summary Cancel workspace invitation
+// @Description Cancels the pending invitation of an email, requires the admin role
+// @Tags workspaces
+// @Accept */*
+// @Produce json
+// @Param workspaceId path string true "Workspace ID"
+// @Param email path string true "Invited email"
+// @Success 200 {object} domain.WorkspaceDB
+// @Failure 403 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/workspaces/{workspaceId}/invitations/{email} [delete]
+func (a *api) cancelWorkspaceInvitationHandler(ctx *fiber.Ctx) error {
+	workspace, ok, err := a.memberWorkspace(ctx, domain.RoleAdmin)
+	if !ok {
+		return err
+	}
+
+	param, err := url.PathUnescape(ctx.Params("email"))
+	if err != nil {
+		return BadRequest(ctx, err)
+	}
+	email, err := normalizeClientEmail(param)
+	if err != nil {
+		return BadRequest(ctx, err)
+	}
+
+	workspace, err = a.workspaceRepo.CancelInvitation(ctx.Context(), workspace.ID, email)
+	if err != nil {
+		return workspaceError(ctx, err)
+	}
+
+	return ctx.JSON(workspace)
+}
+
+// @Summary Get workspace invitations
+// @Description Gets the workspaces the email of the signed in user was invited to, requires an ID token with a verified
+// @Description email
+// @Tags workspaces
+// @Accept */*
+// @Produce json
+// @Success 200 {array} domain.WorkspaceDB
+// @Failure 403 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/workspaces/invitations [get]
+func (a *api) getWorkspaceInvitationsHandler(ctx *fiber.Ctx) error {
+	email, ok := userEmail(ctx)
+	if !ok {
+		return emailRequired(ctx)
+	}
+
+	workspaces, err := a.workspaceRepo.GetInvitations(ctx.Context(), email)
+	if err != nil {
+		return ServerError(ctx, err, "Failed to fetch invitations")
+	}
+
+	return ctx.JSON(workspaces)
+}
+
+// @Summary Accept workspace invitation
+// @Description Joins the workspace the email of the signed in user was invited to, with the invited role
+// @Tags workspaces
+// @Accept */*
+// @Produce json
+// @Param workspaceId path string true "Workspace ID"
+// @Success 200 {object} domain.WorkspaceDB
+// @Failure 403 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 409 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/workspaces/{workspaceId}/invitations/accept [post]
+func (a *api) acceptWorkspaceInvitationHandler(ctx *fiber.Ctx) error {
+	userId := ctx.Locals("userId").(string)
+	workspaceId, err := primitive.ObjectIDFromHex(ctx.Params("workspaceId"))
+	if err != nil {
+		return NotFound(ctx, err)
+	}
+	email, ok := userEmail(ctx)
+	if !ok {
+		return emailRequired(ctx)
+	}
+
+	workspace, err := a.workspaceRepo.AcceptInvitation(ctx.Context(), workspaceId, email, userId)
+	if err != nil {
+		return workspaceError(ctx, err)
+	}
+
+	return ctx.JSON(workspace)
+}
+
+// @Summary Update workspace member
+// @Description Changes the role of a member, requires the admin role. Only owners can grant or take the owner role
+// @Description and the last owner can not be demoted.
+// @Tags workspaces
+// @Accept json
+// @Produce json
+// @Param workspaceId path string true "Workspace ID"
+// @Param userId path string true "Member user ID"
+// @Param request body updateWorkspaceMemberRequest true "New role"
+// @Success 200 {object} domain.WorkspaceDB
+// @Failure 400 {object} fiber.Map
+// @Failure 403 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 409 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/workspaces/{workspaceId}/members/{userId} [put]
+func (a *api) updateWorkspaceMemberHandler(ctx *fiber.Ctx) error {
+	workspace, ok, err := a.memberWorkspace(ctx, domain.RoleAdmin)
+	if !ok {
+		return err
+	}
+	memberId := ctx.Params("userId")
+	current, ok := workspace.Role(memberId)
+	if !ok {
+		return NotFound(ctx, errors.New("member not found"))
+	}
+
+	var req updateWorkspaceMemberRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequest(ctx, err)
+	}
+	if ok, err := canGrantRole(ctx, workspace, req.Role); !ok {
+		return err
+	}
+	if ok, err := canGrantRole(ctx, workspace, current); !ok {
+		return err
+	}
+
+	workspace, err = a.workspaceRepo.UpdateMemberRole(ctx.Context(), workspace.ID, memberId, req.Role)
+	if err != nil {
+		return workspaceError(ctx, err)
+	}
+
+	return ctx.JSON(workspace)
+}
+
+// @Summary Remove workspace member
+// @Description Removes a member from the workspace, requires the admin role unless members leave on their own. Only
+// @Description owners can remove owners and the last owner can not leave.
+// @Tags workspaces
+// @Accept */*
+// @Produce json
+// @Param workspaceId path string true "Workspace ID"
+// @Param userId path string true "Member user ID"
+// @Success 200 {object} domain.WorkspaceDB
+// @Failure 403 {object} fiber.Map
+// @Failure 404 {object} fiber.Map
+// @Failure 409 {object} fiber.Map
+// @Failure 500 {object} fiber.Map
+// @Router /api/v1/workspaces/{workspaceId}/members/{userId} [delete]
+func (a *api) removeWorkspaceMemberHandler(ctx *fiber.Ctx) error {
+	userId := ctx.Locals("userId").(string)
+	memberId := ctx.Params("userId")
+
+	required := domain.RoleAdmin
+	if memberId == userId {
+		required = domain.RoleViewer
+	}
+	workspace, ok, err := a.memberWorkspace(ctx, required)
+	if !ok {
+		return err
+	}
+	current, ok := workspace.Role(memberId)
+	if !ok {
+		return NotFound(ctx, errors.New("member not found"))
+	}
+	if memberId != userId {
+		if ok, err := canGrantRole(ctx, workspace, current); !ok {
+			return err
+		}
+	}
+
+	workspace, err = a.workspaceRepo.RemoveMember(ctx.Context(), workspace.ID, memberId)
+	if err != nil {
+		return workspaceError(ctx, err)
+	}
+
+	return ctx.JSON(workspace)
+}
+
+// memberWorkspace loads the workspace from the path if the user is a member with the required role, ok and err behave
+// like in ownedOrder.
+func (a *api) memberWorkspace(ctx *fiber.Ctx, required domain.WorkspaceRole) (domain.WorkspaceDB, bool, error) {
+	userId := ctx.Locals("userId").(string)
+	workspaceId, err := primitive.ObjectIDFromHex(ctx.Params("workspaceId"))
+	if err != nil {
+		return domain.WorkspaceDB{}, false, NotFound(ctx, err)
+	}
+
+	workspace, err := a.workspaceRepo.GetWorkspace(ctx.Context(), workspaceId, userId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return domain.WorkspaceDB{}, false, NotFound(ctx, err)
+		}
+		return domain.WorkspaceDB{}, false, ServerError(ctx, err, "Failed to fetch workspace")
+	}
+	if role, _ := workspace.Role(userId); !role.Allows(required) {
+		return domain.WorkspaceDB{}, false, ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Workspace role " + string(required) + " required",
+		})
+	}
+	return workspace, true, nil
+}
+
+// canGrantRole checks that the user may hand out the role, admins manage every role but the owner role
+func canGrantRole(ctx *fiber.Ctx, workspace domain.WorkspaceDB, role domain.WorkspaceRole) (bool, error) {
+	if !role.Valid() {
+		return false, BadRequest(ctx, domain.ErrInvalidRole)
+	}
+	current, _ := workspace.Role(ctx.Locals("userId").(string))
+	if role == domain.RoleOwner && current != domain.RoleOwner {
+		return false, ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Only owners can manage owners",
+		})
+	}
+	return true, nil
+}
+
+// userEmail returns the verified email of the signed in user, which is only part of ID tokens
+func userEmail(ctx *fiber.Ctx) (string, bool) {
+	claims, ok := ctx.Locals("claims").(jwt.MapClaims)
+	if !ok {
+		return "", false
+	}
+	if !emailVerified(claims["email_verified"]) {
+		return "", false
+	}
+	email, _ := claims["email"].(string)
+	if email == "" {
+		return "", false
+	}
+	email, err := normalizeClientEmail(email)
+	return email, err == nil
+}
+
+// emailVerified reads the email_verified claim, which some providers send as a string. A missing claim does not
+// count as verified.
+func emailVerified(claim interface{}) bool {
+	switch verified := claim.(type) {
+	case bool:
+		return verified
+	case string:
+		return verified == "true"
+	}
+	return false
+}
+
+func emailRequired(ctx *fiber.Ctx) error {
+	return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"message": "A token with a verified email is required",
+	})
+}
+
+func workspaceError(ctx *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return NotFound(ctx, err)
+	case errors.Is(err, domain.ErrLastOwner):
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Workspace must keep at least one owner"})
+	case errors.Is(err, domain.ErrAlreadyMember):
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "User is already a member of the workspace"})
+	case errors.Is(err, domain.ErrPersonalWorkspace):
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Personal workspaces can not be shared or deleted"})
+	default:
+		return ServerError(ctx, err, "Failed to update workspace")
+	}
+}
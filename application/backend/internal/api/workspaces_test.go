@@ -0,0 +1,23 @@
+package api
+
+import "testing"
+
+func TestEmailVerified(t *testing.T) {
+	tests := []struct {
+		claim interface{}
+		want  bool
+	}{
+		{true, true},
+		{"true", true},
+		{false, false},
+		{"false", false},
+		{nil, false},
+		{"yes", false},
+		{1.0, false},
+	}
+	for _, tt := range tests {
+		if got := emailVerified(tt.claim); got != tt.want {
+			t.Errorf("emailVerified(%#v) = %v, want %v", tt.claim, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Entry is a single file of the archive. Its content is either read from object storage by Key or taken from Body.
+type Entry struct {
+	Name string
+	Key  string
+	Body []byte
+}
+
+// Opener returns the content stored in object storage under key
+type Opener func(ctx context.Context, key string) (io.ReadCloser, error)
+
+// Write streams a zip archive of entries into w without buffering objects in memory or on disk.
+// Objects are stored without compression as photos are already compressed.
+func Write(ctx context.Context, w io.Writer, entries []Entry, open Opener) error {
+	zw := zip.NewWriter(w)
+	modified := time.Now().UTC()
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		header := &zip.FileHeader{
+			Name:     entry.Name,
+			Method:   zip.Store,
+			Modified: modified,
+		}
+		if entry.Key == "" {
+			header.Method = zip.Deflate
+		}
+
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		if entry.Key == "" {
+			if _, err := io.Copy(fw, bytes.NewReader(entry.Body)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		body, err := open(ctx, entry.Key)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", entry.Key, err)
+		}
+		_, err = io.Copy(fw, body)
+		_ = body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to copy %s: %w", entry.Key, err)
+		}
+	}
+
+	return zw.Close()
+}
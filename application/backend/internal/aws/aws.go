@@ -4,6 +4,8 @@ import (
 	"context"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/michalK00/halftone/platform/cloud/aws"
+	"golang.org/x/sync/errgroup"
+	"io"
 	"log"
 	"path"
 	"strings"
@@ -42,6 +44,10 @@ func ObjectExists(key string) (bool, error) {
 }
 
 func GetObjectUrl(key string) (string, error) {
+	return GetObjectUrlWithLifetime(key, lifetimeSecs)
+}
+
+func GetObjectUrlWithLifetime(key string, lifetimeSecs int64) (string, error) {
 
 	client, err := aws.GetClient()
 	if err != nil {
@@ -57,6 +63,90 @@ func GetObjectUrl(key string) (string, error) {
 	return request.URL, nil
 }
 
+// signingConcurrency limits how many urls are signed or objects checked at once
+const signingConcurrency = 16
+
+// GetObjectUrls signs urls for all keys at once, empty keys get empty urls
+func GetObjectUrls(ctx context.Context, keys []string) ([]string, error) {
+	client, err := aws.GetClient()
+	if err != nil {
+		log.Printf("Failed GetAWSClient, %v \n", err)
+		return nil, err
+	}
+
+	urls := make([]string, len(keys))
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(signingConcurrency)
+	for i, key := range keys {
+		if key == "" {
+			continue
+		}
+		g.Go(func() error {
+			request, err := client.S3.GetObjectUrl(ctx, key, lifetimeSecs)
+			if err != nil {
+				return err
+			}
+			urls[i] = request.URL
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		log.Printf("Failed GetObjectUrls, %v \n", err)
+		return nil, err
+	}
+	return urls, nil
+}
+
+// ObjectsExist checks all objects at once, objects that could not be checked are reported missing
+func ObjectsExist(ctx context.Context, keys []string) []bool {
+	exists := make([]bool, len(keys))
+	client, err := aws.GetClient()
+	if err != nil {
+		log.Printf("Failed GetAWSClient, %v \n", err)
+		return exists
+	}
+
+	var g errgroup.Group
+	g.SetLimit(signingConcurrency)
+	for i, key := range keys {
+		g.Go(func() error {
+			_, err := client.S3.HeadObject(ctx, key)
+			exists[i] = err == nil
+			return nil
+		})
+	}
+	_ = g.Wait()
+	return exists
+}
+
+func GetObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	client, err := aws.GetClient()
+	if err != nil {
+		log.Printf("Failed GetAWSClient, %v \n", err)
+		return nil, err
+	}
+	out, err := client.S3.GetObject(ctx, key)
+	if err != nil {
+		log.Printf("Failed GetObject, %v \n", err)
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func UploadObject(ctx context.Context, key string, body io.Reader, contentType string) error {
+	client, err := aws.GetClient()
+	if err != nil {
+		log.Printf("Failed GetAWSClient, %v \n", err)
+		return err
+	}
+	_, err = client.S3.UploadStream(ctx, key, body, contentType)
+	if err != nil {
+		log.Printf("Failed UploadObject, %v \n", err)
+		return err
+	}
+	return nil
+}
+
 func PostObjectRequest(key string, conditions []interface{}) (*s3.PresignedPostRequest, error) {
 
 	client, err := aws.GetClient()
@@ -30,7 +30,13 @@ func APICmd(ctx context.Context) *cobra.Command {
 			}
 			defer func() { _ = db.Client().Disconnect(context.Background()) }()
 
-			a := api.NewApi(db)
+			rdb, err := cmdutil.NewRedisClient(ctx)
+			if err != nil {
+				return fmt.Errorf("could not connect to redis: %w", err)
+			}
+			defer func() { _ = rdb.Close() }()
+
+			a := api.NewApi(db, rdb)
 			app := a.Server()
 
 			go func() {
@@ -41,6 +47,7 @@ func APICmd(ctx context.Context) *cobra.Command {
 
 			<-ctx.Done()
 
+			_ = a.Close()
 			_ = app.Shutdown()
 
 			return nil
@@ -4,7 +4,14 @@ import (
 	"context"
 	"fmt"
 	"github.com/michalK00/halftone/internal/cmdutil"
+	"github.com/michalK00/halftone/internal/domain"
+	"github.com/michalK00/halftone/internal/fcm"
+	"github.com/michalK00/halftone/internal/jobs"
+	"github.com/michalK00/halftone/internal/mail"
+	"github.com/michalK00/halftone/internal/repository"
 	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"os"
 )
 
 func SchedulerCmd(ctx context.Context) *cobra.Command {
@@ -29,7 +36,37 @@ func SchedulerCmd(ctx context.Context) *cobra.Command {
 			}
 			defer func() { _ = rdb.Close() }()
 
-			return nil
+			// Push notifications are optional for background jobs
+			var fcmService *fcm.Service
+			jsonCredentials, err := fcm.GetCredentialsJSON()
+			if err == nil {
+				fcmService, err = fcm.NewService(os.Getenv("FCM_PROJECT_ID"), jsonCredentials, repository.NewMongoPushSubscription(db))
+			}
+			if err != nil {
+				logger.Warn("push notifications disabled", zap.Error(err))
+			}
+
+			mailer, err := mail.NewFromEnv()
+			if err != nil {
+				return fmt.Errorf("failed to initialize mailer: %w", err)
+			}
+
+			orderRepo := repository.NewMongoOrder(db)
+			galleryRepo := repository.NewMongoGallery(db)
+			photoRepo := repository.NewMongoPhoto(db)
+			jobRepo := repository.NewMongoJob(db)
+			notificationRepo := repository.NewMongoNotification(db)
+			notifier := jobs.NewNotifier(notificationRepo, jobRepo)
+
+			runner := jobs.NewRunner(jobRepo, logger)
+			runner.Handle(domain.JobTypeOrderExport, jobs.NewOrderExporter(orderRepo, galleryRepo, photoRepo, notifier).Handle)
+			runner.Handle(domain.JobTypeNotificationDelivery, jobs.NewNotificationDeliverer(notificationRepo, fcmService, mailer).Handle)
+			runner.Handle(domain.JobTypeEmail, jobs.NewEmailSender(mailer).Handle)
+			runner.Handle(domain.JobTypePhotoProcessing, jobs.NewPhotoProcessingChecker(photoRepo, repository.NewRedisEventBroker(rdb), notifier).Handle)
+
+			go jobs.NewExpiryWatcher(galleryRepo, notifier, logger).Run(ctx)
+
+			return runner.Run(ctx)
 		},
 	}
 	return cmd
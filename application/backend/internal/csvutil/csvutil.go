@@ -0,0 +1,13 @@
+package csvutil
+
+import "strings"
+
+// Cell escapes a value written to a CSV file that is opened with a spreadsheet. Values starting with one of the
+// characters that start a formula are prefixed with a quote, so client input such as an order comment is shown as
+// text instead of being evaluated.
+func Cell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
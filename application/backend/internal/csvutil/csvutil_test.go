@@ -0,0 +1,23 @@
+package csvutil
+
+import "testing"
+
+func TestCell(t *testing.T) {
+	tests := map[string]string{
+		"":                        "",
+		"client@example.com":      "client@example.com",
+		"=HYPERLINK(\"x\")":       "'=HYPERLINK(\"x\")",
+		"+48 123":                 "'+48 123",
+		"-1":                      "'-1",
+		"@SUM(A1)":                "'@SUM(A1)",
+		"\tcmd":                   "'\tcmd",
+		"\rcmd":                   "'\rcmd",
+		"IMG_0001.jpg":            "IMG_0001.jpg",
+		"please print = two of x": "please print = two of x",
+	}
+	for value, want := range tests {
+		if got := Cell(value); got != want {
+			t.Errorf("Cell(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
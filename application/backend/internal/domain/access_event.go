@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type AccessEventType string
+
+const (
+	EventGalleryOpened     AccessEventType = "gallery_opened"
+	EventPhotoViewed       AccessEventType = "photo_viewed"
+	EventPhotoDownloaded   AccessEventType = "photo_downloaded"
+	EventArchiveDownloaded AccessEventType = "archive_downloaded"
+	EventOrderPlaced       AccessEventType = "order_placed"
+)
+
+// AccessEventDB records a client interaction with a shared gallery
+type AccessEventDB struct {
+	ID          primitive.ObjectID  `bson:"_id" json:"id"`
+	GalleryID   primitive.ObjectID  `bson:"galleryId" json:"galleryId"`
+	UserId      string              `bson:"userId" json:"-"`
+	WorkspaceID primitive.ObjectID  `bson:"workspaceId" json:"-"`
+	Type        AccessEventType     `bson:"type" json:"type"`
+	PhotoID     *primitive.ObjectID `bson:"photoId,omitempty" json:"photoId,omitempty"`
+	ShareLinkID *primitive.ObjectID `bson:"shareLinkId,omitempty" json:"shareLinkId,omitempty"`
+	// ClientEmail is set for clients who verified their email
+	ClientEmail string `bson:"clientEmail,omitempty" json:"clientEmail,omitempty"`
+	// VisitorID is a hash of the client address and user agent, used to count unique visitors without storing either
+	VisitorID string `bson:"visitorId" json:"visitorId"`
+	// UserAgent is the browser family and operating system, e.g. "Safari on iOS"
+	UserAgent string    `bson:"userAgent" json:"userAgent"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+type GalleryAnalytics struct {
+	From             time.Time         `json:"from"`
+	To               time.Time         `json:"to"`
+	UniqueVisitors   int64             `json:"uniqueVisitors"`
+	Opens            int64             `json:"opens"`
+	PhotoViews       int64             `json:"photoViews"`
+	PhotoDownloads   int64             `json:"photoDownloads"`
+	ArchiveDownloads int64             `json:"archiveDownloads"`
+	Orders           int64             `json:"orders"`
+	TopPhotos        []PhotoViews      `json:"topPhotos"`
+	TimeSeries       []AnalyticsBucket `json:"timeSeries"`
+	UserAgents       []UserAgentCount  `json:"userAgents"`
+}
+
+type PhotoViews struct {
+	PhotoID primitive.ObjectID `bson:"_id" json:"photoId"`
+	Views   int64              `bson:"views" json:"views"`
+}
+
+// AnalyticsBucket holds the events of one day
+type AnalyticsBucket struct {
+	Date       time.Time `bson:"_id" json:"date"`
+	Visitors   int64     `bson:"visitors" json:"visitors"`
+	Opens      int64     `bson:"opens" json:"opens"`
+	PhotoViews int64     `bson:"photoViews" json:"photoViews"`
+	Downloads  int64     `bson:"downloads" json:"downloads"`
+}
+
+type UserAgentCount struct {
+	UserAgent string `bson:"_id" json:"userAgent"`
+	Visitors  int64  `bson:"visitors" json:"visitors"`
+}
+
+type AccessEventRepository interface {
+	RecordEvent(ctx context.Context, event *AccessEventDB) error
+	// GetGalleryAnalytics aggregates events of the gallery created in [from, to), top lists are limited to limit entries
+	GetGalleryAnalytics(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID, from, to time.Time, limit int) (GalleryAnalytics, error)
+}
@@ -0,0 +1,118 @@
+package domain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ApiKeyPrefix starts every API key, so leaked keys are easy to recognise by secret scanners
+const ApiKeyPrefix = "hft_"
+
+var (
+	ErrApiKeyRevoked      = errors.New("API key revoked")
+	ErrInvalidApiKey      = errors.New("invalid API key")
+	ErrInvalidKeyScope    = errors.New("invalid API key scope")
+	ErrInvalidKeyName     = errors.New("API key name must be between 1 and 100 characters long")
+	ErrApiKeyLimitReached = errors.New("API key limit reached")
+)
+
+// MaxApiKeys limits the active keys of a user
+const MaxApiKeys = 25
+
+// ApiKeyScope limits what a request authenticated with the key can do. Read keys can only read and full keys can do
+// everything the user can. Upload keys, e.g. for tethered shooting scripts, can only upload photos and find the
+// galleries to upload them to, so a leaked one does not expose orders or client data.
+type ApiKeyScope string
+
+const (
+	ApiKeyScopeRead   ApiKeyScope = "read"
+	ApiKeyScopeUpload ApiKeyScope = "upload"
+	ApiKeyScopeFull   ApiKeyScope = "full"
+)
+
+// apiKeyScopeGrants lists the scopes granted by each scope, upload does not include read
+var apiKeyScopeGrants = map[ApiKeyScope][]ApiKeyScope{
+	ApiKeyScopeRead:   {ApiKeyScopeRead},
+	ApiKeyScopeUpload: {ApiKeyScopeUpload},
+	ApiKeyScopeFull:   {ApiKeyScopeRead, ApiKeyScopeUpload, ApiKeyScopeFull},
+}
+
+func (s ApiKeyScope) Valid() bool {
+	_, ok := apiKeyScopeGrants[s]
+	return ok
+}
+
+// Allows reports whether the scope grants what the required scope does
+func (s ApiKeyScope) Allows(required ApiKeyScope) bool {
+	return slices.Contains(apiKeyScopeGrants[s], required)
+}
+
+// ApiKeyDB is a personal API key of a photographer for scripts and automation. Only the hash of the key is stored,
+// the key itself is shown once when it is created.
+type ApiKeyDB struct {
+	ID     primitive.ObjectID `bson:"_id" json:"id"`
+	UserId string             `bson:"userId" json:"-"`
+	Name   string             `bson:"name" json:"name" example:"Tethering workstation"`
+	// Hint is the beginning of the key, to tell keys apart without revealing them
+	Hint       string      `bson:"hint" json:"hint" example:"hft_Xq3b"`
+	KeyHash    string      `bson:"keyHash" json:"-"`
+	Scope      ApiKeyScope `bson:"scope" json:"scope" example:"upload"`
+	LastUsedAt *time.Time  `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time  `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+	CreatedAt  time.Time   `bson:"createdAt" json:"createdAt"`
+}
+
+type ApiKeyRepository interface {
+	GetApiKeys(ctx context.Context, userId string) ([]ApiKeyDB, error)
+	GetApiKeyByHash(ctx context.Context, keyHash string) (ApiKeyDB, error)
+	// CreateApiKey fails with ErrApiKeyLimitReached when the user already has MaxApiKeys active keys
+	CreateApiKey(ctx context.Context, key *ApiKeyDB) error
+	RevokeApiKey(ctx context.Context, keyId primitive.ObjectID, userId string) (ApiKeyDB, error)
+	// TouchApiKey records the use of the key, at most once a minute to keep writes off the request path
+	TouchApiKey(ctx context.Context, keyId primitive.ObjectID, usedAt time.Time) error
+}
+
+// GenerateApiKey returns a new random API key
+func GenerateApiKey() (string, error) {
+	token, err := GenerateAccessToken()
+	if err != nil {
+		return "", err
+	}
+	return ApiKeyPrefix + strings.TrimRight(token, "="), nil
+}
+
+// HashApiKey hashes an API key for storage and lookup. Keys are long and random, so a fast hash is sufficient.
+func HashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ApiKeyHint returns the beginning of the key shown in key listings
+func ApiKeyHint(key string) string {
+	if len(key) <= len(ApiKeyPrefix)+4 {
+		return key
+	}
+	return key[:len(ApiKeyPrefix)+4]
+}
+
+func NormalizeApiKeyName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return "", ErrInvalidKeyName
+	}
+	return name, nil
+}
+
+// Active reports whether requests can be authenticated with the key
+func (k ApiKeyDB) Active() error {
+	if k.RevokedAt != nil {
+		return ErrApiKeyRevoked
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApiKeyScopeAllows(t *testing.T) {
+	tests := []struct {
+		scope    ApiKeyScope
+		required ApiKeyScope
+		allowed  bool
+	}{
+		{ApiKeyScopeFull, ApiKeyScopeUpload, true},
+		{ApiKeyScopeFull, ApiKeyScopeRead, true},
+		{ApiKeyScopeUpload, ApiKeyScopeUpload, true},
+		{ApiKeyScopeUpload, ApiKeyScopeRead, false},
+		{ApiKeyScopeUpload, ApiKeyScopeFull, false},
+		{ApiKeyScopeRead, ApiKeyScopeUpload, false},
+		{ApiKeyScope("admin"), ApiKeyScopeRead, false},
+	}
+
+	for _, test := range tests {
+		if allowed := test.scope.Allows(test.required); allowed != test.allowed {
+			t.Errorf("Expected %q allows %q to be %v, got %v", test.scope, test.required, test.allowed, allowed)
+		}
+	}
+}
+
+func TestGenerateApiKey(t *testing.T) {
+	key, err := GenerateApiKey()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(key, ApiKeyPrefix) || strings.Contains(key, "=") {
+		t.Errorf("Unexpected key format %q", key)
+	}
+	if hint := ApiKeyHint(key); !strings.HasPrefix(key, hint) || len(hint) != len(ApiKeyPrefix)+4 {
+		t.Errorf("Unexpected hint %q for key %q", hint, key)
+	}
+
+	other, err := GenerateApiKey()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if HashApiKey(key) == HashApiKey(other) {
+		t.Error("Expected different keys to have different hashes")
+	}
+}
@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math/big"
+	"time"
+)
+
+const (
+	// ClientVerificationLifetime is how long the emailed code and magic link can be used
+	ClientVerificationLifetime = 15 * time.Minute
+	// MaxVerificationAttempts is how many wrong codes are accepted before the verification has to be requested again
+	MaxVerificationAttempts = 5
+)
+
+var ErrVerificationUnavailable = errors.New("verification expired or already used")
+
+// ClientVerificationDB is a pending proof that the client owns the email they identified with. Only hashes of the
+// one-time code and magic link key are stored.
+type ClientVerificationDB struct {
+	ID        primitive.ObjectID  `bson:"_id"`
+	GalleryID primitive.ObjectID  `bson:"galleryId"`
+	LinkID    *primitive.ObjectID `bson:"linkId,omitempty"`
+	Email     string              `bson:"email"`
+	CodeHash  string              `bson:"codeHash"`
+	KeyHash   string              `bson:"keyHash"`
+	Attempts  int                 `bson:"attempts"`
+	// ExpiresAt also drives the TTL index removing stale verifications
+	ExpiresAt  time.Time  `bson:"expiresAt"`
+	VerifiedAt *time.Time `bson:"verifiedAt,omitempty"`
+	CreatedAt  time.Time  `bson:"createdAt"`
+}
+
+type ClientVerificationRepository interface {
+	CreateVerification(ctx context.Context, verification *ClientVerificationDB) error
+	GetVerification(ctx context.Context, verificationId primitive.ObjectID) (ClientVerificationDB, error)
+	// FailVerification counts a wrong code
+	FailVerification(ctx context.Context, verificationId primitive.ObjectID) error
+	// CompleteVerification marks the verification as used, failing with ErrVerificationUnavailable when it was used,
+	// expired or ran out of attempts in the meantime
+	CompleteVerification(ctx context.Context, verificationId primitive.ObjectID) error
+}
+
+// GenerateVerificationCode returns a random 6 digit one-time code
+func GenerateVerificationCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// HashVerificationSecret hashes a one-time code or magic link key. Codes are short lived and attempts are limited, so
+// a fast hash is sufficient.
+func HashVerificationSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Usable reports whether a code can still be checked against the verification
+func (v ClientVerificationDB) Usable(now time.Time) bool {
+	return v.VerifiedAt == nil && now.Before(v.ExpiresAt) && v.Attempts < MaxVerificationAttempts
+}
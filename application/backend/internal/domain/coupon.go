@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+)
+
+type CouponType string
+
+const (
+	CouponTypePercentage CouponType = "percentage"
+	CouponTypeFixed      CouponType = "fixed"
+)
+
+var (
+	ErrCouponExpired       = errors.New("coupon expired")
+	ErrCouponExhausted     = errors.New("coupon usage limit reached")
+	ErrCouponNotApplicable = errors.New("coupon not applicable to this gallery")
+)
+
+type CouponDB struct {
+	ID          primitive.ObjectID `bson:"_id" json:"id"`
+	UserId      string             `bson:"userId" json:"userId"`
+	WorkspaceID primitive.ObjectID `bson:"workspaceId" json:"workspaceId"`
+	// GalleryId limits the coupon to a single gallery, nil means all galleries of the user
+	GalleryId *primitive.ObjectID `bson:"galleryId,omitempty" json:"galleryId,omitempty"`
+	Code      string              `bson:"code" json:"code"`
+	Type      CouponType          `bson:"type" json:"type"`
+	// Value is a percentage (1-100) for percentage coupons and an amount in minor currency units for fixed ones
+	Value     int64     `bson:"value" json:"value"`
+	ExpiresAt time.Time `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	// MaxUses of 0 means the coupon can be used an unlimited number of times
+	MaxUses   int64     `bson:"maxUses" json:"maxUses"`
+	Uses      int64     `bson:"uses" json:"uses"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+type CouponRepository interface {
+	GetCoupons(ctx context.Context, workspaceId primitive.ObjectID) ([]CouponDB, error)
+	GetCoupon(ctx context.Context, couponId primitive.ObjectID, workspaceId primitive.ObjectID) (CouponDB, error)
+	GetCouponByCode(ctx context.Context, code string, workspaceId primitive.ObjectID) (CouponDB, error)
+	CreateCoupon(ctx context.Context, coupon *CouponDB) (string, error)
+	DeleteCoupon(ctx context.Context, couponId primitive.ObjectID, workspaceId primitive.ObjectID) error
+
+	// RedeemCoupon atomically increments the usage count, failing with ErrCouponExhausted when the limit is reached
+	RedeemCoupon(ctx context.Context, couponId primitive.ObjectID) error
+	// ReleaseCoupon reverts a redemption, e.g. when the order could not be stored
+	ReleaseCoupon(ctx context.Context, couponId primitive.ObjectID) error
+}
+
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Validate checks whether the coupon can be applied to an order placed in the given gallery
+func (c CouponDB) Validate(galleryId primitive.ObjectID, now time.Time) error {
+	if c.GalleryId != nil && *c.GalleryId != galleryId {
+		return ErrCouponNotApplicable
+	}
+	if !c.ExpiresAt.IsZero() && now.After(c.ExpiresAt) {
+		return ErrCouponExpired
+	}
+	if c.MaxUses > 0 && c.Uses >= c.MaxUses {
+		return ErrCouponExhausted
+	}
+	return nil
+}
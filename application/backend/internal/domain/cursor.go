@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"encoding/base64"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the opaque position of the last item of a page. It holds the value of the sort field and the _id used
+// as tie-breaker, so the next page can continue with a range query on an index instead of skipping documents.
+type Cursor struct {
+	Value interface{}        `bson:"v"`
+	ID    primitive.ObjectID `bson:"id"`
+}
+
+func (c Cursor) Encode() (string, error) {
+	b, err := bson.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DecodeCursor decodes a cursor whose sort value has the type of sample, e.g. a time.Time for pages sorted by a date.
+// Cursors come from clients, a value of another type could change what the range query matches.
+func DecodeCursor(s string, sample interface{}) (Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	var raw struct {
+		Value bson.RawValue      `bson:"v"`
+		ID    primitive.ObjectID `bson:"id"`
+	}
+	if err := bson.Unmarshal(b, &raw); err != nil || raw.ID.IsZero() {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	valueType, _, err := bson.MarshalValue(sample)
+	if err != nil || raw.Value.Type != valueType {
+		return Cursor{}, ErrInvalidCursor
+	}
+	value := reflect.New(reflect.TypeOf(sample))
+	if err := raw.Value.Unmarshal(value.Interface()); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return Cursor{Value: value.Elem().Interface(), ID: raw.ID}, nil
+}
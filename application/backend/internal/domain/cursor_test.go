@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	id := primitive.NewObjectID()
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	encoded, err := Cursor{Value: createdAt, ID: id}.Encode()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	decoded, err := DecodeCursor(encoded, time.Time{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if decoded.ID != id {
+		t.Errorf("Expected id %s, got %s", id.Hex(), decoded.ID.Hex())
+	}
+	value, ok := decoded.Value.(time.Time)
+	if !ok || !value.Equal(createdAt) {
+		t.Errorf("Expected sort value %v, got %v", createdAt, decoded.Value)
+	}
+}
+
+func TestDecodeInvalidCursor(t *testing.T) {
+	for _, s := range []string{"", "not base64!", "AAAA"} {
+		if _, err := DecodeCursor(s, time.Time{}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("Expected ErrInvalidCursor for %q, got %v", s, err)
+		}
+	}
+}
+
+func TestDecodeCursorOfOtherType(t *testing.T) {
+	id := primitive.NewObjectID()
+	for _, value := range []interface{}{"2024-05-01", bson.M{"$gt": ""}, bson.A{1}} {
+		encoded, err := Cursor{Value: value, ID: id}.Encode()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := DecodeCursor(encoded, time.Time{}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("Expected ErrInvalidCursor for %v, got %v", value, err)
+		}
+	}
+
+	encoded, _ := Cursor{Value: "IMG_0001.jpg", ID: id}.Encode()
+	if c, err := DecodeCursor(encoded, ""); err != nil || c.Value != "IMG_0001.jpg" {
+		t.Errorf("Expected the filename cursor to decode, got %v %v", c.Value, err)
+	}
+}
@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+var ErrInvalidEventTicket = errors.New("invalid or expired event ticket")
+
+// EventTicketLifetime is how long a ticket can be used to open an event stream
+const EventTicketLifetime = 30 * time.Second
+
+type EventType string
+
+const (
+	EventPhotoProcessed EventType = "photo.processed"
+	EventOrderCreated   EventType = "order.created"
+	EventOrderUpdated   EventType = "order.updated"
+	EventCommentCreated EventType = "comment.created"
+)
+
+// Event is a change in a workspace pushed to the dashboards of its members, so they do not have to poll for it
+type Event struct {
+	ID          primitive.ObjectID `json:"id"`
+	Type        EventType          `json:"type" example:"order.created"`
+	WorkspaceID primitive.ObjectID `json:"workspaceId"`
+	// Data is the changed resource, e.g. the order or the comment
+	Data      json.RawMessage `json:"data" swaggertype:"object"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+func NewEvent(eventType EventType, workspaceId primitive.ObjectID, data any) (Event, error) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		ID:          primitive.NewObjectID(),
+		Type:        eventType,
+		WorkspaceID: workspaceId,
+		Data:        jsonData,
+		CreatedAt:   time.Now().UTC(),
+	}, nil
+}
+
+// EventBroker fans events out to the event streams of all API instances
+type EventBroker interface {
+	Publish(ctx context.Context, event Event) error
+	// Subscribe returns the events of the workspace until ctx is done, the channel is closed then. Events are dropped
+	// for subscribers that fall behind rather than holding up the others.
+	Subscribe(ctx context.Context, workspaceId primitive.ObjectID) (<-chan Event, error)
+	// Close ends all subscriptions, e.g. so open streams do not hold up a shutdown
+	Close() error
+}
+
+// EventTicket authenticates opening an event stream from browsers, which can not send headers with EventSource or
+// WebSocket requests. It is created with a token and used once within EventTicketLifetime.
+type EventTicket struct {
+	UserId      string             `json:"userId"`
+	WorkspaceID primitive.ObjectID `json:"workspaceId"`
+}
+
+type EventTicketRepository interface {
+	CreateEventTicket(ctx context.Context, ticket EventTicket) (string, error)
+	// RedeemEventTicket fails with ErrInvalidEventTicket when the ticket is unknown, expired or was already used
+	RedeemEventTicket(ctx context.Context, ticket string) (EventTicket, error)
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
 	"time"
 )
 
@@ -14,10 +17,25 @@ type GalleryDB struct {
 	CollectionId primitive.ObjectID `bson:"collectionId" json:"collectionId"`
 	Name         string             `bson:"name" json:"name"`
 	UserId       string             `bson:"userId" json:"userId"`
+	WorkspaceID  primitive.ObjectID `bson:"workspaceId" json:"workspaceId"`
 	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
 	UpdatedAt    time.Time          `bson:"updatedAt" json:"updatedAt"`
 	Sharing      Sharing            `bson:"sharing" json:"sharing"`
 	PhotoOptions PhotoOptions       `bson:"photoOptions" json:"photoOptions"`
+	Pricing      Pricing            `bson:"pricing" json:"pricing"`
+	Proofing     Proofing           `bson:"proofing" json:"proofing"`
+	// Downloads counts the archives clients downloaded from the gallery
+	Downloads    int64               `bson:"downloads" json:"downloads"`
+	CoverPhotoID *primitive.ObjectID `bson:"coverPhotoId,omitempty" json:"coverPhotoId,omitempty"`
+	SortOrder    PhotoSortOrder      `bson:"sortOrder" json:"sortOrder"`
+	// Sections are listed in the order clients see them
+	Sections []GallerySection `bson:"sections" json:"sections"`
+}
+
+// GallerySection is a named chapter of the gallery, e.g. ceremony or reception, photos are assigned to
+type GallerySection struct {
+	ID   primitive.ObjectID `bson:"id" json:"id"`
+	Name string             `bson:"name" json:"name" example:"Ceremony"`
 }
 
 type Sharing struct {
@@ -25,6 +43,9 @@ type Sharing struct {
 	SharingExpiryDate time.Time `bson:"sharingExpiryDate" json:"sharingExpiryDate"`
 	AccessToken       string    `bson:"accessToken" json:"accessToken"`
 	SharingUrl        string    `bson:"sharingUrl" json:"sharingUrl"`
+	// PasswordHash protects the access token with a password or PIN, see ShareLinkDB
+	PasswordHash string `bson:"passwordHash,omitempty" json:"-"`
+	Protected    bool   `bson:"protected" json:"protected"`
 }
 
 type PhotoOptions struct {
@@ -34,13 +55,16 @@ type PhotoOptions struct {
 
 type GalleryRepository interface {
 	GetGalleryByID(ctx context.Context, galleryId primitive.ObjectID) (GalleryDB, error)
-	GalleryExists(ctx context.Context, galleryId primitive.ObjectID, userId string) (bool, error)
-	CollectionGalleryCount(ctx context.Context, collectionId primitive.ObjectID, userId string) (int64, error)
-	GetGalleries(ctx context.Context, collectionId primitive.ObjectID, userId string) ([]GalleryDB, error)
-	GetGallery(ctx context.Context, galleryId primitive.ObjectID, userId string) (GalleryDB, error)
-	CreateGallery(ctx context.Context, collectionId primitive.ObjectID, name, userId string) (string, error)
-	DeleteGallery(ctx context.Context, galleryId primitive.ObjectID, userId string) error
-	UpdateGallery(ctx context.Context, galleryId primitive.ObjectID, userId string, opts ...GalleryUpdateOption) (GalleryDB, error)
+	GalleryExists(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID) (bool, error)
+	CollectionGalleryCount(ctx context.Context, collectionId primitive.ObjectID, workspaceId primitive.ObjectID) (int64, error)
+	GetGalleries(ctx context.Context, collectionId primitive.ObjectID, workspaceId primitive.ObjectID) ([]GalleryDB, error)
+	GetGallery(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID) (GalleryDB, error)
+	CreateGallery(ctx context.Context, collectionId primitive.ObjectID, name string, workspaceId primitive.ObjectID, userId string) (string, error)
+	DeleteGallery(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID) error
+	UpdateGallery(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID, opts ...GalleryUpdateOption) (GalleryDB, error)
+	CountDownload(ctx context.Context, galleryId primitive.ObjectID) error
+	// GetGalleriesExpiringBetween returns the shared galleries of all workspaces whose sharing expires within the window
+	GetGalleriesExpiringBetween(ctx context.Context, from time.Time, to time.Time) ([]GalleryDB, error)
 }
 
 func GenerateAccessToken() (string, error) {
@@ -70,6 +94,76 @@ func WithSharing(sharing Sharing) GalleryUpdateOption {
 			{Key: "accessToken", Value: sharing.AccessToken},
 			{Key: "sharingExpiryDate", Value: sharing.SharingExpiryDate},
 			{Key: "sharingUrl", Value: sharing.SharingUrl},
+			{Key: "passwordHash", Value: sharing.PasswordHash},
+			{Key: "protected", Value: sharing.PasswordHash != ""},
 		}})
 	}
 }
+
+func WithPricing(pricing Pricing) GalleryUpdateOption {
+	return func(opts *GalleryUpdateOptions) {
+		opts.SetFields = append(opts.SetFields, bson.E{Key: "pricing", Value: pricing})
+	}
+}
+
+// WithCoverPhoto sets the photo shown as the gallery cover, nil removes it
+func WithCoverPhoto(photoId *primitive.ObjectID) GalleryUpdateOption {
+	return func(opts *GalleryUpdateOptions) {
+		opts.SetFields = append(opts.SetFields, bson.E{Key: "coverPhotoId", Value: photoId})
+	}
+}
+
+func WithSortOrder(order PhotoSortOrder) GalleryUpdateOption {
+	return func(opts *GalleryUpdateOptions) {
+		opts.SetFields = append(opts.SetFields, bson.E{Key: "sortOrder", Value: order})
+	}
+}
+
+func WithSections(sections []GallerySection) GalleryUpdateOption {
+	return func(opts *GalleryUpdateOptions) {
+		opts.SetFields = append(opts.SetFields, bson.E{Key: "sections", Value: sections})
+	}
+}
+
+func WithProofing(proofing Proofing) GalleryUpdateOption {
+	return func(opts *GalleryUpdateOptions) {
+		opts.SetFields = append(opts.SetFields, bson.E{Key: "proofing", Value: proofing})
+	}
+}
+
+// NormalizeSections trims section names and assigns IDs to new sections, names have to be unique within the gallery
+func NormalizeSections(sections []GallerySection) ([]GallerySection, error) {
+	normalized := make([]GallerySection, 0, len(sections))
+	names := make(map[string]bool, len(sections))
+	ids := make(map[primitive.ObjectID]bool, len(sections))
+	for _, section := range sections {
+		section.Name = strings.TrimSpace(section.Name)
+		if section.Name == "" {
+			return nil, errors.New("section name is required")
+		}
+		key := strings.ToLower(section.Name)
+		if names[key] {
+			return nil, fmt.Errorf("duplicate section %q", section.Name)
+		}
+		names[key] = true
+		if section.ID.IsZero() {
+			section.ID = primitive.NewObjectID()
+		}
+		if ids[section.ID] {
+			return nil, errors.New("duplicate section id")
+		}
+		ids[section.ID] = true
+		normalized = append(normalized, section)
+	}
+	return normalized, nil
+}
+
+// HasSection reports whether the section belongs to the gallery
+func (g GalleryDB) HasSection(sectionId primitive.ObjectID) bool {
+	for _, section := range g.Sections {
+		if section.ID == sectionId {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+func TestNormalizeSections(t *testing.T) {
+	existing := primitive.NewObjectID()
+
+	sections, err := NormalizeSections([]GallerySection{
+		{ID: existing, Name: " Ceremony "},
+		{Name: "Reception"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if sections[0].ID != existing || sections[0].Name != "Ceremony" {
+		t.Errorf("Expected existing section to be kept and trimmed, got %+v", sections[0])
+	}
+	if sections[1].ID.IsZero() {
+		t.Errorf("Expected new section to get an ID")
+	}
+
+	if _, err := NormalizeSections([]GallerySection{{Name: "Portraits"}, {Name: "portraits"}}); err == nil {
+		t.Errorf("Expected duplicate names to be rejected")
+	}
+	if _, err := NormalizeSections([]GallerySection{{Name: "  "}}); err == nil {
+		t.Errorf("Expected empty name to be rejected")
+	}
+}
@@ -25,6 +25,8 @@ type Job struct {
 	CreatedAt   time.Time          `bson:"createdAt"`
 	ScheduledAt time.Time          `bson:"scheduledAt"`
 	StartedAt   *time.Time         `bson:"startedAt,omitempty"`
+	// LeaseUntil is when the worker running the job is assumed to have died unless it renews the lease
+	LeaseUntil  *time.Time         `bson:"leaseUntil,omitempty"`
 	CompletedAt *time.Time         `bson:"completedAt,omitempty"`
 	WorkerID    primitive.ObjectID `bson:"workerId,omitempty"`
 	Error       string             `bson:"error,omitempty"`
@@ -32,10 +34,23 @@ type Job struct {
 }
 
 type JobRepository interface {
-	GetJobsDue(ctx context.Context) ([]Job, error)
+	// GetJobsDue returns the due pending jobs of the types and their active jobs whose lease ran out, as their worker
+	// is assumed to have died
+	GetJobsDue(ctx context.Context, types []string) ([]Job, error)
 	CreateJob(ctx context.Context, job *Job) (primitive.ObjectID, error)
 	DeleteJob(ctx context.Context, jobId primitive.ObjectID) (Job, error)
 	RescheduleJob(ctx context.Context, jobId primitive.ObjectID, updatedScheduledAt time.Time) (Job, error)
+
+	// ClaimJob marks a pending job, or an active job whose lease ran out, as active for the worker until leaseUntil, it
+	// fails with mongo.ErrNoDocuments when another worker was faster
+	ClaimJob(ctx context.Context, jobId primitive.ObjectID, workerId primitive.ObjectID, leaseUntil time.Time) (Job, error)
+	// RenewJob extends the lease of a job the worker is running, it fails with mongo.ErrNoDocuments when the job was
+	// taken over by another worker
+	RenewJob(ctx context.Context, jobId primitive.ObjectID, workerId primitive.ObjectID, leaseUntil time.Time) error
+	// CompleteJob and FailJob only update jobs the worker still holds, they fail with mongo.ErrNoDocuments otherwise
+	CompleteJob(ctx context.Context, jobId primitive.ObjectID, workerId primitive.ObjectID) error
+	// FailJob reschedules the job at retryAt while it has retries left and marks it as failed otherwise
+	FailJob(ctx context.Context, jobId primitive.ObjectID, workerId primitive.ObjectID, jobErr error, retryAt time.Time) (Job, error)
 }
 
 type JobQueue interface {
@@ -53,6 +68,36 @@ type PhotoCleanupPayload struct {
 	PhotoId   primitive.ObjectID `bson:"photoId"`
 }
 
+const JobTypeOrderExport = "order.export"
+
+type OrderExportPayload struct {
+	OrderId primitive.ObjectID `json:"orderId"`
+}
+
+const JobTypeNotificationDelivery = "notification.deliver"
+
+const JobTypePhotoProcessing = "photo.processing"
+
+// PhotoProcessingPayload checks whether the previews of an uploaded photo were created
+type PhotoProcessingPayload struct {
+	PhotoId     primitive.ObjectID `json:"photoId"`
+	WorkspaceId primitive.ObjectID `json:"workspaceId"`
+}
+
+type NotificationDeliveryPayload struct {
+	NotificationId primitive.ObjectID `json:"notificationId"`
+}
+
+const JobTypeEmail = "email.send"
+
+// EmailPayload is a rendered email, so the job does not depend on data that may change before it runs
+type EmailPayload struct {
+	To      []string `json:"to"`
+	Subject string   `json:"subject"`
+	Text    string   `json:"text"`
+	HTML    string   `json:"html"`
+}
+
 func NewPhotoShareJob(payload PhotoSharePayload, scheduledAt time.Time) (*Job, error) {
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
@@ -88,3 +133,75 @@ func NewPhotoCleanupJob(payload PhotoCleanupPayload, scheduledAt time.Time) (*Jo
 		Retries:     3,
 	}, nil
 }
+
+func NewOrderExportJob(payload OrderExportPayload) (*Job, error) {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Job{
+		ID:          primitive.NewObjectID(),
+		Type:        JobTypeOrderExport,
+		Queue:       "orders",
+		Status:      JobStatusPending,
+		Payload:     jsonPayload,
+		CreatedAt:   time.Now().UTC(),
+		ScheduledAt: time.Now().UTC(),
+		Retries:     3,
+	}, nil
+}
+
+func NewNotificationDeliveryJob(payload NotificationDeliveryPayload) (*Job, error) {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Job{
+		ID:          primitive.NewObjectID(),
+		Type:        JobTypeNotificationDelivery,
+		Queue:       "notifications",
+		Status:      JobStatusPending,
+		Payload:     jsonPayload,
+		CreatedAt:   time.Now().UTC(),
+		ScheduledAt: time.Now().UTC(),
+		Retries:     3,
+	}, nil
+}
+
+func NewPhotoProcessingJob(payload PhotoProcessingPayload, scheduledAt time.Time) (*Job, error) {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Job{
+		ID:          primitive.NewObjectID(),
+		Type:        JobTypePhotoProcessing,
+		Queue:       "gallery",
+		Status:      JobStatusPending,
+		Payload:     jsonPayload,
+		CreatedAt:   time.Now().UTC(),
+		ScheduledAt: scheduledAt,
+		Retries:     5,
+	}, nil
+}
+
+func NewEmailJob(payload EmailPayload) (*Job, error) {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Job{
+		ID:          primitive.NewObjectID(),
+		Type:        JobTypeEmail,
+		Queue:       "emails",
+		Status:      JobStatusPending,
+		Payload:     jsonPayload,
+		CreatedAt:   time.Now().UTC(),
+		ScheduledAt: time.Now().UTC(),
+		Retries:     3,
+	}, nil
+}
@@ -0,0 +1,160 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+var (
+	ErrLocalUserExists = errors.New("user with this email already exists")
+	ErrLocalCodeUsedUp = errors.New("too many attempts for the code")
+)
+
+// MaxLocalCodeAttempts is how many times a one-time code can be tried before it is discarded, so a 6 digit code can
+// not be guessed
+const MaxLocalCodeAttempts = 5
+
+// LocalUserDB is an account of the local identity provider, which replaces Cognito in development and tests
+type LocalUserDB struct {
+	ID           primitive.ObjectID `bson:"_id"`
+	Email        string             `bson:"email"`
+	PasswordHash string             `bson:"passwordHash"`
+	Confirmed    bool               `bson:"confirmed"`
+	// ConfirmationCode and ResetCode are pending one-time codes, only their hashes are stored
+	ConfirmationCode *LocalUserCode      `bson:"confirmationCode,omitempty"`
+	ResetCode        *LocalUserCode      `bson:"resetCode,omitempty"`
+	RefreshTokens    []LocalRefreshToken `bson:"refreshTokens"`
+	// TOTPSecret is the authenticator app secret required when signing in, PendingTOTPSecret the one being set up.
+	// TOTPCounter is the time step of the last accepted code, so codes can not be replayed.
+	TOTPSecret        string `bson:"totpSecret,omitempty"`
+	PendingTOTPSecret string `bson:"pendingTotpSecret,omitempty"`
+	TOTPCounter       int64  `bson:"totpCounter,omitempty"`
+	// MFASession is the session of a sign in waiting for the authenticator app code
+	MFASession *LocalUserCode `bson:"mfaSession,omitempty"`
+	CreatedAt  time.Time      `bson:"createdAt"`
+	UpdatedAt  time.Time      `bson:"updatedAt"`
+}
+
+type LocalUserCode struct {
+	Hash      string    `bson:"hash"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+	Attempts  int       `bson:"attempts"`
+}
+
+type LocalRefreshToken struct {
+	Hash      string    `bson:"hash"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+type LocalUserRepository interface {
+	// CreateLocalUser fails with ErrLocalUserExists when the email is taken
+	CreateLocalUser(ctx context.Context, user *LocalUserDB) error
+	GetLocalUser(ctx context.Context, userId primitive.ObjectID) (LocalUserDB, error)
+	GetLocalUserByEmail(ctx context.Context, email string) (LocalUserDB, error)
+	GetLocalUserByRefreshToken(ctx context.Context, tokenHash string) (LocalUserDB, error)
+	UpdateLocalUser(ctx context.Context, userId primitive.ObjectID, opts ...LocalUserUpdateOption) error
+	// CountCodeAttempt atomically counts trying the one-time code stored in field, failing with ErrLocalCodeUsedUp
+	// when there is no code or it was tried MaxLocalCodeAttempts times
+	CountCodeAttempt(ctx context.Context, userId primitive.ObjectID, field string) error
+	AddRefreshToken(ctx context.Context, userId primitive.ObjectID, token LocalRefreshToken) error
+	RevokeRefreshToken(ctx context.Context, tokenHash string) error
+}
+
+type LocalUserUpdateOption func(*LocalUserUpdateOptions)
+
+type LocalUserUpdateOptions struct {
+	SetFields bson.D
+}
+
+// WithLocalUserConfirmed confirms the account and discards the confirmation code
+func WithLocalUserConfirmed() LocalUserUpdateOption {
+	return func(opts *LocalUserUpdateOptions) {
+		opts.SetFields = append(opts.SetFields,
+			bson.E{Key: "confirmed", Value: true},
+			bson.E{Key: "confirmationCode", Value: nil},
+		)
+	}
+}
+
+func WithConfirmationCode(code LocalUserCode) LocalUserUpdateOption {
+	return func(opts *LocalUserUpdateOptions) {
+		opts.SetFields = append(opts.SetFields, bson.E{Key: "confirmationCode", Value: code})
+	}
+}
+
+func WithResetCode(code LocalUserCode) LocalUserUpdateOption {
+	return func(opts *LocalUserUpdateOptions) {
+		opts.SetFields = append(opts.SetFields, bson.E{Key: "resetCode", Value: code})
+	}
+}
+
+// WithLocalUserPassword sets the bcrypt hash of a new password, which discards the reset code and signs the user out
+// of all devices
+func WithLocalUserPassword(passwordHash string) LocalUserUpdateOption {
+	return func(opts *LocalUserUpdateOptions) {
+		opts.SetFields = append(opts.SetFields,
+			bson.E{Key: "passwordHash", Value: passwordHash},
+			bson.E{Key: "resetCode", Value: nil},
+			bson.E{Key: "refreshTokens", Value: []LocalRefreshToken{}},
+		)
+	}
+}
+
+// WithoutRefreshTokens signs the user out of all devices
+func WithoutRefreshTokens() LocalUserUpdateOption {
+	return func(opts *LocalUserUpdateOptions) {
+		opts.SetFields = append(opts.SetFields, bson.E{Key: "refreshTokens", Value: []LocalRefreshToken{}})
+	}
+}
+
+func WithPendingTOTPSecret(secret string) LocalUserUpdateOption {
+	return func(opts *LocalUserUpdateOptions) {
+		opts.SetFields = append(opts.SetFields, bson.E{Key: "pendingTotpSecret", Value: secret})
+	}
+}
+
+// WithTOTPEnabled requires codes of the pending secret when signing in, counter is the time step of the code it was
+// verified with
+func WithTOTPEnabled(secret string, counter int64) LocalUserUpdateOption {
+	return func(opts *LocalUserUpdateOptions) {
+		opts.SetFields = append(opts.SetFields,
+			bson.E{Key: "totpSecret", Value: secret},
+			bson.E{Key: "pendingTotpSecret", Value: ""},
+			bson.E{Key: "totpCounter", Value: counter},
+		)
+	}
+}
+
+func WithoutTOTP() LocalUserUpdateOption {
+	return func(opts *LocalUserUpdateOptions) {
+		opts.SetFields = append(opts.SetFields,
+			bson.E{Key: "totpSecret", Value: ""},
+			bson.E{Key: "pendingTotpSecret", Value: ""},
+			bson.E{Key: "mfaSession", Value: nil},
+		)
+	}
+}
+
+func WithMFASession(session LocalUserCode) LocalUserUpdateOption {
+	return func(opts *LocalUserUpdateOptions) {
+		opts.SetFields = append(opts.SetFields, bson.E{Key: "mfaSession", Value: session})
+	}
+}
+
+// WithMFACompleted discards the sign in session and records the time step of the accepted code
+func WithMFACompleted(counter int64) LocalUserUpdateOption {
+	return func(opts *LocalUserUpdateOptions) {
+		opts.SetFields = append(opts.SetFields,
+			bson.E{Key: "mfaSession", Value: nil},
+			bson.E{Key: "totpCounter", Value: counter},
+		)
+	}
+}
+
+// Usable reports whether the code has not expired yet and can still be tried
+func (c *LocalUserCode) Usable(now time.Time) bool {
+	return c != nil && now.Before(c.ExpiresAt) && c.Attempts < MaxLocalCodeAttempts
+}
@@ -0,0 +1,157 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+var (
+	// ErrNotificationExists is returned when a notification with the same key was already created
+	ErrNotificationExists      = errors.New("notification already exists")
+	ErrInvalidNotificationType = errors.New("invalid notification type")
+	ErrInvalidChannel          = errors.New("invalid notification channel")
+)
+
+type NotificationType string
+
+const (
+	NotificationNewOrder           NotificationType = "new_order"
+	NotificationComment            NotificationType = "comment"
+	NotificationOrderMessage       NotificationType = "order_message"
+	NotificationSelectionSubmitted NotificationType = "selection_submitted"
+	NotificationGalleryViewed      NotificationType = "gallery_viewed"
+	NotificationExpiryUpcoming     NotificationType = "expiry_upcoming"
+	NotificationExportReady        NotificationType = "export_ready"
+	NotificationProcessingFailed   NotificationType = "processing_failed"
+)
+
+// NotificationChannel is where a notification is delivered to besides the in-app inbox, which keeps every notification
+type NotificationChannel string
+
+const (
+	ChannelPush  NotificationChannel = "push"
+	ChannelEmail NotificationChannel = "email"
+	ChannelNone  NotificationChannel = "none"
+)
+
+// defaultChannels are used for the types a user has not picked a channel for. Gallery views are frequent, so they
+// only show up in the inbox, and an expiring gallery is worth an email.
+var defaultChannels = map[NotificationType]NotificationChannel{
+	NotificationNewOrder:           ChannelPush,
+	NotificationComment:            ChannelPush,
+	NotificationOrderMessage:       ChannelPush,
+	NotificationSelectionSubmitted: ChannelPush,
+	NotificationGalleryViewed:      ChannelNone,
+	NotificationExpiryUpcoming:     ChannelEmail,
+	NotificationExportReady:        ChannelPush,
+	NotificationProcessingFailed:   ChannelPush,
+}
+
+func (t NotificationType) Valid() bool {
+	_, ok := defaultChannels[t]
+	return ok
+}
+
+func (c NotificationChannel) Valid() bool {
+	return c == ChannelPush || c == ChannelEmail || c == ChannelNone
+}
+
+// NotificationDB is an event a photographer is told about. Every notification is kept in the inbox, delivering it
+// over the channel picked in the preferences of the user is left to a job.
+type NotificationDB struct {
+	ID          primitive.ObjectID `bson:"_id" json:"id"`
+	UserId      string             `bson:"userId" json:"-"`
+	WorkspaceID primitive.ObjectID `bson:"workspaceId,omitempty" json:"workspaceId,omitempty"`
+	Type        NotificationType   `bson:"type" json:"type" example:"new_order"`
+	Title       string             `bson:"title" json:"title" example:"New order"`
+	Body        string             `bson:"body" json:"body" example:"anna@example.com ordered 12 photos"`
+	Data        map[string]string  `bson:"data,omitempty" json:"data,omitempty"`
+	// URL is opened when the notification is clicked
+	URL string `bson:"url,omitempty" json:"url,omitempty"`
+	// Key deduplicates notifications, a notification is not created again while one with the same key exists
+	Key          string              `bson:"key,omitempty" json:"-"`
+	ReadAt       *time.Time          `bson:"readAt,omitempty" json:"readAt,omitempty"`
+	DeliveredVia NotificationChannel `bson:"deliveredVia,omitempty" json:"deliveredVia,omitempty"`
+	DeliveredAt  *time.Time          `bson:"deliveredAt,omitempty" json:"deliveredAt,omitempty"`
+	CreatedAt    time.Time           `bson:"createdAt" json:"createdAt"`
+}
+
+// NotificationPreferencesDB holds the channel a user picked for each notification type
+type NotificationPreferencesDB struct {
+	UserId   string                                   `bson:"_id" json:"-"`
+	Channels map[NotificationType]NotificationChannel `bson:"channels" json:"channels"`
+	// Email is the address of the user taken from their token, email notifications are skipped until it is known
+	Email     string    `bson:"email,omitempty" json:"email,omitempty"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Channel returns the channel of the notification type, falling back to its default
+func (p NotificationPreferencesDB) Channel(t NotificationType) NotificationChannel {
+	if channel, ok := p.Channels[t]; ok && channel.Valid() {
+		return channel
+	}
+	return defaultChannels[t]
+}
+
+// DeliveryChannel is the channel notifications of the type are sent over, push is used instead of email until the
+// email address of the user is known
+func (p NotificationPreferencesDB) DeliveryChannel(t NotificationType) NotificationChannel {
+	channel := p.Channel(t)
+	if channel == ChannelEmail && p.Email == "" {
+		return ChannelPush
+	}
+	return channel
+}
+
+// WithDefaults returns the preferences with the channel of every notification type filled in
+func (p NotificationPreferencesDB) WithDefaults() NotificationPreferencesDB {
+	channels := make(map[NotificationType]NotificationChannel, len(defaultChannels))
+	for t := range defaultChannels {
+		channels[t] = p.Channel(t)
+	}
+	p.Channels = channels
+	return p
+}
+
+// ValidateChannels checks the channels picked for notification types
+func ValidateChannels(channels map[NotificationType]NotificationChannel) error {
+	for t, channel := range channels {
+		if !t.Valid() {
+			return ErrInvalidNotificationType
+		}
+		if !channel.Valid() {
+			return ErrInvalidChannel
+		}
+	}
+	return nil
+}
+
+type NotificationFilter struct {
+	UnreadOnly bool
+	// Before continues the list after the notification with this ID, notifications are listed newest first
+	Before primitive.ObjectID
+	Limit  int64
+}
+
+type NotificationPage struct {
+	Notifications []NotificationDB `json:"notifications"`
+	UnreadCount   int64            `json:"unreadCount"`
+	// Next is passed as before to get the next page, it is empty on the last page
+	Next string `json:"next,omitempty"`
+}
+
+type NotificationRepository interface {
+	GetNotifications(ctx context.Context, userId string, filter NotificationFilter) (NotificationPage, error)
+	GetNotification(ctx context.Context, notificationId primitive.ObjectID) (NotificationDB, error)
+	// CreateNotification fails with ErrNotificationExists when the user already has a notification with its key
+	CreateNotification(ctx context.Context, notification *NotificationDB) error
+	// MarkNotificationsRead marks the notifications of the user as read or unread, all of them when ids is empty
+	MarkNotificationsRead(ctx context.Context, userId string, ids []primitive.ObjectID, read bool) (int64, error)
+	MarkNotificationDelivered(ctx context.Context, notificationId primitive.ObjectID, channel NotificationChannel) error
+
+	GetNotificationPreferences(ctx context.Context, userId string) (NotificationPreferencesDB, error)
+	// UpdateNotificationPreferences sets the channels of the given types and the email when it is not empty
+	UpdateNotificationPreferences(ctx context.Context, userId string, channels map[NotificationType]NotificationChannel, email string) (NotificationPreferencesDB, error)
+}
@@ -0,0 +1,59 @@
+package domain
+
+import "testing"
+
+func TestNotificationPreferencesChannel(t *testing.T) {
+	preferences := NotificationPreferencesDB{
+		Channels: map[NotificationType]NotificationChannel{
+			NotificationNewOrder:      ChannelEmail,
+			NotificationGalleryViewed: NotificationChannel("sms"),
+		},
+	}
+
+	tests := []struct {
+		notificationType NotificationType
+		channel          NotificationChannel
+	}{
+		{NotificationNewOrder, ChannelEmail},
+		{NotificationComment, ChannelPush},
+		{NotificationGalleryViewed, ChannelNone},
+		{NotificationExpiryUpcoming, ChannelEmail},
+	}
+
+	for _, test := range tests {
+		if channel := preferences.Channel(test.notificationType); channel != test.channel {
+			t.Errorf("Expected %q to be delivered over %q, got %q", test.notificationType, test.channel, channel)
+		}
+	}
+
+	withDefaults := preferences.WithDefaults()
+	if len(withDefaults.Channels) != len(defaultChannels) {
+		t.Errorf("Expected a channel for each of the %d types, got %d", len(defaultChannels), len(withDefaults.Channels))
+	}
+	if withDefaults.Channels[NotificationNewOrder] != ChannelEmail {
+		t.Errorf("Expected the picked channel to be kept")
+	}
+}
+
+func TestNotificationPreferencesDeliveryChannel(t *testing.T) {
+	preferences := NotificationPreferencesDB{}
+	if channel := preferences.DeliveryChannel(NotificationExpiryUpcoming); channel != ChannelPush {
+		t.Errorf("Expected push without a known email, got %s", channel)
+	}
+	preferences.Email = "photographer@example.com"
+	if channel := preferences.DeliveryChannel(NotificationExpiryUpcoming); channel != ChannelEmail {
+		t.Errorf("Expected email, got %s", channel)
+	}
+}
+
+func TestValidateChannels(t *testing.T) {
+	if err := ValidateChannels(map[NotificationType]NotificationChannel{NotificationComment: ChannelNone}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := ValidateChannels(map[NotificationType]NotificationChannel{"invoice_paid": ChannelPush}); err != ErrInvalidNotificationType {
+		t.Errorf("Expected ErrInvalidNotificationType, got %v", err)
+	}
+	if err := ValidateChannels(map[NotificationType]NotificationChannel{NotificationComment: "sms"}); err != ErrInvalidChannel {
+		t.Errorf("Expected ErrInvalidChannel, got %v", err)
+	}
+}
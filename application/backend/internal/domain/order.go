@@ -10,40 +10,115 @@ import (
 type OrderStatus string
 
 const (
-	OrderStatusPending   OrderStatus = "pending"
-	OrderStatusCompleted OrderStatus = "completed"
+	OrderStatusPending        OrderStatus = "pending"
+	OrderStatusReadyForPickup OrderStatus = "ready_for_pickup"
+	OrderStatusShipped        OrderStatus = "shipped"
+	OrderStatusCompleted      OrderStatus = "completed"
 )
 
+func (s OrderStatus) Valid() bool {
+	switch s {
+	case OrderStatusPending, OrderStatusReadyForPickup, OrderStatusShipped, OrderStatusCompleted:
+		return true
+	}
+	return false
+}
+
+// Exportable reports whether the order was accepted by the photographer, so it can be sent to a print lab. Orders
+// are accepted by moving them on from pending.
+func (s OrderStatus) Exportable() bool {
+	switch s {
+	case OrderStatusReadyForPickup, OrderStatusShipped, OrderStatusCompleted:
+		return true
+	}
+	return false
+}
+
 type OrderDB struct {
-	ID          primitive.ObjectID `bson:"_id" json:"id"`
-	GalleryID   primitive.ObjectID `bson:"gallery_id" json:"galleryId"`
-	ClientEmail string             `bson:"client_email" json:"clientEmail"`
-	Comment     string             `bson:"comment" json:"comment"`
-	Status      OrderStatus        `bson:"status" json:"status"`
-	CreatedAt   time.Time          `bson:"created_at" json:"createdAt"`
-	UpdatedAt   time.Time          `bson:"updated_at" json:"updatedAt"`
-	Photos      []OrderPhoto       `bson:"photos" json:"photos"`
+	ID           primitive.ObjectID `bson:"_id" json:"id"`
+	UserId       string             `bson:"user_id" json:"userId"`
+	WorkspaceID  primitive.ObjectID `bson:"workspace_id" json:"workspaceId"`
+	GalleryID    primitive.ObjectID `bson:"gallery_id" json:"galleryId"`
+	CollectionID primitive.ObjectID `bson:"collection_id" json:"collectionId"`
+	ClientEmail  string             `bson:"client_email" json:"clientEmail"`
+	// ClientVerified is set when the client email was verified for the session the order was placed with
+	ClientVerified bool         `bson:"client_verified" json:"clientVerified"`
+	Comment        string       `bson:"comment" json:"comment"`
+	Status         OrderStatus  `bson:"status" json:"status"`
+	CreatedAt      time.Time    `bson:"created_at" json:"createdAt"`
+	UpdatedAt      time.Time    `bson:"updated_at" json:"updatedAt"`
+	Photos         []OrderPhoto `bson:"photos" json:"photos"`
+	CouponCode     string       `bson:"coupon_code,omitempty" json:"couponCode,omitempty"`
+	Export         *OrderExport `bson:"export,omitempty" json:"export,omitempty"`
+	OrderTotals    `bson:",inline"`
+}
+
+type OrderExportStatus string
+
+const (
+	OrderExportPending OrderExportStatus = "pending"
+	OrderExportReady   OrderExportStatus = "ready"
+	OrderExportFailed  OrderExportStatus = "failed"
+)
+
+// OrderExport tracks the print lab archive of an order built by the job scheduler
+type OrderExport struct {
+	Status      OrderExportStatus  `bson:"status" json:"status"`
+	JobID       primitive.ObjectID `bson:"job_id" json:"jobId"`
+	ObjectKey   string             `bson:"object_key,omitempty" json:"-"`
+	Error       string             `bson:"error,omitempty" json:"error,omitempty"`
+	RequestedAt time.Time          `bson:"requested_at" json:"requestedAt"`
+	CompletedAt *time.Time         `bson:"completed_at,omitempty" json:"completedAt,omitempty"`
 }
 
 type OrderPhoto struct {
-	PhotoID primitive.ObjectID `bson:"photo_id" json:"photoId"`
+	PhotoID   primitive.ObjectID `bson:"photo_id" json:"photoId"`
+	Product   string             `bson:"product,omitempty" json:"product,omitempty"`
+	Quantity  int                `bson:"quantity,omitempty" json:"quantity,omitempty"`
+	UnitPrice int64              `bson:"unit_price,omitempty" json:"unitPrice,omitempty"`
 }
 
 type OrderRepository interface {
 	// User endpoints
-	GetOrders(ctx context.Context, userId string) ([]OrderDB, error)
-	GetOrder(ctx context.Context, orderId primitive.ObjectID, userId string) (OrderDB, error)
-	UpdateOrder(ctx context.Context, orderId primitive.ObjectID, userId string, opts ...OrderUpdateOption) (OrderDB, error)
-	DeleteOrder(ctx context.Context, orderId primitive.ObjectID, userId string) error
+	GetOrders(ctx context.Context, workspaceId primitive.ObjectID, filter OrderFilter) (OrderPage, error)
+	GetOrder(ctx context.Context, orderId primitive.ObjectID, workspaceId primitive.ObjectID) (OrderDB, error)
+	UpdateOrder(ctx context.Context, orderId primitive.ObjectID, workspaceId primitive.ObjectID, opts ...OrderUpdateOption) (OrderDB, error)
+	DeleteOrder(ctx context.Context, orderId primitive.ObjectID, workspaceId primitive.ObjectID) error
+	// StartOrderExport sets the export of an order unless one is already pending, it fails with
+	// mongo.ErrNoDocuments when the order has a pending export or doesn't exist
+	StartOrderExport(ctx context.Context, orderId primitive.ObjectID, workspaceId primitive.ObjectID, export OrderExport) error
 
 	// Client endpoints
-	CreateOrder(ctx context.Context, galleryId primitive.ObjectID, clientEmail, comment string, photoIds []primitive.ObjectID) (string, error)
+	CreateOrder(ctx context.Context, order *OrderDB) (string, error)
+
+	// Job methods
+	GetOrderByID(ctx context.Context, orderId primitive.ObjectID) (OrderDB, error)
+	UpdateOrderExport(ctx context.Context, orderId primitive.ObjectID, export OrderExport) error
 
 	// Helper methods
-	OrderExists(ctx context.Context, orderId primitive.ObjectID, userId string) (bool, error)
+	OrderExists(ctx context.Context, orderId primitive.ObjectID, workspaceId primitive.ObjectID) (bool, error)
 	OrderExistsForGallery(ctx context.Context, galleryId primitive.ObjectID) (bool, error)
 }
 
+// OrderFilter narrows down the orders listing, zero values are ignored
+type OrderFilter struct {
+	Status       OrderStatus
+	GalleryID    primitive.ObjectID
+	CollectionID primitive.ObjectID
+	ClientEmail  string
+	From         time.Time
+	To           time.Time
+	// Query is matched case-insensitively against the order comment
+	Query  string
+	Limit  int64
+	Cursor *Cursor
+}
+
+type OrderPage struct {
+	Orders     []OrderDB
+	NextCursor *Cursor
+}
+
 type OrderUpdateOption func(*OrderUpdateOptions)
 
 type OrderUpdateOptions struct {
@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type MessageAuthor string
+
+const (
+	MessageAuthorPhotographer MessageAuthor = "photographer"
+	MessageAuthorClient       MessageAuthor = "client"
+)
+
+// OrderMessageDB is a single message in the conversation about an order. Messages are never edited, so the thread
+// replaces the overwritable order comment as the record of what was agreed.
+type OrderMessageDB struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	OrderID   primitive.ObjectID `bson:"order_id" json:"orderId"`
+	GalleryID primitive.ObjectID `bson:"gallery_id" json:"galleryId"`
+	UserId    string             `bson:"user_id" json:"-"`
+	Author    MessageAuthor      `bson:"author" json:"author" example:"client"`
+	Body      string             `bson:"body" json:"body" example:"Could the second photo be printed in black and white?"`
+	// PhotoIDs reference photos of the gallery the message is about
+	PhotoIDs []primitive.ObjectID `bson:"photo_ids" json:"photoIds"`
+	// ReadAt is set once the other party has read the message
+	ReadAt    *time.Time `bson:"read_at,omitempty" json:"readAt,omitempty"`
+	CreatedAt time.Time  `bson:"created_at" json:"createdAt"`
+}
+
+type OrderMessageRepository interface {
+	GetMessages(ctx context.Context, orderId primitive.ObjectID) ([]OrderMessageDB, error)
+	CreateMessage(ctx context.Context, message *OrderMessageDB) (string, error)
+	// MarkMessagesRead marks messages of the order not written by reader as read and returns how many were updated
+	MarkMessagesRead(ctx context.Context, orderId primitive.ObjectID, reader MessageAuthor) (int64, error)
+	DeleteMessages(ctx context.Context, orderId primitive.ObjectID) error
+}
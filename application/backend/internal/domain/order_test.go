@@ -0,0 +1,18 @@
+package domain
+
+import "testing"
+
+func TestOrderStatusExportable(t *testing.T) {
+	tests := map[OrderStatus]bool{
+		OrderStatusPending:        false,
+		OrderStatusReadyForPickup: true,
+		OrderStatusShipped:        true,
+		OrderStatusCompleted:      true,
+		OrderStatus("cancelled"):  false,
+	}
+	for status, want := range tests {
+		if got := status.Exportable(); got != want {
+			t.Errorf("%s.Exportable() = %v, want %v", status, got, want)
+		}
+	}
+}
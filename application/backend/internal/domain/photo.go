@@ -3,21 +3,91 @@ package domain
 import (
 	"context"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math"
 	"time"
 )
 
 type PhotoDB struct {
-	ID                 primitive.ObjectID `bson:"_id" json:"id"`
-	GalleryId          primitive.ObjectID `bson:"galleryId" json:"galleryId"`
-	CollectionId       primitive.ObjectID `bson:"collectionId" json:"collectionId"`
-	UserId             string             `bson:"userId" json:"userId"`
-	Status             PhotoStatus        `bson:"status" json:"status"`
-	CreatedAt          time.Time          `bson:"createdAt" json:"createdAt"`
-	UpdatedAt          time.Time          `bson:"updatedAt" json:"updatedAt"`
-	OriginalFilename   string             `bson:"originalFilename" json:"originalFilename"`
-	ObjectKey          string             `bson:"objectKey" json:"objectKey"`
-	ClientObjectKey    string             `bson:"clientObjectKey" json:"clientObjectKey"`
-	ThumbnailObjectKey string             `bson:"thumbnailObjectKey" json:"thumbnailObjectKey"`
+	ID                 primitive.ObjectID  `bson:"_id" json:"id"`
+	GalleryId          primitive.ObjectID  `bson:"galleryId" json:"galleryId"`
+	CollectionId       primitive.ObjectID  `bson:"collectionId" json:"collectionId"`
+	UserId             string              `bson:"userId" json:"userId"`
+	WorkspaceID        primitive.ObjectID  `bson:"workspaceId" json:"workspaceId"`
+	Status             PhotoStatus         `bson:"status" json:"status"`
+	CreatedAt          time.Time           `bson:"createdAt" json:"createdAt"`
+	UpdatedAt          time.Time           `bson:"updatedAt" json:"updatedAt"`
+	OriginalFilename   string              `bson:"originalFilename" json:"originalFilename"`
+	ObjectKey          string              `bson:"objectKey" json:"objectKey"`
+	ClientObjectKey    string              `bson:"clientObjectKey" json:"clientObjectKey"`
+	ThumbnailObjectKey string              `bson:"thumbnailObjectKey" json:"thumbnailObjectKey"`
+	SectionID          *primitive.ObjectID `bson:"sectionId,omitempty" json:"sectionId,omitempty"`
+	// Position is the manual order of the photo in the gallery, photos never placed go last
+	Position int64 `bson:"position" json:"position"`
+	// CapturedAt is when the photo was taken, the upload time when it is unknown
+	CapturedAt time.Time `bson:"capturedAt" json:"capturedAt"`
+	// VisibleToClient hides the photo from clients when false, e.g. outtakes or photos pending retouch
+	VisibleToClient bool `bson:"visibleToClient" json:"visibleToClient"`
+}
+
+// NewPhoto describes a photo about to be uploaded
+type NewPhoto struct {
+	OriginalFilename string
+	// CapturedAt of zero means the capture time is unknown
+	CapturedAt time.Time
+}
+
+// UnplacedPosition is the position of photos that were not placed manually
+const UnplacedPosition int64 = math.MaxInt64
+
+// PhotoSortOrder is how gallery photos are ordered
+type PhotoSortOrder string
+
+const (
+	// SortByUpload is the default order, oldest uploads first
+	SortByUpload     PhotoSortOrder = ""
+	SortManual       PhotoSortOrder = "manual"
+	SortByCapturedAt PhotoSortOrder = "capturedAt"
+	SortByFilename   PhotoSortOrder = "filename"
+)
+
+func (o PhotoSortOrder) Valid() bool {
+	switch o {
+	case SortByUpload, SortManual, SortByCapturedAt, SortByFilename:
+		return true
+	}
+	return false
+}
+
+// PhotoFilter narrows down the photos of a gallery, a Limit of 0 returns all of them
+type PhotoFilter struct {
+	Sort PhotoSortOrder
+	// SectionID limits the photos to one section of the gallery
+	SectionID *primitive.ObjectID
+	// VisibleToClient limits the photos to the shown or hidden ones
+	VisibleToClient *bool
+	Limit           int64
+	Cursor          *Cursor
+}
+
+type PhotoPage struct {
+	Photos     []PhotoDB
+	NextCursor *Cursor
+	// Total counts the photos matching the filter on all pages
+	Total int64
+}
+
+// SortValue returns the value of the field the photo is sorted by, stored in the cursor of the page it ends
+func (p PhotoDB) SortValue(order PhotoSortOrder) interface{} {
+	switch order {
+	case SortManual:
+		return p.Position
+	case SortByCapturedAt:
+		return p.CapturedAt
+	case SortByFilename:
+		return p.OriginalFilename
+	default:
+		return p.ID
+	}
 }
 
 type PhotoStatus int64
@@ -30,17 +100,28 @@ const (
 )
 
 type PhotoRepository interface {
-	PhotoExists(ctx context.Context, photoId primitive.ObjectID, userId string) (bool, error)
-	GalleryPhotoCount(ctx context.Context, galleryId primitive.ObjectID, userId string) (int64, error)
-	GetPhotos(ctx context.Context, galleryId primitive.ObjectID, userId string) ([]PhotoDB, error)
-	GetPhoto(ctx context.Context, photoId primitive.ObjectID, userId string) (PhotoDB, error)
-	CreatePhoto(ctx context.Context, collectionId primitive.ObjectID, galleryId primitive.ObjectID, originalFilename string, userId string) (primitive.ObjectID, error)
-	CreatePhotos(ctx context.Context, collectionId primitive.ObjectID, galleryId primitive.ObjectID, originalFilename []string, userId string) ([]primitive.ObjectID, error)
-	DeletePhoto(ctx context.Context, photoId primitive.ObjectID, userId string) error
-	SoftDeletePhoto(ctx context.Context, photoId primitive.ObjectID, userId string) error
-	DeletePhotos(ctx context.Context, photoIds []primitive.ObjectID, userId string) error
-	UpdatePhoto(ctx context.Context, photoId primitive.ObjectID, status PhotoStatus, userId string) (PhotoDB, error)
-	GetSharedPhotosByGallery(ctx context.Context, galleryId primitive.ObjectID) ([]PhotoDB, error)
+	PhotoExists(ctx context.Context, photoId primitive.ObjectID, workspaceId primitive.ObjectID) (bool, error)
+	GalleryPhotoCount(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID) (int64, error)
+	GetPhotos(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID, filter PhotoFilter) (PhotoPage, error)
+	GetPhoto(ctx context.Context, photoId primitive.ObjectID, workspaceId primitive.ObjectID) (PhotoDB, error)
+	GetPhotosByIds(ctx context.Context, photoIds []primitive.ObjectID, workspaceId primitive.ObjectID) ([]PhotoDB, error)
+	CreatePhoto(ctx context.Context, collectionId primitive.ObjectID, galleryId primitive.ObjectID, originalFilename string, workspaceId primitive.ObjectID, userId string) (primitive.ObjectID, error)
+	CreatePhotos(ctx context.Context, collectionId primitive.ObjectID, galleryId primitive.ObjectID, photos []NewPhoto, workspaceId primitive.ObjectID, userId string) ([]primitive.ObjectID, error)
+	DeletePhoto(ctx context.Context, photoId primitive.ObjectID, workspaceId primitive.ObjectID) error
+	SoftDeletePhoto(ctx context.Context, photoId primitive.ObjectID, workspaceId primitive.ObjectID) error
+	DeletePhotos(ctx context.Context, photoIds []primitive.ObjectID, workspaceId primitive.ObjectID) error
+	UpdatePhoto(ctx context.Context, photoId primitive.ObjectID, status PhotoStatus, workspaceId primitive.ObjectID) (PhotoDB, error)
+	GetSharedPhotosByGallery(ctx context.Context, galleryId primitive.ObjectID, filter PhotoFilter) (PhotoPage, error)
 	GetSharedPhotoById(ctx context.Context, photoId primitive.ObjectID) (PhotoDB, error)
 	VerifyPhotosInGallery(ctx context.Context, galleryId primitive.ObjectID, photoIds []primitive.ObjectID) (bool, error)
+	// VerifySharedPhotosInGallery is VerifyPhotosInGallery for photos clients can see
+	VerifySharedPhotosInGallery(ctx context.Context, galleryId primitive.ObjectID, photoIds []primitive.ObjectID) (bool, error)
+	// SetPhotosVisibility shows or hides the photos of the gallery from clients, returning how many photos matched
+	SetPhotosVisibility(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID, photoIds []primitive.ObjectID, visible bool) (int64, error)
+	// ReorderPhotos places the photos in the given order, the remaining photos of the gallery go after them
+	ReorderPhotos(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID, photoIds []primitive.ObjectID) error
+	// AssignSection moves the photos to the section, nil removes them from their section
+	AssignSection(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID, photoIds []primitive.ObjectID, sectionId *primitive.ObjectID) (int64, error)
+	// ClearSections removes the photos of the gallery from all sections except the kept ones
+	ClearSections(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID, keep []primitive.ObjectID) error
 }
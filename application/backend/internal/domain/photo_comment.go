@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Pin is a point on the photo the comment refers to, normalized to 0-1 so it does not depend on the rendered size
+type Pin struct {
+	X float64 `bson:"x" json:"x" example:"0.42"`
+	Y float64 `bson:"y" json:"y" example:"0.17"`
+}
+
+// PhotoCommentDB is a comment or retouch request on a single photo. Top level comments start a thread, replies
+// reference them with ParentID.
+type PhotoCommentDB struct {
+	ID          primitive.ObjectID  `bson:"_id" json:"id"`
+	PhotoID     primitive.ObjectID  `bson:"photoId" json:"photoId"`
+	GalleryID   primitive.ObjectID  `bson:"galleryId" json:"galleryId"`
+	UserId      string              `bson:"userId" json:"-"`
+	WorkspaceID primitive.ObjectID  `bson:"workspaceId" json:"-"`
+	ParentID    *primitive.ObjectID `bson:"parentId,omitempty" json:"parentId,omitempty"`
+	Author      MessageAuthor       `bson:"author" json:"author" example:"client"`
+	// ClientEmail is known when the client identified themselves, it is empty for photographer replies
+	ClientEmail string    `bson:"clientEmail,omitempty" json:"clientEmail,omitempty"`
+	Body        string    `bson:"body" json:"body" example:"Please remove the sign in the background"`
+	Pin         *Pin      `bson:"pin,omitempty" json:"pin,omitempty"`
+	CreatedAt   time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+type PhotoCommentRepository interface {
+	GetComments(ctx context.Context, photoId primitive.ObjectID) ([]PhotoCommentDB, error)
+	GetGalleryComments(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID) ([]PhotoCommentDB, error)
+	GetComment(ctx context.Context, commentId primitive.ObjectID) (PhotoCommentDB, error)
+	CreateComment(ctx context.Context, comment *PhotoCommentDB) (string, error)
+}
+
+func (p Pin) Validate() error {
+	if p.X < 0 || p.X > 1 || p.Y < 0 || p.Y > 1 {
+		return errors.New("pin coordinates must be between 0 and 1")
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var (
+	ErrUnknownProduct  = errors.New("unknown product")
+	ErrInvalidQuantity = errors.New("invalid quantity")
+	ErrOrderTooLarge   = errors.New("order total is too large")
+)
+
+// MaxOrderQuantity is the most copies of a photo a client can order at once
+const MaxOrderQuantity = 1000
+
+// Pricing describes what clients can order from a gallery. All amounts are in minor currency units.
+type Pricing struct {
+	Currency string    `bson:"currency" json:"currency" example:"PLN"`
+	Products []Product `bson:"products" json:"products"`
+	// IncludedDigital is the number of digital downloads included with the photographer's package
+	IncludedDigital int `bson:"includedDigital" json:"includedDigital"`
+	// FreePrints is the number of prints the client can order free of charge
+	FreePrints int `bson:"freePrints" json:"freePrints"`
+}
+
+type Product struct {
+	Code    string `bson:"code" json:"code" example:"print-10x15"`
+	Name    string `bson:"name" json:"name" example:"Print 10x15cm"`
+	Price   int64  `bson:"price" json:"price" example:"1500"`
+	Digital bool   `bson:"digital" json:"digital"`
+}
+
+type OrderDiscount struct {
+	Description string `bson:"description" json:"description" example:"Coupon SUMMER10"`
+	Amount      int64  `bson:"amount" json:"amount" example:"500"`
+	CouponCode  string `bson:"couponCode,omitempty" json:"couponCode,omitempty"`
+}
+
+type OrderTotals struct {
+	Currency  string          `bson:"currency" json:"currency"`
+	Subtotal  int64           `bson:"subtotal" json:"subtotal"`
+	Discounts []OrderDiscount `bson:"discounts" json:"discounts"`
+	Total     int64           `bson:"total" json:"total"`
+}
+
+// FormatAmount formats an amount in minor currency units, e.g. 1250 PLN as "12.50 PLN"
+func FormatAmount(amount int64, currency string) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s%d.%02d %s", sign, amount/100, amount%100, currency))
+}
+
+func (p Pricing) Product(code string) (Product, bool) {
+	for _, product := range p.Products {
+		if product.Code == code {
+			return product, true
+		}
+	}
+	return Product{}, false
+}
+
+func (p Pricing) Validate() error {
+	seen := make(map[string]bool, len(p.Products))
+	for _, product := range p.Products {
+		if product.Code == "" {
+			return errors.New("product code is required")
+		}
+		if seen[product.Code] {
+			return fmt.Errorf("duplicate product code %q", product.Code)
+		}
+		if product.Price < 0 {
+			return fmt.Errorf("negative price for product %q", product.Code)
+		}
+		seen[product.Code] = true
+	}
+	if p.IncludedDigital < 0 || p.FreePrints < 0 {
+		return errors.New("allowances can not be negative")
+	}
+	return nil
+}
+
+// PriceOrder sets unit prices on the ordered photos and computes the order totals.
+// Package allowances are applied first, in the order the photos were selected, and the coupon, if any, is applied
+// to what remains.
+func PriceOrder(pricing Pricing, photos []OrderPhoto, coupon *CouponDB) (OrderTotals, error) {
+	totals := OrderTotals{
+		Currency:  pricing.Currency,
+		Discounts: make([]OrderDiscount, 0),
+	}
+
+	var includedDigital, freePrints int64
+	digitalLeft, printsLeft := pricing.IncludedDigital, pricing.FreePrints
+	for i := range photos {
+		if photos[i].Quantity <= 0 {
+			photos[i].Quantity = 1
+		}
+		if photos[i].Quantity > MaxOrderQuantity {
+			return OrderTotals{}, ErrInvalidQuantity
+		}
+		if photos[i].Product == "" && len(pricing.Products) == 0 {
+			continue
+		}
+		product, ok := pricing.Product(photos[i].Product)
+		if !ok {
+			return OrderTotals{}, fmt.Errorf("%w: %q", ErrUnknownProduct, photos[i].Product)
+		}
+		photos[i].UnitPrice = product.Price
+		quantity := int64(photos[i].Quantity)
+		if product.Price > (math.MaxInt64-totals.Subtotal)/quantity {
+			return OrderTotals{}, ErrOrderTooLarge
+		}
+		totals.Subtotal += product.Price * quantity
+
+		// the free units never cost more than the subtotal, so they can not overflow
+		if product.Digital {
+			free := min(photos[i].Quantity, digitalLeft)
+			includedDigital += product.Price * int64(free)
+			digitalLeft -= free
+		} else {
+			free := min(photos[i].Quantity, printsLeft)
+			freePrints += product.Price * int64(free)
+			printsLeft -= free
+		}
+	}
+
+	if includedDigital > 0 {
+		totals.Discounts = append(totals.Discounts, OrderDiscount{
+			Description: "Digital downloads included with the package",
+			Amount:      includedDigital,
+		})
+	}
+	if freePrints > 0 {
+		totals.Discounts = append(totals.Discounts, OrderDiscount{
+			Description: "Free prints",
+			Amount:      freePrints,
+		})
+	}
+
+	remaining := totals.Subtotal - includedDigital - freePrints
+	if coupon != nil && remaining > 0 {
+		var amount int64
+		switch coupon.Type {
+		case CouponTypePercentage:
+			amount = remaining * coupon.Value / 100
+		case CouponTypeFixed:
+			amount = min(coupon.Value, remaining)
+		}
+		if amount > 0 {
+			totals.Discounts = append(totals.Discounts, OrderDiscount{
+				Description: "Coupon " + coupon.Code,
+				Amount:      amount,
+				CouponCode:  coupon.Code,
+			})
+			remaining -= amount
+		}
+	}
+	totals.Total = remaining
+
+	return totals, nil
+}
@@ -0,0 +1,114 @@
+package domain
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math"
+	"testing"
+	"time"
+)
+
+var testPricing = Pricing{
+	Currency: "PLN",
+	Products: []Product{
+		{Code: "digital", Name: "Digital download", Price: 1000, Digital: true},
+		{Code: "print-10x15", Name: "Print 10x15cm", Price: 500},
+	},
+	IncludedDigital: 2,
+	FreePrints:      1,
+}
+
+func TestPriceOrderAllowances(t *testing.T) {
+	photos := []OrderPhoto{
+		{PhotoID: primitive.NewObjectID(), Product: "digital", Quantity: 3},
+		{PhotoID: primitive.NewObjectID(), Product: "print-10x15", Quantity: 2},
+	}
+
+	totals, err := PriceOrder(testPricing, photos, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if totals.Subtotal != 4000 {
+		t.Errorf("Expected subtotal 4000, got %d", totals.Subtotal)
+	}
+	if len(totals.Discounts) != 2 {
+		t.Fatalf("Expected 2 discount lines, got %d", len(totals.Discounts))
+	}
+	if totals.Discounts[0].Amount != 2000 || totals.Discounts[1].Amount != 500 {
+		t.Errorf("Unexpected discount amounts: %+v", totals.Discounts)
+	}
+	if totals.Total != 1500 {
+		t.Errorf("Expected total 1500, got %d", totals.Total)
+	}
+	if photos[0].UnitPrice != 1000 || photos[1].UnitPrice != 500 {
+		t.Error("Expected unit prices to be set on ordered photos")
+	}
+}
+
+func TestPriceOrderCoupons(t *testing.T) {
+	photos := []OrderPhoto{{PhotoID: primitive.NewObjectID(), Product: "print-10x15", Quantity: 5}}
+	pricing := testPricing
+	pricing.FreePrints = 0
+
+	totals, err := PriceOrder(pricing, photos, &CouponDB{Code: "TEN", Type: CouponTypePercentage, Value: 10})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if totals.Total != 2250 {
+		t.Errorf("Expected total 2250 after percentage coupon, got %d", totals.Total)
+	}
+
+	// Fixed coupons never bring the total below zero
+	totals, err = PriceOrder(pricing, photos, &CouponDB{Code: "BIG", Type: CouponTypeFixed, Value: 10000})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if totals.Total != 0 || totals.Discounts[0].Amount != 2500 {
+		t.Errorf("Expected fixed coupon to be capped at the subtotal, got %+v", totals)
+	}
+}
+
+func TestPriceOrderUnknownProduct(t *testing.T) {
+	photos := []OrderPhoto{{PhotoID: primitive.NewObjectID(), Product: "canvas"}}
+	if _, err := PriceOrder(testPricing, photos, nil); !errors.Is(err, ErrUnknownProduct) {
+		t.Errorf("Expected ErrUnknownProduct, got %v", err)
+	}
+
+	// Galleries without pricing accept plain photo selections
+	if _, err := PriceOrder(Pricing{}, []OrderPhoto{{PhotoID: primitive.NewObjectID()}}, nil); err != nil {
+		t.Errorf("Expected unpriced order to be accepted, got %v", err)
+	}
+}
+
+func TestPriceOrderLimits(t *testing.T) {
+	photos := []OrderPhoto{{PhotoID: primitive.NewObjectID(), Product: "print-10x15", Quantity: MaxOrderQuantity + 1}}
+	if _, err := PriceOrder(testPricing, photos, nil); !errors.Is(err, ErrInvalidQuantity) {
+		t.Errorf("Expected ErrInvalidQuantity, got %v", err)
+	}
+
+	pricing := Pricing{Products: []Product{{Code: "print", Price: math.MaxInt64 / 2}}}
+	photos = []OrderPhoto{{PhotoID: primitive.NewObjectID(), Product: "print", Quantity: 3}}
+	if _, err := PriceOrder(pricing, photos, nil); !errors.Is(err, ErrOrderTooLarge) {
+		t.Errorf("Expected ErrOrderTooLarge, got %v", err)
+	}
+}
+
+func TestCouponValidate(t *testing.T) {
+	galleryId := primitive.NewObjectID()
+	now := time.Now().UTC()
+
+	if err := (CouponDB{ExpiresAt: now.Add(-time.Hour)}).Validate(galleryId, now); !errors.Is(err, ErrCouponExpired) {
+		t.Errorf("Expected ErrCouponExpired, got %v", err)
+	}
+	if err := (CouponDB{MaxUses: 1, Uses: 1}).Validate(galleryId, now); !errors.Is(err, ErrCouponExhausted) {
+		t.Errorf("Expected ErrCouponExhausted, got %v", err)
+	}
+	otherGallery := primitive.NewObjectID()
+	if err := (CouponDB{GalleryId: &otherGallery}).Validate(galleryId, now); !errors.Is(err, ErrCouponNotApplicable) {
+		t.Errorf("Expected ErrCouponNotApplicable, got %v", err)
+	}
+	if err := (CouponDB{GalleryId: &galleryId, MaxUses: 2, Uses: 1}).Validate(galleryId, now); err != nil {
+		t.Errorf("Expected coupon to be valid, got %v", err)
+	}
+}
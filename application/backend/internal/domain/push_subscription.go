@@ -0,0 +1,46 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+)
+
+var ErrInvalidDeviceLabel = errors.New("device label must be at most 100 characters long")
+
+// MaxPushSubscriptions limits the devices of a user, subscribing another device replaces the one seen least recently
+const MaxPushSubscriptions = 20
+
+// PushSubscriptionDB is a device of a photographer registered for push notifications. A device token belongs to
+// one user at a time, subscribing it again moves it to the user signed in on the device.
+type PushSubscriptionDB struct {
+	ID     primitive.ObjectID `bson:"_id" json:"id"`
+	UserId string             `bson:"userId" json:"-"`
+	Token  string             `bson:"token" json:"-"`
+	// Device is a label the client picks to tell its devices apart
+	Device     string    `bson:"device,omitempty" json:"device,omitempty" example:"Chrome on MacBook"`
+	LastSeenAt time.Time `bson:"lastSeenAt" json:"lastSeenAt"`
+	CreatedAt  time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+type PushSubscriptionRepository interface {
+	GetPushSubscriptions(ctx context.Context, userId string) ([]PushSubscriptionDB, error)
+	// GetPushTokens returns the device tokens of the users
+	GetPushTokens(ctx context.Context, userIds []string) ([]string, error)
+	// SavePushSubscription subscribes the device token for the user or refreshes its label and last seen time
+	SavePushSubscription(ctx context.Context, subscription *PushSubscriptionDB) error
+	DeletePushSubscription(ctx context.Context, subscriptionId primitive.ObjectID, userId string) error
+	DeletePushSubscriptionByToken(ctx context.Context, token string, userId string) error
+	// DeletePushTokens removes device tokens FCM no longer accepts, whoever they belong to
+	DeletePushTokens(ctx context.Context, tokens []string) error
+}
+
+func NormalizeDeviceLabel(device string) (string, error) {
+	device = strings.TrimSpace(device)
+	if len(device) > 100 {
+		return "", ErrInvalidDeviceLabel
+	}
+	return device, nil
+}
@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+var (
+	ErrSelectionLimitReached = errors.New("selection limit reached")
+	ErrSelectionSubmitted    = errors.New("selection already submitted")
+)
+
+// Proofing configures how many photos clients have to choose, e.g. 30 photos for the album. Zero means no limit.
+type Proofing struct {
+	MinSelection int `bson:"minSelection" json:"minSelection" example:"30"`
+	MaxSelection int `bson:"maxSelection" json:"maxSelection" example:"30"`
+}
+
+// SelectionDB holds the photos a client marked as favorites in a gallery
+type SelectionDB struct {
+	ID          primitive.ObjectID   `bson:"_id" json:"id"`
+	GalleryID   primitive.ObjectID   `bson:"galleryId" json:"galleryId"`
+	UserId      string               `bson:"userId" json:"-"`
+	WorkspaceID primitive.ObjectID   `bson:"workspaceId" json:"-"`
+	ClientEmail string               `bson:"clientEmail" json:"clientEmail"`
+	PhotoIDs    []primitive.ObjectID `bson:"photoIds" json:"photoIds"`
+	// SubmittedAt is set once the client confirmed the selection, it can not be changed afterwards
+	SubmittedAt *time.Time `bson:"submittedAt,omitempty" json:"submittedAt,omitempty"`
+	CreatedAt   time.Time  `bson:"createdAt" json:"createdAt"`
+	UpdatedAt   time.Time  `bson:"updatedAt" json:"updatedAt"`
+}
+
+type SelectionRepository interface {
+	GetSelections(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID) ([]SelectionDB, error)
+	GetSelection(ctx context.Context, galleryId primitive.ObjectID, clientEmail string) (SelectionDB, error)
+	// AddPhoto adds the photo to the client's selection, creating it if needed. It fails with ErrSelectionLimitReached
+	// when the selection already holds maxSelection photos and with ErrSelectionSubmitted once it was submitted.
+	AddPhoto(ctx context.Context, gallery GalleryDB, clientEmail string, photoId primitive.ObjectID) (SelectionDB, error)
+	RemovePhoto(ctx context.Context, galleryId primitive.ObjectID, clientEmail string, photoId primitive.ObjectID) (SelectionDB, error)
+	SubmitSelection(ctx context.Context, galleryId primitive.ObjectID, clientEmail string) (SelectionDB, error)
+}
+
+func (p Proofing) Validate() error {
+	if p.MinSelection < 0 || p.MaxSelection < 0 {
+		return errors.New("selection limits can not be negative")
+	}
+	if p.MaxSelection > 0 && p.MinSelection > p.MaxSelection {
+		return errors.New("minimum selection can not exceed the maximum")
+	}
+	return nil
+}
+
+// CheckSelection reports whether a selection of count photos can be submitted
+func (p Proofing) CheckSelection(count int) error {
+	if count < p.MinSelection {
+		return fmt.Errorf("select at least %d photos", p.MinSelection)
+	}
+	if p.MaxSelection > 0 && count > p.MaxSelection {
+		return fmt.Errorf("select at most %d photos", p.MaxSelection)
+	}
+	return nil
+}
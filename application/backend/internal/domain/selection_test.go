@@ -0,0 +1,26 @@
+package domain
+
+import "testing"
+
+func TestProofing(t *testing.T) {
+	album := Proofing{MinSelection: 30, MaxSelection: 30}
+	if err := album.Validate(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := album.CheckSelection(29); err == nil {
+		t.Error("Expected selection below the minimum to be rejected")
+	}
+	if err := album.CheckSelection(30); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := album.CheckSelection(31); err == nil {
+		t.Error("Expected selection above the maximum to be rejected")
+	}
+
+	if err := (Proofing{MinSelection: 5}).CheckSelection(500); err != nil {
+		t.Errorf("Expected no maximum when it is 0, got %v", err)
+	}
+	if err := (Proofing{MinSelection: 10, MaxSelection: 5}).Validate(); err == nil {
+		t.Error("Expected minimum above the maximum to be rejected")
+	}
+}
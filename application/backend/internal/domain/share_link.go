@@ -0,0 +1,167 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+	"time"
+)
+
+var (
+	ErrShareLinkRevoked     = errors.New("share link revoked")
+	ErrShareLinkExpired     = errors.New("share link expired")
+	ErrShareLinkExhausted   = errors.New("share link usage limit reached")
+	ErrInvalidSharePassword = errors.New("password must be between 4 and 72 characters long")
+)
+
+type SharePermission string
+
+const (
+	PermissionView     SharePermission = "view"
+	PermissionDownload SharePermission = "download"
+	PermissionOrder    SharePermission = "order"
+	PermissionComment  SharePermission = "comment"
+)
+
+type SharePermissions struct {
+	View bool `bson:"view" json:"view"`
+	// Download allows downloading original files and whole galleries as archives
+	Download bool `bson:"download" json:"download"`
+	Order    bool `bson:"order" json:"order"`
+	Comment  bool `bson:"comment" json:"comment"`
+}
+
+// FullAccess is what the gallery access token grants, it predates share links
+var FullAccess = SharePermissions{View: true, Download: true, Order: true, Comment: true}
+
+// ShareLinkDB is one of many links a gallery can be shared with, e.g. one for the couple and one for the guests
+type ShareLinkDB struct {
+	ID          primitive.ObjectID `bson:"_id" json:"id"`
+	GalleryID   primitive.ObjectID `bson:"galleryId" json:"galleryId"`
+	UserId      string             `bson:"userId" json:"-"`
+	WorkspaceID primitive.ObjectID `bson:"workspaceId" json:"-"`
+	Label       string             `bson:"label" json:"label" example:"Wedding guests"`
+	Token       string             `bson:"token" json:"token"`
+	Url         string             `bson:"url" json:"url"`
+	Permissions SharePermissions   `bson:"permissions" json:"permissions"`
+	// ExpiresAt of zero means the link does not expire
+	ExpiresAt time.Time `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	// MaxUses limits how many times the gallery can be opened with the link, 0 means unlimited
+	MaxUses int64 `bson:"maxUses" json:"maxUses"`
+	Uses    int64 `bson:"uses" json:"uses"`
+	// Downloads counts the archives downloaded with the link
+	Downloads int64 `bson:"downloads" json:"downloads"`
+	// PasswordHash is the bcrypt hash of the password or PIN protecting the link, clients have to unlock it first
+	PasswordHash string `bson:"passwordHash,omitempty" json:"-"`
+	Protected    bool   `bson:"protected" json:"protected"`
+	// RequireEmail makes clients verify their email before accessing the gallery with the link
+	RequireEmail bool       `bson:"requireEmail" json:"requireEmail"`
+	RevokedAt    *time.Time `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+	CreatedAt    time.Time  `bson:"createdAt" json:"createdAt"`
+	UpdatedAt    time.Time  `bson:"updatedAt" json:"updatedAt"`
+}
+
+type ShareLinkRepository interface {
+	GetShareLinks(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID) ([]ShareLinkDB, error)
+	GetShareLink(ctx context.Context, linkId primitive.ObjectID, workspaceId primitive.ObjectID) (ShareLinkDB, error)
+	GetShareLinkByToken(ctx context.Context, token string) (ShareLinkDB, error)
+	CreateShareLink(ctx context.Context, link *ShareLinkDB) (string, error)
+	UpdateShareLink(ctx context.Context, linkId primitive.ObjectID, workspaceId primitive.ObjectID, opts ...ShareLinkUpdateOption) (ShareLinkDB, error)
+	RevokeShareLink(ctx context.Context, linkId primitive.ObjectID, workspaceId primitive.ObjectID) (ShareLinkDB, error)
+	// UseShareLink atomically counts opening the gallery, failing with ErrShareLinkExhausted when the limit is reached
+	UseShareLink(ctx context.Context, linkId primitive.ObjectID) error
+	CountDownload(ctx context.Context, linkId primitive.ObjectID) error
+}
+
+type ShareLinkUpdateOption func(*ShareLinkUpdateOptions)
+
+type ShareLinkUpdateOptions struct {
+	SetFields bson.D
+}
+
+func WithShareLinkLabel(label string) ShareLinkUpdateOption {
+	return func(opts *ShareLinkUpdateOptions) {
+		opts.SetFields = append(opts.SetFields, bson.E{Key: "label", Value: label})
+	}
+}
+
+func WithShareLinkPermissions(permissions SharePermissions) ShareLinkUpdateOption {
+	return func(opts *ShareLinkUpdateOptions) {
+		opts.SetFields = append(opts.SetFields, bson.E{Key: "permissions", Value: permissions})
+	}
+}
+
+func WithShareLinkExpiry(expiresAt time.Time) ShareLinkUpdateOption {
+	return func(opts *ShareLinkUpdateOptions) {
+		opts.SetFields = append(opts.SetFields, bson.E{Key: "expiresAt", Value: expiresAt})
+	}
+}
+
+func WithShareLinkMaxUses(maxUses int64) ShareLinkUpdateOption {
+	return func(opts *ShareLinkUpdateOptions) {
+		opts.SetFields = append(opts.SetFields, bson.E{Key: "maxUses", Value: maxUses})
+	}
+}
+
+func WithShareLinkRequireEmail(requireEmail bool) ShareLinkUpdateOption {
+	return func(opts *ShareLinkUpdateOptions) {
+		opts.SetFields = append(opts.SetFields, bson.E{Key: "requireEmail", Value: requireEmail})
+	}
+}
+
+// WithShareLinkPassword sets the bcrypt hash protecting the link, an empty hash removes the protection
+func WithShareLinkPassword(passwordHash string) ShareLinkUpdateOption {
+	return func(opts *ShareLinkUpdateOptions) {
+		opts.SetFields = append(opts.SetFields,
+			bson.E{Key: "passwordHash", Value: passwordHash},
+			bson.E{Key: "protected", Value: passwordHash != ""},
+		)
+	}
+}
+
+func (p SharePermissions) Allows(permission SharePermission) bool {
+	switch permission {
+	case PermissionView:
+		return p.View
+	case PermissionDownload:
+		return p.Download
+	case PermissionOrder:
+		return p.Order
+	case PermissionComment:
+		return p.Comment
+	}
+	return false
+}
+
+// Active reports why the link can not be used anymore. Uses are only counted when opening the gallery, a link whose
+// limit is reached can not be used for anything else either.
+func (l ShareLinkDB) Active(now time.Time) error {
+	if l.RevokedAt != nil {
+		return ErrShareLinkRevoked
+	}
+	if !l.ExpiresAt.IsZero() && now.After(l.ExpiresAt) {
+		return ErrShareLinkExpired
+	}
+	if l.MaxUses > 0 && l.Uses >= l.MaxUses {
+		return ErrShareLinkExhausted
+	}
+	return nil
+}
+
+// HashSharePassword hashes the password or PIN protecting a share
+func HashSharePassword(password string) (string, error) {
+	if len(password) < 4 || len(password) > 72 {
+		return "", ErrInvalidSharePassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func CheckSharePassword(passwordHash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)) == nil
+}
@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShareLinkActive(t *testing.T) {
+	now := time.Now().UTC()
+
+	link := ShareLinkDB{ExpiresAt: now.Add(time.Hour)}
+	if err := link.Active(now); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := (ShareLinkDB{}).Active(now); err != nil {
+		t.Errorf("Expected link without expiry to be active, got %v", err)
+	}
+
+	link.ExpiresAt = now.Add(-time.Hour)
+	if err := link.Active(now); !errors.Is(err, ErrShareLinkExpired) {
+		t.Errorf("Expected ErrShareLinkExpired, got %v", err)
+	}
+
+	if err := (ShareLinkDB{MaxUses: 2, Uses: 1}).Active(now); err != nil {
+		t.Errorf("Expected link below its usage limit to be active, got %v", err)
+	}
+	if err := (ShareLinkDB{MaxUses: 2, Uses: 2}).Active(now); !errors.Is(err, ErrShareLinkExhausted) {
+		t.Errorf("Expected ErrShareLinkExhausted, got %v", err)
+	}
+
+	link.RevokedAt = &now
+	if err := link.Active(now); !errors.Is(err, ErrShareLinkRevoked) {
+		t.Errorf("Expected ErrShareLinkRevoked, got %v", err)
+	}
+}
+
+func TestSharePermissionsAllows(t *testing.T) {
+	guests := SharePermissions{View: true, Comment: true}
+	if !guests.Allows(PermissionView) || !guests.Allows(PermissionComment) {
+		t.Error("Expected granted permissions to be allowed")
+	}
+	if guests.Allows(PermissionOrder) || guests.Allows(PermissionDownload) {
+		t.Error("Expected missing permissions to be denied")
+	}
+	if FullAccess.Allows(SharePermission("delete")) {
+		t.Error("Expected unknown permissions to be denied")
+	}
+}
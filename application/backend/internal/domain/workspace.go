@@ -0,0 +1,125 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+)
+
+var (
+	ErrLastOwner         = errors.New("workspace must keep at least one owner")
+	ErrAlreadyMember     = errors.New("user is already a member of the workspace")
+	ErrInvalidRole       = errors.New("invalid workspace role")
+	ErrPersonalWorkspace = errors.New("personal workspaces can not be shared or deleted")
+)
+
+// WorkspaceRole grants the permissions of the roles below it: viewers can see everything, editors manage galleries,
+// photos and orders, admins manage members, coupons and deletions, and owners the workspace itself
+type WorkspaceRole string
+
+const (
+	RoleOwner  WorkspaceRole = "owner"
+	RoleAdmin  WorkspaceRole = "admin"
+	RoleEditor WorkspaceRole = "editor"
+	RoleViewer WorkspaceRole = "viewer"
+)
+
+var workspaceRoleRanks = map[WorkspaceRole]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+	RoleOwner:  4,
+}
+
+func (r WorkspaceRole) Valid() bool {
+	_, ok := workspaceRoleRanks[r]
+	return ok
+}
+
+// Allows reports whether the role grants the permissions of the required role
+func (r WorkspaceRole) Allows(required WorkspaceRole) bool {
+	return r.Valid() && workspaceRoleRanks[r] >= workspaceRoleRanks[required]
+}
+
+// WorkspaceDB owns collections, galleries, photos, orders and coupons, so a studio's team can manage them together.
+// Every photographer gets a personal workspace, data created before workspaces existed was moved to it.
+type WorkspaceDB struct {
+	ID   primitive.ObjectID `bson:"_id" json:"id"`
+	Name string             `bson:"name" json:"name" example:"Studio North"`
+	// PersonalOwner is the user the personal workspace was created for, it is empty for shared workspaces
+	PersonalOwner string                `bson:"personalOwner,omitempty" json:"-"`
+	Personal      bool                  `bson:"personal" json:"personal"`
+	Members       []WorkspaceMember     `bson:"members" json:"members"`
+	Invitations   []WorkspaceInvitation `bson:"invitations" json:"invitations"`
+	CreatedAt     time.Time             `bson:"createdAt" json:"createdAt"`
+	UpdatedAt     time.Time             `bson:"updatedAt" json:"updatedAt"`
+}
+
+type WorkspaceMember struct {
+	UserId  string        `bson:"userId" json:"userId"`
+	Email   string        `bson:"email,omitempty" json:"email,omitempty"`
+	Role    WorkspaceRole `bson:"role" json:"role"`
+	AddedAt time.Time     `bson:"addedAt" json:"addedAt"`
+}
+
+// WorkspaceInvitation is accepted by the user signed in with the invited email
+type WorkspaceInvitation struct {
+	Email     string        `bson:"email" json:"email"`
+	Role      WorkspaceRole `bson:"role" json:"role"`
+	InvitedBy string        `bson:"invitedBy" json:"invitedBy"`
+	InvitedAt time.Time     `bson:"invitedAt" json:"invitedAt"`
+}
+
+type WorkspaceRepository interface {
+	// GetWorkspaces returns the workspaces the user is a member of
+	GetWorkspaces(ctx context.Context, userId string) ([]WorkspaceDB, error)
+	// GetWorkspace returns the workspace only when the user is a member of it
+	GetWorkspace(ctx context.Context, workspaceId primitive.ObjectID, userId string) (WorkspaceDB, error)
+	// GetPersonalWorkspace returns the personal workspace of the user, creating it on first use
+	GetPersonalWorkspace(ctx context.Context, userId string) (WorkspaceDB, error)
+	CreateWorkspace(ctx context.Context, name, ownerId, ownerEmail string) (WorkspaceDB, error)
+	RenameWorkspace(ctx context.Context, workspaceId primitive.ObjectID, name string) (WorkspaceDB, error)
+	DeleteWorkspace(ctx context.Context, workspaceId primitive.ObjectID) error
+
+	// GetInvitations returns the workspaces the email was invited to
+	GetInvitations(ctx context.Context, email string) ([]WorkspaceDB, error)
+	// InviteMember adds or replaces the invitation of the email, failing with ErrAlreadyMember for members
+	InviteMember(ctx context.Context, workspaceId primitive.ObjectID, invitation WorkspaceInvitation) (WorkspaceDB, error)
+	CancelInvitation(ctx context.Context, workspaceId primitive.ObjectID, email string) (WorkspaceDB, error)
+	// AcceptInvitation turns the invitation of the email into a membership of the user
+	AcceptInvitation(ctx context.Context, workspaceId primitive.ObjectID, email, userId string) (WorkspaceDB, error)
+	// UpdateMemberRole and RemoveMember fail with ErrLastOwner when the workspace would be left without an owner
+	UpdateMemberRole(ctx context.Context, workspaceId primitive.ObjectID, userId string, role WorkspaceRole) (WorkspaceDB, error)
+	RemoveMember(ctx context.Context, workspaceId primitive.ObjectID, userId string) (WorkspaceDB, error)
+}
+
+// Role returns the role of the user in the workspace, ok is false when they are not a member
+func (w WorkspaceDB) Role(userId string) (role WorkspaceRole, ok bool) {
+	for _, member := range w.Members {
+		if member.UserId == userId {
+			return member.Role, true
+		}
+	}
+	return "", false
+}
+
+// OwnerCount is used to keep at least one owner in the workspace
+func (w WorkspaceDB) OwnerCount() int {
+	owners := 0
+	for _, member := range w.Members {
+		if member.Role == RoleOwner {
+			owners++
+		}
+	}
+	return owners
+}
+
+func NormalizeWorkspaceName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return "", errors.New("workspace name must be between 1 and 100 characters long")
+	}
+	return name, nil
+}
@@ -0,0 +1,42 @@
+package domain
+
+import "testing"
+
+func TestWorkspaceRoleAllows(t *testing.T) {
+	tests := []struct {
+		role     WorkspaceRole
+		required WorkspaceRole
+		allowed  bool
+	}{
+		{RoleOwner, RoleAdmin, true},
+		{RoleAdmin, RoleAdmin, true},
+		{RoleAdmin, RoleOwner, false},
+		{RoleEditor, RoleViewer, true},
+		{RoleViewer, RoleEditor, false},
+		{WorkspaceRole("guest"), RoleViewer, false},
+		{WorkspaceRole(""), RoleViewer, false},
+	}
+
+	for _, test := range tests {
+		if allowed := test.role.Allows(test.required); allowed != test.allowed {
+			t.Errorf("Expected %q allows %q to be %v, got %v", test.role, test.required, test.allowed, allowed)
+		}
+	}
+}
+
+func TestWorkspaceMembers(t *testing.T) {
+	workspace := WorkspaceDB{Members: []WorkspaceMember{
+		{UserId: "owner", Role: RoleOwner},
+		{UserId: "editor", Role: RoleEditor},
+	}}
+
+	if role, ok := workspace.Role("editor"); !ok || role != RoleEditor {
+		t.Errorf("Expected editor role, got %q", role)
+	}
+	if _, ok := workspace.Role("stranger"); ok {
+		t.Error("Expected stranger not to be a member")
+	}
+	if count := workspace.OwnerCount(); count != 1 {
+		t.Errorf("Expected 1 owner, got %d", count)
+	}
+}
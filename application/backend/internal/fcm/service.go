@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/domain"
 	"golang.org/x/oauth2/google"
+	"io"
+	"log"
 	"net/http"
 	"os"
 )
@@ -26,13 +29,19 @@ func GetCredentialsJSON() ([]byte, error) {
 	return credentialsJSON, nil
 }
 
+// ErrNoTokens is returned when none of the users subscribed a device
+var ErrNoTokens = errors.New("no valid tokens found")
+
 type Service struct {
-	projectID string
-	client    *http.Client
+	projectID     string
+	client        *http.Client
+	subscriptions domain.PushSubscriptionRepository
 }
 
 type SubscriptionRequest struct {
 	Token string `json:"token"`
+	// Device is an optional label to tell the devices of the user apart
+	Device string `json:"device,omitempty" example:"Chrome on MacBook"`
 }
 
 type SendMessageRequest struct {
@@ -69,9 +78,55 @@ type FCMWebPush struct {
 	Notification map[string]any    `json:"notification,omitempty"`
 }
 
-var userTokens = make(map[string]string)
+// SendError is an error response of the FCM API
+type SendError struct {
+	StatusCode int
+	// ErrorCode is the FCM error code, e.g. UNREGISTERED, falling back to the status of the response
+	ErrorCode string
+	Message   string
+}
+
+func (e *SendError) Error() string {
+	return fmt.Sprintf("FCM request failed with status %d: %s %s", e.StatusCode, e.ErrorCode, e.Message)
+}
+
+// StaleToken reports whether FCM rejected the device token itself, so it will never be accepted again
+func (e *SendError) StaleToken() bool {
+	return e.ErrorCode == "UNREGISTERED" || e.ErrorCode == "INVALID_ARGUMENT"
+}
+
+type fcmErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Status  string `json:"status"`
+		Details []struct {
+			Type      string `json:"@type"`
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// parseSendError reads an FCM error response, preferring the FCM error code of its details to the generic status
+func parseSendError(statusCode int, body []byte) *SendError {
+	sendErr := &SendError{StatusCode: statusCode}
 
-func NewService(projectID string, credentialsJSON []byte) (*Service, error) {
+	var response fcmErrorResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		sendErr.Message = string(body)
+		return sendErr
+	}
+	sendErr.Message = response.Error.Message
+	sendErr.ErrorCode = response.Error.Status
+	for _, detail := range response.Error.Details {
+		if detail.Type == "type.googleapis.com/google.firebase.fcm.v1.FcmError" && detail.ErrorCode != "" {
+			sendErr.ErrorCode = detail.ErrorCode
+			break
+		}
+	}
+	return sendErr
+}
+
+func NewService(projectID string, credentialsJSON []byte, subscriptions domain.PushSubscriptionRepository) (*Service, error) {
 	ctx := context.Background()
 
 	config, err := google.JWTConfigFromJSON(
@@ -85,46 +140,86 @@ func NewService(projectID string, credentialsJSON []byte) (*Service, error) {
 	client := config.Client(ctx)
 
 	return &Service{
-		projectID: projectID,
-		client:    client,
+		projectID:     projectID,
+		client:        client,
+		subscriptions: subscriptions,
 	}, nil
 }
 
-func (s *Service) Subscribe(ctx *fiber.Ctx, req *SubscriptionRequest) error {
-	userId := ctx.Locals("userId").(string)
-	userTokens[userId] = req.Token
+// Subscribe registers the device token for push notifications of the user, subscribing a known token again
+// refreshes the time it was last seen
+func (s *Service) Subscribe(ctx context.Context, userId string, req *SubscriptionRequest) (domain.PushSubscriptionDB, error) {
+	device, err := domain.NormalizeDeviceLabel(req.Device)
+	if err != nil {
+		return domain.PushSubscriptionDB{}, err
+	}
 
-	fmt.Printf("Successfully registered user %s with token %s\n", userId, req.Token[:20]+"...")
-	return nil
+	subscription := domain.PushSubscriptionDB{
+		UserId: userId,
+		Token:  req.Token,
+		Device: device,
+	}
+	if err := s.subscriptions.SavePushSubscription(ctx, &subscription); err != nil {
+		return domain.PushSubscriptionDB{}, err
+	}
+	return subscription, nil
 }
 
-func (s *Service) SendMessage(req *SendMessageRequest) error {
+// SendMessage sends the message to every device of the users. Tokens FCM reports as unregistered or invalid are
+// removed, so they are not tried again. It fails when the message reached no device and sending to one of them can
+// be retried, e.g. on a server or network error.
+func (s *Service) SendMessage(ctx context.Context, req *SendMessageRequest) error {
 	var tokens []string
-
 	if len(req.UserIDs) > 0 {
-		for _, userID := range req.UserIDs {
-			if token, exists := userTokens[userID]; exists {
-				tokens = append(tokens, token)
-			}
+		var err error
+		tokens, err = s.subscriptions.GetPushTokens(ctx, req.UserIDs)
+		if err != nil {
+			return fmt.Errorf("failed to fetch push subscriptions: %w", err)
 		}
 	}
 
 	if len(tokens) == 0 {
-		return fmt.Errorf("no valid tokens found")
+		return ErrNoTokens
 	}
 
+	var stale []string
+	var sent int
+	var lastErr error
 	for _, token := range tokens {
-		if err := s.sendToToken(token, req.Message); err != nil {
-			fmt.Printf("Failed to send to token %s: %v\n", token[:20]+"...", err)
+		if err := s.sendToToken(ctx, token, req.Message); err != nil {
+			var sendErr *SendError
+			if errors.As(err, &sendErr) && sendErr.StaleToken() {
+				stale = append(stale, token)
+			} else {
+				lastErr = err
+			}
+			log.Printf("Failed to send to token %s: %v", tokenHint(token), err)
 			continue
 		}
-		fmt.Printf("Successfully sent message to token %s\n", token[:20]+"...")
+		sent++
+	}
+
+	if len(stale) > 0 {
+		if err := s.subscriptions.DeletePushTokens(ctx, stale); err != nil {
+			log.Printf("Failed to remove %d stale push tokens: %v", len(stale), err)
+		}
 	}
 
+	if sent == 0 && lastErr != nil {
+		return fmt.Errorf("failed to send to any of %d devices: %w", len(tokens), lastErr)
+	}
 	return nil
 }
 
-func (s *Service) sendToToken(token string, message *PushMessage) error {
+// tokenHint returns the beginning of a device token for logs
+func tokenHint(token string) string {
+	if len(token) <= 20 {
+		return token
+	}
+	return token[:20] + "..."
+}
+
+func (s *Service) sendToToken(ctx context.Context, token string, message *PushMessage) error {
 	fcmMessage := FCMMessage{
 		Message: FCMMessagePayload{
 			Token: token,
@@ -165,19 +260,24 @@ func (s *Service) sendToToken(token string, message *PushMessage) error {
 
 	url := fmt.Sprintf("https://fcm.googleapis.com/v1/projects/%s/messages:send", s.projectID)
 
-	resp, err := s.client.Post(url, "application/json", bytes.NewBuffer(payload))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send HTTP request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		var errorResponse map[string]any
-		err := json.NewDecoder(resp.Body).Decode(&errorResponse)
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
 		if err != nil {
-			return err
+			return fmt.Errorf("FCM request failed with status %d: %w", resp.StatusCode, err)
 		}
-		return fmt.Errorf("FCM request failed with status %d: %v", resp.StatusCode, errorResponse)
+		return parseSendError(resp.StatusCode, body)
 	}
 
 	return nil
@@ -0,0 +1,51 @@
+package fcm
+
+import "testing"
+
+func TestParseSendError(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		code  string
+		stale bool
+	}{
+		{
+			name:  "unregistered token",
+			body:  `{"error":{"code":404,"message":"Requested entity was not found.","status":"NOT_FOUND","details":[{"@type":"type.googleapis.com/google.firebase.fcm.v1.FcmError","errorCode":"UNREGISTERED"}]}}`,
+			code:  "UNREGISTERED",
+			stale: true,
+		},
+		{
+			name:  "invalid token",
+			body:  `{"error":{"code":400,"message":"The registration token is not a valid FCM registration token","status":"INVALID_ARGUMENT","details":[{"@type":"type.googleapis.com/google.firebase.fcm.v1.FcmError","errorCode":"INVALID_ARGUMENT"}]}}`,
+			code:  "INVALID_ARGUMENT",
+			stale: true,
+		},
+		{
+			name: "quota exceeded",
+			body: `{"error":{"code":429,"message":"Quota exceeded.","status":"RESOURCE_EXHAUSTED","details":[{"@type":"type.googleapis.com/google.firebase.fcm.v1.FcmError","errorCode":"QUOTA_EXCEEDED"}]}}`,
+			code: "QUOTA_EXCEEDED",
+		},
+		{
+			name: "status without details",
+			body: `{"error":{"code":503,"message":"The service is currently unavailable.","status":"UNAVAILABLE"}}`,
+			code: "UNAVAILABLE",
+		},
+		{
+			name: "not json",
+			body: `Bad Gateway`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseSendError(400, []byte(tt.body))
+			if err.ErrorCode != tt.code {
+				t.Errorf("ErrorCode = %q, want %q", err.ErrorCode, tt.code)
+			}
+			if err.StaleToken() != tt.stale {
+				t.Errorf("StaleToken() = %v, want %v", err.StaleToken(), tt.stale)
+			}
+		})
+	}
+}
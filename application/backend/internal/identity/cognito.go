@@ -0,0 +1,266 @@
+package identity
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+	awsClient "github.com/michalK00/halftone/platform/cloud/aws"
+)
+
+// Cognito is the provider backed by an AWS Cognito user pool
+type Cognito struct {
+	client      *awsClient.CognitoClient
+	issuer      string
+	appClientID string
+	keys        *KeySet
+}
+
+func NewCognito(client *awsClient.CognitoClient, region, userPoolID, appClientID string) *Cognito {
+	issuer := fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s", region, userPoolID)
+	return &Cognito{
+		client:      client,
+		issuer:      issuer,
+		appClientID: appClientID,
+		keys:        NewKeySet(issuer + "/.well-known/jwks.json"),
+	}
+}
+
+func (c *Cognito) SignUp(ctx context.Context, email, password string) error {
+	_, err := c.client.SignUp(ctx, email, password, map[string]string{})
+	return cognitoError(err)
+}
+
+func (c *Cognito) ConfirmSignUp(ctx context.Context, email, code string) error {
+	_, err := c.client.ConfirmSignUp(ctx, email, code)
+	return cognitoError(err)
+}
+
+func (c *Cognito) ResendCode(ctx context.Context, email string) error {
+	_, err := c.client.ResendConfirmationCode(ctx, email)
+	return cognitoError(err)
+}
+
+func (c *Cognito) SignIn(ctx context.Context, email, password string) (Tokens, error) {
+	resp, err := c.client.InitiateAuth(ctx, email, password)
+	if err != nil {
+		return Tokens{}, cognitoError(err)
+	}
+	return authTokens(resp.AuthenticationResult, resp.ChallengeName, resp.Session)
+}
+
+func (c *Cognito) RespondToChallenge(ctx context.Context, response ChallengeResponse) (Tokens, error) {
+	responses := map[string]string{}
+	switch response.Name {
+	case ChallengeSoftwareTokenMFA:
+		responses["SOFTWARE_TOKEN_MFA_CODE"] = response.Code
+	case ChallengeSMSMFA:
+		responses["SMS_MFA_CODE"] = response.Code
+	case ChallengeNewPassword:
+		responses["NEW_PASSWORD"] = response.NewPassword
+	case ChallengeSelectMFAType:
+		responses["ANSWER"] = response.MFAType
+	case ChallengeMFASetup:
+		if response.Code == "" {
+			resp, err := c.client.AssociateSoftwareToken(ctx, "", response.Session)
+			if err != nil {
+				return Tokens{}, cognitoError(err)
+			}
+			return Tokens{}, &ChallengeError{
+				Name:       ChallengeMFASetup,
+				Session:    aws.ToString(resp.Session),
+				SecretCode: aws.ToString(resp.SecretCode),
+			}
+		}
+		resp, err := c.client.VerifySoftwareToken(ctx, "", response.Session, response.Code, response.DeviceName)
+		if err != nil {
+			return Tokens{}, cognitoError(err)
+		}
+		if resp.Status != types.VerifySoftwareTokenResponseTypeSuccess {
+			return Tokens{}, ErrCodeMismatch
+		}
+		response.Session = aws.ToString(resp.Session)
+	default:
+		return Tokens{}, fmt.Errorf("%w: unsupported challenge %q", ErrInvalidParameter, response.Name)
+	}
+
+	resp, err := c.client.RespondToAuthChallenge(ctx, types.ChallengeNameType(response.Name), response.Session, response.Email, responses)
+	if err != nil {
+		return Tokens{}, cognitoError(err)
+	}
+	return authTokens(resp.AuthenticationResult, resp.ChallengeName, resp.Session)
+}
+
+func (c *Cognito) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	resp, err := c.client.RefreshToken(ctx, refreshToken)
+	if err != nil {
+		return Tokens{}, cognitoError(err)
+	}
+	if resp.AuthenticationResult == nil {
+		return Tokens{}, ErrNotAuthorized
+	}
+
+	return Tokens{
+		IDToken:     aws.ToString(resp.AuthenticationResult.IdToken),
+		AccessToken: aws.ToString(resp.AuthenticationResult.AccessToken),
+		ExpiresIn:   resp.AuthenticationResult.ExpiresIn,
+	}, nil
+}
+
+func (c *Cognito) ForgotPassword(ctx context.Context, email string) error {
+	_, err := c.client.ForgotPassword(ctx, email)
+	return cognitoError(err)
+}
+
+func (c *Cognito) ConfirmForgotPassword(ctx context.Context, email, code, password string) error {
+	_, err := c.client.ConfirmForgotPassword(ctx, email, code, password)
+	return cognitoError(err)
+}
+
+func (c *Cognito) ChangePassword(ctx context.Context, accessToken, oldPassword, newPassword string) error {
+	_, err := c.client.ChangePassword(ctx, accessToken, oldPassword, newPassword)
+	return cognitoError(err)
+}
+
+func (c *Cognito) GetUser(ctx context.Context, accessToken string) (User, error) {
+	resp, err := c.client.GetUser(ctx, accessToken)
+	if err != nil {
+		return User{}, cognitoError(err)
+	}
+
+	user := User{
+		Username:     aws.ToString(resp.Username),
+		Attributes:   make(map[string]string, len(resp.UserAttributes)),
+		PreferredMFA: aws.ToString(resp.PreferredMfaSetting),
+	}
+	for _, attribute := range resp.UserAttributes {
+		user.Attributes[aws.ToString(attribute.Name)] = aws.ToString(attribute.Value)
+	}
+	return user, nil
+}
+
+func (c *Cognito) SignOut(ctx context.Context, accessToken string) error {
+	_, err := c.client.GlobalSignOut(ctx, accessToken)
+	return cognitoError(err)
+}
+
+func (c *Cognito) RevokeToken(ctx context.Context, refreshToken string) error {
+	_, err := c.client.RevokeToken(ctx, refreshToken)
+	return cognitoError(err)
+}
+
+func (c *Cognito) AssociateTOTP(ctx context.Context, accessToken string) (string, error) {
+	resp, err := c.client.AssociateSoftwareToken(ctx, accessToken, "")
+	if err != nil {
+		return "", cognitoError(err)
+	}
+	return aws.ToString(resp.SecretCode), nil
+}
+
+func (c *Cognito) VerifyTOTP(ctx context.Context, accessToken, code, deviceName string) error {
+	resp, err := c.client.VerifySoftwareToken(ctx, accessToken, "", code, deviceName)
+	if err != nil {
+		return cognitoError(err)
+	}
+	if resp.Status != types.VerifySoftwareTokenResponseTypeSuccess {
+		return ErrCodeMismatch
+	}
+
+	_, err = c.client.SetSoftwareTokenMFA(ctx, accessToken, true)
+	return cognitoError(err)
+}
+
+func (c *Cognito) DisableTOTP(ctx context.Context, accessToken string) error {
+	_, err := c.client.SetSoftwareTokenMFA(ctx, accessToken, false)
+	return cognitoError(err)
+}
+
+func (c *Cognito) Issuer() string {
+	return c.issuer
+}
+
+func (c *Cognito) Audience() string {
+	return c.appClientID
+}
+
+func (c *Cognito) PublicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	return c.keys.PublicKey(ctx, kid)
+}
+
+func (c *Cognito) JWKS(ctx context.Context) (JSONWebKeySet, error) {
+	return c.keys.JWKS(ctx)
+}
+
+// authTokens returns the tokens of a successful authentication, or the challenge Cognito asks for instead
+func authTokens(result *types.AuthenticationResultType, challenge types.ChallengeNameType, session *string) (Tokens, error) {
+	if result == nil {
+		return Tokens{}, &ChallengeError{Name: string(challenge), Session: aws.ToString(session)}
+	}
+
+	return Tokens{
+		IDToken:      aws.ToString(result.IdToken),
+		AccessToken:  aws.ToString(result.AccessToken),
+		RefreshToken: aws.ToString(result.RefreshToken),
+		ExpiresIn:    result.ExpiresIn,
+	}, nil
+}
+
+// cognitoError wraps Cognito exceptions with the matching error of this package, other errors are returned unchanged
+func cognitoError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var (
+		usernameExists    *types.UsernameExistsException
+		aliasExists       *types.AliasExistsException
+		invalidPassword   *types.InvalidPasswordException
+		invalidParameter  *types.InvalidParameterException
+		codeMismatch      *types.CodeMismatchException
+		expiredCode       *types.ExpiredCodeException
+		notAuthorized     *types.NotAuthorizedException
+		unsupportedToken  *types.UnsupportedTokenTypeException
+		unauthorizedToken *types.UnauthorizedException
+		notConfirmed      *types.UserNotConfirmedException
+		resetRequired     *types.PasswordResetRequiredException
+		userNotFound      *types.UserNotFoundException
+		limitExceeded     *types.LimitExceededException
+		tooManyRequests   *types.TooManyRequestsException
+		tooManyAttempts   *types.TooManyFailedAttemptsException
+		deliveryFailure   *types.CodeDeliveryFailureException
+		enableMFAFailed   *types.EnableSoftwareTokenMFAException
+		totpNotFound      *types.SoftwareTokenMFANotFoundException
+		mfaNotFound       *types.MFAMethodNotFoundException
+	)
+
+	var sentinel error
+	switch {
+	case errors.As(err, &usernameExists), errors.As(err, &aliasExists):
+		sentinel = ErrUserExists
+	case errors.As(err, &invalidPassword):
+		sentinel = ErrInvalidPassword
+	case errors.As(err, &invalidParameter), errors.As(err, &totpNotFound), errors.As(err, &mfaNotFound):
+		sentinel = ErrInvalidParameter
+	case errors.As(err, &codeMismatch), errors.As(err, &enableMFAFailed):
+		sentinel = ErrCodeMismatch
+	case errors.As(err, &expiredCode):
+		sentinel = ErrCodeExpired
+	case errors.As(err, &notAuthorized), errors.As(err, &unsupportedToken), errors.As(err, &unauthorizedToken):
+		sentinel = ErrNotAuthorized
+	case errors.As(err, &notConfirmed):
+		sentinel = ErrUserNotConfirmed
+	case errors.As(err, &resetRequired):
+		sentinel = ErrPasswordResetRequired
+	case errors.As(err, &userNotFound):
+		sentinel = ErrUserNotFound
+	case errors.As(err, &limitExceeded), errors.As(err, &tooManyRequests), errors.As(err, &tooManyAttempts):
+		sentinel = ErrTooManyRequests
+	case errors.As(err, &deliveryFailure):
+		sentinel = ErrCodeDeliveryFailed
+	default:
+		return err
+	}
+	return fmt.Errorf("%w: %w", sentinel, err)
+}
@@ -0,0 +1,39 @@
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+	"testing"
+)
+
+func TestCognitoError(t *testing.T) {
+	connectionReset := errors.New("connection reset")
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{&types.UsernameExistsException{}, ErrUserExists},
+		{&types.CodeMismatchException{}, ErrCodeMismatch},
+		{&types.ExpiredCodeException{}, ErrCodeExpired},
+		{&types.NotAuthorizedException{}, ErrNotAuthorized},
+		{&types.UserNotConfirmedException{}, ErrUserNotConfirmed},
+		{&types.LimitExceededException{}, ErrTooManyRequests},
+		// The SDK wraps exceptions in operation errors
+		{fmt.Errorf("operation SignUp: %w", &types.InvalidPasswordException{}), ErrInvalidPassword},
+		{connectionReset, connectionReset},
+	}
+
+	for _, tt := range tests {
+		got := cognitoError(tt.err)
+		if !errors.Is(got, tt.want) {
+			t.Errorf("cognitoError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+		if !errors.Is(got, tt.err) {
+			t.Errorf("cognitoError(%v) does not wrap the original error", tt.err)
+		}
+	}
+	if cognitoError(nil) != nil {
+		t.Error("cognitoError(nil) is not nil")
+	}
+}
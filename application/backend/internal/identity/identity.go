@@ -0,0 +1,240 @@
+// Package identity abstracts the service photographers sign in with, so the API and the token validation do not
+// depend on a particular user pool.
+package identity
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/michalK00/halftone/internal/domain"
+	awsClient "github.com/michalK00/halftone/platform/cloud/aws"
+	"log"
+	"os"
+	"strings"
+)
+
+// Verifier is what tokens are validated against: the expected issuer and audience, and the keys they are signed with
+type Verifier interface {
+	// Issuer is the iss claim of the issued tokens
+	Issuer() string
+	// Audience is the aud claim of ID tokens and the client_id claim of access tokens
+	Audience() string
+	// PublicKey returns the key tokens with the key ID were signed with
+	PublicKey(ctx context.Context, kid string) (*rsa.PublicKey, error)
+}
+
+// Provider manages photographer accounts and issues the RS256 tokens protected endpoints are called with
+type Provider interface {
+	Verifier
+
+	SignUp(ctx context.Context, email, password string) error
+	// ConfirmSignUp verifies the account with the code sent after signing up
+	ConfirmSignUp(ctx context.Context, email, code string) error
+	ResendCode(ctx context.Context, email string) error
+	// SignIn returns a *ChallengeError when another authentication step is required
+	SignIn(ctx context.Context, email, password string) (Tokens, error)
+	// RespondToChallenge answers the challenge of SignIn, it returns another *ChallengeError when a further step is
+	// required
+	RespondToChallenge(ctx context.Context, response ChallengeResponse) (Tokens, error)
+	// Refresh issues new ID and access tokens, the refresh token is not rotated
+	Refresh(ctx context.Context, refreshToken string) (Tokens, error)
+	ForgotPassword(ctx context.Context, email string) error
+	ConfirmForgotPassword(ctx context.Context, email, code, password string) error
+	ChangePassword(ctx context.Context, accessToken, oldPassword, newPassword string) error
+	GetUser(ctx context.Context, accessToken string) (User, error)
+	// SignOut invalidates all refresh tokens of the user
+	SignOut(ctx context.Context, accessToken string) error
+	// RevokeToken invalidates a single refresh token
+	RevokeToken(ctx context.Context, refreshToken string) error
+	JWKS(ctx context.Context) (JSONWebKeySet, error)
+
+	// AssociateTOTP starts the setup of an authenticator app for the signed in user and returns the shared secret
+	AssociateTOTP(ctx context.Context, accessToken string) (string, error)
+	// VerifyTOTP completes the setup with a code of the authenticator app and requires it when signing in from now on
+	VerifyTOTP(ctx context.Context, accessToken, code, deviceName string) error
+	// DisableTOTP stops requiring authenticator app codes when signing in
+	DisableTOTP(ctx context.Context, accessToken string) error
+}
+
+type Tokens struct {
+	IDToken      string
+	AccessToken  string
+	RefreshToken string
+	// ExpiresIn is the lifetime of the ID and access tokens in seconds
+	ExpiresIn int32
+}
+
+type User struct {
+	Username   string
+	Attributes map[string]string
+	// PreferredMFA is the challenge the user is asked for when signing in, empty when MFA is not enabled
+	PreferredMFA string
+}
+
+// Challenges SignIn may return, named like in Cognito
+const (
+	ChallengeSoftwareTokenMFA = "SOFTWARE_TOKEN_MFA"
+	ChallengeSMSMFA           = "SMS_MFA"
+	ChallengeMFASetup         = "MFA_SETUP"
+	ChallengeSelectMFAType    = "SELECT_MFA_TYPE"
+	ChallengeNewPassword      = "NEW_PASSWORD_REQUIRED"
+)
+
+// ChallengeError is returned by SignIn when the provider requires another step, e.g. a new password or MFA code
+type ChallengeError struct {
+	Name    string
+	Session string
+	// SecretCode is the TOTP secret to add to an authenticator app, only set for MFA_SETUP after its first step
+	SecretCode string
+}
+
+// ChallengeResponse answers a ChallengeError. Email is the one signed in with, Code the MFA code, NewPassword the
+// answer to NEW_PASSWORD_REQUIRED and MFAType the answer to SELECT_MFA_TYPE. MFA_SETUP is answered in two steps, first
+// without a code to receive the secret, then with a code of the authenticator app.
+type ChallengeResponse struct {
+	Name        string
+	Session     string
+	Email       string
+	Code        string
+	NewPassword string
+	MFAType     string
+	DeviceName  string
+}
+
+func (e *ChallengeError) Error() string {
+	return "authentication challenge required: " + e.Name
+}
+
+var (
+	ErrUserExists            = errors.New("user already exists")
+	ErrInvalidPassword       = errors.New("password does not meet the requirements")
+	ErrInvalidParameter      = errors.New("invalid parameter")
+	ErrCodeMismatch          = errors.New("invalid verification code")
+	ErrCodeExpired           = errors.New("verification code expired")
+	ErrNotAuthorized         = errors.New("not authorized")
+	ErrUserNotConfirmed      = errors.New("user is not confirmed")
+	ErrPasswordResetRequired = errors.New("password reset required")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrTooManyRequests       = errors.New("too many requests")
+	ErrCodeDeliveryFailed    = errors.New("failed to deliver code")
+)
+
+// NewFromEnv creates the provider configured by IDENTITY_PROVIDER: "cognito" (default) or "local". The local users
+// repository is only used by the local provider.
+func NewFromEnv(users domain.LocalUserRepository) (Provider, error) {
+	switch provider := strings.ToLower(os.Getenv("IDENTITY_PROVIDER")); provider {
+	case "", "cognito":
+		client, err := awsClient.GetClient()
+		if err != nil {
+			return nil, err
+		}
+		return NewCognito(client.Cognito, os.Getenv("AWS_REGION"), os.Getenv("AWS_USER_POOL_ID"), os.Getenv("AWS_APP_CLIENT_ID")), nil
+	case "local":
+		var key *rsa.PrivateKey
+		if pemKey := os.Getenv("LOCAL_IDENTITY_PRIVATE_KEY"); pemKey != "" {
+			parsed, err := ParsePrivateKey([]byte(pemKey))
+			if err != nil {
+				return nil, fmt.Errorf("invalid LOCAL_IDENTITY_PRIVATE_KEY: %w", err)
+			}
+			key = parsed
+		} else {
+			log.Println("LOCAL_IDENTITY_PRIVATE_KEY is not set, tokens are signed with a key generated for this run")
+			generated, err := generateKey()
+			if err != nil {
+				return nil, err
+			}
+			key = generated
+		}
+		return NewLocal(users, key, envOrDefault("LOCAL_IDENTITY_ISSUER", "halftone-local"), envOrDefault("LOCAL_IDENTITY_AUDIENCE", "halftone")), nil
+	default:
+		return nil, fmt.Errorf("unknown identity provider %q", provider)
+	}
+}
+
+// NewVerifierFromEnv creates the verifier configured by TOKEN_VALIDATOR for the protected API: "auth0" or "oidc" accept
+// tokens of an external issuer, by default tokens of the identity provider are accepted.
+func NewVerifierFromEnv(ctx context.Context, provider Provider) (Verifier, error) {
+	switch validator := strings.ToLower(os.Getenv("TOKEN_VALIDATOR")); validator {
+	case "", "identity":
+		return provider, nil
+	case "auth0":
+		return NewAuth0(ctx, os.Getenv("AUTH0_DOMAIN"), os.Getenv("AUTH0_AUDIENCE"))
+	case "oidc":
+		return NewOIDC(ctx, os.Getenv("OIDC_ISSUER"), os.Getenv("OIDC_AUDIENCE"))
+	default:
+		return nil, fmt.Errorf("unknown token validator %q", validator)
+	}
+}
+
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// Validate checks the signature, issuer, audience and lifetime of a token and returns its claims. Tokens without an
+// expiry are rejected. Cognito style tokens name their use, ID tokens are checked against aud and access tokens against
+// client_id, tokens of other issuers are checked against aud.
+func Validate(ctx context.Context, verifier Verifier, tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}))
+	token, err := parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, ok := token.Header["kid"].(string)
+		if !ok {
+			return nil, errors.New("kid header not found in token")
+		}
+		return verifier.PublicKey(ctx, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	// The parser checks exp and nbf only when they are present
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("token has no expiry")
+	}
+	if claims["iss"] != verifier.Issuer() {
+		return nil, errors.New("invalid token issuer")
+	}
+
+	audienceClaim := "aud"
+	switch claims["token_use"] {
+	case nil, "id":
+	case "access":
+		audienceClaim = "client_id"
+	default:
+		return nil, errors.New("invalid token use")
+	}
+	// Access tokens of some issuers carry several audiences
+	if !containsString(claims[audienceClaim], verifier.Audience()) {
+		return nil, errors.New("invalid token audience")
+	}
+
+	return claims, nil
+}
+
+func containsString(claim interface{}, str string) bool {
+	switch v := claim.(type) {
+	case string:
+		return v == str
+	case []string:
+		for _, s := range v {
+			if s == str {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, s := range v {
+			if s, ok := s.(string); ok && s == str {
+				return true
+			}
+		}
+	}
+	return false
+}
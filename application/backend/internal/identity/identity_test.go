@@ -0,0 +1,76 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/golang-jwt/jwt/v4"
+	"testing"
+	"time"
+)
+
+type staticVerifier struct {
+	key *rsa.PublicKey
+}
+
+func (v staticVerifier) Issuer() string   { return "https://issuer.test" }
+func (v staticVerifier) Audience() string { return "halftone" }
+func (v staticVerifier) PublicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	if kid != "test" {
+		return nil, ErrUnknownKey
+	}
+	return v.key, nil
+}
+
+func TestValidateClaims(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := staticVerifier{key: &key.PublicKey}
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		valid  bool
+	}{
+		{"id token", jwt.MapClaims{"token_use": "id", "aud": "halftone"}, true},
+		{"access token", jwt.MapClaims{"token_use": "access", "client_id": "halftone"}, true},
+		{"token of another issuer", jwt.MapClaims{"aud": "halftone"}, true},
+		{"access token for another client", jwt.MapClaims{"token_use": "access", "aud": "halftone", "client_id": "other"}, false},
+		{"id token for another client", jwt.MapClaims{"token_use": "id", "aud": "other", "client_id": "halftone"}, false},
+		{"unknown token use", jwt.MapClaims{"token_use": "refresh", "aud": "halftone"}, false},
+		{"wrong issuer", jwt.MapClaims{"aud": "halftone", "iss": "https://evil.test"}, false},
+		{"expired", jwt.MapClaims{"aud": "halftone", "exp": now.Add(-time.Minute).Unix()}, false},
+		{"not valid yet", jwt.MapClaims{"aud": "halftone", "nbf": now.Add(time.Hour).Unix()}, false},
+		{"no expiry", jwt.MapClaims{"aud": "halftone", "exp": nil}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := jwt.MapClaims{"iss": verifier.Issuer(), "sub": "user", "exp": now.Add(time.Hour).Unix()}
+			for name, value := range tt.claims {
+				if value == nil {
+					delete(claims, name)
+				} else {
+					claims[name] = value
+				}
+			}
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+			token.Header["kid"] = "test"
+			signed, err := token.SignedString(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = Validate(context.Background(), verifier, signed)
+			if tt.valid && err != nil {
+				t.Errorf("Validate = %v, want valid", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Validate accepted the token")
+			}
+		})
+	}
+}
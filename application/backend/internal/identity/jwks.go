@@ -0,0 +1,106 @@
+package identity
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// httpClient bounds requests to issuers, a slow issuer must not hold requests of the API
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// JSONWebKey is an RSA public key in the JWK format
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+func NewJSONWebKey(kid string, key *rsa.PublicKey) JSONWebKey {
+	return JSONWebKey{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// KeyID derives a stable key ID from the public key
+func KeyID(key *rsa.PublicKey) string {
+	sum := sha256.Sum256(key.N.Bytes())
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+func (k JSONWebKey) RSAPublicKey() (*rsa.PublicKey, error) {
+	if k.N == "" {
+		return nil, errors.New("invalid JWK: missing or invalid modulus (n)")
+	}
+	if k.E == "" {
+		return nil, errors.New("invalid JWK: missing or invalid exponent (e)")
+	}
+
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode modulus: %v", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode exponent: %v", err)
+	}
+
+	var exponent int
+	for i := 0; i < len(e); i++ {
+		exponent = exponent<<8 + int(e[i])
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: exponent,
+	}, nil
+}
+
+func (s JSONWebKeySet) Key(kid string) (JSONWebKey, bool) {
+	for _, key := range s.Keys {
+		if key.Kid == kid {
+			return key, true
+		}
+	}
+	return JSONWebKey{}, false
+}
+
+func FetchJWKS(ctx context.Context, url string) (JSONWebKeySet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return JSONWebKeySet{}, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return JSONWebKeySet{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return JSONWebKeySet{}, fmt.Errorf("failed to fetch JWKS: %s", resp.Status)
+	}
+
+	var jwks JSONWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return JSONWebKeySet{}, err
+	}
+	return jwks, nil
+}
@@ -0,0 +1,175 @@
+package identity
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"golang.org/x/sync/singleflight"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// keySetTTL is how long fetched keys are used before the set is refreshed in the background
+	keySetTTL = time.Hour
+	// keySetRefreshInterval limits how often an unknown key ID can trigger a fetch, so tokens with random key IDs can
+	// not make us hammer the issuer
+	keySetRefreshInterval = time.Minute
+	// unknownKeyTTL is how long a key ID missing from a fresh set is rejected without fetching again
+	unknownKeyTTL = 5 * time.Minute
+	// maxUnknownKeys bounds the memory used to remember unknown key IDs
+	maxUnknownKeys = 1024
+)
+
+var ErrUnknownKey = errors.New("no matching JWK found for kid")
+
+// KeySet caches the keys of a JWKS endpoint and is safe for concurrent use. Expired sets keep being served while they
+// are refreshed in the background, an unknown key ID fetches the set again to pick up rotated keys. Fetches are
+// limited by the refresh interval and key IDs missing from a fresh set are rejected for a while without fetching.
+type KeySet struct {
+	url             string
+	ttl             time.Duration
+	refreshInterval time.Duration
+	unknownKeyTTL   time.Duration
+
+	fetches    singleflight.Group
+	refreshing atomic.Bool
+
+	mu        sync.RWMutex
+	jwks      JSONWebKeySet
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+	// attemptedAt and fetchErr are about the last fetch, successful or not
+	attemptedAt time.Time
+	fetchErr    error
+	unknown     map[string]time.Time
+}
+
+func NewKeySet(url string) *KeySet {
+	return &KeySet{
+		url:             url,
+		ttl:             keySetTTL,
+		refreshInterval: keySetRefreshInterval,
+		unknownKeyTTL:   unknownKeyTTL,
+		keys:            make(map[string]*rsa.PublicKey),
+		unknown:         make(map[string]time.Time),
+	}
+}
+
+func (k *KeySet) PublicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	now := time.Now()
+
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	stale := now.Sub(k.fetchedAt) > k.ttl
+	rejectedUntil, rejected := k.unknown[kid]
+	k.mu.RUnlock()
+
+	if ok {
+		if stale && k.refreshing.CompareAndSwap(false, true) {
+			go k.refreshInBackground()
+		}
+		return key, nil
+	}
+	if rejected && now.Before(rejectedUntil) {
+		return nil, ErrUnknownKey
+	}
+
+	if _, err := k.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if key, ok := k.keys[kid]; ok {
+		return key, nil
+	}
+	k.rememberUnknown(kid, now)
+	return nil, ErrUnknownKey
+}
+
+// JWKS returns the cached key set, it is fetched when it expired
+func (k *KeySet) JWKS(ctx context.Context) (JSONWebKeySet, error) {
+	k.mu.RLock()
+	jwks, fresh := k.jwks, time.Since(k.fetchedAt) <= k.ttl
+	k.mu.RUnlock()
+	if fresh {
+		return jwks, nil
+	}
+	return k.refresh(ctx)
+}
+
+func (k *KeySet) refreshInBackground() {
+	defer k.refreshing.Store(false)
+	ctx, cancel := context.WithTimeout(context.Background(), httpClient.Timeout)
+	defer cancel()
+	if _, err := k.refresh(ctx); err != nil {
+		log.Printf("Failed to refresh JWKS from %s: %v", k.url, err)
+	}
+}
+
+// refresh fetches the key set once for all concurrent callers and at most once per refresh interval, in between the
+// result of the last fetch is returned. A failed fetch keeps the previous keys.
+func (k *KeySet) refresh(ctx context.Context) (JSONWebKeySet, error) {
+	result, err, _ := k.fetches.Do("jwks", func() (interface{}, error) {
+		k.mu.Lock()
+		if time.Since(k.attemptedAt) < k.refreshInterval {
+			jwks, err := k.jwks, k.fetchErr
+			k.mu.Unlock()
+			return jwks, err
+		}
+		k.attemptedAt = time.Now()
+		k.mu.Unlock()
+
+		jwks, err := FetchJWKS(ctx, k.url)
+		if err != nil {
+			k.mu.Lock()
+			k.fetchErr = err
+			k.mu.Unlock()
+			return JSONWebKeySet{}, err
+		}
+
+		keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+		for _, jwk := range jwks.Keys {
+			if jwk.Kty != "RSA" {
+				continue
+			}
+			key, err := jwk.RSAPublicKey()
+			if err != nil {
+				log.Printf("Skipping invalid JWK %s from %s: %v", jwk.Kid, k.url, err)
+				continue
+			}
+			keys[jwk.Kid] = key
+		}
+
+		k.mu.Lock()
+		k.jwks = jwks
+		k.keys = keys
+		k.fetchedAt = time.Now()
+		k.fetchErr = nil
+		k.unknown = make(map[string]time.Time)
+		k.mu.Unlock()
+		return jwks, nil
+	})
+	if err != nil {
+		return JSONWebKeySet{}, err
+	}
+	return result.(JSONWebKeySet), nil
+}
+
+// rememberUnknown has to be called with the lock held
+func (k *KeySet) rememberUnknown(kid string, now time.Time) {
+	if len(k.unknown) >= maxUnknownKeys {
+		for unknownKid, until := range k.unknown {
+			if now.After(until) {
+				delete(k.unknown, unknownKid)
+			}
+		}
+		if len(k.unknown) >= maxUnknownKeys {
+			k.unknown = make(map[string]time.Time)
+		}
+	}
+	k.unknown[kid] = now.Add(k.unknownKeyTTL)
+}
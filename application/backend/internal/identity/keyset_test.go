@@ -0,0 +1,113 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// jwksServer serves the keys currently in the set and counts how often they are fetched
+type jwksServer struct {
+	*httptest.Server
+	fetches atomic.Int32
+
+	mu   sync.Mutex
+	keys []JSONWebKey
+}
+
+func newJWKSServer(t *testing.T) *jwksServer {
+	s := &jwksServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		json.NewEncoder(w).Encode(JSONWebKeySet{Keys: s.keys})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) rotate(t *testing.T) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid := KeyID(&key.PublicKey)
+	s.mu.Lock()
+	s.keys = append(s.keys, NewJSONWebKey(kid, &key.PublicKey))
+	s.mu.Unlock()
+	return kid
+}
+
+func TestKeySetFetchesOnceForConcurrentRequests(t *testing.T) {
+	server := newJWKSServer(t)
+	kid := server.rotate(t)
+	keys := NewKeySet(server.URL)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := keys.PublicKey(context.Background(), kid); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if fetches := server.fetches.Load(); fetches != 1 {
+		t.Errorf("fetched %d times, want 1", fetches)
+	}
+}
+
+func TestKeySetRejectsUnknownKeysWithoutFetching(t *testing.T) {
+	server := newJWKSServer(t)
+	server.rotate(t)
+	keys := NewKeySet(server.URL)
+	// Allow fetching on every unknown key ID, only the negative cache should prevent it
+	keys.refreshInterval = 0
+
+	for i := 0; i < 10; i++ {
+		if _, err := keys.PublicKey(context.Background(), "random"); !errors.Is(err, ErrUnknownKey) {
+			t.Fatalf("PublicKey(random) = %v, want ErrUnknownKey", err)
+		}
+	}
+	if fetches := server.fetches.Load(); fetches != 1 {
+		t.Errorf("fetched %d times, want 1", fetches)
+	}
+}
+
+func TestKeySetPicksUpRotatedKeys(t *testing.T) {
+	server := newJWKSServer(t)
+	oldKid := server.rotate(t)
+	keys := NewKeySet(server.URL)
+	// Only the refresh interval should delay picking up the new key
+	keys.unknownKeyTTL = 0
+	ctx := context.Background()
+
+	if _, err := keys.PublicKey(ctx, oldKid); err != nil {
+		t.Fatal(err)
+	}
+	newKid := server.rotate(t)
+
+	// Within the refresh interval the new key is not fetched yet
+	if _, err := keys.PublicKey(ctx, newKid); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("PublicKey within the refresh interval = %v, want ErrUnknownKey", err)
+	}
+
+	keys.refreshInterval = 0
+	if _, err := keys.PublicKey(ctx, newKid); err != nil {
+		t.Fatalf("PublicKey after rotation: %v", err)
+	}
+	if _, err := keys.PublicKey(ctx, oldKid); err != nil {
+		t.Errorf("old key was dropped: %v", err)
+	}
+}
@@ -0,0 +1,514 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+const (
+	localTokenLifetime        = time.Hour
+	localRefreshTokenLifetime = 30 * 24 * time.Hour
+	localCodeLifetime         = 24 * time.Hour
+	// localSessionLifetime is how long the authenticator app code can be entered after the password, like in Cognito
+	localSessionLifetime   = 3 * time.Minute
+	minLocalPasswordLength = 8
+	// maxLocalPasswordLength is the most bcrypt hashes
+	maxLocalPasswordLength = 72
+)
+
+// Local stores accounts in MongoDB and signs its own tokens, so the API can run without a Cognito user pool. Codes are
+// written to the log instead of being emailed, it is not meant for production.
+type Local struct {
+	users    domain.LocalUserRepository
+	key      *rsa.PrivateKey
+	kid      string
+	issuer   string
+	audience string
+}
+
+func NewLocal(users domain.LocalUserRepository, key *rsa.PrivateKey, issuer, audience string) *Local {
+	return &Local{
+		users:    users,
+		key:      key,
+		kid:      KeyID(&key.PublicKey),
+		issuer:   issuer,
+		audience: audience,
+	}
+}
+
+// ParsePrivateKey parses a PEM encoded PKCS #1 or PKCS #8 RSA private key
+func ParsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+func (l *Local) SignUp(ctx context.Context, email, password string) error {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	code, err := l.newCode(email, "confirmation")
+	if err != nil {
+		return err
+	}
+	err = l.users.CreateLocalUser(ctx, &domain.LocalUserDB{
+		Email:            email,
+		PasswordHash:     passwordHash,
+		ConfirmationCode: &code,
+	})
+	if errors.Is(err, domain.ErrLocalUserExists) {
+		return ErrUserExists
+	}
+	return err
+}
+
+func (l *Local) ConfirmSignUp(ctx context.Context, email, code string) error {
+	user, err := l.userByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if user.Confirmed {
+		return fmt.Errorf("%w: user is already confirmed", ErrNotAuthorized)
+	}
+	if err := l.useCode(ctx, user.ID, "confirmationCode", user.ConfirmationCode, code); err != nil {
+		return err
+	}
+
+	return l.users.UpdateLocalUser(ctx, user.ID, domain.WithLocalUserConfirmed())
+}
+
+func (l *Local) ResendCode(ctx context.Context, email string) error {
+	user, err := l.userByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if user.Confirmed {
+		return fmt.Errorf("%w: user is already confirmed", ErrInvalidParameter)
+	}
+
+	code, err := l.newCode(user.Email, "confirmation")
+	if err != nil {
+		return err
+	}
+	return l.users.UpdateLocalUser(ctx, user.ID, domain.WithConfirmationCode(code))
+}
+
+func (l *Local) SignIn(ctx context.Context, email, password string) (Tokens, error) {
+	user, err := l.userByEmail(ctx, email)
+	if errors.Is(err, ErrUserNotFound) {
+		// Unknown emails are reported like wrong passwords, so accounts can not be enumerated
+		return Tokens{}, ErrNotAuthorized
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return Tokens{}, ErrNotAuthorized
+	}
+	if !user.Confirmed {
+		return Tokens{}, ErrUserNotConfirmed
+	}
+	if user.TOTPSecret != "" {
+		session, err := domain.GenerateAccessToken()
+		if err != nil {
+			return Tokens{}, err
+		}
+		err = l.users.UpdateLocalUser(ctx, user.ID, domain.WithMFASession(domain.LocalUserCode{
+			Hash:      domain.HashVerificationSecret(session),
+			ExpiresAt: time.Now().UTC().Add(localSessionLifetime),
+		}))
+		if err != nil {
+			return Tokens{}, err
+		}
+		return Tokens{}, &ChallengeError{Name: ChallengeSoftwareTokenMFA, Session: session}
+	}
+
+	return l.signIn(ctx, user)
+}
+
+// RespondToChallenge accepts authenticator app codes, the only challenge of the local provider
+func (l *Local) RespondToChallenge(ctx context.Context, response ChallengeResponse) (Tokens, error) {
+	if response.Name != ChallengeSoftwareTokenMFA {
+		return Tokens{}, fmt.Errorf("%w: unsupported challenge %q", ErrInvalidParameter, response.Name)
+	}
+	user, err := l.userByEmail(ctx, response.Email)
+	if errors.Is(err, ErrUserNotFound) {
+		return Tokens{}, ErrNotAuthorized
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+	// the attempt is counted on the session, so its authenticator app codes can not be guessed either
+	if user.TOTPSecret == "" || l.useCode(ctx, user.ID, "mfaSession", user.MFASession, response.Session) != nil {
+		return Tokens{}, fmt.Errorf("%w: invalid session", ErrNotAuthorized)
+	}
+	counter, err := checkTOTP(user.TOTPSecret, response.Code, user.TOTPCounter)
+	if err != nil {
+		return Tokens{}, err
+	}
+	if err := l.users.UpdateLocalUser(ctx, user.ID, domain.WithMFACompleted(counter)); err != nil {
+		return Tokens{}, err
+	}
+
+	return l.signIn(ctx, user)
+}
+
+// signIn issues tokens to the user after all authentication steps passed
+func (l *Local) signIn(ctx context.Context, user domain.LocalUserDB) (Tokens, error) {
+	refreshToken, err := domain.GenerateAccessToken()
+	if err != nil {
+		return Tokens{}, err
+	}
+	err = l.users.AddRefreshToken(ctx, user.ID, domain.LocalRefreshToken{
+		Hash:      domain.HashVerificationSecret(refreshToken),
+		ExpiresAt: time.Now().UTC().Add(localRefreshTokenLifetime),
+	})
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	tokens, err := l.issueTokens(user)
+	if err != nil {
+		return Tokens{}, err
+	}
+	tokens.RefreshToken = refreshToken
+	return tokens, nil
+}
+
+func (l *Local) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	tokenHash := domain.HashVerificationSecret(refreshToken)
+	user, err := l.users.GetLocalUserByRefreshToken(ctx, tokenHash)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Tokens{}, ErrNotAuthorized
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	now := time.Now()
+	for _, token := range user.RefreshTokens {
+		if token.Hash == tokenHash && now.Before(token.ExpiresAt) {
+			return l.issueTokens(user)
+		}
+	}
+	return Tokens{}, ErrNotAuthorized
+}
+
+func (l *Local) ForgotPassword(ctx context.Context, email string) error {
+	user, err := l.userByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	code, err := l.newCode(user.Email, "password reset")
+	if err != nil {
+		return err
+	}
+	return l.users.UpdateLocalUser(ctx, user.ID, domain.WithResetCode(code))
+}
+
+func (l *Local) ConfirmForgotPassword(ctx context.Context, email, code, password string) error {
+	user, err := l.userByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if err := l.useCode(ctx, user.ID, "resetCode", user.ResetCode, code); err != nil {
+		return err
+	}
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return l.users.UpdateLocalUser(ctx, user.ID, domain.WithLocalUserPassword(passwordHash))
+}
+
+func (l *Local) ChangePassword(ctx context.Context, accessToken, oldPassword, newPassword string) error {
+	user, err := l.userByAccessToken(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(oldPassword)) != nil {
+		return ErrNotAuthorized
+	}
+	passwordHash, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	return l.users.UpdateLocalUser(ctx, user.ID, domain.WithLocalUserPassword(passwordHash))
+}
+
+func (l *Local) GetUser(ctx context.Context, accessToken string) (User, error) {
+	user, err := l.userByAccessToken(ctx, accessToken)
+	if err != nil {
+		return User{}, err
+	}
+
+	profile := User{
+		Username: user.ID.Hex(),
+		Attributes: map[string]string{
+			"sub":            user.ID.Hex(),
+			"email":          user.Email,
+			"email_verified": fmt.Sprint(user.Confirmed),
+		},
+	}
+	if user.TOTPSecret != "" {
+		profile.PreferredMFA = ChallengeSoftwareTokenMFA
+	}
+	return profile, nil
+}
+
+func (l *Local) SignOut(ctx context.Context, accessToken string) error {
+	user, err := l.userByAccessToken(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+	return l.users.UpdateLocalUser(ctx, user.ID, domain.WithoutRefreshTokens())
+}
+
+func (l *Local) RevokeToken(ctx context.Context, refreshToken string) error {
+	return l.users.RevokeRefreshToken(ctx, domain.HashVerificationSecret(refreshToken))
+}
+
+func (l *Local) AssociateTOTP(ctx context.Context, accessToken string) (string, error) {
+	user, err := l.userByAccessToken(ctx, accessToken)
+	if err != nil {
+		return "", err
+	}
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	if err := l.users.UpdateLocalUser(ctx, user.ID, domain.WithPendingTOTPSecret(secret)); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+func (l *Local) VerifyTOTP(ctx context.Context, accessToken, code, deviceName string) error {
+	user, err := l.userByAccessToken(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+	if user.PendingTOTPSecret == "" {
+		return fmt.Errorf("%w: no authenticator app is being set up", ErrInvalidParameter)
+	}
+	counter, err := checkTOTP(user.PendingTOTPSecret, code, 0)
+	if err != nil {
+		return err
+	}
+
+	return l.users.UpdateLocalUser(ctx, user.ID, domain.WithTOTPEnabled(user.PendingTOTPSecret, counter))
+}
+
+func (l *Local) DisableTOTP(ctx context.Context, accessToken string) error {
+	user, err := l.userByAccessToken(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+	return l.users.UpdateLocalUser(ctx, user.ID, domain.WithoutTOTP())
+}
+
+func (l *Local) Issuer() string {
+	return l.issuer
+}
+
+func (l *Local) Audience() string {
+	return l.audience
+}
+
+func (l *Local) PublicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	if kid != l.kid {
+		return nil, ErrUnknownKey
+	}
+	return &l.key.PublicKey, nil
+}
+
+func (l *Local) JWKS(ctx context.Context) (JSONWebKeySet, error) {
+	return JSONWebKeySet{Keys: []JSONWebKey{NewJSONWebKey(l.kid, &l.key.PublicKey)}}, nil
+}
+
+// issueTokens signs an ID and an access token with the claims Cognito would include
+func (l *Local) issueTokens(user domain.LocalUserDB) (Tokens, error) {
+	now := time.Now()
+	common := jwt.MapClaims{
+		"sub":       user.ID.Hex(),
+		"iss":       l.issuer,
+		"iat":       now.Unix(),
+		"auth_time": now.Unix(),
+		"exp":       now.Add(localTokenLifetime).Unix(),
+	}
+
+	idClaims := jwt.MapClaims{
+		"aud":            l.audience,
+		"token_use":      "id",
+		"email":          user.Email,
+		"email_verified": user.Confirmed,
+	}
+	accessClaims := jwt.MapClaims{
+		"client_id": l.audience,
+		"token_use": "access",
+		"username":  user.ID.Hex(),
+	}
+	for key, value := range common {
+		idClaims[key] = value
+		accessClaims[key] = value
+	}
+
+	idToken, err := l.sign(idClaims)
+	if err != nil {
+		return Tokens{}, err
+	}
+	accessToken, err := l.sign(accessClaims)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	return Tokens{
+		IDToken:     idToken,
+		AccessToken: accessToken,
+		ExpiresIn:   int32(localTokenLifetime / time.Second),
+	}, nil
+}
+
+func (l *Local) sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = l.kid
+	return token.SignedString(l.key)
+}
+
+func (l *Local) userByEmail(ctx context.Context, email string) (domain.LocalUserDB, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return domain.LocalUserDB{}, err
+	}
+
+	user, err := l.users.GetLocalUserByEmail(ctx, email)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return domain.LocalUserDB{}, ErrUserNotFound
+	}
+	return user, err
+}
+
+// userByAccessToken loads the user an access token was issued to, like Cognito operations on the signed in user
+func (l *Local) userByAccessToken(ctx context.Context, accessToken string) (domain.LocalUserDB, error) {
+	claims, err := Validate(ctx, l, accessToken)
+	if err != nil || claims["token_use"] != "access" {
+		return domain.LocalUserDB{}, ErrNotAuthorized
+	}
+	sub, _ := claims["sub"].(string)
+	userId, err := primitive.ObjectIDFromHex(sub)
+	if err != nil {
+		return domain.LocalUserDB{}, ErrNotAuthorized
+	}
+
+	user, err := l.users.GetLocalUser(ctx, userId)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return domain.LocalUserDB{}, ErrNotAuthorized
+	}
+	return user, err
+}
+
+// newCode generates a one-time code and logs it in place of sending an email
+func (l *Local) newCode(email, purpose string) (domain.LocalUserCode, error) {
+	code, err := domain.GenerateVerificationCode()
+	if err != nil {
+		return domain.LocalUserCode{}, err
+	}
+	log.Printf("Local identity %s code for %s: %s", purpose, email, code)
+
+	return domain.LocalUserCode{
+		Hash:      domain.HashVerificationSecret(code),
+		ExpiresAt: time.Now().UTC().Add(localCodeLifetime),
+	}, nil
+}
+
+// useCode counts the attempt before checking the one-time code stored in field, a code tried too often has to be
+// requested again
+func (l *Local) useCode(ctx context.Context, userId primitive.ObjectID, field string, stored *domain.LocalUserCode, code string) error {
+	if stored == nil {
+		return ErrCodeMismatch
+	}
+	if !stored.Usable(time.Now()) {
+		return ErrCodeExpired
+	}
+	if err := l.users.CountCodeAttempt(ctx, userId, field); err != nil {
+		if errors.Is(err, domain.ErrLocalCodeUsedUp) {
+			return fmt.Errorf("%w: too many attempts", ErrCodeExpired)
+		}
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(stored.Hash), []byte(domain.HashVerificationSecret(code))) != 1 {
+		return ErrCodeMismatch
+	}
+	return nil
+}
+
+// checkTOTP returns the time step of the code if it is valid and newer than the last accepted one
+func checkTOTP(secret, code string, lastCounter int64) (int64, error) {
+	counter, ok := matchTOTP(secret, code, time.Now())
+	if !ok || counter <= lastCounter {
+		return 0, ErrCodeMismatch
+	}
+	return counter, nil
+}
+
+func normalizeEmail(email string) (string, error) {
+	address, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || address.Address != strings.TrimSpace(email) {
+		return "", fmt.Errorf("%w: invalid email", ErrInvalidParameter)
+	}
+	return strings.ToLower(address.Address), nil
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < minLocalPasswordLength || len(password) > maxLocalPasswordLength {
+		return "", ErrInvalidPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// generateKey creates a signing key for a single run, tokens stop validating after a restart
+func generateKey() (*rsa.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, 2048)
+}
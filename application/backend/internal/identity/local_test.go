@@ -0,0 +1,326 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"testing"
+	"time"
+)
+
+// memoryUsers keeps local users in memory, updates are applied by round tripping the user through BSON
+type memoryUsers struct {
+	users map[primitive.ObjectID]domain.LocalUserDB
+}
+
+func (m *memoryUsers) CreateLocalUser(ctx context.Context, user *domain.LocalUserDB) error {
+	if _, err := m.GetLocalUserByEmail(ctx, user.Email); err == nil {
+		return domain.ErrLocalUserExists
+	}
+	user.ID = primitive.NewObjectID()
+	m.users[user.ID] = *user
+	return nil
+}
+
+func (m *memoryUsers) GetLocalUser(ctx context.Context, userId primitive.ObjectID) (domain.LocalUserDB, error) {
+	user, ok := m.users[userId]
+	if !ok {
+		return domain.LocalUserDB{}, mongo.ErrNoDocuments
+	}
+	return user, nil
+}
+
+func (m *memoryUsers) GetLocalUserByEmail(ctx context.Context, email string) (domain.LocalUserDB, error) {
+	for _, user := range m.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return domain.LocalUserDB{}, mongo.ErrNoDocuments
+}
+
+func (m *memoryUsers) GetLocalUserByRefreshToken(ctx context.Context, tokenHash string) (domain.LocalUserDB, error) {
+	for _, user := range m.users {
+		for _, token := range user.RefreshTokens {
+			if token.Hash == tokenHash {
+				return user, nil
+			}
+		}
+	}
+	return domain.LocalUserDB{}, mongo.ErrNoDocuments
+}
+
+func (m *memoryUsers) UpdateLocalUser(ctx context.Context, userId primitive.ObjectID, opts ...domain.LocalUserUpdateOption) error {
+	user, err := m.GetLocalUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+	updateOptions := &domain.LocalUserUpdateOptions{}
+	for _, opt := range opts {
+		opt(updateOptions)
+	}
+
+	raw, err := bson.Marshal(user)
+	if err != nil {
+		return err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	for _, field := range updateOptions.SetFields {
+		doc[field.Key] = field.Value
+	}
+	if raw, err = bson.Marshal(doc); err != nil {
+		return err
+	}
+	var updated domain.LocalUserDB
+	if err := bson.Unmarshal(raw, &updated); err != nil {
+		return err
+	}
+	m.users[userId] = updated
+	return nil
+}
+
+func (m *memoryUsers) CountCodeAttempt(ctx context.Context, userId primitive.ObjectID, field string) error {
+	user, err := m.GetLocalUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+	codes := map[string]*domain.LocalUserCode{
+		"confirmationCode": user.ConfirmationCode,
+		"resetCode":        user.ResetCode,
+		"mfaSession":       user.MFASession,
+	}
+	code := codes[field]
+	if code == nil || code.Attempts >= domain.MaxLocalCodeAttempts {
+		return domain.ErrLocalCodeUsedUp
+	}
+	code.Attempts++
+	m.users[userId] = user
+	return nil
+}
+
+func (m *memoryUsers) AddRefreshToken(ctx context.Context, userId primitive.ObjectID, token domain.LocalRefreshToken) error {
+	user, err := m.GetLocalUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+	user.RefreshTokens = append(user.RefreshTokens, token)
+	m.users[userId] = user
+	return nil
+}
+
+func (m *memoryUsers) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	user, err := m.GetLocalUserByRefreshToken(ctx, tokenHash)
+	if err != nil {
+		return nil
+	}
+	tokens := user.RefreshTokens[:0]
+	for _, token := range user.RefreshTokens {
+		if token.Hash != tokenHash {
+			tokens = append(tokens, token)
+		}
+	}
+	user.RefreshTokens = tokens
+	m.users[user.ID] = user
+	return nil
+}
+
+func newTestLocal(t *testing.T) (*Local, *memoryUsers) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &memoryUsers{users: make(map[primitive.ObjectID]domain.LocalUserDB)}
+	return NewLocal(users, key, "halftone-test", "halftone"), users
+}
+
+// setCode replaces the logged one-time code with a known one
+func setCode(t *testing.T, users *memoryUsers, email string, opt func(domain.LocalUserCode) domain.LocalUserUpdateOption) string {
+	t.Helper()
+	user, err := users.GetLocalUserByEmail(context.Background(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := "123456"
+	stored := domain.LocalUserCode{Hash: domain.HashVerificationSecret(code), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := users.UpdateLocalUser(context.Background(), user.ID, opt(stored)); err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestLocalSignInFlow(t *testing.T) {
+	ctx := context.Background()
+	local, users := newTestLocal(t)
+	const email, password = "anna@example.com", "correct horse"
+
+	if err := local.SignUp(ctx, "Anna@example.com", password); err != nil {
+		t.Fatalf("SignUp: %v", err)
+	}
+	if err := local.SignUp(ctx, email, password); !errors.Is(err, ErrUserExists) {
+		t.Errorf("SignUp with a taken email = %v, want ErrUserExists", err)
+	}
+	if err := local.SignUp(ctx, "ben@example.com", "short"); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("SignUp with a short password = %v, want ErrInvalidPassword", err)
+	}
+	if _, err := local.SignIn(ctx, email, password); !errors.Is(err, ErrUserNotConfirmed) {
+		t.Errorf("SignIn before confirming = %v, want ErrUserNotConfirmed", err)
+	}
+
+	code := setCode(t, users, email, domain.WithConfirmationCode)
+	if err := local.ConfirmSignUp(ctx, email, "000000"); !errors.Is(err, ErrCodeMismatch) {
+		t.Errorf("ConfirmSignUp with a wrong code = %v, want ErrCodeMismatch", err)
+	}
+	if err := local.ConfirmSignUp(ctx, email, code); err != nil {
+		t.Fatalf("ConfirmSignUp: %v", err)
+	}
+
+	if _, err := local.SignIn(ctx, email, "wrong password"); !errors.Is(err, ErrNotAuthorized) {
+		t.Errorf("SignIn with a wrong password = %v, want ErrNotAuthorized", err)
+	}
+	tokens, err := local.SignIn(ctx, email, password)
+	if err != nil {
+		t.Fatalf("SignIn: %v", err)
+	}
+
+	claims, err := Validate(ctx, local, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("Validate access token: %v", err)
+	}
+	if claims["token_use"] != "access" || claims["sub"] == "" {
+		t.Errorf("unexpected access token claims %v", claims)
+	}
+	claims, err = Validate(ctx, local, tokens.IDToken)
+	if err != nil {
+		t.Fatalf("Validate ID token: %v", err)
+	}
+	if claims["email"] != email {
+		t.Errorf("ID token email = %v, want %s", claims["email"], email)
+	}
+
+	user, err := local.GetUser(ctx, tokens.AccessToken)
+	if err != nil || user.Attributes["email"] != email {
+		t.Errorf("GetUser = %v, %v", user, err)
+	}
+	if _, err := local.GetUser(ctx, tokens.IDToken); !errors.Is(err, ErrNotAuthorized) {
+		t.Errorf("GetUser with an ID token = %v, want ErrNotAuthorized", err)
+	}
+
+	if _, err := local.Refresh(ctx, tokens.RefreshToken); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if err := local.SignOut(ctx, tokens.AccessToken); err != nil {
+		t.Fatalf("SignOut: %v", err)
+	}
+	if _, err := local.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, ErrNotAuthorized) {
+		t.Errorf("Refresh after signing out = %v, want ErrNotAuthorized", err)
+	}
+}
+
+func TestLocalPasswordReset(t *testing.T) {
+	ctx := context.Background()
+	local, users := newTestLocal(t)
+	const email = "anna@example.com"
+
+	if err := local.SignUp(ctx, email, "first password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.ConfirmSignUp(ctx, email, setCode(t, users, email, domain.WithConfirmationCode)); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := local.SignIn(ctx, email, "first password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := local.ForgotPassword(ctx, "nobody@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("ForgotPassword for an unknown email = %v, want ErrUserNotFound", err)
+	}
+	if err := local.ForgotPassword(ctx, email); err != nil {
+		t.Fatal(err)
+	}
+	code := setCode(t, users, email, domain.WithResetCode)
+	if err := local.ConfirmForgotPassword(ctx, email, code, "second password"); err != nil {
+		t.Fatalf("ConfirmForgotPassword: %v", err)
+	}
+
+	if _, err := local.SignIn(ctx, email, "first password"); !errors.Is(err, ErrNotAuthorized) {
+		t.Errorf("SignIn with the old password = %v, want ErrNotAuthorized", err)
+	}
+	if _, err := local.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, ErrNotAuthorized) {
+		t.Errorf("Refresh after a password reset = %v, want ErrNotAuthorized", err)
+	}
+	if _, err := local.SignIn(ctx, email, "second password"); err != nil {
+		t.Errorf("SignIn with the new password: %v", err)
+	}
+}
+
+func TestLocalCodeAttempts(t *testing.T) {
+	ctx := context.Background()
+	local, users := newTestLocal(t)
+	const email = "anna@example.com"
+
+	if err := local.SignUp(ctx, email, "first password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.ConfirmSignUp(ctx, email, setCode(t, users, email, domain.WithConfirmationCode)); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.ForgotPassword(ctx, email); err != nil {
+		t.Fatal(err)
+	}
+	code := setCode(t, users, email, domain.WithResetCode)
+	for i := 0; i < domain.MaxLocalCodeAttempts; i++ {
+		if err := local.ConfirmForgotPassword(ctx, email, "000000", "second password"); !errors.Is(err, ErrCodeMismatch) {
+			t.Fatalf("ConfirmForgotPassword with a wrong code = %v, want ErrCodeMismatch", err)
+		}
+	}
+	if err := local.ConfirmForgotPassword(ctx, email, code, "second password"); !errors.Is(err, ErrCodeExpired) {
+		t.Errorf("ConfirmForgotPassword after too many attempts = %v, want ErrCodeExpired", err)
+	}
+}
+
+func TestValidateRejectsForeignTokens(t *testing.T) {
+	ctx := context.Background()
+	local, users := newTestLocal(t)
+	other, _ := newTestLocal(t)
+	other.users = users
+
+	if err := local.SignUp(ctx, "anna@example.com", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.ConfirmSignUp(ctx, "anna@example.com", setCode(t, users, "anna@example.com", domain.WithConfirmationCode)); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := other.SignIn(ctx, "anna@example.com", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Validate(ctx, local, tokens.AccessToken); err == nil {
+		t.Error("Validate accepted a token signed with another key")
+	}
+}
+
+func TestJSONWebKeyRoundTrip(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwk := NewJSONWebKey(KeyID(&key.PublicKey), &key.PublicKey)
+	got, err := jwk.RSAPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(&key.PublicKey) {
+		t.Error("public key does not survive the JWK round trip")
+	}
+}
@@ -0,0 +1,83 @@
+package identity
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// OIDC verifies tokens of an OpenID Connect issuer, the signing keys are found through its discovery document. Accounts
+// are managed by the issuer, so it can only protect the API.
+type OIDC struct {
+	issuer   string
+	audience string
+	keys     *KeySet
+}
+
+type openIDConfiguration struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+// NewOIDC fetches the discovery document of the issuer, it fails when the issuer is not reachable
+func NewOIDC(ctx context.Context, issuer, audience string) (*OIDC, error) {
+	if issuer == "" || audience == "" {
+		return nil, errors.New("OIDC issuer and audience are required")
+	}
+
+	discoveryURL := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch OIDC discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch OIDC discovery document: %s", resp.Status)
+	}
+
+	var config openIDConfiguration
+	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+		return nil, fmt.Errorf("invalid OIDC discovery document: %w", err)
+	}
+	// The issuer has to match exactly, including the trailing slash some issuers use
+	if config.Issuer != issuer {
+		return nil, fmt.Errorf("OIDC discovery document is for issuer %q", config.Issuer)
+	}
+	if config.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document has no jwks_uri")
+	}
+
+	return &OIDC{
+		issuer:   config.Issuer,
+		audience: audience,
+		keys:     NewKeySet(config.JWKSURI),
+	}, nil
+}
+
+// NewAuth0 verifies tokens of an Auth0 tenant issued for the API identified by audience
+func NewAuth0(ctx context.Context, domain, audience string) (*OIDC, error) {
+	if domain == "" {
+		return nil, errors.New("Auth0 domain is required")
+	}
+	return NewOIDC(ctx, "https://"+domain+"/", audience)
+}
+
+func (o *OIDC) Issuer() string {
+	return o.issuer
+}
+
+func (o *OIDC) Audience() string {
+	return o.audience
+}
+
+func (o *OIDC) PublicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	return o.keys.PublicKey(ctx, kid)
+}
@@ -0,0 +1,67 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v4"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOIDCValidatesDiscoveredKeys(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid := KeyID(&key.PublicKey)
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	issuer := server.URL + "/"
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(openIDConfiguration{Issuer: issuer, JWKSURI: server.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(JSONWebKeySet{Keys: []JSONWebKey{NewJSONWebKey(kid, &key.PublicKey)}})
+	})
+
+	ctx := context.Background()
+	verifier, err := NewOIDC(ctx, issuer, "https://api.halftone.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	claims, err := Validate(ctx, verifier, sign(jwt.MapClaims{
+		"iss": issuer,
+		"sub": "auth0|5f1a",
+		"aud": []string{"https://api.halftone.test", issuer + "userinfo"},
+		"exp": exp,
+	}))
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if claims["sub"] != "auth0|5f1a" {
+		t.Errorf("sub = %v", claims["sub"])
+	}
+
+	_, err = Validate(ctx, verifier, sign(jwt.MapClaims{"iss": issuer, "sub": "auth0|5f1a", "aud": "another-api", "exp": exp}))
+	if err == nil {
+		t.Error("Validate accepted a token for another audience")
+	}
+}
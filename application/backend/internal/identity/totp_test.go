@@ -0,0 +1,116 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"github.com/michalK00/halftone/internal/domain"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// Test vectors of RFC 6238 for SHA-1, truncated to 6 digits
+	secret := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, test := range tests {
+		if code := totpCode(secret, uint64(test.unix/30)); code != test.code {
+			t.Errorf("totpCode at %d = %s, want %s", test.unix, code, test.code)
+		}
+	}
+
+	encoded := totpEncoding.EncodeToString(secret)
+	now := time.Unix(1111111109, 0)
+	if _, ok := matchTOTP(encoded, "081804", now.Add(30*time.Second)); !ok {
+		t.Error("matchTOTP rejected a code of the previous period")
+	}
+	if _, ok := matchTOTP(encoded, "081804", now.Add(2*time.Minute)); ok {
+		t.Error("matchTOTP accepted an outdated code")
+	}
+}
+
+func TestLocalTOTPSignIn(t *testing.T) {
+	ctx := context.Background()
+	local, users := newTestLocal(t)
+	const email, password = "anna@example.com", "correct horse"
+
+	if err := local.SignUp(ctx, email, password); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.ConfirmSignUp(ctx, email, setCode(t, users, email, domain.WithConfirmationCode)); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := local.SignIn(ctx, email, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := local.AssociateTOTP(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("AssociateTOTP: %v", err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	step := uint64(time.Now().Unix() / 30)
+	if err := local.VerifyTOTP(ctx, tokens.AccessToken, totpCode(key, step+5), ""); !errors.Is(err, ErrCodeMismatch) {
+		t.Errorf("VerifyTOTP with a wrong code = %v, want ErrCodeMismatch", err)
+	}
+	if err := local.VerifyTOTP(ctx, tokens.AccessToken, totpCode(key, step), "Phone"); err != nil {
+		t.Fatalf("VerifyTOTP: %v", err)
+	}
+
+	_, err = local.SignIn(ctx, email, password)
+	var challenge *ChallengeError
+	if !errors.As(err, &challenge) || challenge.Name != ChallengeSoftwareTokenMFA {
+		t.Fatalf("SignIn with TOTP enabled = %v, want a %s challenge", err, ChallengeSoftwareTokenMFA)
+	}
+
+	response := ChallengeResponse{Name: challenge.Name, Session: challenge.Session, Email: email, Code: totpCode(key, step)}
+	if _, err := local.RespondToChallenge(ctx, response); !errors.Is(err, ErrCodeMismatch) {
+		t.Errorf("RespondToChallenge with a replayed code = %v, want ErrCodeMismatch", err)
+	}
+	response.Code = totpCode(key, step+1)
+	if _, err := local.RespondToChallenge(ctx, ChallengeResponse{Name: response.Name, Session: "wrong", Email: email, Code: response.Code}); !errors.Is(err, ErrNotAuthorized) {
+		t.Errorf("RespondToChallenge with a wrong session = %v, want ErrNotAuthorized", err)
+	}
+	tokens, err = local.RespondToChallenge(ctx, response)
+	if err != nil {
+		t.Fatalf("RespondToChallenge: %v", err)
+	}
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Error("RespondToChallenge did not issue tokens")
+	}
+	if _, err := local.RespondToChallenge(ctx, response); !errors.Is(err, ErrNotAuthorized) {
+		t.Errorf("RespondToChallenge with a used session = %v, want ErrNotAuthorized", err)
+	}
+
+	user, err := local.GetUser(ctx, tokens.AccessToken)
+	if err != nil || user.PreferredMFA != ChallengeSoftwareTokenMFA {
+		t.Errorf("GetUser = %v, %v, want TOTP as preferred MFA", user, err)
+	}
+	if err := local.DisableTOTP(ctx, tokens.AccessToken); err != nil {
+		t.Fatalf("DisableTOTP: %v", err)
+	}
+	if _, err := local.SignIn(ctx, email, password); err != nil {
+		t.Errorf("SignIn after disabling TOTP: %v", err)
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("Halftone", "anna@example.com", "JBSWY3DPEHPK3PXP")
+	if !strings.HasPrefix(uri, "otpauth://totp/Halftone:anna@example.com?") ||
+		!strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") || !strings.Contains(uri, "issuer=Halftone") {
+		t.Errorf("unexpected URI %s", uri)
+	}
+}
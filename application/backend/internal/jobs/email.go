@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/michalK00/halftone/internal/domain"
+	"github.com/michalK00/halftone/internal/mail"
+	"time"
+)
+
+// emailSendTimeout keeps a mail server that does not answer from holding up the runner
+const emailSendTimeout = 30 * time.Second
+
+// EmailSender handles email jobs queued by the API
+type EmailSender struct {
+	mailer mail.Mailer
+}
+
+func NewEmailSender(mailer mail.Mailer) *EmailSender {
+	return &EmailSender{
+		mailer: mailer,
+	}
+}
+
+func (s *EmailSender) Handle(ctx context.Context, job domain.Job) error {
+	var payload domain.EmailPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, emailSendTimeout)
+	defer cancel()
+	return s.mailer.Send(ctx, mail.Message{
+		To:      payload.To,
+		Subject: payload.Subject,
+		Text:    payload.Text,
+		HTML:    payload.HTML,
+	})
+}
@@ -0,0 +1,216 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/michalK00/halftone/internal/domain"
+	"github.com/michalK00/halftone/internal/fcm"
+	"github.com/michalK00/halftone/internal/mail"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"log"
+	"time"
+)
+
+const (
+	// ExpiryNoticePeriod is how long before the sharing of a gallery expires the photographer is told about it
+	ExpiryNoticePeriod  = 3 * 24 * time.Hour
+	expiryCheckInterval = time.Hour
+)
+
+// Notifier stores notifications in the inbox of the user and queues their delivery
+type Notifier struct {
+	notificationRepo domain.NotificationRepository
+	jobRepo          domain.JobRepository
+}
+
+func NewNotifier(notificationRepo domain.NotificationRepository, jobRepo domain.JobRepository) *Notifier {
+	return &Notifier{
+		notificationRepo: notificationRepo,
+		jobRepo:          jobRepo,
+	}
+}
+
+// Notify creates the notification and queues its delivery, notifications whose key was already used are skipped. The
+// delivery is queued first, so a notification is never stored without it.
+func (n *Notifier) Notify(ctx context.Context, notification *domain.NotificationDB) error {
+	notification.ID = primitive.NewObjectID()
+	job, err := domain.NewNotificationDeliveryJob(domain.NotificationDeliveryPayload{NotificationId: notification.ID})
+	if err != nil {
+		return err
+	}
+	jobId, err := n.jobRepo.CreateJob(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	if err := n.notificationRepo.CreateNotification(ctx, notification); err != nil {
+		// a delivery job left behind fails to find the notification until its retries are used up
+		if _, deleteErr := n.jobRepo.DeleteJob(ctx, jobId); deleteErr != nil {
+			log.Printf("Failed to remove delivery job of notification %s: %v", notification.ID.Hex(), deleteErr)
+		}
+		if errors.Is(err, domain.ErrNotificationExists) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// NotificationDeliverer handles notification delivery jobs, sending the notification over the channel the user picked
+type NotificationDeliverer struct {
+	notificationRepo domain.NotificationRepository
+	fcmService       *fcm.Service
+	mailer           mail.Mailer
+}
+
+// NewNotificationDeliverer creates the handler of notification delivery jobs, fcmService is optional
+func NewNotificationDeliverer(notificationRepo domain.NotificationRepository, fcmService *fcm.Service, mailer mail.Mailer) *NotificationDeliverer {
+	return &NotificationDeliverer{
+		notificationRepo: notificationRepo,
+		fcmService:       fcmService,
+		mailer:           mailer,
+	}
+}
+
+func (d *NotificationDeliverer) Handle(ctx context.Context, job domain.Job) error {
+	var payload domain.NotificationDeliveryPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
+
+	notification, err := d.notificationRepo.GetNotification(ctx, payload.NotificationId)
+	if err != nil {
+		return err
+	}
+	// a retry after the delivery was recorded must not send it twice
+	if notification.DeliveredAt != nil {
+		return nil
+	}
+
+	preferences, err := d.notificationRepo.GetNotificationPreferences(ctx, notification.UserId)
+	if err != nil {
+		return err
+	}
+
+	channel := preferences.DeliveryChannel(notification.Type)
+	switch channel {
+	case domain.ChannelPush:
+		if d.fcmService == nil {
+			return nil
+		}
+		err = d.fcmService.SendMessage(ctx, pushMessage(notification))
+		if errors.Is(err, fcm.ErrNoTokens) {
+			return nil
+		}
+	case domain.ChannelEmail:
+		err = d.sendEmail(ctx, notification, preferences.Email)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return d.notificationRepo.MarkNotificationDelivered(ctx, notification.ID, channel)
+}
+
+func pushMessage(notification domain.NotificationDB) *fcm.SendMessageRequest {
+	data := map[string]string{
+		"notificationId": notification.ID.Hex(),
+		"type":           string(notification.Type),
+	}
+	for key, value := range notification.Data {
+		data[key] = value
+	}
+
+	return &fcm.SendMessageRequest{
+		Message: &fcm.PushMessage{
+			Title: notification.Title,
+			Body:  notification.Body,
+			Data:  data,
+			URL:   notification.URL,
+		},
+		UserIDs: []string{notification.UserId},
+	}
+}
+
+func (d *NotificationDeliverer) sendEmail(ctx context.Context, notification domain.NotificationDB, email string) error {
+	data := mail.NotificationEmailData{
+		Title: notification.Title,
+		Body:  notification.Body,
+		URL:   notification.URL,
+	}
+	msg, err := mail.Render(mail.TemplateNotification, notification.Title, []string{email}, data)
+	if err != nil {
+		return err
+	}
+	return d.mailer.Send(ctx, msg)
+}
+
+// ExpiryWatcher notifies photographers about shared galleries that expire within ExpiryNoticePeriod
+type ExpiryWatcher struct {
+	galleryRepo domain.GalleryRepository
+	notifier    *Notifier
+	logger      *zap.Logger
+}
+
+func NewExpiryWatcher(galleryRepo domain.GalleryRepository, notifier *Notifier, logger *zap.Logger) *ExpiryWatcher {
+	return &ExpiryWatcher{
+		galleryRepo: galleryRepo,
+		notifier:    notifier,
+		logger:      logger,
+	}
+}
+
+// Run blocks until ctx is cancelled. Several schedulers can run it, the notification key lets only one of them
+// notify about an expiry date.
+func (w *ExpiryWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(expiryCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.check(ctx, time.Now().UTC()); err != nil && ctx.Err() == nil {
+			w.logger.Error("failed to check expiring galleries", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *ExpiryWatcher) check(ctx context.Context, now time.Time) error {
+	galleries, err := w.galleryRepo.GetGalleriesExpiringBetween(ctx, now, now.Add(ExpiryNoticePeriod))
+	if err != nil {
+		return err
+	}
+
+	for _, gallery := range galleries {
+		if err := w.notifier.Notify(ctx, ExpiryNotification(gallery)); err != nil {
+			w.logger.Error("failed to notify about expiring gallery", zap.String("galleryId", gallery.ID.Hex()), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// ExpiryNotification tells the photographer that the sharing of the gallery expires soon, it is keyed by the expiry
+// date so extending the sharing notifies again when the new date comes close
+func ExpiryNotification(gallery domain.GalleryDB) *domain.NotificationDB {
+	expiry := gallery.Sharing.SharingExpiryDate
+	return &domain.NotificationDB{
+		UserId:      gallery.UserId,
+		WorkspaceID: gallery.WorkspaceID,
+		Type:        domain.NotificationExpiryUpcoming,
+		Title:       "Gallery expires soon",
+		Body:        fmt.Sprintf("Sharing of %s expires on %s", gallery.Name, expiry.Format("2 Jan 2006 15:04 MST")),
+		Data: map[string]string{
+			"galleryId": gallery.ID.Hex(),
+		},
+		Key: fmt.Sprintf("%s:%s:%d", domain.NotificationExpiryUpcoming, gallery.ID.Hex(), expiry.Unix()),
+	}
+}
@@ -0,0 +1,280 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/michalK00/halftone/internal/archive"
+	"github.com/michalK00/halftone/internal/aws"
+	"github.com/michalK00/halftone/internal/csvutil"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportLinkLifetime is how long the download link sent to the photographer stays valid
+const ExportLinkLifetime int64 = 60 * 60 * 24 * 7
+
+const originalsFolder = "originals"
+
+type OrderExporter struct {
+	orderRepo   domain.OrderRepository
+	galleryRepo domain.GalleryRepository
+	photoRepo   domain.PhotoRepository
+	notifier    *Notifier
+}
+
+type exportManifestItem struct {
+	Folder           string `json:"folder"`
+	File             string `json:"file"`
+	OriginalFilename string `json:"originalFilename"`
+	PhotoId          string `json:"photoId"`
+	Product          string `json:"product"`
+	Quantity         int    `json:"quantity"`
+}
+
+type exportManifest struct {
+	OrderId     string               `json:"orderId"`
+	GalleryId   string               `json:"galleryId"`
+	ClientEmail string               `json:"clientEmail"`
+	Comment     string               `json:"comment"`
+	CreatedAt   time.Time            `json:"createdAt"`
+	Items       []exportManifestItem `json:"items"`
+}
+
+// NewOrderExporter creates the handler of order export jobs, notifier is optional
+func NewOrderExporter(orderRepo domain.OrderRepository, galleryRepo domain.GalleryRepository, photoRepo domain.PhotoRepository, notifier *Notifier) *OrderExporter {
+	return &OrderExporter{
+		orderRepo:   orderRepo,
+		galleryRepo: galleryRepo,
+		photoRepo:   photoRepo,
+		notifier:    notifier,
+	}
+}
+
+func ExportObjectKey(gallery domain.GalleryDB, orderId primitive.ObjectID) string {
+	return path.Join(gallery.CollectionId.Hex(), gallery.ID.Hex(), "exports", orderId.Hex()+".zip")
+}
+
+func (e *OrderExporter) Handle(ctx context.Context, job domain.Job) error {
+	var payload domain.OrderExportPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
+
+	order, err := e.orderRepo.GetOrderByID(ctx, payload.OrderId)
+	if err != nil {
+		return err
+	}
+	export := domain.OrderExport{
+		Status:      domain.OrderExportPending,
+		JobID:       job.ID,
+		RequestedAt: job.CreatedAt,
+	}
+	if order.Export != nil {
+		export.RequestedAt = order.Export.RequestedAt
+	}
+
+	gallery, objectKey, err := e.export(ctx, order)
+	if err != nil {
+		// Retries are used up, let the photographer know it will not finish
+		if job.Retries == 0 {
+			now := time.Now().UTC()
+			export.Status = domain.OrderExportFailed
+			export.Error = "Export failed"
+			export.CompletedAt = &now
+			_ = e.orderRepo.UpdateOrderExport(ctx, order.ID, export)
+			e.notifyFailure(ctx, order)
+		}
+		return err
+	}
+
+	now := time.Now().UTC()
+	export.Status = domain.OrderExportReady
+	export.ObjectKey = objectKey
+	export.CompletedAt = &now
+	if err := e.orderRepo.UpdateOrderExport(ctx, order.ID, export); err != nil {
+		return err
+	}
+
+	e.notify(ctx, gallery, order, objectKey)
+	return nil
+}
+
+func (e *OrderExporter) export(ctx context.Context, order domain.OrderDB) (domain.GalleryDB, string, error) {
+	gallery, err := e.galleryRepo.GetGalleryByID(ctx, order.GalleryID)
+	if err != nil {
+		return domain.GalleryDB{}, "", err
+	}
+
+	photoIds := make([]primitive.ObjectID, len(order.Photos))
+	for i, photo := range order.Photos {
+		photoIds[i] = photo.PhotoID
+	}
+	photos, err := e.photoRepo.GetPhotosByIds(ctx, photoIds, gallery.WorkspaceID)
+	if err != nil {
+		return domain.GalleryDB{}, "", err
+	}
+	photosById := make(map[primitive.ObjectID]domain.PhotoDB, len(photos))
+	for _, photo := range photos {
+		photosById[photo.ID] = photo
+	}
+
+	entries, items, err := exportEntries(order, photosById)
+	if err != nil {
+		return domain.GalleryDB{}, "", err
+	}
+	manifestEntries, err := manifestFiles(order, items)
+	if err != nil {
+		return domain.GalleryDB{}, "", err
+	}
+	entries = append(entries, manifestEntries...)
+
+	objectKey := ExportObjectKey(gallery, order.ID)
+	pr, pw := io.Pipe()
+	go func() {
+		_ = pw.CloseWithError(archive.Write(ctx, pw, entries, aws.GetObject))
+	}()
+	if err := aws.UploadObject(ctx, objectKey, pr, "application/zip"); err != nil {
+		_ = pr.CloseWithError(err)
+		return domain.GalleryDB{}, "", err
+	}
+
+	return gallery, objectKey, nil
+}
+
+func (e *OrderExporter) notify(ctx context.Context, gallery domain.GalleryDB, order domain.OrderDB, objectKey string) {
+	if e.notifier == nil {
+		return
+	}
+	url, err := aws.GetObjectUrlWithLifetime(objectKey, ExportLinkLifetime)
+	if err != nil {
+		log.Printf("Failed to sign export url: %v", err)
+		return
+	}
+
+	err = e.notifier.Notify(ctx, &domain.NotificationDB{
+		UserId:      gallery.UserId,
+		WorkspaceID: order.WorkspaceID,
+		Type:        domain.NotificationExportReady,
+		Title:       "Order export ready",
+		Body:        fmt.Sprintf("Print lab export for %s is ready to download", order.ClientEmail),
+		URL:         url,
+		Data: map[string]string{
+			"orderId": order.ID.Hex(),
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to notify about order export: %v", err)
+	}
+}
+
+func (e *OrderExporter) notifyFailure(ctx context.Context, order domain.OrderDB) {
+	if e.notifier == nil {
+		return
+	}
+	err := e.notifier.Notify(ctx, &domain.NotificationDB{
+		UserId:      order.UserId,
+		WorkspaceID: order.WorkspaceID,
+		Type:        domain.NotificationProcessingFailed,
+		Title:       "Order export failed",
+		Body:        fmt.Sprintf("Print lab export for %s could not be created", order.ClientEmail),
+		Data: map[string]string{
+			"orderId": order.ID.Hex(),
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to notify about failed order export: %v", err)
+	}
+}
+
+// exportEntries groups ordered originals into product folders and names them after the original file with the
+// ordered quantity as suffix, e.g. print-10x15/IMG_0001_x2.jpg
+func exportEntries(order domain.OrderDB, photos map[primitive.ObjectID]domain.PhotoDB) ([]archive.Entry, []exportManifestItem, error) {
+	entries := make([]archive.Entry, 0, len(order.Photos))
+	items := make([]exportManifestItem, 0, len(order.Photos))
+	used := make(map[string]bool, len(order.Photos))
+
+	for _, ordered := range order.Photos {
+		photo, ok := photos[ordered.PhotoID]
+		if !ok {
+			return nil, nil, fmt.Errorf("photo %s of order %s not found", ordered.PhotoID.Hex(), order.ID.Hex())
+		}
+
+		folder := ordered.Product
+		if folder == "" {
+			folder = originalsFolder
+		}
+		quantity := max(ordered.Quantity, 1)
+
+		ext := path.Ext(photo.ObjectKey)
+		base := strings.TrimSuffix(path.Base(photo.OriginalFilename), path.Ext(photo.OriginalFilename))
+		if base == "" || base == "." || base == "/" {
+			base = photo.ID.Hex()
+		}
+		file := fmt.Sprintf("%s_x%d%s", base, quantity, ext)
+		if used[path.Join(folder, file)] {
+			file = fmt.Sprintf("%s_%s_x%d%s", base, photo.ID.Hex(), quantity, ext)
+		}
+		used[path.Join(folder, file)] = true
+
+		entries = append(entries, archive.Entry{
+			Name: path.Join(folder, file),
+			Key:  photo.ObjectKey,
+		})
+		items = append(items, exportManifestItem{
+			Folder:           folder,
+			File:             file,
+			OriginalFilename: photo.OriginalFilename,
+			PhotoId:          photo.ID.Hex(),
+			Product:          ordered.Product,
+			Quantity:         quantity,
+		})
+	}
+
+	return entries, items, nil
+}
+
+func manifestFiles(order domain.OrderDB, items []exportManifestItem) ([]archive.Entry, error) {
+	var csvBuf bytes.Buffer
+	w := csv.NewWriter(&csvBuf)
+	_ = w.Write([]string{"folder", "file", "original_filename", "photo_id", "product", "quantity"})
+	for _, item := range items {
+		_ = w.Write([]string{
+			csvutil.Cell(item.Folder),
+			csvutil.Cell(item.File),
+			csvutil.Cell(item.OriginalFilename),
+			item.PhotoId,
+			csvutil.Cell(item.Product),
+			strconv.Itoa(item.Quantity),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+
+	jsonBody, err := json.MarshalIndent(exportManifest{
+		OrderId:     order.ID.Hex(),
+		GalleryId:   order.GalleryID.Hex(),
+		ClientEmail: order.ClientEmail,
+		Comment:     order.Comment,
+		CreatedAt:   order.CreatedAt,
+		Items:       items,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return []archive.Entry{
+		{Name: "manifest.csv", Body: csvBuf.Bytes()},
+		{Name: "manifest.json", Body: jsonBody},
+	}, nil
+}
@@ -0,0 +1,80 @@
+package jobs
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"github.com/michalK00/halftone/internal/archive"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"testing"
+)
+
+func TestExportEntries(t *testing.T) {
+	first := domain.PhotoDB{ID: primitive.NewObjectID(), OriginalFilename: "IMG_0001.JPG", ObjectKey: "c/g/photos/1.JPG"}
+	second := domain.PhotoDB{ID: primitive.NewObjectID(), OriginalFilename: "IMG_0001.JPG", ObjectKey: "c/g/photos/2.JPG"}
+	order := domain.OrderDB{
+		ID: primitive.NewObjectID(),
+		Photos: []domain.OrderPhoto{
+			{PhotoID: first.ID, Product: "print-10x15", Quantity: 2},
+			{PhotoID: first.ID},
+			{PhotoID: second.ID, Product: "print-10x15", Quantity: 2},
+		},
+	}
+	photos := map[primitive.ObjectID]domain.PhotoDB{first.ID: first, second.ID: second}
+
+	entries, items, err := exportEntries(order, photos)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"print-10x15/IMG_0001_x2.JPG",
+		"originals/IMG_0001_x1.JPG",
+		"print-10x15/IMG_0001_" + second.ID.Hex() + "_x2.JPG",
+	}
+	for i, name := range expected {
+		if entries[i].Name != name {
+			t.Errorf("Expected entry %d to be %s, got %s", i, name, entries[i].Name)
+		}
+	}
+	if items[0].Quantity != 2 || items[1].Quantity != 1 {
+		t.Errorf("Unexpected manifest quantities: %+v", items)
+	}
+
+	delete(photos, second.ID)
+	if _, _, err := exportEntries(order, photos); err == nil {
+		t.Error("Expected missing photo to fail the export")
+	}
+}
+
+func TestArchiveWrite(t *testing.T) {
+	objects := map[string]string{"a.jpg": "first", "b.jpg": "second"}
+	open := func(ctx context.Context, key string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewBufferString(objects[key])), nil
+	}
+	entries := []archive.Entry{
+		{Name: "prints/a.jpg", Key: "a.jpg"},
+		{Name: "prints/b.jpg", Key: "b.jpg"},
+		{Name: "manifest.csv", Body: []byte("folder,file\n")},
+	}
+
+	var buf bytes.Buffer
+	if err := archive.Write(context.Background(), &buf, entries, open); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	if len(zr.File) != len(entries) {
+		t.Fatalf("Expected %d files, got %d", len(entries), len(zr.File))
+	}
+	rc, _ := zr.File[1].Open()
+	content, _ := io.ReadAll(rc)
+	if string(content) != "second" {
+		t.Errorf("Expected object content to be copied, got %q", content)
+	}
+}
@@ -0,0 +1,76 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/michalK00/halftone/internal/aws"
+	"github.com/michalK00/halftone/internal/domain"
+	"log"
+)
+
+var errPreviewsMissing = errors.New("photo previews were not created yet")
+
+// PhotoProcessingChecker handles photo processing jobs. The image processing Lambda does not report back, so the job
+// checks for the thumbnail it creates and is retried until it shows up. The photo is announced to the dashboards
+// once it does and the photographer is told when the retries are used up.
+type PhotoProcessingChecker struct {
+	photoRepo   domain.PhotoRepository
+	eventBroker domain.EventBroker
+	notifier    *Notifier
+}
+
+// NewPhotoProcessingChecker creates the handler of photo processing jobs, notifier is optional
+func NewPhotoProcessingChecker(photoRepo domain.PhotoRepository, eventBroker domain.EventBroker, notifier *Notifier) *PhotoProcessingChecker {
+	return &PhotoProcessingChecker{
+		photoRepo:   photoRepo,
+		eventBroker: eventBroker,
+		notifier:    notifier,
+	}
+}
+
+func (c *PhotoProcessingChecker) Handle(ctx context.Context, job domain.Job) error {
+	var payload domain.PhotoProcessingPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
+
+	photo, err := c.photoRepo.GetPhoto(ctx, payload.PhotoId, payload.WorkspaceId)
+	if err != nil {
+		return err
+	}
+
+	if !aws.ObjectsExist(ctx, []string{photo.ThumbnailObjectKey})[0] {
+		if job.Retries == 0 {
+			c.notifyFailure(ctx, photo)
+		}
+		return errPreviewsMissing
+	}
+
+	event, err := domain.NewEvent(domain.EventPhotoProcessed, photo.WorkspaceID, photo)
+	if err != nil {
+		return err
+	}
+	return c.eventBroker.Publish(ctx, event)
+}
+
+func (c *PhotoProcessingChecker) notifyFailure(ctx context.Context, photo domain.PhotoDB) {
+	if c.notifier == nil {
+		return
+	}
+	err := c.notifier.Notify(ctx, &domain.NotificationDB{
+		UserId:      photo.UserId,
+		WorkspaceID: photo.WorkspaceID,
+		Type:        domain.NotificationProcessingFailed,
+		Title:       "Photo processing failed",
+		Body:        fmt.Sprintf("Previews of %s could not be created", photo.OriginalFilename),
+		Data: map[string]string{
+			"galleryId": photo.GalleryId.Hex(),
+			"photoId":   photo.ID.Hex(),
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to notify about failed photo processing: %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+const (
+	pollInterval = 5 * time.Second
+	retryDelay   = time.Minute
+	// jobLease is how long a job is held without renewal before it is assumed its worker died and another worker takes
+	// it over, running jobs renew it every jobLease/3
+	jobLease = 2 * time.Minute
+	// jobsPerType bounds how many jobs of one type a worker runs at once, so slow exports don't hold up emails
+	jobsPerType = 2
+)
+
+// Handler processes a single job, returning an error schedules a retry
+type Handler func(ctx context.Context, job domain.Job) error
+
+// Runner polls the job repository for due jobs and dispatches them to the handler registered for their type
+type Runner struct {
+	jobRepo  domain.JobRepository
+	handlers map[string]Handler
+	slots    map[string]chan struct{}
+	running  sync.WaitGroup
+	workerId primitive.ObjectID
+	logger   *zap.Logger
+}
+
+func NewRunner(jobRepo domain.JobRepository, logger *zap.Logger) *Runner {
+	return &Runner{
+		jobRepo:  jobRepo,
+		handlers: make(map[string]Handler),
+		slots:    make(map[string]chan struct{}),
+		workerId: primitive.NewObjectID(),
+		logger:   logger,
+	}
+}
+
+func (r *Runner) Handle(jobType string, handler Handler) {
+	r.handlers[jobType] = handler
+	r.slots[jobType] = make(chan struct{}, jobsPerType)
+}
+
+// Run blocks until ctx is cancelled and the running jobs returned
+func (r *Runner) Run(ctx context.Context) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	defer r.running.Wait()
+
+	r.logger.Info("job runner started", zap.String("workerId", r.workerId.Hex()))
+	for {
+		r.runDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Runner) runDue(ctx context.Context) {
+	types := make([]string, 0, len(r.handlers))
+	for jobType := range r.handlers {
+		types = append(types, jobType)
+	}
+
+	jobs, err := r.jobRepo.GetJobsDue(ctx, types)
+	if err != nil {
+		r.logger.Error("failed to fetch due jobs", zap.Error(err))
+		return
+	}
+
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			return
+		}
+		handler, ok := r.handlers[job.Type]
+		if !ok {
+			continue
+		}
+
+		// Leave the job for the next poll or another worker when all slots of its type are taken
+		slots := r.slots[job.Type]
+		select {
+		case slots <- struct{}{}:
+		default:
+			continue
+		}
+
+		claimed, err := r.jobRepo.ClaimJob(ctx, job.ID, r.workerId, time.Now().UTC().Add(jobLease))
+		if err != nil {
+			<-slots
+			if !errors.Is(err, mongo.ErrNoDocuments) {
+				r.logger.Error("failed to claim job", zap.String("jobId", job.ID.Hex()), zap.Error(err))
+			}
+			continue
+		}
+		if job.Status == domain.JobStatusActive {
+			r.logger.Warn("reclaimed stale job", zap.String("jobId", job.ID.Hex()), zap.String("previousWorkerId", job.WorkerID.Hex()))
+		}
+
+		r.running.Add(1)
+		go func() {
+			defer r.running.Done()
+			defer func() { <-slots }()
+			r.run(ctx, claimed, handler)
+		}()
+	}
+}
+
+func (r *Runner) run(ctx context.Context, job domain.Job, handler Handler) {
+	logger := r.logger.With(zap.String("jobId", job.ID.Hex()), zap.String("type", job.Type))
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		r.renew(jobCtx, cancel, job, logger)
+	}()
+	err := safeRun(jobCtx, job, handler)
+	cancel()
+	<-renewed
+
+	// Record the outcome even when the runner is shutting down
+	ctx = context.WithoutCancel(ctx)
+	if err == nil {
+		if err := r.jobRepo.CompleteJob(ctx, job.ID, r.workerId); err != nil {
+			r.logLostJob(logger, "failed to complete job", err)
+			return
+		}
+		logger.Info("job completed")
+		return
+	}
+
+	logger.Warn("job failed", zap.Error(err))
+	failed, err := r.jobRepo.FailJob(ctx, job.ID, r.workerId, err, time.Now().UTC().Add(retryDelay))
+	if err != nil {
+		r.logLostJob(logger, "failed to reschedule job", err)
+		return
+	}
+	if failed.Status == domain.JobStatusFailed {
+		logger.Error("job failed permanently", zap.String("error", failed.Error))
+	}
+}
+
+// renew extends the lease of the job until ctx is done, it cancels the job when another worker took it over
+func (r *Runner) renew(ctx context.Context, cancel context.CancelFunc, job domain.Job, logger *zap.Logger) {
+	ticker := time.NewTicker(jobLease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := r.jobRepo.RenewJob(ctx, job.ID, r.workerId, time.Now().UTC().Add(jobLease))
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			logger.Warn("job lease lost, cancelling job")
+			cancel()
+			return
+		}
+		if err != nil && ctx.Err() == nil {
+			logger.Error("failed to renew job lease", zap.Error(err))
+		}
+	}
+}
+
+func (r *Runner) logLostJob(logger *zap.Logger, msg string, err error) {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		logger.Warn("job was taken over by another worker, dropping its result")
+		return
+	}
+	logger.Error(msg, zap.Error(err))
+}
+
+func safeRun(ctx context.Context, job domain.Job, handler Handler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+	return handler(ctx, job)
+}
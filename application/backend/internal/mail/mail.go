@@ -0,0 +1,49 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+type Message struct {
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers email messages. Implementations are selected with the MAIL_PROVIDER environment variable.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewFromEnv creates the mailer configured by MAIL_PROVIDER: "smtp", "sns" or "log" (default)
+func NewFromEnv() (Mailer, error) {
+	switch provider := strings.ToLower(os.Getenv("MAIL_PROVIDER")); provider {
+	case "smtp":
+		return NewSMTPMailer(SMTPConfig{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		})
+	case "sns":
+		return NewSNSMailer(), nil
+	case "", "log":
+		return LogMailer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail provider %q", provider)
+	}
+}
+
+// LogMailer only logs messages, it is meant for local development
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("Email to %s: %s\n%s", strings.Join(msg.To, ", "), msg.Subject, msg.Text)
+	return nil
+}
@@ -0,0 +1,29 @@
+package mail
+
+import (
+	"context"
+	awsClient "github.com/michalK00/halftone/platform/cloud/aws"
+	"strings"
+)
+
+// SNSMailer publishes the text part of the message to the default SNS topic, the recipient is passed in the
+// "email" message attribute for the topic's subscription filter
+type SNSMailer struct{}
+
+func NewSNSMailer() *SNSMailer {
+	return &SNSMailer{}
+}
+
+func (m *SNSMailer) Send(ctx context.Context, msg Message) error {
+	client, err := awsClient.GetClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.SNS.SendEmailNotification(ctx, &awsClient.EmailNotification{
+		Email:   strings.Join(msg.To, ","),
+		Subject: msg.Subject,
+		Message: msg.Text,
+	})
+	return err
+}
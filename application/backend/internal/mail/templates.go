@@ -0,0 +1,76 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	htmlTemplate "html/template"
+	textTemplate "text/template"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+type Template string
+
+const (
+	TemplateOrderReceived       Template = "order_received"
+	TemplateOrderStatusChanged  Template = "order_status_changed"
+	TemplateOrderReadyForPickup Template = "order_ready_for_pickup"
+	TemplateOrderShipped        Template = "order_shipped"
+	TemplateClientVerification  Template = "client_verification"
+	TemplateNotification        Template = "notification"
+)
+
+// OrderEmailData is rendered by all order templates
+type OrderEmailData struct {
+	OrderId     string
+	GalleryName string
+	GalleryUrl  string
+	Status      string
+	Comment     string
+	PhotoCount  int
+	Total       string
+}
+
+// ClientVerificationData is rendered by the email confirming a client's address
+type ClientVerificationData struct {
+	GalleryName      string
+	Code             string
+	Link             string
+	ExpiresInMinutes int
+}
+
+// NotificationEmailData is rendered by the email delivering a notification to a photographer
+type NotificationEmailData struct {
+	Title string
+	Body  string
+	URL   string
+}
+
+// Render builds a message from the HTML and text variants of the template
+func Render(tmpl Template, subject string, to []string, data any) (Message, error) {
+	html, err := htmlTemplate.ParseFS(templateFS, "templates/layout.html", "templates/"+string(tmpl)+".html")
+	if err != nil {
+		return Message{}, err
+	}
+	var htmlBuf bytes.Buffer
+	if err := html.ExecuteTemplate(&htmlBuf, "layout", data); err != nil {
+		return Message{}, err
+	}
+
+	text, err := textTemplate.ParseFS(templateFS, "templates/"+string(tmpl)+".txt")
+	if err != nil {
+		return Message{}, err
+	}
+	var textBuf bytes.Buffer
+	if err := text.Execute(&textBuf, data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		To:      to,
+		Subject: subject,
+		Text:    textBuf.String(),
+		HTML:    htmlBuf.String(),
+	}, nil
+}
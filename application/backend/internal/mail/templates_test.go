@@ -0,0 +1,89 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderOrderTemplates(t *testing.T) {
+	data := OrderEmailData{
+		OrderId:     "671442a11fd0c5eb46b5a3fa",
+		GalleryName: "Anna & Tom <Wedding>",
+		GalleryUrl:  "https://halftone.example/galleries/1?token=abc",
+		Status:      "ready for pickup",
+		PhotoCount:  3,
+		Total:       "12.50 PLN",
+	}
+
+	for _, tmpl := range []Template{TemplateOrderReceived, TemplateOrderStatusChanged, TemplateOrderReadyForPickup, TemplateOrderShipped} {
+		msg, err := Render(tmpl, "Subject", []string{"client@example.com"}, data)
+		if err != nil {
+			t.Fatalf("Failed to render %s: %v", tmpl, err)
+		}
+		if !strings.Contains(msg.Text, data.GalleryUrl) || !strings.Contains(msg.HTML, "galleries/1?token=abc") {
+			t.Errorf("Expected %s to link back to the gallery", tmpl)
+		}
+		if strings.Contains(msg.HTML, "<Wedding>") {
+			t.Errorf("Expected %s HTML to escape the gallery name", tmpl)
+		}
+	}
+}
+
+func TestBuildMIME(t *testing.T) {
+	body, err := buildMIME("studio@example.com", Message{
+		To:      []string{"client@example.com"},
+		Subject: "Zamówienie",
+		Text:    "plain",
+		HTML:    "<p>html</p>",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s := string(body)
+	for _, part := range []string{"multipart/alternative", "text/plain", "text/html", "Subject: =?UTF-8?q?"} {
+		if !strings.Contains(s, part) {
+			t.Errorf("Expected message to contain %q", part)
+		}
+	}
+}
+
+func TestRenderClientVerification(t *testing.T) {
+	data := ClientVerificationData{
+		GalleryName:      "Anna & Tom",
+		Code:             "042117",
+		Link:             "https://halftone.example/galleries/1/verify?verification=2&key=abc",
+		ExpiresInMinutes: 15,
+	}
+
+	msg, err := Render(TemplateClientVerification, "Subject", []string{"client@example.com"}, data)
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	for _, body := range []string{msg.Text, msg.HTML} {
+		if !strings.Contains(body, data.Code) {
+			t.Errorf("Expected the message to contain the code")
+		}
+	}
+	if !strings.Contains(msg.Text, data.Link) || !strings.Contains(msg.HTML, "verification=2&amp;key=abc") {
+		t.Errorf("Expected the message to contain the magic link")
+	}
+}
+
+func TestRenderNotification(t *testing.T) {
+	data := NotificationEmailData{
+		Title: "Gallery expires soon",
+		Body:  "Sharing of <Wedding> expires on 2 Jan 2026 15:04 UTC",
+		URL:   "https://halftone.example/galleries/1?tab=sharing&x=1",
+	}
+
+	msg, err := Render(TemplateNotification, data.Title, []string{"studio@example.com"}, data)
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	if !strings.Contains(msg.Text, data.URL) || !strings.Contains(msg.HTML, "tab=sharing&amp;x=1") {
+		t.Errorf("Expected the message to link to the notification")
+	}
+	if strings.Contains(msg.HTML, "<Wedding>") {
+		t.Errorf("Expected the HTML to escape the body")
+	}
+}
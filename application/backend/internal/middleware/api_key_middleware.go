@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/domain"
+	"github.com/michalK00/halftone/internal/identity"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"strings"
+	"time"
+)
+
+// ProtectedOrApiKey is Protected that also accepts personal API keys sent as "Authorization: ApiKey <key>". Requests
+// authenticated with a key act as the user who created it, its scope is stored as "apiKeyScope" and checked by
+// RequireWorkspaceRole and RequireUploadAccess.
+func ProtectedOrApiKey(verifier identity.Verifier, apiKeyRepo domain.ApiKeyRepository) fiber.Handler {
+	protected := Protected(verifier)
+	return func(ctx *fiber.Ctx) error {
+		key, ok := strings.CutPrefix(ctx.Get("Authorization"), "ApiKey ")
+		if !ok {
+			return protected(ctx)
+		}
+
+		apiKey, err := apiKeyRepo.GetApiKeyByHash(ctx.Context(), domain.HashApiKey(strings.TrimSpace(key)))
+		if err == nil {
+			err = apiKey.Active()
+		}
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) || errors.Is(err, domain.ErrApiKeyRevoked) {
+				return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": domain.ErrInvalidApiKey.Error(),
+				})
+			}
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to check API key",
+			})
+		}
+
+		if err := apiKeyRepo.TouchApiKey(ctx.Context(), apiKey.ID, time.Now().UTC()); err != nil {
+			log.Printf("Failed to record use of API key %s: %v", apiKey.ID.Hex(), err)
+		}
+
+		ctx.Locals("userId", apiKey.UserId)
+		ctx.Locals("apiKeyId", apiKey.ID)
+		ctx.Locals("apiKeyScope", apiKey.Scope)
+
+		return ctx.Next()
+	}
+}
+
+// requireApiKeyScope rejects requests authenticated with an API key whose scope grants none of the accepted scopes,
+// requests authenticated with a token are not limited. ok is false when the response was written.
+func requireApiKeyScope(ctx *fiber.Ctx, accepted ...domain.ApiKeyScope) (bool, error) {
+	scope, ok := ctx.Locals("apiKeyScope").(domain.ApiKeyScope)
+	if !ok {
+		return true, nil
+	}
+	names := make([]string, 0, len(accepted))
+	for _, required := range accepted {
+		if scope.Allows(required) {
+			return true, nil
+		}
+		names = append(names, string(required))
+	}
+	return false, ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error": "API key scope " + strings.Join(names, " or ") + " required",
+	})
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type memoryApiKeys struct {
+	domain.ApiKeyRepository
+	keys map[string]domain.ApiKeyDB
+}
+
+func (m memoryApiKeys) GetApiKeyByHash(ctx context.Context, keyHash string) (domain.ApiKeyDB, error) {
+	key, ok := m.keys[keyHash]
+	if !ok {
+		return domain.ApiKeyDB{}, mongo.ErrNoDocuments
+	}
+	return key, nil
+}
+
+func (m memoryApiKeys) TouchApiKey(ctx context.Context, keyId primitive.ObjectID, usedAt time.Time) error {
+	return nil
+}
+
+type memoryWorkspaces struct {
+	domain.WorkspaceRepository
+}
+
+func (m memoryWorkspaces) GetPersonalWorkspace(ctx context.Context, userId string) (domain.WorkspaceDB, error) {
+	return domain.WorkspaceDB{
+		ID:      primitive.NewObjectID(),
+		Members: []domain.WorkspaceMember{{UserId: userId, Role: domain.RoleOwner}},
+	}, nil
+}
+
+func TestApiKeyScopes(t *testing.T) {
+	keys := memoryApiKeys{keys: map[string]domain.ApiKeyDB{}}
+	for _, scope := range []domain.ApiKeyScope{domain.ApiKeyScopeRead, domain.ApiKeyScopeUpload, domain.ApiKeyScopeFull} {
+		keys.keys[domain.HashApiKey("hft_"+string(scope))] = domain.ApiKeyDB{ID: primitive.NewObjectID(), UserId: "user", Scope: scope}
+	}
+
+	// the routes as registered by the api
+	app := fiber.New()
+	protected := app.Group("/api/v1", ProtectedOrApiKey(nil, keys), Workspace(memoryWorkspaces{}))
+	ok := func(ctx *fiber.Ctx) error { return ctx.SendStatus(fiber.StatusOK) }
+	protected.Get("/collections", RequireUploadTargetAccess(), ok)
+	protected.Post("/galleries/:galleryId/photos", RequireUploadAccess(), ok)
+	protected.Get("/orders", RequireWorkspaceRole(domain.RoleViewer), ok)
+	protected.Put("/orders/:orderId", RequireWorkspaceRole(domain.RoleEditor), ok)
+
+	tests := []struct {
+		scope  domain.ApiKeyScope
+		method string
+		path   string
+		status int
+	}{
+		{domain.ApiKeyScopeUpload, "POST", "/api/v1/galleries/1/photos", fiber.StatusOK},
+		{domain.ApiKeyScopeUpload, "GET", "/api/v1/collections", fiber.StatusOK},
+		{domain.ApiKeyScopeUpload, "GET", "/api/v1/orders", fiber.StatusForbidden},
+		{domain.ApiKeyScopeUpload, "PUT", "/api/v1/orders/1", fiber.StatusForbidden},
+		{domain.ApiKeyScopeRead, "GET", "/api/v1/orders", fiber.StatusOK},
+		{domain.ApiKeyScopeRead, "POST", "/api/v1/galleries/1/photos", fiber.StatusForbidden},
+		{domain.ApiKeyScopeFull, "PUT", "/api/v1/orders/1", fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Authorization", "ApiKey hft_"+string(tt.scope))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s key %s %s = %d, want %d", tt.scope, tt.method, tt.path, resp.StatusCode, tt.status)
+		}
+	}
+}
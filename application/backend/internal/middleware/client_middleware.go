@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"context"
+	"crypto/subtle"
 	"errors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/michalK00/halftone/internal/domain"
@@ -10,8 +12,21 @@ import (
 	"time"
 )
 
-// AuthenticateClient validates the access token for client endpoints
-func AuthenticateClient(galleryRepo domain.GalleryRepository) fiber.Handler {
+// AuthenticateClient validates the access token for client endpoints. The token is either one of the gallery share
+// links, whose permissions are stored in the context, the gallery access token, which grants full access, or a client
+// session issued when unlocking a password protected share or verifying the client email. Share links requiring email
+// identification are only accessible with a session carrying the verified email.
+func AuthenticateClient(galleryRepo domain.GalleryRepository, shareLinkRepo domain.ShareLinkRepository) fiber.Handler {
+	return authenticateClient(galleryRepo, shareLinkRepo, true)
+}
+
+// AuthenticateUnverifiedClient is AuthenticateClient for the endpoints verifying the client email, which have to be
+// reachable before the client is identified
+func AuthenticateUnverifiedClient(galleryRepo domain.GalleryRepository, shareLinkRepo domain.ShareLinkRepository) fiber.Handler {
+	return authenticateClient(galleryRepo, shareLinkRepo, false)
+}
+
+func authenticateClient(galleryRepo domain.GalleryRepository, shareLinkRepo domain.ShareLinkRepository, requireIdentity bool) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		// Extract gallery ID from params
 		galleryIdStr := ctx.Params("galleryId")
@@ -60,30 +75,182 @@ func AuthenticateClient(galleryRepo domain.GalleryRepository) fiber.Handler {
 			})
 		}
 
-		// Validate sharing is enabled
-		if !gallery.Sharing.SharingEnabled {
-			return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error": "Gallery sharing is not enabled",
-			})
+		var access ShareAccess
+		var email string
+		if isClientSession(token) {
+			claims, err := parseClientSession(token)
+			if err != nil || claims.GalleryID != gallery.ID.Hex() {
+				return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Invalid or expired session",
+				})
+			}
+			access, err = resolveClientSession(ctx.Context(), shareLinkRepo, gallery, claims)
+			if err != nil {
+				return shareErrorResponse(ctx, err)
+			}
+			email = claims.Email
+		} else {
+			access, err = ResolveShareToken(ctx.Context(), shareLinkRepo, gallery, token)
+			if err != nil {
+				return shareErrorResponse(ctx, err)
+			}
+			// Protected shares are only accessible with the session issued after unlocking them
+			if access.PasswordHash != "" {
+				return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error":            "Password required",
+					"passwordRequired": true,
+				})
+			}
 		}
-
-		// Validate token matches
-		if gallery.Sharing.AccessToken != token {
+		if requireIdentity && access.Link != nil && access.Link.RequireEmail && email == "" {
 			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid access token",
+				"error":         "Email verification required",
+				"emailRequired": true,
 			})
 		}
-
-		// Check expiry date
-		if !gallery.Sharing.SharingExpiryDate.IsZero() && time.Now().UTC().After(gallery.Sharing.SharingExpiryDate) {
-			return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error": "Access token has expired",
-			})
+		if access.Link != nil {
+			ctx.Locals("shareLink", *access.Link)
+		}
+		if email != "" {
+			ctx.Locals("clientEmail", email)
 		}
 
 		// Store gallery in context for use in handlers
 		ctx.Locals("gallery", gallery)
+		ctx.Locals("permissions", access.Permissions)
+
+		return ctx.Next()
+	}
+}
 
+// RequireSharePermission rejects client requests made with a share link that does not grant the permission, it has to
+// run after AuthenticateClient
+func RequireSharePermission(permission domain.SharePermission) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		permissions, ok := ctx.Locals("permissions").(domain.SharePermissions)
+		if !ok || !permissions.Allows(permission) {
+			return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Share link does not allow to " + string(permission),
+			})
+		}
 		return ctx.Next()
 	}
 }
+
+// ShareAccess is what a share token grants. Link is nil for the gallery access token.
+type ShareAccess struct {
+	Link         *domain.ShareLinkDB
+	Permissions  domain.SharePermissions
+	PasswordHash string
+}
+
+// ShareError is returned for tokens that do not grant access, Status is the response status to report it with
+type ShareError struct {
+	Status  int
+	Message string
+}
+
+func (e *ShareError) Error() string {
+	return e.Message
+}
+
+// ResolveShareToken resolves a share token of the gallery to the share link it belongs to or the gallery access token,
+// without checking the share password
+func ResolveShareToken(ctx context.Context, shareLinkRepo domain.ShareLinkRepository, gallery domain.GalleryDB, token string) (ShareAccess, error) {
+	link, err := shareLinkRepo.GetShareLinkByToken(ctx, token)
+	if err == nil {
+		return linkAccess(link, gallery, false)
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return ShareAccess{}, err
+	}
+
+	if err := validateSharing(gallery); err != nil {
+		return ShareAccess{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(gallery.Sharing.AccessToken), []byte(token)) != 1 {
+		return ShareAccess{}, &ShareError{Status: fiber.StatusUnauthorized, Message: "Invalid access token"}
+	}
+	return ShareAccess{Permissions: domain.FullAccess, PasswordHash: gallery.Sharing.PasswordHash}, nil
+}
+
+// resolveClientSession checks the share a session was issued for is still valid, so revoking a link, stopping sharing
+// or changing the share password ends the sessions as well. Sessions outlive the usage limit of the link, as they are
+// issued for a use of it.
+func resolveClientSession(ctx context.Context, shareLinkRepo domain.ShareLinkRepository, gallery domain.GalleryDB, claims ClientSessionClaims) (ShareAccess, error) {
+	if claims.LinkID == "" {
+		if err := validateSharing(gallery); err != nil {
+			return ShareAccess{}, err
+		}
+		if claims.PasswordVersion != passwordVersion(sharePasswordHash(gallery, nil)) {
+			return ShareAccess{}, &ShareError{Status: fiber.StatusUnauthorized, Message: "Invalid or expired session"}
+		}
+		return ShareAccess{Permissions: domain.FullAccess}, nil
+	}
+
+	linkId, err := primitive.ObjectIDFromHex(claims.LinkID)
+	if err != nil {
+		return ShareAccess{}, &ShareError{Status: fiber.StatusUnauthorized, Message: "Invalid or expired session"}
+	}
+	link, err := shareLinkRepo.GetShareLink(ctx, linkId, gallery.WorkspaceID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ShareAccess{}, &ShareError{Status: fiber.StatusUnauthorized, Message: "Invalid or expired session"}
+		}
+		return ShareAccess{}, err
+	}
+	if claims.PasswordVersion != passwordVersion(sharePasswordHash(gallery, &link)) {
+		return ShareAccess{}, &ShareError{Status: fiber.StatusUnauthorized, Message: "Invalid or expired session"}
+	}
+	access, err := linkAccess(link, gallery, true)
+	access.PasswordHash = ""
+	return access, err
+}
+
+func linkAccess(link domain.ShareLinkDB, gallery domain.GalleryDB, session bool) (ShareAccess, error) {
+	if link.GalleryID != gallery.ID {
+		return ShareAccess{}, &ShareError{Status: fiber.StatusUnauthorized, Message: "Invalid access token"}
+	}
+	err := link.Active(time.Now().UTC())
+	if session && errors.Is(err, domain.ErrShareLinkExhausted) {
+		err = nil
+	}
+	if err != nil {
+		message := "Share link has expired"
+		switch {
+		case errors.Is(err, domain.ErrShareLinkRevoked):
+			message = "Share link has been revoked"
+		case errors.Is(err, domain.ErrShareLinkExhausted):
+			message = "Share link usage limit reached"
+		}
+		return ShareAccess{}, &ShareError{Status: fiber.StatusForbidden, Message: message}
+	}
+	return ShareAccess{Link: &link, Permissions: link.Permissions, PasswordHash: link.PasswordHash}, nil
+}
+
+// validateSharing checks the gallery access token can be used
+func validateSharing(gallery domain.GalleryDB) error {
+	// Validate sharing is enabled
+	if !gallery.Sharing.SharingEnabled {
+		return &ShareError{Status: fiber.StatusForbidden, Message: "Gallery sharing is not enabled"}
+	}
+
+	// Check expiry date
+	if !gallery.Sharing.SharingExpiryDate.IsZero() && time.Now().UTC().After(gallery.Sharing.SharingExpiryDate) {
+		return &ShareError{Status: fiber.StatusForbidden, Message: "Access token has expired"}
+	}
+
+	return nil
+}
+
+func shareErrorResponse(ctx *fiber.Ctx, err error) error {
+	var shareErr *ShareError
+	if errors.As(err, &shareErr) {
+		return ctx.Status(shareErr.Status).JSON(fiber.Map{
+			"error": shareErr.Message,
+		})
+	}
+	return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to fetch share link",
+	})
+}
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/michalK00/halftone/internal/domain"
+	"os"
+	"strings"
+	"time"
+)
+
+// ClientSessionLifetime is how long a client stays signed in after unlocking a protected share
+const ClientSessionLifetime = 2 * time.Hour
+
+const clientSessionIssuer = "halftone-client"
+
+// ClientSessionClaims are carried by the session token issued when a client unlocks a protected share or verifies
+// their email. LinkID is empty when the gallery access token was used, Email is empty until the client verifies it.
+// PasswordVersion identifies the password of the share, so changing or removing it ends the sessions.
+type ClientSessionClaims struct {
+	GalleryID       string `json:"gid"`
+	LinkID          string `json:"lid,omitempty"`
+	Email           string `json:"email,omitempty"`
+	PasswordVersion string `json:"pwv,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// IssueClientSession signs a session token for the gallery and optionally one of its share links and the verified
+// client email
+func IssueClientSession(gallery domain.GalleryDB, link *domain.ShareLinkDB, email string) (string, time.Time, error) {
+	secret, err := clientSessionSecret()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(ClientSessionLifetime)
+	claims := ClientSessionClaims{
+		GalleryID:       gallery.ID.Hex(),
+		Email:           email,
+		PasswordVersion: passwordVersion(sharePasswordHash(gallery, link)),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    clientSessionIssuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	if link != nil {
+		claims.LinkID = link.ID.Hex()
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// sharePasswordHash returns the hash of the password protecting the share link, or the gallery access token when link
+// is nil
+func sharePasswordHash(gallery domain.GalleryDB, link *domain.ShareLinkDB) string {
+	if link != nil {
+		return link.PasswordHash
+	}
+	return gallery.Sharing.PasswordHash
+}
+
+// passwordVersion fingerprints a password hash without putting the hash itself into the session token
+func passwordVersion(passwordHash string) string {
+	if passwordHash == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(passwordHash))
+	return hex.EncodeToString(sum[:8])
+}
+
+// UnlockRateLimiter limits failed unlock attempts per client address and gallery, successful ones are not counted. The
+// attempts are counted in the storage, which is shared by the api instances.
+func UnlockRateLimiter(storage fiber.Storage) fiber.Handler {
+	return clientRateLimiter(storage, 5, true, "Too many failed attempts, try again later")
+}
+
+// IdentifyRateLimiter limits verification emails requested per client address and gallery, like UnlockRateLimiter
+func IdentifyRateLimiter(storage fiber.Storage) fiber.Handler {
+	return clientRateLimiter(storage, 5, false, "Too many verification requests, try again later")
+}
+
+func clientRateLimiter(storage fiber.Storage, max int, skipSuccessful bool, message string) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Storage:                storage,
+		Max:                    max,
+		Expiration:             15 * time.Minute,
+		SkipSuccessfulRequests: skipSuccessful,
+		// The routes share the storage, so each counts under its own route
+		KeyGenerator: func(ctx *fiber.Ctx) string {
+			return ctx.Route().Path + "|" + ctx.IP() + "|" + ctx.Params("galleryId")
+		},
+		LimitReached: func(ctx *fiber.Ctx) error {
+			return ctx.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": message,
+			})
+		},
+	})
+}
+
+// isClientSession tells session tokens apart from share tokens, which are base64 without dots
+func isClientSession(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func parseClientSession(tokenString string) (ClientSessionClaims, error) {
+	secret, err := clientSessionSecret()
+	if err != nil {
+		return ClientSessionClaims{}, err
+	}
+
+	var claims ClientSessionClaims
+	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return secret, nil
+	})
+	if err != nil {
+		return ClientSessionClaims{}, err
+	}
+	if !token.Valid || !claims.VerifyIssuer(clientSessionIssuer, true) {
+		return ClientSessionClaims{}, errors.New("invalid session token")
+	}
+	return claims, nil
+}
+
+func clientSessionSecret() ([]byte, error) {
+	secret := os.Getenv("CLIENT_SESSION_SECRET")
+	if len(secret) < 32 {
+		return nil, errors.New("CLIENT_SESSION_SECRET must be at least 32 characters long")
+	}
+	return []byte(secret), nil
+}
@@ -15,9 +15,10 @@ func FiberMiddleware(a *fiber.App) {
 
 	a.Use(
 		cors.New(cors.Config{
-			AllowOrigins: allowOrigins,
-			AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
-			AllowHeaders: "Origin, Content-Type, Accept, Authorization",
+			AllowOrigins:  allowOrigins,
+			AllowMethods:  "GET,POST,PUT,DELETE,OPTIONS",
+			AllowHeaders:  "Origin, Content-Type, Accept, Authorization, X-Client-Email, X-Workspace-ID",
+			ExposeHeaders: "X-Next-Cursor, X-Total-Count, Content-Disposition",
 		}),
 		logger.New(),
 	)
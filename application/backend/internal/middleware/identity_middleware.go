@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/identity"
+	"strings"
+)
+
+// Protected requires a bearer token accepted by the verifier, which is built once at startup. Whichever issuer signed
+// the token, its sub claim identifies the photographer as userId and the validated claims are available as "claims".
+func Protected(verifier identity.Verifier) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		authHeader := ctx.Get("Authorization")
+		if authHeader == "" {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Missing authorization header",
+			})
+		}
+
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid authorization header format",
+			})
+		}
+
+		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+
+		claims, err := identity.Validate(ctx.Context(), verifier, tokenString)
+		if err != nil {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		sub, _ := claims["sub"].(string)
+		if sub == "" {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Token has no subject",
+			})
+		}
+
+		ctx.Locals("userId", sub)
+		ctx.Locals("username", claims["username"])
+		ctx.Locals("claims", claims)
+
+		return ctx.Next()
+	}
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const WorkspaceHeader = "X-Workspace-ID"
+
+// Workspace selects the workspace a request works in from the X-Workspace-ID header, defaulting to the personal
+// workspace of the user. It has to run after Protected and stores the workspace, its ID as "workspaceId" and the role
+// of the user in it as "workspaceRole".
+func Workspace(workspaceRepo domain.WorkspaceRepository) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		userId := ctx.Locals("userId").(string)
+
+		var workspace domain.WorkspaceDB
+		if header := ctx.Get(WorkspaceHeader); header != "" {
+			workspaceId, err := primitive.ObjectIDFromHex(header)
+			if err != nil {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid workspace ID",
+				})
+			}
+			workspace, err = workspaceRepo.GetWorkspace(ctx.Context(), workspaceId, userId)
+			if err != nil {
+				if errors.Is(err, mongo.ErrNoDocuments) {
+					return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+						"error": "Not a member of the workspace",
+					})
+				}
+				return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to fetch workspace",
+				})
+			}
+		} else {
+			var err error
+			workspace, err = workspaceRepo.GetPersonalWorkspace(ctx.Context(), userId)
+			if err != nil {
+				return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to fetch workspace",
+				})
+			}
+		}
+
+		role, _ := workspace.Role(userId)
+		ctx.Locals("workspace", workspace)
+		ctx.Locals("workspaceId", workspace.ID)
+		ctx.Locals("workspaceRole", role)
+
+		return ctx.Next()
+	}
+}
+
+// RequireWorkspaceRole rejects requests of members whose role does not grant the permissions of the required role, it
+// has to run after Workspace. Routes requiring more than the viewer role need a full API key.
+func RequireWorkspaceRole(required domain.WorkspaceRole) fiber.Handler {
+	scope := domain.ApiKeyScopeFull
+	if required == domain.RoleViewer {
+		scope = domain.ApiKeyScopeRead
+	}
+	return requireAccess(required, scope)
+}
+
+// RequireUploadAccess is RequireWorkspaceRole for the routes uploading photos, which upload API keys can use as well
+func RequireUploadAccess() fiber.Handler {
+	return requireAccess(domain.RoleEditor, domain.ApiKeyScopeUpload)
+}
+
+// RequireUploadTargetAccess is RequireWorkspaceRole(domain.RoleViewer) for the routes listing collections and galleries,
+// which upload API keys need to find the gallery to upload to
+func RequireUploadTargetAccess() fiber.Handler {
+	return requireAccess(domain.RoleViewer, domain.ApiKeyScopeRead, domain.ApiKeyScopeUpload)
+}
+
+func requireAccess(required domain.WorkspaceRole, scopes ...domain.ApiKeyScope) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		role, ok := ctx.Locals("workspaceRole").(domain.WorkspaceRole)
+		if !ok || !role.Allows(required) {
+			return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Workspace role " + string(required) + " required",
+			})
+		}
+		if ok, err := requireApiKeyScope(ctx, scopes...); !ok {
+			return err
+		}
+		return ctx.Next()
+	}
+}
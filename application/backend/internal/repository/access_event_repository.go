@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// accessEventRetention is how long access events are kept before Mongo expires them
+const accessEventRetention = 365 * 24 * time.Hour
+
+type MongoAccessEvent struct {
+	db *mongo.Database
+}
+
+func NewMongoAccessEvent(db *mongo.Database) *MongoAccessEvent {
+	collection := db.Collection("access_events")
+
+	indexModels := []mongo.IndexModel{
+		{Keys: bson.D{{"galleryId", 1}, {"createdAt", 1}}},
+		{
+			Keys:    bson.D{{"createdAt", 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(accessEventRetention.Seconds())),
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, indexModels)
+	if err != nil {
+		panic(err)
+	}
+
+	return &MongoAccessEvent{
+		db: db,
+	}
+}
+
+func (s *MongoAccessEvent) RecordEvent(ctx context.Context, event *domain.AccessEventDB) error {
+	coll := s.db.Collection("access_events")
+
+	event.ID = primitive.NewObjectID()
+	event.CreatedAt = time.Now().UTC()
+
+	_, err := coll.InsertOne(ctx, event)
+	return err
+}
+
+func (s *MongoAccessEvent) GetGalleryAnalytics(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID, from, to time.Time, limit int) (domain.GalleryAnalytics, error) {
+	coll := s.db.Collection("access_events")
+
+	countType := func(types ...domain.AccessEventType) bson.M {
+		return bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$in": bson.A{"$type", types}}, 1, 0}}}
+	}
+
+	// A single pass over the events of the period computes all aggregates
+	pipeline := mongo.Pipeline{
+		{{"$match", bson.M{
+			"galleryId":   galleryId,
+			"workspaceId": workspaceId,
+			"createdAt":   bson.M{"$gte": from, "$lt": to},
+		}}},
+		{{"$facet", bson.M{
+			"totals": bson.A{
+				bson.M{"$group": bson.M{"_id": "$type", "count": bson.M{"$sum": 1}}},
+			},
+			"visitors": bson.A{
+				bson.M{"$group": bson.M{"_id": "$visitorId"}},
+				bson.M{"$count": "count"},
+			},
+			"topPhotos": bson.A{
+				bson.M{"$match": bson.M{"type": domain.EventPhotoViewed}},
+				bson.M{"$group": bson.M{"_id": "$photoId", "views": bson.M{"$sum": 1}}},
+				bson.M{"$sort": bson.D{{"views", -1}, {"_id", 1}}},
+				bson.M{"$limit": limit},
+			},
+			"timeSeries": bson.A{
+				bson.M{"$group": bson.M{
+					"_id":        bson.M{"$dateTrunc": bson.M{"date": "$createdAt", "unit": "day"}},
+					"visitors":   bson.M{"$addToSet": "$visitorId"},
+					"opens":      countType(domain.EventGalleryOpened),
+					"photoViews": countType(domain.EventPhotoViewed),
+					"downloads":  countType(domain.EventPhotoDownloaded, domain.EventArchiveDownloaded),
+				}},
+				bson.M{"$set": bson.M{"visitors": bson.M{"$size": "$visitors"}}},
+				bson.M{"$sort": bson.M{"_id": 1}},
+			},
+			"userAgents": bson.A{
+				bson.M{"$group": bson.M{"_id": bson.M{"userAgent": "$userAgent", "visitorId": "$visitorId"}}},
+				bson.M{"$group": bson.M{"_id": "$_id.userAgent", "visitors": bson.M{"$sum": 1}}},
+				bson.M{"$sort": bson.D{{"visitors", -1}, {"_id", 1}}},
+				bson.M{"$limit": limit},
+			},
+		}}},
+	}
+
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return domain.GalleryAnalytics{}, err
+	}
+
+	var results []struct {
+		Totals []struct {
+			Type  domain.AccessEventType `bson:"_id"`
+			Count int64                  `bson:"count"`
+		} `bson:"totals"`
+		Visitors []struct {
+			Count int64 `bson:"count"`
+		} `bson:"visitors"`
+		TopPhotos  []domain.PhotoViews      `bson:"topPhotos"`
+		TimeSeries []domain.AnalyticsBucket `bson:"timeSeries"`
+		UserAgents []domain.UserAgentCount  `bson:"userAgents"`
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		return domain.GalleryAnalytics{}, err
+	}
+
+	analytics := domain.GalleryAnalytics{
+		From:       from,
+		To:         to,
+		TopPhotos:  make([]domain.PhotoViews, 0),
+		TimeSeries: make([]domain.AnalyticsBucket, 0),
+		UserAgents: make([]domain.UserAgentCount, 0),
+	}
+	if len(results) == 0 {
+		return analytics, nil
+	}
+
+	result := results[0]
+	for _, total := range result.Totals {
+		switch total.Type {
+		case domain.EventGalleryOpened:
+			analytics.Opens = total.Count
+		case domain.EventPhotoViewed:
+			analytics.PhotoViews = total.Count
+		case domain.EventPhotoDownloaded:
+			analytics.PhotoDownloads = total.Count
+		case domain.EventArchiveDownloaded:
+			analytics.ArchiveDownloads = total.Count
+		case domain.EventOrderPlaced:
+			analytics.Orders = total.Count
+		}
+	}
+	if len(result.Visitors) > 0 {
+		analytics.UniqueVisitors = result.Visitors[0].Count
+	}
+	if result.TopPhotos != nil {
+		analytics.TopPhotos = result.TopPhotos
+	}
+	if result.TimeSeries != nil {
+		analytics.TimeSeries = result.TimeSeries
+	}
+	if result.UserAgents != nil {
+		analytics.UserAgents = result.UserAgents
+	}
+	return analytics, nil
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// apiKeyTouchInterval is how often the last use of a key is recorded
+const apiKeyTouchInterval = time.Minute
+
+type MongoApiKey struct {
+	db *mongo.Database
+}
+
+func NewMongoApiKey(db *mongo.Database) *MongoApiKey {
+	collection := db.Collection("api_keys")
+
+	indexModels := []mongo.IndexModel{
+		{Keys: bson.D{{"keyHash", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{"userId", 1}, {"createdAt", -1}}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, indexModels)
+	if err != nil {
+		panic(err)
+	}
+
+	return &MongoApiKey{
+		db: db,
+	}
+}
+
+func (s *MongoApiKey) GetApiKeys(ctx context.Context, userId string) ([]domain.ApiKeyDB, error) {
+	coll := s.db.Collection("api_keys")
+
+	opts := options.Find().SetSort(bson.D{{"createdAt", -1}})
+	cursor, err := coll.Find(ctx, bson.M{"userId": userId}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]domain.ApiKeyDB, 0)
+	if err = cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *MongoApiKey) GetApiKeyByHash(ctx context.Context, keyHash string) (domain.ApiKeyDB, error) {
+	coll := s.db.Collection("api_keys")
+
+	var key domain.ApiKeyDB
+	err := coll.FindOne(ctx, bson.M{"keyHash": keyHash}).Decode(&key)
+	if err != nil {
+		return domain.ApiKeyDB{}, err
+	}
+	return key, nil
+}
+
+func (s *MongoApiKey) CreateApiKey(ctx context.Context, key *domain.ApiKeyDB) error {
+	coll := s.db.Collection("api_keys")
+
+	active, err := coll.CountDocuments(ctx, bson.M{"userId": key.UserId, "revokedAt": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	if active >= domain.MaxApiKeys {
+		return domain.ErrApiKeyLimitReached
+	}
+
+	key.ID = primitive.NewObjectID()
+	key.CreatedAt = time.Now().UTC()
+	_, err = coll.InsertOne(ctx, key)
+	return err
+}
+
+func (s *MongoApiKey) RevokeApiKey(ctx context.Context, keyId primitive.ObjectID, userId string) (domain.ApiKeyDB, error) {
+	coll := s.db.Collection("api_keys")
+
+	// Revoking a revoked key keeps the time it was first revoked
+	filter := bson.M{"_id": keyId, "userId": userId}
+	update := bson.A{
+		bson.M{"$set": bson.M{
+			"revokedAt": bson.M{"$ifNull": bson.A{"$revokedAt", "$$NOW"}},
+		}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var key domain.ApiKeyDB
+	err := coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&key)
+	if err != nil {
+		return domain.ApiKeyDB{}, err
+	}
+	return key, nil
+}
+
+func (s *MongoApiKey) TouchApiKey(ctx context.Context, keyId primitive.ObjectID, usedAt time.Time) error {
+	coll := s.db.Collection("api_keys")
+
+	filter := bson.M{
+		"_id": keyId,
+		"$or": bson.A{
+			bson.M{"lastUsedAt": bson.M{"$exists": false}},
+			bson.M{"lastUsedAt": bson.M{"$lt": usedAt.Add(-apiKeyTouchInterval)}},
+		},
+	}
+	_, err := coll.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"lastUsedAt": usedAt}})
+	return err
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type MongoClientVerification struct {
+	db *mongo.Database
+}
+
+func NewMongoClientVerification(db *mongo.Database) *MongoClientVerification {
+	collection := db.Collection("client_verifications")
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{"expiresAt", 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, indexModel)
+	if err != nil {
+		panic(err)
+	}
+
+	return &MongoClientVerification{
+		db: db,
+	}
+}
+
+func (s *MongoClientVerification) CreateVerification(ctx context.Context, verification *domain.ClientVerificationDB) error {
+	coll := s.db.Collection("client_verifications")
+
+	now := time.Now().UTC()
+	verification.ID = primitive.NewObjectID()
+	verification.Attempts = 0
+	verification.VerifiedAt = nil
+	verification.CreatedAt = now
+	verification.ExpiresAt = now.Add(domain.ClientVerificationLifetime)
+
+	_, err := coll.InsertOne(ctx, verification)
+	return err
+}
+
+func (s *MongoClientVerification) GetVerification(ctx context.Context, verificationId primitive.ObjectID) (domain.ClientVerificationDB, error) {
+	coll := s.db.Collection("client_verifications")
+
+	var verification domain.ClientVerificationDB
+	err := coll.FindOne(ctx, bson.M{"_id": verificationId}).Decode(&verification)
+	if err != nil {
+		return domain.ClientVerificationDB{}, err
+	}
+	return verification, nil
+}
+
+func (s *MongoClientVerification) FailVerification(ctx context.Context, verificationId primitive.ObjectID) error {
+	coll := s.db.Collection("client_verifications")
+
+	_, err := coll.UpdateByID(ctx, verificationId, bson.M{"$inc": bson.M{"attempts": 1}})
+	return err
+}
+
+func (s *MongoClientVerification) CompleteVerification(ctx context.Context, verificationId primitive.ObjectID) error {
+	coll := s.db.Collection("client_verifications")
+
+	now := time.Now().UTC()
+	filter := bson.M{
+		"_id":        verificationId,
+		"verifiedAt": bson.M{"$exists": false},
+		"expiresAt":  bson.M{"$gt": now},
+		"attempts":   bson.M{"$lt": domain.MaxVerificationAttempts},
+	}
+	result, err := coll.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"verifiedAt": now}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrVerificationUnavailable
+	}
+	return nil
+}
@@ -18,7 +18,7 @@ func NewMongoCollection(db *mongo.Database) *MongoCollection {
 	collection := db.Collection("collections")
 
 	indexModel := mongo.IndexModel{
-		Keys: bson.D{{"userId", 1}},
+		Keys: bson.D{{"workspaceId", 1}},
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -34,10 +34,10 @@ func NewMongoCollection(db *mongo.Database) *MongoCollection {
 	}
 }
 
-func (s *MongoCollection) CollectionExists(ctx context.Context, collectionId primitive.ObjectID, userId string) (bool, error) {
+func (s *MongoCollection) CollectionExists(ctx context.Context, collectionId primitive.ObjectID, workspaceId primitive.ObjectID) (bool, error) {
 	coll := s.db.Collection("collections")
 
-	count, err := coll.CountDocuments(ctx, bson.M{"_id": collectionId, "userId": userId}, options.Count().SetLimit(1))
+	count, err := coll.CountDocuments(ctx, bson.M{"_id": collectionId, "workspaceId": workspaceId}, options.Count().SetLimit(1))
 	if err != nil {
 		return false, err
 	}
@@ -45,11 +45,11 @@ func (s *MongoCollection) CollectionExists(ctx context.Context, collectionId pri
 	return count > 0, nil
 }
 
-func (s *MongoCollection) GetCollection(ctx context.Context, collectionId primitive.ObjectID, userId string) (domain.CollectionDB, error) {
+func (s *MongoCollection) GetCollection(ctx context.Context, collectionId primitive.ObjectID, workspaceId primitive.ObjectID) (domain.CollectionDB, error) {
 	coll := s.db.Collection("collections")
 
 	var collection domain.CollectionDB
-	err := coll.FindOne(ctx, bson.M{"_id": collectionId, "userId": userId}).Decode(&collection)
+	err := coll.FindOne(ctx, bson.M{"_id": collectionId, "workspaceId": workspaceId}).Decode(&collection)
 	if err != nil {
 		return domain.CollectionDB{}, err
 	}
@@ -57,10 +57,10 @@ func (s *MongoCollection) GetCollection(ctx context.Context, collectionId primit
 	return collection, nil
 }
 
-func (s *MongoCollection) GetCollections(ctx context.Context, userId string) ([]domain.CollectionDB, error) {
+func (s *MongoCollection) GetCollections(ctx context.Context, workspaceId primitive.ObjectID) ([]domain.CollectionDB, error) {
 	collection := s.db.Collection("collections")
 
-	cursor, err := collection.Find(ctx, bson.D{{"userId", userId}})
+	cursor, err := collection.Find(ctx, bson.D{{"workspaceId", workspaceId}})
 	if err != nil {
 		return nil, err
 	}
@@ -73,12 +73,13 @@ func (s *MongoCollection) GetCollections(ctx context.Context, userId string) ([]
 	return collections, nil
 }
 
-func (s *MongoCollection) CreateCollection(ctx context.Context, name string, userId string) (string, error) {
+func (s *MongoCollection) CreateCollection(ctx context.Context, name string, workspaceId primitive.ObjectID, userId string) (string, error) {
 	collection := s.db.Collection("collections")
 
 	col := bson.D{
 		{"name", name},
 		{"userId", userId},
+		{"workspaceId", workspaceId},
 		{"createdAt", primitive.NewDateTimeFromTime(time.Now().UTC())},
 		{"updatedAt", primitive.NewDateTimeFromTime(time.Now().UTC())},
 	}
@@ -90,16 +91,16 @@ func (s *MongoCollection) CreateCollection(ctx context.Context, name string, use
 	return result.InsertedID.(primitive.ObjectID).Hex(), nil
 }
 
-func (s *MongoCollection) DeleteCollection(ctx context.Context, collectionId primitive.ObjectID, userId string) error {
+func (s *MongoCollection) DeleteCollection(ctx context.Context, collectionId primitive.ObjectID, workspaceId primitive.ObjectID) error {
 	collection := s.db.Collection("collections")
-	_, err := collection.DeleteOne(ctx, bson.M{"_id": collectionId, "userId": userId})
+	_, err := collection.DeleteOne(ctx, bson.M{"_id": collectionId, "workspaceId": workspaceId})
 	return err
 }
 
-func (s *MongoCollection) UpdateCollection(ctx context.Context, collectionId primitive.ObjectID, name string, userId string) (domain.CollectionDB, error) {
+func (s *MongoCollection) UpdateCollection(ctx context.Context, collectionId primitive.ObjectID, name string, workspaceId primitive.ObjectID) (domain.CollectionDB, error) {
 	coll := s.db.Collection("collections")
 
-	filter := bson.M{"_id": collectionId, "userId": userId}
+	filter := bson.M{"_id": collectionId, "workspaceId": workspaceId}
 	update := bson.D{
 		{"$set", bson.D{
 			{"name", name},
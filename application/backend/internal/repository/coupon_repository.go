@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type MongoCoupon struct {
+	db *mongo.Database
+}
+
+func NewMongoCoupon(db *mongo.Database) *MongoCoupon {
+	collection := db.Collection("coupons")
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{"workspaceId", 1}, {"code", 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, indexModel)
+	if err != nil {
+		panic(err)
+	}
+
+	return &MongoCoupon{
+		db: db,
+	}
+}
+
+func (s *MongoCoupon) GetCoupons(ctx context.Context, workspaceId primitive.ObjectID) ([]domain.CouponDB, error) {
+	coll := s.db.Collection("coupons")
+
+	opts := options.Find().SetSort(bson.D{{"createdAt", -1}})
+	cursor, err := coll.Find(ctx, bson.M{"workspaceId": workspaceId}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	coupons := make([]domain.CouponDB, 0)
+	if err = cursor.All(ctx, &coupons); err != nil {
+		return nil, err
+	}
+	return coupons, nil
+}
+
+func (s *MongoCoupon) GetCoupon(ctx context.Context, couponId primitive.ObjectID, workspaceId primitive.ObjectID) (domain.CouponDB, error) {
+	coll := s.db.Collection("coupons")
+
+	var coupon domain.CouponDB
+	err := coll.FindOne(ctx, bson.M{"_id": couponId, "workspaceId": workspaceId}).Decode(&coupon)
+	if err != nil {
+		return domain.CouponDB{}, err
+	}
+	return coupon, nil
+}
+
+func (s *MongoCoupon) GetCouponByCode(ctx context.Context, code string, workspaceId primitive.ObjectID) (domain.CouponDB, error) {
+	coll := s.db.Collection("coupons")
+
+	var coupon domain.CouponDB
+	err := coll.FindOne(ctx, bson.M{"code": domain.NormalizeCouponCode(code), "workspaceId": workspaceId}).Decode(&coupon)
+	if err != nil {
+		return domain.CouponDB{}, err
+	}
+	return coupon, nil
+}
+
+func (s *MongoCoupon) CreateCoupon(ctx context.Context, coupon *domain.CouponDB) (string, error) {
+	coll := s.db.Collection("coupons")
+
+	coupon.ID = primitive.NewObjectID()
+	coupon.Code = domain.NormalizeCouponCode(coupon.Code)
+	coupon.Uses = 0
+	coupon.CreatedAt = time.Now().UTC()
+	coupon.UpdatedAt = time.Now().UTC()
+
+	_, err := coll.InsertOne(ctx, coupon)
+	if err != nil {
+		return "", err
+	}
+	return coupon.ID.Hex(), nil
+}
+
+func (s *MongoCoupon) DeleteCoupon(ctx context.Context, couponId primitive.ObjectID, workspaceId primitive.ObjectID) error {
+	coll := s.db.Collection("coupons")
+	_, err := coll.DeleteOne(ctx, bson.M{"_id": couponId, "workspaceId": workspaceId})
+	return err
+}
+
+func (s *MongoCoupon) RedeemCoupon(ctx context.Context, couponId primitive.ObjectID) error {
+	coll := s.db.Collection("coupons")
+
+	filter := bson.M{
+		"_id": couponId,
+		"$or": bson.A{
+			bson.M{"maxUses": 0},
+			bson.M{"$expr": bson.M{"$lt": bson.A{"$uses", "$maxUses"}}},
+		},
+	}
+	update := bson.D{
+		{"$inc", bson.D{
+			{"uses", 1},
+		}},
+		{"$currentDate", bson.D{
+			{"updatedAt", true},
+		}},
+	}
+
+	err := coll.FindOneAndUpdate(ctx, filter, update).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return domain.ErrCouponExhausted
+	}
+	return err
+}
+
+func (s *MongoCoupon) ReleaseCoupon(ctx context.Context, couponId primitive.ObjectID) error {
+	coll := s.db.Collection("coupons")
+
+	filter := bson.M{"_id": couponId, "uses": bson.M{"$gt": 0}}
+	update := bson.D{
+		{"$inc", bson.D{
+			{"uses", -1},
+		}},
+		{"$currentDate", bson.D{
+			{"updatedAt", true},
+		}},
+	}
+	_, err := coll.UpdateOne(ctx, filter, update)
+	return err
+}
@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// afterCursor matches documents that come after the cursor when sorting by field and then by _id in the same direction
+func afterCursor(field string, cursor domain.Cursor, descending bool) bson.M {
+	op := "$gt"
+	if descending {
+		op = "$lt"
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{field: bson.M{op: cursor.Value}},
+		bson.M{field: cursor.Value, "_id": bson.M{op: cursor.ID}},
+	}}
+}
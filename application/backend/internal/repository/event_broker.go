@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/michalK00/halftone/internal/domain"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	eventChannelPrefix = "events:"
+	// eventSubscriberBuffer is how many events a stream can fall behind before events are dropped for it
+	eventSubscriberBuffer = 32
+	// eventSubscribeTimeout limits waiting for Redis to confirm the subscription
+	eventSubscribeTimeout = 5 * time.Second
+)
+
+// RedisEventBroker publishes events to a Redis channel per workspace. Every instance subscribes to the channels of
+// all workspaces with a single connection and hands the events to the streams it serves.
+type RedisEventBroker struct {
+	rdb *redis.Client
+
+	mu          sync.Mutex
+	pubsub      *redis.PubSub
+	subscribers map[primitive.ObjectID]map[chan domain.Event]struct{}
+}
+
+func NewRedisEventBroker(rdb *redis.Client) *RedisEventBroker {
+	return &RedisEventBroker{
+		rdb:         rdb,
+		subscribers: make(map[primitive.ObjectID]map[chan domain.Event]struct{}),
+	}
+}
+
+func eventChannel(workspaceId primitive.ObjectID) string {
+	return eventChannelPrefix + workspaceId.Hex()
+}
+
+func (b *RedisEventBroker) Publish(ctx context.Context, event domain.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return b.rdb.Publish(ctx, eventChannel(event.WorkspaceID), payload).Err()
+}
+
+func (b *RedisEventBroker) Subscribe(ctx context.Context, workspaceId primitive.ObjectID) (<-chan domain.Event, error) {
+	b.mu.Lock()
+	subscribed := b.pubsub != nil
+	b.mu.Unlock()
+
+	// the subscription is set up without holding the lock, so a slow Redis does not hold up dispatching to open streams
+	var pubsub *redis.PubSub
+	if !subscribed {
+		pubsub = b.rdb.PSubscribe(context.Background(), eventChannelPrefix+"*")
+		receiveCtx, cancel := context.WithTimeout(ctx, eventSubscribeTimeout)
+		// wait for the subscription, so the stream does not miss events published right after it is opened
+		_, err := pubsub.Receive(receiveCtx)
+		cancel()
+		if err != nil {
+			_ = pubsub.Close()
+			return nil, err
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if pubsub != nil {
+		if b.pubsub == nil {
+			b.pubsub = pubsub
+			go b.listen(pubsub)
+		} else {
+			// another stream subscribed in the meantime
+			_ = pubsub.Close()
+		}
+	} else if b.pubsub == nil {
+		// the subscription ended in the meantime, the next stream sets up a new one
+		return nil, errors.New("event subscription closed")
+	}
+
+	events := make(chan domain.Event, eventSubscriberBuffer)
+	if b.subscribers[workspaceId] == nil {
+		b.subscribers[workspaceId] = make(map[chan domain.Event]struct{})
+	}
+	b.subscribers[workspaceId][events] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+		b.unsubscribe(workspaceId, events)
+	}()
+
+	return events, nil
+}
+
+func (b *RedisEventBroker) Close() error {
+	b.mu.Lock()
+	pubsub := b.pubsub
+	b.mu.Unlock()
+
+	// the listener closes the channels of the streams once the subscription is closed
+	if pubsub == nil {
+		return nil
+	}
+	return pubsub.Close()
+}
+
+func (b *RedisEventBroker) unsubscribe(workspaceId primitive.ObjectID, events chan domain.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// the listener closes all channels when the subscription ends, a channel is only closed by who removes it
+	if _, ok := b.subscribers[workspaceId][events]; !ok {
+		return
+	}
+	delete(b.subscribers[workspaceId], events)
+	if len(b.subscribers[workspaceId]) == 0 {
+		delete(b.subscribers, workspaceId)
+	}
+	close(events)
+}
+
+// listen dispatches the received events until the subscription is closed by Close or with the Redis client, and
+// closes the channels of the streams then
+func (b *RedisEventBroker) listen(pubsub *redis.PubSub) {
+	for msg := range pubsub.Channel() {
+		workspaceId, err := primitive.ObjectIDFromHex(strings.TrimPrefix(msg.Channel, eventChannelPrefix))
+		if err != nil {
+			continue
+		}
+		var event domain.Event
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+			log.Printf("Failed to decode event from %s: %v", msg.Channel, err)
+			continue
+		}
+		b.dispatch(workspaceId, event)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pubsub != pubsub {
+		return
+	}
+	for _, subscribers := range b.subscribers {
+		for events := range subscribers {
+			close(events)
+		}
+	}
+	b.subscribers = make(map[primitive.ObjectID]map[chan domain.Event]struct{})
+	b.pubsub = nil
+}
+
+func (b *RedisEventBroker) dispatch(workspaceId primitive.ObjectID, event domain.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for events := range b.subscribers[workspaceId] {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+type RedisEventTicket struct {
+	rdb *redis.Client
+}
+
+func NewRedisEventTicket(rdb *redis.Client) *RedisEventTicket {
+	return &RedisEventTicket{
+		rdb: rdb,
+	}
+}
+
+func eventTicketKey(ticket string) string {
+	return "event_ticket:" + ticket
+}
+
+func (s *RedisEventTicket) CreateEventTicket(ctx context.Context, ticket domain.EventTicket) (string, error) {
+	token, err := domain.GenerateAccessToken()
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(ticket)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.rdb.Set(ctx, eventTicketKey(token), payload, domain.EventTicketLifetime).Err(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (s *RedisEventTicket) RedeemEventTicket(ctx context.Context, token string) (domain.EventTicket, error) {
+	payload, err := s.rdb.GetDel(ctx, eventTicketKey(token)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return domain.EventTicket{}, domain.ErrInvalidEventTicket
+		}
+		return domain.EventTicket{}, err
+	}
+
+	var ticket domain.EventTicket
+	if err := json.Unmarshal(payload, &ticket); err != nil {
+		return domain.EventTicket{}, err
+	}
+	return ticket, nil
+}
@@ -32,10 +32,10 @@ func (s *MongoGallery) GetGalleryByID(ctx context.Context, galleryId primitive.O
 	return result, nil
 }
 
-func (s *MongoGallery) GalleryExists(ctx context.Context, galleryId primitive.ObjectID, userId string) (bool, error) {
+func (s *MongoGallery) GalleryExists(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID) (bool, error) {
 	coll := s.db.Collection("galleries")
 
-	count, err := coll.CountDocuments(ctx, bson.M{"_id": galleryId, "userId": userId}, options.Count().SetLimit(1))
+	count, err := coll.CountDocuments(ctx, bson.M{"_id": galleryId, "workspaceId": workspaceId}, options.Count().SetLimit(1))
 	if err != nil {
 		return false, err
 	}
@@ -43,19 +43,19 @@ func (s *MongoGallery) GalleryExists(ctx context.Context, galleryId primitive.Ob
 	return count > 0, nil
 }
 
-func (s *MongoGallery) CollectionGalleryCount(ctx context.Context, collectionId primitive.ObjectID, userId string) (int64, error) {
+func (s *MongoGallery) CollectionGalleryCount(ctx context.Context, collectionId primitive.ObjectID, workspaceId primitive.ObjectID) (int64, error) {
 	coll := s.db.Collection("galleries")
-	count, err := coll.CountDocuments(ctx, bson.M{"collectionId": collectionId, "userId": userId})
+	count, err := coll.CountDocuments(ctx, bson.M{"collectionId": collectionId, "workspaceId": workspaceId})
 	if err != nil {
 		return 0, err
 	}
 	return count, nil
 }
 
-func (s *MongoGallery) GetGalleries(ctx context.Context, collectionId primitive.ObjectID, userId string) ([]domain.GalleryDB, error) {
+func (s *MongoGallery) GetGalleries(ctx context.Context, collectionId primitive.ObjectID, workspaceId primitive.ObjectID) ([]domain.GalleryDB, error) {
 	coll := s.db.Collection("galleries")
 
-	cursor, err := coll.Find(ctx, bson.M{"collectionId": collectionId, "userId": userId})
+	cursor, err := coll.Find(ctx, bson.M{"collectionId": collectionId, "workspaceId": workspaceId})
 	if err != nil {
 		return nil, err
 	}
@@ -67,11 +67,11 @@ func (s *MongoGallery) GetGalleries(ctx context.Context, collectionId primitive.
 	return result, nil
 }
 
-func (s *MongoGallery) GetGallery(ctx context.Context, galleryId primitive.ObjectID, userId string) (domain.GalleryDB, error) {
+func (s *MongoGallery) GetGallery(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID) (domain.GalleryDB, error) {
 	coll := s.db.Collection("galleries")
 
 	var result domain.GalleryDB
-	err := coll.FindOne(ctx, bson.M{"_id": galleryId, "userId": userId}).Decode(&result)
+	err := coll.FindOne(ctx, bson.M{"_id": galleryId, "workspaceId": workspaceId}).Decode(&result)
 	if err != nil {
 		return domain.GalleryDB{}, err
 	}
@@ -79,7 +79,7 @@ func (s *MongoGallery) GetGallery(ctx context.Context, galleryId primitive.Objec
 	return result, nil
 }
 
-func (s *MongoGallery) CreateGallery(ctx context.Context, collectionId primitive.ObjectID, name, userId string) (string, error) {
+func (s *MongoGallery) CreateGallery(ctx context.Context, collectionId primitive.ObjectID, name string, workspaceId primitive.ObjectID, userId string) (string, error) {
 
 	galleriesColl := s.db.Collection("galleries")
 	galleryID := primitive.NewObjectID()
@@ -89,6 +89,7 @@ func (s *MongoGallery) CreateGallery(ctx context.Context, collectionId primitive
 		{"collectionId", collectionId},
 		{"name", name},
 		{"userId", userId},
+		{"workspaceId", workspaceId},
 		{"createdAt", primitive.NewDateTimeFromTime(time.Now().UTC())},
 		{"updatedAt", primitive.NewDateTimeFromTime(time.Now().UTC())},
 		{"sharing", bson.D{
@@ -103,13 +104,13 @@ func (s *MongoGallery) CreateGallery(ctx context.Context, collectionId primitive
 	return galleryID.Hex(), nil
 }
 
-func (s *MongoGallery) DeleteGallery(ctx context.Context, galleryId primitive.ObjectID, userId string) error {
+func (s *MongoGallery) DeleteGallery(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID) error {
 	coll := s.db.Collection("galleries")
-	_, err := coll.DeleteOne(ctx, bson.M{"_id": galleryId, "userId": userId})
+	_, err := coll.DeleteOne(ctx, bson.M{"_id": galleryId, "workspaceId": workspaceId})
 	return err
 }
 
-func (s *MongoGallery) UpdateGallery(ctx context.Context, galleryId primitive.ObjectID, userId string, opts ...domain.GalleryUpdateOption) (domain.GalleryDB, error) {
+func (s *MongoGallery) UpdateGallery(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID, opts ...domain.GalleryUpdateOption) (domain.GalleryDB, error) {
 
 	updateOptions := &domain.GalleryUpdateOptions{
 		SetFields: bson.D{},
@@ -119,7 +120,7 @@ func (s *MongoGallery) UpdateGallery(ctx context.Context, galleryId primitive.Ob
 	}
 
 	coll := s.db.Collection("galleries")
-	filter := bson.M{"_id": galleryId, "userId": userId}
+	filter := bson.M{"_id": galleryId, "workspaceId": workspaceId}
 	update := bson.D{
 		{"$set", updateOptions.SetFields},
 		{"$currentDate", bson.D{
@@ -131,3 +132,29 @@ func (s *MongoGallery) UpdateGallery(ctx context.Context, galleryId primitive.Ob
 	err := coll.FindOneAndUpdate(ctx, filter, update, findOpts).Decode(&gallery)
 	return gallery, err
 }
+
+func (s *MongoGallery) CountDownload(ctx context.Context, galleryId primitive.ObjectID) error {
+	coll := s.db.Collection("galleries")
+
+	_, err := coll.UpdateByID(ctx, galleryId, bson.M{"$inc": bson.M{"downloads": 1}})
+	return err
+}
+
+func (s *MongoGallery) GetGalleriesExpiringBetween(ctx context.Context, from time.Time, to time.Time) ([]domain.GalleryDB, error) {
+	coll := s.db.Collection("galleries")
+
+	filter := bson.M{
+		"sharing.sharingEnabled":    true,
+		"sharing.sharingExpiryDate": bson.M{"$gt": from, "$lte": to},
+	}
+	cursor, err := coll.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	galleries := make([]domain.GalleryDB, 0)
+	if err = cursor.All(ctx, &galleries); err != nil {
+		return nil, err
+	}
+	return galleries, nil
+}
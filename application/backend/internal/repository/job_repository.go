@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"github.com/michalK00/halftone/internal/domain"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -20,10 +21,26 @@ func NewMongoJob(db *mongo.Database) *MongoJob {
 	}
 }
 
-func (s *MongoJob) GetJobsDue(ctx context.Context) ([]domain.Job, error) {
+// claimableJobs matches the jobs a worker can take over
+func claimableJobs(now time.Time) bson.E {
+	return bson.E{Key: "$or", Value: bson.A{
+		bson.D{{"status", domain.JobStatusPending}},
+		bson.D{{"status", domain.JobStatusActive}, {"leaseUntil", bson.D{{"$lt", now}}}},
+	}}
+}
+
+// heldJob matches a job the worker is running
+func heldJob(jobId primitive.ObjectID, workerId primitive.ObjectID) bson.D {
+	return bson.D{{"_id", jobId}, {"status", domain.JobStatusActive}, {"workerId", workerId}}
+}
+
+func (s *MongoJob) GetJobsDue(ctx context.Context, types []string) ([]domain.Job, error) {
 	collection := s.db.Collection("jobs")
+	now := time.Now().UTC()
 	filter := bson.D{
-		{"scheduled_at", bson.D{{"$lte", time.Now().UTC()}}},
+		{"type", bson.D{{"$in", types}}},
+		{"scheduledAt", bson.D{{"$lte", now}}},
+		claimableJobs(now),
 	}
 
 	var result []domain.Job
@@ -71,3 +88,96 @@ func (s *MongoJob) DeleteJob(ctx context.Context, jobId primitive.ObjectID) (dom
 
 	return job, err
 }
+
+func (s *MongoJob) ClaimJob(ctx context.Context, jobId primitive.ObjectID, workerId primitive.ObjectID, leaseUntil time.Time) (domain.Job, error) {
+	collection := s.db.Collection("jobs")
+
+	filter := bson.D{{"_id", jobId}, claimableJobs(time.Now().UTC())}
+	update := bson.D{
+		{"$set", bson.D{
+			{"status", domain.JobStatusActive},
+			{"workerId", workerId},
+			{"startedAt", time.Now().UTC()},
+			{"leaseUntil", leaseUntil},
+		}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var job domain.Job
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	return job, err
+}
+
+func (s *MongoJob) RenewJob(ctx context.Context, jobId primitive.ObjectID, workerId primitive.ObjectID, leaseUntil time.Time) error {
+	collection := s.db.Collection("jobs")
+
+	result, err := collection.UpdateOne(ctx, heldJob(jobId, workerId), bson.D{{"$set", bson.D{{"leaseUntil", leaseUntil}}}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (s *MongoJob) CompleteJob(ctx context.Context, jobId primitive.ObjectID, workerId primitive.ObjectID) error {
+	collection := s.db.Collection("jobs")
+
+	update := bson.D{
+		{"$set", bson.D{
+			{"status", domain.JobStatusComplete},
+			{"completedAt", time.Now().UTC()},
+		}},
+		{"$unset", bson.D{
+			{"error", ""},
+			{"leaseUntil", ""},
+		}},
+	}
+	result, err := collection.UpdateOne(ctx, heldJob(jobId, workerId), update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (s *MongoJob) FailJob(ctx context.Context, jobId primitive.ObjectID, workerId primitive.ObjectID, jobErr error, retryAt time.Time) (domain.Job, error) {
+	collection := s.db.Collection("jobs")
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	// Retry while there are retries left
+	filter := append(heldJob(jobId, workerId), bson.E{Key: "retries", Value: bson.D{{"$gt", 0}}})
+	update := bson.D{
+		{"$set", bson.D{
+			{"status", domain.JobStatusPending},
+			{"scheduledAt", retryAt},
+			{"error", jobErr.Error()},
+		}},
+		{"$inc", bson.D{
+			{"retries", -1},
+		}},
+		{"$unset", bson.D{
+			{"leaseUntil", ""},
+		}},
+	}
+	var job domain.Job
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return job, err
+	}
+
+	update = bson.D{
+		{"$set", bson.D{
+			{"status", domain.JobStatusFailed},
+			{"completedAt", time.Now().UTC()},
+			{"error", jobErr.Error()},
+		}},
+		{"$unset", bson.D{
+			{"leaseUntil", ""},
+		}},
+	}
+	err = collection.FindOneAndUpdate(ctx, heldJob(jobId, workerId), update, opts).Decode(&job)
+	return job, err
+}
@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type MongoLocalUser struct {
+	db *mongo.Database
+}
+
+func NewMongoLocalUser(db *mongo.Database) *MongoLocalUser {
+	collection := db.Collection("local_users")
+
+	indexModels := []mongo.IndexModel{
+		{Keys: bson.D{{"email", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{"refreshTokens.hash", 1}}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, indexModels)
+	if err != nil {
+		panic(err)
+	}
+
+	return &MongoLocalUser{
+		db: db,
+	}
+}
+
+func (s *MongoLocalUser) CreateLocalUser(ctx context.Context, user *domain.LocalUserDB) error {
+	coll := s.db.Collection("local_users")
+
+	now := time.Now().UTC()
+	user.ID = primitive.NewObjectID()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	if user.RefreshTokens == nil {
+		user.RefreshTokens = []domain.LocalRefreshToken{}
+	}
+
+	_, err := coll.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return domain.ErrLocalUserExists
+	}
+	return err
+}
+
+func (s *MongoLocalUser) GetLocalUser(ctx context.Context, userId primitive.ObjectID) (domain.LocalUserDB, error) {
+	return s.findLocalUser(ctx, bson.M{"_id": userId})
+}
+
+func (s *MongoLocalUser) GetLocalUserByEmail(ctx context.Context, email string) (domain.LocalUserDB, error) {
+	return s.findLocalUser(ctx, bson.M{"email": email})
+}
+
+func (s *MongoLocalUser) GetLocalUserByRefreshToken(ctx context.Context, tokenHash string) (domain.LocalUserDB, error) {
+	return s.findLocalUser(ctx, bson.M{"refreshTokens.hash": tokenHash})
+}
+
+func (s *MongoLocalUser) findLocalUser(ctx context.Context, filter bson.M) (domain.LocalUserDB, error) {
+	coll := s.db.Collection("local_users")
+
+	var user domain.LocalUserDB
+	err := coll.FindOne(ctx, filter).Decode(&user)
+	if err != nil {
+		return domain.LocalUserDB{}, err
+	}
+	return user, nil
+}
+
+func (s *MongoLocalUser) UpdateLocalUser(ctx context.Context, userId primitive.ObjectID, opts ...domain.LocalUserUpdateOption) error {
+	updateOptions := &domain.LocalUserUpdateOptions{
+		SetFields: bson.D{},
+	}
+	for _, opt := range opts {
+		opt(updateOptions)
+	}
+
+	coll := s.db.Collection("local_users")
+	update := bson.D{
+		{"$set", updateOptions.SetFields},
+		{"$currentDate", bson.D{
+			{"updatedAt", true},
+		}},
+	}
+
+	result, err := coll.UpdateByID(ctx, userId, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (s *MongoLocalUser) CountCodeAttempt(ctx context.Context, userId primitive.ObjectID, field string) error {
+	coll := s.db.Collection("local_users")
+
+	filter := bson.M{
+		"_id":               userId,
+		field:               bson.M{"$type": "object"},
+		field + ".attempts": bson.M{"$not": bson.M{"$gte": domain.MaxLocalCodeAttempts}},
+	}
+	result, err := coll.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{field + ".attempts": 1}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrLocalCodeUsedUp
+	}
+	return nil
+}
+
+func (s *MongoLocalUser) AddRefreshToken(ctx context.Context, userId primitive.ObjectID, token domain.LocalRefreshToken) error {
+	coll := s.db.Collection("local_users")
+
+	// Expired tokens are dropped whenever the user signs in again
+	update := bson.A{
+		bson.M{"$set": bson.M{
+			"refreshTokens": bson.M{"$concatArrays": bson.A{
+				bson.M{"$filter": bson.M{
+					"input": bson.M{"$ifNull": bson.A{"$refreshTokens", bson.A{}}},
+					"cond":  bson.M{"$gt": bson.A{"$$this.expiresAt", "$$NOW"}},
+				}},
+				bson.A{token},
+			}},
+			"updatedAt": "$$NOW",
+		}},
+	}
+	result, err := coll.UpdateByID(ctx, userId, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (s *MongoLocalUser) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	coll := s.db.Collection("local_users")
+
+	filter := bson.M{"refreshTokens.hash": tokenHash}
+	update := bson.M{
+		"$pull": bson.M{"refreshTokens": bson.M{"hash": tokenHash}},
+		"$set":  bson.M{"updatedAt": time.Now().UTC()},
+	}
+	_, err := coll.UpdateOne(ctx, filter, update)
+	return err
+}
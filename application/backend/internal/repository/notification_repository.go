@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const (
+	// notificationRetention is how long notifications are kept before Mongo expires them
+	notificationRetention    = 180 * 24 * time.Hour
+	defaultNotificationLimit = 50
+)
+
+type MongoNotification struct {
+	db *mongo.Database
+}
+
+func NewMongoNotification(db *mongo.Database) *MongoNotification {
+	collection := db.Collection("notifications")
+
+	indexModels := []mongo.IndexModel{
+		{Keys: bson.D{{"userId", 1}, {"_id", -1}}},
+		{Keys: bson.D{{"userId", 1}, {"readAt", 1}}},
+		{
+			Keys: bson.D{{"userId", 1}, {"key", 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"key": bson.M{"$exists": true}}),
+		},
+		{
+			Keys:    bson.D{{"createdAt", 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(notificationRetention.Seconds())),
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, indexModels)
+	if err != nil {
+		panic(err)
+	}
+
+	return &MongoNotification{
+		db: db,
+	}
+}
+
+func (s *MongoNotification) GetNotifications(ctx context.Context, userId string, filter domain.NotificationFilter) (domain.NotificationPage, error) {
+	coll := s.db.Collection("notifications")
+
+	query := bson.M{"userId": userId}
+	if filter.UnreadOnly {
+		query["readAt"] = bson.M{"$exists": false}
+	}
+	if !filter.Before.IsZero() {
+		query["_id"] = bson.M{"$lt": filter.Before}
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultNotificationLimit
+	}
+
+	opts := options.Find().SetSort(bson.D{{"_id", -1}}).SetLimit(limit + 1)
+	cursor, err := coll.Find(ctx, query, opts)
+	if err != nil {
+		return domain.NotificationPage{}, err
+	}
+
+	notifications := make([]domain.NotificationDB, 0)
+	if err = cursor.All(ctx, &notifications); err != nil {
+		return domain.NotificationPage{}, err
+	}
+
+	unread, err := coll.CountDocuments(ctx, bson.M{"userId": userId, "readAt": bson.M{"$exists": false}})
+	if err != nil {
+		return domain.NotificationPage{}, err
+	}
+
+	page := domain.NotificationPage{UnreadCount: unread}
+	if int64(len(notifications)) > limit {
+		notifications = notifications[:limit]
+		page.Next = notifications[limit-1].ID.Hex()
+	}
+	page.Notifications = notifications
+	return page, nil
+}
+
+func (s *MongoNotification) GetNotification(ctx context.Context, notificationId primitive.ObjectID) (domain.NotificationDB, error) {
+	coll := s.db.Collection("notifications")
+
+	var notification domain.NotificationDB
+	err := coll.FindOne(ctx, bson.M{"_id": notificationId}).Decode(&notification)
+	if err != nil {
+		return domain.NotificationDB{}, err
+	}
+	return notification, nil
+}
+
+func (s *MongoNotification) CreateNotification(ctx context.Context, notification *domain.NotificationDB) error {
+	coll := s.db.Collection("notifications")
+
+	if notification.ID.IsZero() {
+		notification.ID = primitive.NewObjectID()
+	}
+	notification.CreatedAt = time.Now().UTC()
+	_, err := coll.InsertOne(ctx, notification)
+	if mongo.IsDuplicateKeyError(err) {
+		return domain.ErrNotificationExists
+	}
+	return err
+}
+
+func (s *MongoNotification) MarkNotificationsRead(ctx context.Context, userId string, ids []primitive.ObjectID, read bool) (int64, error) {
+	coll := s.db.Collection("notifications")
+
+	filter := bson.M{"userId": userId}
+	if len(ids) > 0 {
+		filter["_id"] = bson.M{"$in": ids}
+	}
+
+	var update bson.M
+	if read {
+		filter["readAt"] = bson.M{"$exists": false}
+		update = bson.M{"$set": bson.M{"readAt": time.Now().UTC()}}
+	} else {
+		filter["readAt"] = bson.M{"$exists": true}
+		update = bson.M{"$unset": bson.M{"readAt": ""}}
+	}
+
+	result, err := coll.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (s *MongoNotification) MarkNotificationDelivered(ctx context.Context, notificationId primitive.ObjectID, channel domain.NotificationChannel) error {
+	coll := s.db.Collection("notifications")
+
+	update := bson.M{"$set": bson.M{
+		"deliveredVia": channel,
+		"deliveredAt":  time.Now().UTC(),
+	}}
+	_, err := coll.UpdateByID(ctx, notificationId, update)
+	return err
+}
+
+func (s *MongoNotification) GetNotificationPreferences(ctx context.Context, userId string) (domain.NotificationPreferencesDB, error) {
+	coll := s.db.Collection("notification_preferences")
+
+	var preferences domain.NotificationPreferencesDB
+	err := coll.FindOne(ctx, bson.M{"_id": userId}).Decode(&preferences)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return domain.NotificationPreferencesDB{UserId: userId}, nil
+	}
+	if err != nil {
+		return domain.NotificationPreferencesDB{}, err
+	}
+	return preferences, nil
+}
+
+func (s *MongoNotification) UpdateNotificationPreferences(ctx context.Context, userId string, channels map[domain.NotificationType]domain.NotificationChannel, email string) (domain.NotificationPreferencesDB, error) {
+	coll := s.db.Collection("notification_preferences")
+
+	set := bson.M{"updatedAt": time.Now().UTC()}
+	for t, channel := range channels {
+		set["channels."+string(t)] = channel
+	}
+	if email != "" {
+		set["email"] = email
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var preferences domain.NotificationPreferencesDB
+	err := coll.FindOneAndUpdate(ctx, bson.M{"_id": userId}, bson.M{"$set": set}, opts).Decode(&preferences)
+	if err != nil {
+		return domain.NotificationPreferencesDB{}, err
+	}
+	return preferences, nil
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type MongoOrderMessage struct {
+	db *mongo.Database
+}
+
+func NewMongoOrderMessage(db *mongo.Database) *MongoOrderMessage {
+	collection := db.Collection("order_messages")
+
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{{"order_id", 1}, {"created_at", 1}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, indexModel)
+	if err != nil {
+		panic(err)
+	}
+
+	return &MongoOrderMessage{
+		db: db,
+	}
+}
+
+func (s *MongoOrderMessage) GetMessages(ctx context.Context, orderId primitive.ObjectID) ([]domain.OrderMessageDB, error) {
+	coll := s.db.Collection("order_messages")
+
+	opts := options.Find().SetSort(bson.D{{"created_at", 1}, {"_id", 1}})
+	cursor, err := coll.Find(ctx, bson.M{"order_id": orderId}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]domain.OrderMessageDB, 0)
+	if err = cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (s *MongoOrderMessage) CreateMessage(ctx context.Context, message *domain.OrderMessageDB) (string, error) {
+	coll := s.db.Collection("order_messages")
+
+	message.ID = primitive.NewObjectID()
+	message.CreatedAt = time.Now().UTC()
+	message.ReadAt = nil
+	if message.PhotoIDs == nil {
+		message.PhotoIDs = make([]primitive.ObjectID, 0)
+	}
+
+	result, err := coll.InsertOne(ctx, message)
+	if err != nil {
+		return "", err
+	}
+	return result.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+func (s *MongoOrderMessage) MarkMessagesRead(ctx context.Context, orderId primitive.ObjectID, reader domain.MessageAuthor) (int64, error) {
+	coll := s.db.Collection("order_messages")
+
+	filter := bson.M{
+		"order_id": orderId,
+		"author":   bson.M{"$ne": reader},
+		"read_at":  bson.M{"$exists": false},
+	}
+	update := bson.M{"$set": bson.M{"read_at": time.Now().UTC()}}
+
+	result, err := coll.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (s *MongoOrderMessage) DeleteMessages(ctx context.Context, orderId primitive.ObjectID) error {
+	coll := s.db.Collection("order_messages")
+
+	_, err := coll.DeleteMany(ctx, bson.M{"order_id": orderId})
+	return err
+}
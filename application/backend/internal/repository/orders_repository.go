@@ -8,6 +8,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
 	"time"
 )
 
@@ -16,39 +17,34 @@ type MongoOrder struct {
 }
 
 func NewMongoOrder(db *mongo.Database) *MongoOrder {
-	return &MongoOrder{
-		db: db,
-	}
-}
+	collection := db.Collection("orders")
 
-func (s *MongoOrder) OrderExists(ctx context.Context, orderId primitive.ObjectID, userId string) (bool, error) {
-	// Check if order exists and belongs to a gallery owned by the user
-	pipeline := []bson.M{
-		{"$match": bson.M{"_id": orderId}},
-		{"$lookup": bson.M{
-			"from":         "galleries",
-			"localField":   "gallery_id",
-			"foreignField": "_id",
-			"as":           "gallery",
-		}},
-		{"$unwind": "$gallery"},
-		{"$match": bson.M{"gallery.userId": userId}},
-		{"$limit": 1},
+	indexModels := []mongo.IndexModel{
+		{Keys: bson.D{{"workspace_id", 1}, {"created_at", -1}, {"_id", -1}}},
+		{Keys: bson.D{{"gallery_id", 1}}},
 	}
 
-	coll := s.db.Collection("orders")
-	cursor, err := coll.Aggregate(ctx, pipeline)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, indexModels)
 	if err != nil {
-		return false, err
+		panic(err)
 	}
-	defer cursor.Close(ctx)
 
-	return cursor.Next(ctx), nil
+	s := &MongoOrder{
+		db: db,
+	}
+	if err := s.backfillOwners(ctx); err != nil {
+		panic(err)
+	}
+	return s
 }
 
-func (s *MongoOrder) GetOrders(ctx context.Context, userId string) ([]domain.OrderDB, error) {
-	// Get all orders for galleries owned by the user
+// backfillOwners denormalises the gallery owner and collection onto orders created before they were stored on the order
+func (s *MongoOrder) backfillOwners(ctx context.Context) error {
 	pipeline := []bson.M{
+		{"$match": bson.M{"user_id": bson.M{"$exists": false}}},
 		{"$lookup": bson.M{
 			"from":         "galleries",
 			"localField":   "gallery_id",
@@ -56,82 +52,132 @@ func (s *MongoOrder) GetOrders(ctx context.Context, userId string) ([]domain.Ord
 			"as":           "gallery",
 		}},
 		{"$unwind": "$gallery"},
-		{"$match": bson.M{"gallery.userId": userId}},
 		{"$project": bson.M{
-			"gallery": 0, // Remove gallery data from result
+			"user_id":       "$gallery.userId",
+			"collection_id": "$gallery.collectionId",
 		}},
-		{"$sort": bson.M{"created_at": -1}}, // Most recent first
 	}
 
 	coll := s.db.Collection("orders")
 	cursor, err := coll.Aggregate(ctx, pipeline)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer cursor.Close(ctx)
 
-	var orders []domain.OrderDB
-	if err = cursor.All(ctx, &orders); err != nil {
-		return nil, err
+	for cursor.Next(ctx) {
+		var owner struct {
+			ID           primitive.ObjectID `bson:"_id"`
+			UserId       string             `bson:"user_id"`
+			CollectionID primitive.ObjectID `bson:"collection_id"`
+		}
+		if err := cursor.Decode(&owner); err != nil {
+			return err
+		}
+		_, err := coll.UpdateByID(ctx, owner.ID, bson.D{
+			{"$set", bson.D{
+				{"user_id", owner.UserId},
+				{"collection_id", owner.CollectionID},
+			}},
+		})
+		if err != nil {
+			return err
+		}
 	}
+	return cursor.Err()
+}
 
-	return orders, nil
+func (s *MongoOrder) OrderExists(ctx context.Context, orderId primitive.ObjectID, workspaceId primitive.ObjectID) (bool, error) {
+	coll := s.db.Collection("orders")
+
+	count, err := coll.CountDocuments(ctx, bson.M{"_id": orderId, "workspace_id": workspaceId}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
 }
 
-func (s *MongoOrder) GetOrder(ctx context.Context, orderId primitive.ObjectID, userId string) (domain.OrderDB, error) {
-	// Get order only if it belongs to a gallery owned by the user
-	pipeline := []bson.M{
-		{"$match": bson.M{"_id": orderId}},
-		{"$lookup": bson.M{
-			"from":         "galleries",
-			"localField":   "gallery_id",
-			"foreignField": "_id",
-			"as":           "gallery",
-		}},
-		{"$unwind": "$gallery"},
-		{"$match": bson.M{"gallery.userId": userId}},
-		{"$project": bson.M{
-			"gallery": 0, // Remove gallery data from result
-		}},
+func (s *MongoOrder) GetOrders(ctx context.Context, workspaceId primitive.ObjectID, filter domain.OrderFilter) (domain.OrderPage, error) {
+	conditions := bson.A{bson.M{"workspace_id": workspaceId}}
+
+	if filter.Status != "" {
+		conditions = append(conditions, bson.M{"status": filter.Status})
+	}
+	if !filter.GalleryID.IsZero() {
+		conditions = append(conditions, bson.M{"gallery_id": filter.GalleryID})
+	}
+	if !filter.CollectionID.IsZero() {
+		conditions = append(conditions, bson.M{"collection_id": filter.CollectionID})
+	}
+	if filter.ClientEmail != "" {
+		conditions = append(conditions, bson.M{"client_email": primitive.Regex{
+			Pattern: "^" + regexp.QuoteMeta(filter.ClientEmail) + "$",
+			Options: "i",
+		}})
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, bson.M{"created_at": bson.M{"$gte": filter.From}})
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, bson.M{"created_at": bson.M{"$lt": filter.To}})
+	}
+	if filter.Query != "" {
+		conditions = append(conditions, bson.M{"comment": primitive.Regex{
+			Pattern: regexp.QuoteMeta(filter.Query),
+			Options: "i",
+		}})
+	}
+	if filter.Cursor != nil {
+		conditions = append(conditions, afterCursor("created_at", *filter.Cursor, true))
+	}
+
+	// Most recent first, one extra document tells if there is a next page
+	opts := options.Find().SetSort(bson.D{{"created_at", -1}, {"_id", -1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(filter.Limit + 1)
 	}
 
 	coll := s.db.Collection("orders")
-	cursor, err := coll.Aggregate(ctx, pipeline)
+	cursor, err := coll.Find(ctx, bson.M{"$and": conditions}, opts)
 	if err != nil {
-		return domain.OrderDB{}, err
+		return domain.OrderPage{}, err
 	}
-	defer cursor.Close(ctx)
 
-	var order domain.OrderDB
-	if cursor.Next(ctx) {
-		if err := cursor.Decode(&order); err != nil {
-			return domain.OrderDB{}, err
-		}
-		return order, nil
+	orders := make([]domain.OrderDB, 0)
+	if err = cursor.All(ctx, &orders); err != nil {
+		return domain.OrderPage{}, err
 	}
 
-	return domain.OrderDB{}, mongo.ErrNoDocuments
+	page := domain.OrderPage{Orders: orders}
+	if filter.Limit > 0 && int64(len(orders)) > filter.Limit {
+		page.Orders = orders[:filter.Limit]
+		last := page.Orders[len(page.Orders)-1]
+		page.NextCursor = &domain.Cursor{Value: last.CreatedAt, ID: last.ID}
+	}
+	return page, nil
 }
 
-func (s *MongoOrder) CreateOrder(ctx context.Context, galleryId primitive.ObjectID, clientEmail, comment string, photoIds []primitive.ObjectID) (string, error) {
-	ordersColl := s.db.Collection("orders")
-	orderID := primitive.NewObjectID()
+func (s *MongoOrder) GetOrder(ctx context.Context, orderId primitive.ObjectID, workspaceId primitive.ObjectID) (domain.OrderDB, error) {
+	coll := s.db.Collection("orders")
 
-	// Convert photo IDs to OrderPhoto structs
-	photos := make([]domain.OrderPhoto, len(photoIds))
-	for i, photoId := range photoIds {
-		photos[i] = domain.OrderPhoto{PhotoID: photoId}
+	var order domain.OrderDB
+	err := coll.FindOne(ctx, bson.M{"_id": orderId, "workspace_id": workspaceId}).Decode(&order)
+	if err != nil {
+		return domain.OrderDB{}, err
 	}
+	return order, nil
+}
+
+func (s *MongoOrder) CreateOrder(ctx context.Context, order *domain.OrderDB) (string, error) {
+	ordersColl := s.db.Collection("orders")
 
-	order := domain.OrderDB{
-		ID:          orderID,
-		GalleryID:   galleryId,
-		ClientEmail: clientEmail,
-		Comment:     comment,
-		Status:      domain.OrderStatusPending,
-		CreatedAt:   time.Now().UTC(),
-		UpdatedAt:   time.Now().UTC(),
-		Photos:      photos,
+	order.ID = primitive.NewObjectID()
+	order.Status = domain.OrderStatusPending
+	order.CreatedAt = time.Now().UTC()
+	order.UpdatedAt = time.Now().UTC()
+	if order.Discounts == nil {
+		order.Discounts = make([]domain.OrderDiscount, 0)
 	}
 
 	_, err := ordersColl.InsertOne(ctx, order)
@@ -139,10 +185,10 @@ func (s *MongoOrder) CreateOrder(ctx context.Context, galleryId primitive.Object
 		return "", err
 	}
 
-	return orderID.Hex(), nil
+	return order.ID.Hex(), nil
 }
 
-func (s *MongoOrder) UpdateOrder(ctx context.Context, orderId primitive.ObjectID, userId string, opts ...domain.OrderUpdateOption) (domain.OrderDB, error) {
+func (s *MongoOrder) UpdateOrder(ctx context.Context, orderId primitive.ObjectID, workspaceId primitive.ObjectID, opts ...domain.OrderUpdateOption) (domain.OrderDB, error) {
 	updateOptions := &domain.OrderUpdateOptions{
 		SetFields: bson.D{},
 	}
@@ -150,17 +196,8 @@ func (s *MongoOrder) UpdateOrder(ctx context.Context, orderId primitive.ObjectID
 		opt(updateOptions)
 	}
 
-	// First verify the order belongs to user's gallery
-	exists, err := s.OrderExists(ctx, orderId, userId)
-	if err != nil {
-		return domain.OrderDB{}, err
-	}
-	if !exists {
-		return domain.OrderDB{}, mongo.ErrNoDocuments
-	}
-
 	coll := s.db.Collection("orders")
-	filter := bson.M{"_id": orderId}
+	filter := bson.M{"_id": orderId, "workspace_id": workspaceId}
 	update := bson.D{
 		{"$set", updateOptions.SetFields},
 		{"$currentDate", bson.D{
@@ -170,23 +207,20 @@ func (s *MongoOrder) UpdateOrder(ctx context.Context, orderId primitive.ObjectID
 
 	findOpts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 	var order domain.OrderDB
-	err = coll.FindOneAndUpdate(ctx, filter, update, findOpts).Decode(&order)
+	err := coll.FindOneAndUpdate(ctx, filter, update, findOpts).Decode(&order)
 	return order, err
 }
 
-func (s *MongoOrder) DeleteOrder(ctx context.Context, orderId primitive.ObjectID, userId string) error {
-	// First verify the order belongs to user's gallery
-	exists, err := s.OrderExists(ctx, orderId, userId)
+func (s *MongoOrder) DeleteOrder(ctx context.Context, orderId primitive.ObjectID, workspaceId primitive.ObjectID) error {
+	coll := s.db.Collection("orders")
+	result, err := coll.DeleteOne(ctx, bson.M{"_id": orderId, "workspace_id": workspaceId})
 	if err != nil {
 		return err
 	}
-	if !exists {
+	if result.DeletedCount == 0 {
 		return mongo.ErrNoDocuments
 	}
-
-	coll := s.db.Collection("orders")
-	_, err = coll.DeleteOne(ctx, bson.M{"_id": orderId})
-	return err
+	return nil
 }
 
 func (s *MongoOrder) OrderExistsForGallery(ctx context.Context, galleryId primitive.ObjectID) (bool, error) {
@@ -202,3 +236,55 @@ func (s *MongoOrder) OrderExistsForGallery(ctx context.Context, galleryId primit
 	return true, nil
 
 }
+
+func (s *MongoOrder) GetOrderByID(ctx context.Context, orderId primitive.ObjectID) (domain.OrderDB, error) {
+	coll := s.db.Collection("orders")
+
+	var order domain.OrderDB
+	err := coll.FindOne(ctx, bson.M{"_id": orderId}).Decode(&order)
+	if err != nil {
+		return domain.OrderDB{}, err
+	}
+	return order, nil
+}
+
+func (s *MongoOrder) StartOrderExport(ctx context.Context, orderId primitive.ObjectID, workspaceId primitive.ObjectID, export domain.OrderExport) error {
+	coll := s.db.Collection("orders")
+
+	filter := bson.D{
+		{"_id", orderId},
+		{"workspace_id", workspaceId},
+		{"export.status", bson.D{{"$ne", domain.OrderExportPending}}},
+	}
+	update := bson.D{
+		{"$set", bson.D{
+			{"export", export},
+		}},
+		{"$currentDate", bson.D{
+			{"updated_at", true},
+		}},
+	}
+	result, err := coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (s *MongoOrder) UpdateOrderExport(ctx context.Context, orderId primitive.ObjectID, export domain.OrderExport) error {
+	coll := s.db.Collection("orders")
+
+	update := bson.D{
+		{"$set", bson.D{
+			{"export", export},
+		}},
+		{"$currentDate", bson.D{
+			{"updated_at", true},
+		}},
+	}
+	_, err := coll.UpdateByID(ctx, orderId, update)
+	return err
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type MongoPhotoComment struct {
+	db *mongo.Database
+}
+
+func NewMongoPhotoComment(db *mongo.Database) *MongoPhotoComment {
+	collection := db.Collection("photo_comments")
+
+	indexModels := []mongo.IndexModel{
+		{Keys: bson.D{{"photoId", 1}, {"createdAt", 1}}},
+		{Keys: bson.D{{"galleryId", 1}, {"createdAt", 1}}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, indexModels)
+	if err != nil {
+		panic(err)
+	}
+
+	return &MongoPhotoComment{
+		db: db,
+	}
+}
+
+func (s *MongoPhotoComment) GetComments(ctx context.Context, photoId primitive.ObjectID) ([]domain.PhotoCommentDB, error) {
+	return s.find(ctx, bson.M{"photoId": photoId})
+}
+
+func (s *MongoPhotoComment) GetGalleryComments(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID) ([]domain.PhotoCommentDB, error) {
+	return s.find(ctx, bson.M{"galleryId": galleryId, "workspaceId": workspaceId})
+}
+
+func (s *MongoPhotoComment) find(ctx context.Context, filter bson.M) ([]domain.PhotoCommentDB, error) {
+	coll := s.db.Collection("photo_comments")
+
+	opts := options.Find().SetSort(bson.D{{"createdAt", 1}, {"_id", 1}})
+	cursor, err := coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	comments := make([]domain.PhotoCommentDB, 0)
+	if err = cursor.All(ctx, &comments); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (s *MongoPhotoComment) GetComment(ctx context.Context, commentId primitive.ObjectID) (domain.PhotoCommentDB, error) {
+	coll := s.db.Collection("photo_comments")
+
+	var comment domain.PhotoCommentDB
+	err := coll.FindOne(ctx, bson.M{"_id": commentId}).Decode(&comment)
+	if err != nil {
+		return domain.PhotoCommentDB{}, err
+	}
+	return comment, nil
+}
+
+func (s *MongoPhotoComment) CreateComment(ctx context.Context, comment *domain.PhotoCommentDB) (string, error) {
+	coll := s.db.Collection("photo_comments")
+
+	comment.ID = primitive.NewObjectID()
+	comment.CreatedAt = time.Now().UTC()
+
+	result, err := coll.InsertOne(ctx, comment)
+	if err != nil {
+		return "", err
+	}
+	return result.InsertedID.(primitive.ObjectID).Hex(), nil
+}
@@ -17,33 +17,133 @@ type MongoPhoto struct {
 }
 
 func NewMongoPhoto(db *mongo.Database) *MongoPhoto {
-	return &MongoPhoto{
+	s := &MongoPhoto{
 		db: db,
 	}
+
+	indexModels := []mongo.IndexModel{
+		{Keys: bson.D{{"galleryId", 1}, {"position", 1}, {"_id", 1}}},
+		{Keys: bson.D{{"galleryId", 1}, {"capturedAt", 1}, {"_id", 1}}},
+		{Keys: bson.D{{"galleryId", 1}, {"originalFilename", 1}, {"_id", 1}}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := db.Collection("photos").Indexes().CreateMany(ctx, indexModels); err != nil {
+		panic(err)
+	}
+	if err := s.backfillFields(ctx); err != nil {
+		panic(err)
+	}
+	return s
 }
 
-func (s *MongoPhoto) GetSharedPhotosByGallery(ctx context.Context, galleryId primitive.ObjectID) ([]domain.PhotoDB, error) {
+// backfillFields sets the ordering and visibility fields on photos uploaded before they were stored
+func (s *MongoPhoto) backfillFields(ctx context.Context) error {
 	coll := s.db.Collection("photos")
 
-	cursor, err := coll.Find(ctx, bson.M{"galleryId": galleryId, "status": domain.Uploaded})
+	filter := bson.M{"$or": bson.A{
+		bson.M{"position": bson.M{"$exists": false}},
+		bson.M{"capturedAt": bson.M{"$exists": false}},
+		bson.M{"visibleToClient": bson.M{"$exists": false}},
+	}}
+	update := mongo.Pipeline{
+		{{"$set", bson.D{
+			{"position", bson.D{{"$ifNull", bson.A{"$position", domain.UnplacedPosition}}}},
+			{"capturedAt", bson.D{{"$ifNull", bson.A{"$capturedAt", "$createdAt"}}}},
+			{"visibleToClient", bson.D{{"$ifNull", bson.A{"$visibleToClient", true}}}},
+		}}},
+	}
+	_, err := coll.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// sharedPhoto matches photos clients can see, photos stored before they could be hidden are visible
+func sharedPhoto(query bson.M) bson.M {
+	query["status"] = domain.Uploaded
+	query["visibleToClient"] = bson.M{"$ne": false}
+	return query
+}
+
+// photoSortField returns the field photos are sorted by, ties are broken by upload order
+func photoSortField(order domain.PhotoSortOrder) string {
+	switch order {
+	case domain.SortManual:
+		return "position"
+	case domain.SortByCapturedAt:
+		return "capturedAt"
+	case domain.SortByFilename:
+		return "originalFilename"
+	default:
+		return "_id"
+	}
+}
+
+// findPhotos returns a page of the photos matching the filter in the requested order
+func (s *MongoPhoto) findPhotos(ctx context.Context, query bson.M, filter domain.PhotoFilter) (domain.PhotoPage, error) {
+	coll := s.db.Collection("photos")
+
+	if filter.SectionID != nil {
+		query["sectionId"] = *filter.SectionID
+	}
+	if filter.VisibleToClient != nil {
+		if *filter.VisibleToClient {
+			query["visibleToClient"] = bson.M{"$ne": false}
+		} else {
+			query["visibleToClient"] = false
+		}
+	}
+	total, err := coll.CountDocuments(ctx, query)
 	if err != nil {
-		return nil, err
+		return domain.PhotoPage{}, err
+	}
+
+	field := photoSortField(filter.Sort)
+	if filter.Cursor != nil {
+		if field == "_id" {
+			query["_id"] = bson.M{"$gt": filter.Cursor.ID}
+		} else {
+			query = bson.M{"$and": bson.A{query, afterCursor(field, *filter.Cursor, false)}}
+		}
+	}
+	opts := options.Find().SetSort(bson.D{{field, 1}, {"_id", 1}})
+	if field == "_id" {
+		opts.SetSort(bson.D{{"_id", 1}})
+	}
+	if filter.Limit > 0 {
+		opts.SetLimit(filter.Limit + 1)
+	}
+
+	cursor, err := coll.Find(ctx, query, opts)
+	if err != nil {
+		return domain.PhotoPage{}, err
 	}
 	defer cursor.Close(ctx)
 
 	photos := make([]domain.PhotoDB, 0)
 	if err = cursor.All(ctx, &photos); err != nil {
-		return nil, err
+		return domain.PhotoPage{}, err
 	}
 
-	return photos, nil
+	page := domain.PhotoPage{Photos: photos, Total: total}
+	if filter.Limit > 0 && int64(len(photos)) > filter.Limit {
+		page.Photos = photos[:filter.Limit]
+		last := page.Photos[len(page.Photos)-1]
+		page.NextCursor = &domain.Cursor{Value: last.SortValue(filter.Sort), ID: last.ID}
+	}
+	return page, nil
+}
+
+func (s *MongoPhoto) GetSharedPhotosByGallery(ctx context.Context, galleryId primitive.ObjectID, filter domain.PhotoFilter) (domain.PhotoPage, error) {
+	return s.findPhotos(ctx, sharedPhoto(bson.M{"galleryId": galleryId}), filter)
 }
 
 func (s *MongoPhoto) GetSharedPhotoById(ctx context.Context, photoId primitive.ObjectID) (domain.PhotoDB, error) {
 	coll := s.db.Collection("photos")
 
 	var photo domain.PhotoDB
-	err := coll.FindOne(ctx, bson.M{"_id": photoId, "status": domain.Uploaded}).Decode(&photo)
+	err := coll.FindOne(ctx, sharedPhoto(bson.M{"_id": photoId})).Decode(&photo)
 	if err != nil {
 		return domain.PhotoDB{}, err
 	}
@@ -67,10 +167,24 @@ func (s *MongoPhoto) VerifyPhotosInGallery(ctx context.Context, galleryId primit
 	return count == int64(len(photoIds)), nil
 }
 
-func (s *MongoPhoto) PhotoExists(ctx context.Context, photoId primitive.ObjectID, userId string) (bool, error) {
+func (s *MongoPhoto) VerifySharedPhotosInGallery(ctx context.Context, galleryId primitive.ObjectID, photoIds []primitive.ObjectID) (bool, error) {
 	coll := s.db.Collection("photos")
 
-	count, err := coll.CountDocuments(ctx, bson.M{"_id": photoId, "userId": userId}, options.Count().SetLimit(1))
+	count, err := coll.CountDocuments(ctx, sharedPhoto(bson.M{
+		"galleryId": galleryId,
+		"_id":       bson.M{"$in": photoIds},
+	}))
+	if err != nil {
+		return false, err
+	}
+
+	return count == int64(len(photoIds)), nil
+}
+
+func (s *MongoPhoto) PhotoExists(ctx context.Context, photoId primitive.ObjectID, workspaceId primitive.ObjectID) (bool, error) {
+	coll := s.db.Collection("photos")
+
+	count, err := coll.CountDocuments(ctx, bson.M{"_id": photoId, "workspaceId": workspaceId}, options.Count().SetLimit(1))
 	if err != nil {
 		return false, err
 	}
@@ -78,50 +192,52 @@ func (s *MongoPhoto) PhotoExists(ctx context.Context, photoId primitive.ObjectID
 	return count > 0, nil
 }
 
-func (s *MongoPhoto) GalleryPhotoCount(ctx context.Context, galleryId primitive.ObjectID, userId string) (int64, error) {
+func (s *MongoPhoto) GalleryPhotoCount(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID) (int64, error) {
 	coll := s.db.Collection("photos")
-	count, err := coll.CountDocuments(ctx, bson.M{"galleryId": galleryId, "userId": userId})
+	count, err := coll.CountDocuments(ctx, bson.M{"galleryId": galleryId, "workspaceId": workspaceId})
 	if err != nil {
 		return 0, err
 	}
 	return count, nil
 }
 
-func (s *MongoPhoto) GetPhotos(ctx context.Context, galleryId primitive.ObjectID, userId string) ([]domain.PhotoDB, error) {
-	coll := s.db.Collection("photos")
-
-	var result []domain.PhotoDB
+func (s *MongoPhoto) GetPhotos(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID, filter domain.PhotoFilter) (domain.PhotoPage, error) {
 	// returns only uploaded and shared
-	cursor, err := coll.Find(ctx, bson.M{
-		"galleryId": galleryId,
-		"status":    bson.D{{"$in", primitive.A{1, 2}}},
-		"userId":    userId,
-	})
+	return s.findPhotos(ctx, bson.M{
+		"galleryId":   galleryId,
+		"status":      bson.D{{"$in", primitive.A{1, 2}}},
+		"workspaceId": workspaceId,
+	}, filter)
+}
 
-	if err != nil {
-		return nil, err
-	}
+func (s *MongoPhoto) GetPhoto(ctx context.Context, photoId primitive.ObjectID, workspaceId primitive.ObjectID) (domain.PhotoDB, error) {
+	coll := s.db.Collection("photos")
 
-	err = cursor.All(ctx, &result)
+	var result domain.PhotoDB
+	err := coll.FindOne(ctx, bson.M{"_id": photoId, "workspaceId": workspaceId}).Decode(&result)
 	if err != nil {
-		return nil, err
+		return domain.PhotoDB{}, err
 	}
+
 	return result, nil
 }
 
-func (s *MongoPhoto) GetPhoto(ctx context.Context, photoId primitive.ObjectID, userId string) (domain.PhotoDB, error) {
+func (s *MongoPhoto) GetPhotosByIds(ctx context.Context, photoIds []primitive.ObjectID, workspaceId primitive.ObjectID) ([]domain.PhotoDB, error) {
 	coll := s.db.Collection("photos")
 
-	var result domain.PhotoDB
-	err := coll.FindOne(ctx, bson.M{"_id": photoId, "userId": userId}).Decode(&result)
+	cursor, err := coll.Find(ctx, bson.M{"_id": bson.M{"$in": photoIds}, "workspaceId": workspaceId})
 	if err != nil {
-		return domain.PhotoDB{}, err
+		return nil, err
 	}
 
-	return result, nil
+	photos := make([]domain.PhotoDB, 0)
+	if err = cursor.All(ctx, &photos); err != nil {
+		return nil, err
+	}
+	return photos, nil
 }
 
-func (s *MongoPhoto) CreatePhoto(ctx context.Context, collectionId primitive.ObjectID, galleryId primitive.ObjectID, originalFilename string, userId string) (primitive.ObjectID, error) {
+func (s *MongoPhoto) CreatePhoto(ctx context.Context, collectionId primitive.ObjectID, galleryId primitive.ObjectID, originalFilename string, workspaceId primitive.ObjectID, userId string) (primitive.ObjectID, error) {
 
 	coll := s.db.Collection("photos")
 	photoId := primitive.NewObjectID()
@@ -135,6 +251,7 @@ func (s *MongoPhoto) CreatePhoto(ctx context.Context, collectionId primitive.Obj
 		{"collectionId", collectionId},
 		{"galleryId", galleryId},
 		{"userId", userId},
+		{"workspaceId", workspaceId},
 		{"originalFilename", originalFilename},
 		{"createdAt", primitive.NewDateTimeFromTime(time.Now().UTC())},
 		{"updatedAt", primitive.NewDateTimeFromTime(time.Now().UTC())},
@@ -142,6 +259,9 @@ func (s *MongoPhoto) CreatePhoto(ctx context.Context, collectionId primitive.Obj
 		{"objectKey", path.Join(collectionId.Hex(), galleryId.Hex(), "photos", photoId.Hex()+ext)},
 		{"clientObjectKey", path.Join(collectionId.Hex(), galleryId.Hex(), "photos_client", photoId.Hex()+ext)},
 		{"thumbnailObjectKey", path.Join(collectionId.Hex(), galleryId.Hex(), "photos_client", photoId.Hex()+"_thumbnail"+ext)},
+		{"position", domain.UnplacedPosition},
+		{"capturedAt", primitive.NewDateTimeFromTime(time.Now().UTC())},
+		{"visibleToClient", true},
 	}
 	_, err := coll.InsertOne(ctx, photo)
 	if err != nil {
@@ -151,33 +271,45 @@ func (s *MongoPhoto) CreatePhoto(ctx context.Context, collectionId primitive.Obj
 	return photoId, nil
 }
 
-func (s *MongoPhoto) CreatePhotos(ctx context.Context, collectionId primitive.ObjectID, galleryId primitive.ObjectID, originalFilenames []string, userId string) ([]primitive.ObjectID, error) {
+// newPhotoDocument builds the document of a photo about to be uploaded
+func newPhotoDocument(photoId primitive.ObjectID, collectionId primitive.ObjectID, galleryId primitive.ObjectID, newPhoto domain.NewPhoto, workspaceId primitive.ObjectID, userId string) bson.D {
+	filename := newPhoto.OriginalFilename
+	capturedAt := newPhoto.CapturedAt
+	if capturedAt.IsZero() {
+		capturedAt = time.Now().UTC()
+	}
+	ext := filepath.Ext(filename)
+	if ext == "" {
+		ext = ".jpg"
+	}
+	return bson.D{
+		{"_id", photoId},
+		{"collectionId", collectionId},
+		{"galleryId", galleryId},
+		{"userId", userId},
+		{"workspaceId", workspaceId},
+		{"originalFilename", filename},
+		{"createdAt", primitive.NewDateTimeFromTime(time.Now().UTC())},
+		{"updatedAt", primitive.NewDateTimeFromTime(time.Now().UTC())},
+		{"status", domain.PhotoStatus(0)},
+		{"objectKey", path.Join(collectionId.Hex(), galleryId.Hex(), "photos", photoId.Hex()+ext)},
+		{"clientObjectKey", path.Join(collectionId.Hex(), galleryId.Hex(), "photos_client", photoId.Hex()+ext)},
+		{"thumbnailObjectKey", path.Join(collectionId.Hex(), galleryId.Hex(), "photos_client", photoId.Hex()+"_thumbnail"+ext)},
+		{"position", domain.UnplacedPosition},
+		{"capturedAt", primitive.NewDateTimeFromTime(capturedAt.UTC())},
+		{"visibleToClient", true},
+	}
+}
+
+func (s *MongoPhoto) CreatePhotos(ctx context.Context, collectionId primitive.ObjectID, galleryId primitive.ObjectID, photos []domain.NewPhoto, workspaceId primitive.ObjectID, userId string) ([]primitive.ObjectID, error) {
 
 	coll := s.db.Collection("photos")
 
-	photoIds := make([]primitive.ObjectID, len(originalFilenames))
-	documents := make([]interface{}, len(originalFilenames))
-	for i, filename := range originalFilenames {
-		photoId := primitive.NewObjectID()
-		ext := filepath.Ext(filename)
-		if ext == "" {
-			ext = ".jpg"
-		}
-		photo := bson.D{
-			{"_id", photoId},
-			{"collectionId", collectionId},
-			{"galleryId", galleryId},
-			{"userId", userId},
-			{"originalFilename", filename},
-			{"createdAt", primitive.NewDateTimeFromTime(time.Now().UTC())},
-			{"updatedAt", primitive.NewDateTimeFromTime(time.Now().UTC())},
-			{"status", domain.PhotoStatus(0)},
-			{"objectKey", path.Join(collectionId.Hex(), galleryId.Hex(), "photos", photoId.Hex()+ext)},
-			{"clientObjectKey", path.Join(collectionId.Hex(), galleryId.Hex(), "photos_client", photoId.Hex()+ext)},
-			{"thumbnailObjectKey", path.Join(collectionId.Hex(), galleryId.Hex(), "photos_client", photoId.Hex()+"_thumbnail"+ext)},
-		}
-		documents[i] = photo
-		photoIds[i] = photoId
+	photoIds := make([]primitive.ObjectID, len(photos))
+	documents := make([]interface{}, len(photos))
+	for i, newPhoto := range photos {
+		photoIds[i] = primitive.NewObjectID()
+		documents[i] = newPhotoDocument(photoIds[i], collectionId, galleryId, newPhoto, workspaceId, userId)
 	}
 
 	_, err := coll.InsertMany(ctx, documents)
@@ -188,9 +320,9 @@ func (s *MongoPhoto) CreatePhotos(ctx context.Context, collectionId primitive.Ob
 	return photoIds, nil
 }
 
-func (s *MongoPhoto) SoftDeletePhoto(ctx context.Context, photoId primitive.ObjectID, userId string) error {
+func (s *MongoPhoto) SoftDeletePhoto(ctx context.Context, photoId primitive.ObjectID, workspaceId primitive.ObjectID) error {
 	coll := s.db.Collection("photos")
-	filter := bson.M{"_id": photoId, "userId": userId}
+	filter := bson.M{"_id": photoId, "workspaceId": workspaceId}
 	update := bson.D{
 		{"$set", bson.D{
 			{"status", domain.PhotoStatus(3)},
@@ -203,22 +335,22 @@ func (s *MongoPhoto) SoftDeletePhoto(ctx context.Context, photoId primitive.Obje
 	return coll.FindOneAndUpdate(ctx, filter, update, opts).Err()
 }
 
-func (s *MongoPhoto) DeletePhoto(ctx context.Context, photoId primitive.ObjectID, userId string) error {
+func (s *MongoPhoto) DeletePhoto(ctx context.Context, photoId primitive.ObjectID, workspaceId primitive.ObjectID) error {
 	coll := s.db.Collection("photos")
-	_, err := coll.DeleteOne(ctx, bson.M{"_id": photoId, "userId": userId})
+	_, err := coll.DeleteOne(ctx, bson.M{"_id": photoId, "workspaceId": workspaceId})
 	return err
 }
 
-func (s *MongoPhoto) DeletePhotos(ctx context.Context, photoIds []primitive.ObjectID, userId string) error {
+func (s *MongoPhoto) DeletePhotos(ctx context.Context, photoIds []primitive.ObjectID, workspaceId primitive.ObjectID) error {
 	coll := s.db.Collection("photos")
-	filter := bson.M{"_id": bson.M{"$in": photoIds}, "userId": userId}
+	filter := bson.M{"_id": bson.M{"$in": photoIds}, "workspaceId": workspaceId}
 	_, err := coll.DeleteMany(ctx, filter)
 	return err
 }
 
-func (s *MongoPhoto) UpdatePhoto(ctx context.Context, photoId primitive.ObjectID, status domain.PhotoStatus, userId string) (domain.PhotoDB, error) {
+func (s *MongoPhoto) UpdatePhoto(ctx context.Context, photoId primitive.ObjectID, status domain.PhotoStatus, workspaceId primitive.ObjectID) (domain.PhotoDB, error) {
 	coll := s.db.Collection("photos")
-	filter := bson.M{"_id": photoId, "userId": userId}
+	filter := bson.M{"_id": photoId, "workspaceId": workspaceId}
 	update := bson.D{
 		{"$set", bson.D{
 			{"status", status},
@@ -232,3 +364,64 @@ func (s *MongoPhoto) UpdatePhoto(ctx context.Context, photoId primitive.ObjectID
 	err := coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&photo)
 	return photo, err
 }
+
+func (s *MongoPhoto) ReorderPhotos(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID, photoIds []primitive.ObjectID) error {
+	coll := s.db.Collection("photos")
+
+	models := make([]mongo.WriteModel, 0, len(photoIds)+1)
+	// Photos left out of the new order go after the placed ones
+	models = append(models, mongo.NewUpdateManyModel().
+		SetFilter(bson.M{"galleryId": galleryId, "workspaceId": workspaceId, "_id": bson.M{"$nin": photoIds}}).
+		SetUpdate(bson.M{"$set": bson.M{"position": domain.UnplacedPosition}}))
+	for i, photoId := range photoIds {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": photoId, "galleryId": galleryId, "workspaceId": workspaceId}).
+			SetUpdate(bson.M{"$set": bson.M{"position": int64(i)}}))
+	}
+
+	_, err := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (s *MongoPhoto) AssignSection(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID, photoIds []primitive.ObjectID, sectionId *primitive.ObjectID) (int64, error) {
+	coll := s.db.Collection("photos")
+
+	filter := bson.M{"_id": bson.M{"$in": photoIds}, "galleryId": galleryId, "workspaceId": workspaceId}
+	update := bson.M{"$unset": bson.M{"sectionId": ""}}
+	if sectionId != nil {
+		update = bson.M{"$set": bson.M{"sectionId": *sectionId}}
+	}
+
+	result, err := coll.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.MatchedCount, nil
+}
+
+func (s *MongoPhoto) ClearSections(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID, keep []primitive.ObjectID) error {
+	coll := s.db.Collection("photos")
+
+	filter := bson.M{
+		"galleryId":   galleryId,
+		"workspaceId": workspaceId,
+		"sectionId":   bson.M{"$exists": true, "$nin": keep},
+	}
+	_, err := coll.UpdateMany(ctx, filter, bson.M{"$unset": bson.M{"sectionId": ""}})
+	return err
+}
+
+func (s *MongoPhoto) SetPhotosVisibility(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID, photoIds []primitive.ObjectID, visible bool) (int64, error) {
+	coll := s.db.Collection("photos")
+
+	filter := bson.M{"_id": bson.M{"$in": photoIds}, "galleryId": galleryId, "workspaceId": workspaceId}
+	update := bson.D{
+		{"$set", bson.D{{"visibleToClient", visible}}},
+		{"$currentDate", bson.D{{"updatedAt", true}}},
+	}
+	result, err := coll.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.MatchedCount, nil
+}
@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+func TestNewPhotoDocument(t *testing.T) {
+	photoId, collectionId, galleryId, workspaceId := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	doc := newPhotoDocument(photoId, collectionId, galleryId, domain.NewPhoto{OriginalFilename: "IMG_0001"}, workspaceId, "user")
+
+	fields := make(map[string]interface{}, len(doc))
+	for _, field := range doc {
+		if _, ok := fields[field.Key]; ok {
+			t.Errorf("Duplicate field %q", field.Key)
+		}
+		fields[field.Key] = field.Value
+	}
+	if got := fields["workspaceId"]; got != workspaceId {
+		t.Errorf("Expected workspaceId %s, got %v", workspaceId.Hex(), got)
+	}
+	want := collectionId.Hex() + "/" + galleryId.Hex() + "/photos/" + photoId.Hex() + ".jpg"
+	if got := fields["objectKey"]; got != want {
+		t.Errorf("Expected objectKey %s, got %v", want, got)
+	}
+}
@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type MongoPushSubscription struct {
+	db *mongo.Database
+}
+
+func NewMongoPushSubscription(db *mongo.Database) *MongoPushSubscription {
+	collection := db.Collection("push_subscriptions")
+
+	indexModels := []mongo.IndexModel{
+		{Keys: bson.D{{"token", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{"userId", 1}, {"lastSeenAt", -1}}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, indexModels)
+	if err != nil {
+		panic(err)
+	}
+
+	return &MongoPushSubscription{
+		db: db,
+	}
+}
+
+func (s *MongoPushSubscription) GetPushSubscriptions(ctx context.Context, userId string) ([]domain.PushSubscriptionDB, error) {
+	coll := s.db.Collection("push_subscriptions")
+
+	opts := options.Find().SetSort(bson.D{{"lastSeenAt", -1}})
+	cursor, err := coll.Find(ctx, bson.M{"userId": userId}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := make([]domain.PushSubscriptionDB, 0)
+	if err = cursor.All(ctx, &subscriptions); err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+func (s *MongoPushSubscription) GetPushTokens(ctx context.Context, userIds []string) ([]string, error) {
+	coll := s.db.Collection("push_subscriptions")
+
+	opts := options.Find().SetProjection(bson.M{"token": 1})
+	cursor, err := coll.Find(ctx, bson.M{"userId": bson.M{"$in": userIds}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var subscriptions []domain.PushSubscriptionDB
+	if err = cursor.All(ctx, &subscriptions); err != nil {
+		return nil, err
+	}
+	tokens := make([]string, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		tokens = append(tokens, subscription.Token)
+	}
+	return tokens, nil
+}
+
+func (s *MongoPushSubscription) SavePushSubscription(ctx context.Context, subscription *domain.PushSubscriptionDB) error {
+	coll := s.db.Collection("push_subscriptions")
+
+	now := time.Now().UTC()
+	filter := bson.M{"token": subscription.Token}
+	update := bson.M{
+		"$set": bson.M{
+			"userId":     subscription.UserId,
+			"device":     subscription.Device,
+			"lastSeenAt": now,
+		},
+		"$setOnInsert": bson.M{
+			"_id":       primitive.NewObjectID(),
+			"createdAt": now,
+		},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	err := coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(subscription)
+	if mongo.IsDuplicateKeyError(err) {
+		// a concurrent subscription of the same token inserted it first, update that one
+		err = coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(subscription)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.pruneSubscriptions(ctx, subscription.UserId)
+}
+
+// pruneSubscriptions removes the devices seen least recently above MaxPushSubscriptions
+func (s *MongoPushSubscription) pruneSubscriptions(ctx context.Context, userId string) error {
+	coll := s.db.Collection("push_subscriptions")
+
+	opts := options.Find().
+		SetSort(bson.D{{"lastSeenAt", -1}}).
+		SetSkip(domain.MaxPushSubscriptions).
+		SetProjection(bson.M{"_id": 1})
+	cursor, err := coll.Find(ctx, bson.M{"userId": userId}, opts)
+	if err != nil {
+		return err
+	}
+
+	var stale []domain.PushSubscriptionDB
+	if err = cursor.All(ctx, &stale); err != nil {
+		return err
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	ids := make([]primitive.ObjectID, 0, len(stale))
+	for _, subscription := range stale {
+		ids = append(ids, subscription.ID)
+	}
+	_, err = coll.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	return err
+}
+
+func (s *MongoPushSubscription) DeletePushSubscription(ctx context.Context, subscriptionId primitive.ObjectID, userId string) error {
+	coll := s.db.Collection("push_subscriptions")
+
+	result, err := coll.DeleteOne(ctx, bson.M{"_id": subscriptionId, "userId": userId})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (s *MongoPushSubscription) DeletePushSubscriptionByToken(ctx context.Context, token string, userId string) error {
+	coll := s.db.Collection("push_subscriptions")
+
+	result, err := coll.DeleteOne(ctx, bson.M{"token": token, "userId": userId})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (s *MongoPushSubscription) DeletePushTokens(ctx context.Context, tokens []string) error {
+	coll := s.db.Collection("push_subscriptions")
+
+	_, err := coll.DeleteMany(ctx, bson.M{"token": bson.M{"$in": tokens}})
+	return err
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// redisStorageTimeout bounds the calls of fiber middleware, which passes no request context to its storage
+const redisStorageTimeout = 2 * time.Second
+
+// RedisStorage is a fiber.Storage keeping the state of fiber middleware, like the rate limiter counters, in Redis so
+// it is shared by all api instances and survives restarts. Keys are stored under the prefix.
+type RedisStorage struct {
+	rdb    *redis.Client
+	prefix string
+}
+
+func NewRedisStorage(rdb *redis.Client, prefix string) *RedisStorage {
+	return &RedisStorage{
+		rdb:    rdb,
+		prefix: prefix,
+	}
+}
+
+// Get returns nil without an error for missing keys, as fiber.Storage requires
+func (s *RedisStorage) Get(key string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisStorageTimeout)
+	defer cancel()
+
+	value, err := s.rdb.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return value, err
+}
+
+// Set stores the value without expiration when exp is 0
+func (s *RedisStorage) Set(key string, val []byte, exp time.Duration) error {
+	if key == "" || len(val) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisStorageTimeout)
+	defer cancel()
+
+	return s.rdb.Set(ctx, s.prefix+key, val, exp).Err()
+}
+
+func (s *RedisStorage) Delete(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisStorageTimeout)
+	defer cancel()
+
+	return s.rdb.Del(ctx, s.prefix+key).Err()
+}
+
+// Reset deletes the keys under the prefix only, the Redis database is shared with the rest of the app
+func (s *RedisStorage) Reset() error {
+	ctx := context.Background()
+	iter := s.rdb.Scan(ctx, 0, s.prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		if err := s.rdb.Del(ctx, iter.Val()).Err(); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+// Close leaves the client open, it is owned by the app
+func (s *RedisStorage) Close() error {
+	return nil
+}
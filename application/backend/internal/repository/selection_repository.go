@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type MongoSelection struct {
+	db *mongo.Database
+}
+
+func NewMongoSelection(db *mongo.Database) *MongoSelection {
+	collection := db.Collection("selections")
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{"galleryId", 1}, {"clientEmail", 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, indexModel)
+	if err != nil {
+		panic(err)
+	}
+
+	return &MongoSelection{
+		db: db,
+	}
+}
+
+func (s *MongoSelection) GetSelections(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID) ([]domain.SelectionDB, error) {
+	coll := s.db.Collection("selections")
+
+	opts := options.Find().SetSort(bson.D{{"updatedAt", -1}})
+	cursor, err := coll.Find(ctx, bson.M{"galleryId": galleryId, "workspaceId": workspaceId}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	selections := make([]domain.SelectionDB, 0)
+	if err = cursor.All(ctx, &selections); err != nil {
+		return nil, err
+	}
+	return selections, nil
+}
+
+func (s *MongoSelection) GetSelection(ctx context.Context, galleryId primitive.ObjectID, clientEmail string) (domain.SelectionDB, error) {
+	coll := s.db.Collection("selections")
+
+	var selection domain.SelectionDB
+	err := coll.FindOne(ctx, bson.M{"galleryId": galleryId, "clientEmail": clientEmail}).Decode(&selection)
+	if err != nil {
+		return domain.SelectionDB{}, err
+	}
+	return selection, nil
+}
+
+func (s *MongoSelection) AddPhoto(ctx context.Context, gallery domain.GalleryDB, clientEmail string, photoId primitive.ObjectID) (domain.SelectionDB, error) {
+	coll := s.db.Collection("selections")
+
+	filter := bson.M{
+		"galleryId":   gallery.ID,
+		"clientEmail": clientEmail,
+		"submittedAt": bson.M{"$exists": false},
+	}
+	// Adding a photo that is already selected is always allowed, the limit only applies to new ones
+	if max := gallery.Proofing.MaxSelection; max > 0 {
+		filter["$or"] = bson.A{
+			bson.M{"photoIds": photoId},
+			bson.M{"$expr": bson.M{"$lt": bson.A{bson.M{"$size": "$photoIds"}, max}}},
+		}
+	}
+
+	now := time.Now().UTC()
+	update := bson.M{
+		"$addToSet":    bson.M{"photoIds": photoId},
+		"$set":         bson.M{"updatedAt": now},
+		"$setOnInsert": bson.M{"_id": primitive.NewObjectID(), "userId": gallery.UserId, "workspaceId": gallery.WorkspaceID, "createdAt": now},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var selection domain.SelectionDB
+	err := coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&selection)
+	if mongo.IsDuplicateKeyError(err) {
+		// The selection exists but did not match the filter, it is either submitted or full
+		return domain.SelectionDB{}, s.lockedReason(ctx, gallery.ID, clientEmail, domain.ErrSelectionLimitReached)
+	}
+	if err != nil {
+		return domain.SelectionDB{}, err
+	}
+	return selection, nil
+}
+
+func (s *MongoSelection) RemovePhoto(ctx context.Context, galleryId primitive.ObjectID, clientEmail string, photoId primitive.ObjectID) (domain.SelectionDB, error) {
+	coll := s.db.Collection("selections")
+
+	filter := bson.M{
+		"galleryId":   galleryId,
+		"clientEmail": clientEmail,
+		"submittedAt": bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$pull": bson.M{"photoIds": photoId},
+		"$set":  bson.M{"updatedAt": time.Now().UTC()},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var selection domain.SelectionDB
+	err := coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&selection)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return domain.SelectionDB{}, s.lockedReason(ctx, galleryId, clientEmail, mongo.ErrNoDocuments)
+	}
+	if err != nil {
+		return domain.SelectionDB{}, err
+	}
+	return selection, nil
+}
+
+func (s *MongoSelection) SubmitSelection(ctx context.Context, galleryId primitive.ObjectID, clientEmail string) (domain.SelectionDB, error) {
+	coll := s.db.Collection("selections")
+
+	filter := bson.M{
+		"galleryId":   galleryId,
+		"clientEmail": clientEmail,
+		"submittedAt": bson.M{"$exists": false},
+	}
+	now := time.Now().UTC()
+	update := bson.M{"$set": bson.M{"submittedAt": now, "updatedAt": now}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var selection domain.SelectionDB
+	err := coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&selection)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return domain.SelectionDB{}, s.lockedReason(ctx, galleryId, clientEmail, mongo.ErrNoDocuments)
+	}
+	if err != nil {
+		return domain.SelectionDB{}, err
+	}
+	return selection, nil
+}
+
+// lockedReason returns ErrSelectionSubmitted if the selection was submitted and fallback otherwise
+func (s *MongoSelection) lockedReason(ctx context.Context, galleryId primitive.ObjectID, clientEmail string, fallback error) error {
+	selection, err := s.GetSelection(ctx, galleryId, clientEmail)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+	if selection.SubmittedAt != nil {
+		return domain.ErrSelectionSubmitted
+	}
+	return fallback
+}
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type MongoShareLink struct {
+	db *mongo.Database
+}
+
+func NewMongoShareLink(db *mongo.Database) *MongoShareLink {
+	collection := db.Collection("share_links")
+
+	indexModels := []mongo.IndexModel{
+		{Keys: bson.D{{"token", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{"galleryId", 1}, {"createdAt", -1}}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, indexModels)
+	if err != nil {
+		panic(err)
+	}
+
+	return &MongoShareLink{
+		db: db,
+	}
+}
+
+func (s *MongoShareLink) GetShareLinks(ctx context.Context, galleryId primitive.ObjectID, workspaceId primitive.ObjectID) ([]domain.ShareLinkDB, error) {
+	coll := s.db.Collection("share_links")
+
+	opts := options.Find().SetSort(bson.D{{"createdAt", -1}})
+	cursor, err := coll.Find(ctx, bson.M{"galleryId": galleryId, "workspaceId": workspaceId}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	links := make([]domain.ShareLinkDB, 0)
+	if err = cursor.All(ctx, &links); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+func (s *MongoShareLink) GetShareLink(ctx context.Context, linkId primitive.ObjectID, workspaceId primitive.ObjectID) (domain.ShareLinkDB, error) {
+	coll := s.db.Collection("share_links")
+
+	var link domain.ShareLinkDB
+	err := coll.FindOne(ctx, bson.M{"_id": linkId, "workspaceId": workspaceId}).Decode(&link)
+	if err != nil {
+		return domain.ShareLinkDB{}, err
+	}
+	return link, nil
+}
+
+func (s *MongoShareLink) GetShareLinkByToken(ctx context.Context, token string) (domain.ShareLinkDB, error) {
+	coll := s.db.Collection("share_links")
+
+	var link domain.ShareLinkDB
+	err := coll.FindOne(ctx, bson.M{"token": token}).Decode(&link)
+	if err != nil {
+		return domain.ShareLinkDB{}, err
+	}
+	return link, nil
+}
+
+func (s *MongoShareLink) CreateShareLink(ctx context.Context, link *domain.ShareLinkDB) (string, error) {
+	coll := s.db.Collection("share_links")
+
+	link.ID = primitive.NewObjectID()
+	link.Uses = 0
+	link.Downloads = 0
+	link.RevokedAt = nil
+	link.CreatedAt = time.Now().UTC()
+	link.UpdatedAt = link.CreatedAt
+
+	result, err := coll.InsertOne(ctx, link)
+	if err != nil {
+		return "", err
+	}
+	return result.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+func (s *MongoShareLink) UpdateShareLink(ctx context.Context, linkId primitive.ObjectID, workspaceId primitive.ObjectID, opts ...domain.ShareLinkUpdateOption) (domain.ShareLinkDB, error) {
+	updateOptions := &domain.ShareLinkUpdateOptions{
+		SetFields: bson.D{},
+	}
+	for _, opt := range opts {
+		opt(updateOptions)
+	}
+
+	coll := s.db.Collection("share_links")
+	filter := bson.M{"_id": linkId, "workspaceId": workspaceId}
+	update := bson.D{
+		{"$set", updateOptions.SetFields},
+		{"$currentDate", bson.D{
+			{"updatedAt", true},
+		}},
+	}
+
+	findOpts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var link domain.ShareLinkDB
+	err := coll.FindOneAndUpdate(ctx, filter, update, findOpts).Decode(&link)
+	return link, err
+}
+
+func (s *MongoShareLink) RevokeShareLink(ctx context.Context, linkId primitive.ObjectID, workspaceId primitive.ObjectID) (domain.ShareLinkDB, error) {
+	coll := s.db.Collection("share_links")
+
+	now := time.Now().UTC()
+	filter := bson.M{"_id": linkId, "workspaceId": workspaceId}
+	// Revoking twice keeps the original revocation time
+	update := bson.A{
+		bson.M{"$set": bson.M{
+			"revokedAt": bson.M{"$ifNull": bson.A{"$revokedAt", now}},
+			"updatedAt": now,
+		}},
+	}
+
+	findOpts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var link domain.ShareLinkDB
+	err := coll.FindOneAndUpdate(ctx, filter, update, findOpts).Decode(&link)
+	return link, err
+}
+
+func (s *MongoShareLink) UseShareLink(ctx context.Context, linkId primitive.ObjectID) error {
+	coll := s.db.Collection("share_links")
+
+	filter := bson.M{
+		"_id": linkId,
+		"$or": bson.A{
+			bson.M{"maxUses": 0},
+			bson.M{"$expr": bson.M{"$lt": bson.A{"$uses", "$maxUses"}}},
+		},
+	}
+	update := bson.M{"$inc": bson.M{"uses": 1}}
+
+	result, err := coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrShareLinkExhausted
+	}
+	return nil
+}
+
+func (s *MongoShareLink) CountDownload(ctx context.Context, linkId primitive.ObjectID) error {
+	coll := s.db.Collection("share_links")
+
+	_, err := coll.UpdateByID(ctx, linkId, bson.M{"$inc": bson.M{"downloads": 1}})
+	return err
+}
@@ -0,0 +1,354 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const personalWorkspaceName = "Personal"
+
+// workspaceOwnedCollections maps the collections scoped to a workspace to the fields holding the creator and the
+// workspace of their documents
+var workspaceOwnedCollections = []struct {
+	name           string
+	userField      string
+	workspaceField string
+}{
+	{"collections", "userId", "workspaceId"},
+	{"galleries", "userId", "workspaceId"},
+	{"photos", "userId", "workspaceId"},
+	{"orders", "user_id", "workspace_id"},
+	{"coupons", "userId", "workspaceId"},
+	{"share_links", "userId", "workspaceId"},
+	{"photo_comments", "userId", "workspaceId"},
+	{"selections", "userId", "workspaceId"},
+	{"access_events", "userId", "workspaceId"},
+}
+
+type MongoWorkspace struct {
+	db *mongo.Database
+}
+
+// NewMongoWorkspace has to be created after the repositories of the workspace owned collections, so their own
+// backfills have run before documents are moved to personal workspaces
+func NewMongoWorkspace(db *mongo.Database) *MongoWorkspace {
+	collection := db.Collection("workspaces")
+
+	indexModels := []mongo.IndexModel{
+		{Keys: bson.D{{"members.userId", 1}}},
+		{Keys: bson.D{{"invitations.email", 1}}},
+		{
+			Keys: bson.D{{"personalOwner", 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"personalOwner": bson.M{"$exists": true}}),
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, indexModels)
+	if err != nil {
+		panic(err)
+	}
+
+	s := &MongoWorkspace{
+		db: db,
+	}
+	if err := s.backfillWorkspaces(ctx); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// backfillWorkspaces moves documents created before workspaces existed to the personal workspace of their creator
+func (s *MongoWorkspace) backfillWorkspaces(ctx context.Context) error {
+	for _, owned := range workspaceOwnedCollections {
+		coll := s.db.Collection(owned.name)
+
+		missing := bson.M{owned.workspaceField: bson.M{"$exists": false}}
+		userIds, err := coll.Distinct(ctx, owned.userField, missing)
+		if err != nil {
+			return err
+		}
+		for _, value := range userIds {
+			userId, ok := value.(string)
+			if !ok || userId == "" {
+				continue
+			}
+			workspace, err := s.GetPersonalWorkspace(ctx, userId)
+			if err != nil {
+				return err
+			}
+			filter := bson.M{owned.userField: userId, owned.workspaceField: bson.M{"$exists": false}}
+			update := bson.M{"$set": bson.M{owned.workspaceField: workspace.ID}}
+			if _, err := coll.UpdateMany(ctx, filter, update); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MongoWorkspace) GetWorkspaces(ctx context.Context, userId string) ([]domain.WorkspaceDB, error) {
+	return s.findWorkspaces(ctx, bson.M{"members.userId": userId})
+}
+
+func (s *MongoWorkspace) GetInvitations(ctx context.Context, email string) ([]domain.WorkspaceDB, error) {
+	return s.findWorkspaces(ctx, bson.M{"invitations.email": email})
+}
+
+func (s *MongoWorkspace) findWorkspaces(ctx context.Context, filter bson.M) ([]domain.WorkspaceDB, error) {
+	coll := s.db.Collection("workspaces")
+
+	// The personal workspace is listed first
+	opts := options.Find().SetSort(bson.D{{"personal", -1}, {"createdAt", 1}})
+	cursor, err := coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	workspaces := make([]domain.WorkspaceDB, 0)
+	if err = cursor.All(ctx, &workspaces); err != nil {
+		return nil, err
+	}
+	return workspaces, nil
+}
+
+func (s *MongoWorkspace) GetWorkspace(ctx context.Context, workspaceId primitive.ObjectID, userId string) (domain.WorkspaceDB, error) {
+	coll := s.db.Collection("workspaces")
+
+	var workspace domain.WorkspaceDB
+	err := coll.FindOne(ctx, bson.M{"_id": workspaceId, "members.userId": userId}).Decode(&workspace)
+	if err != nil {
+		return domain.WorkspaceDB{}, err
+	}
+	return workspace, nil
+}
+
+func (s *MongoWorkspace) GetPersonalWorkspace(ctx context.Context, userId string) (domain.WorkspaceDB, error) {
+	coll := s.db.Collection("workspaces")
+
+	now := time.Now().UTC()
+	filter := bson.M{"personalOwner": userId}
+	update := bson.M{"$setOnInsert": bson.M{
+		"name":     personalWorkspaceName,
+		"personal": true,
+		"members": bson.A{domain.WorkspaceMember{
+			UserId:  userId,
+			Role:    domain.RoleOwner,
+			AddedAt: now,
+		}},
+		"invitations": bson.A{},
+		"createdAt":   now,
+		"updatedAt":   now,
+	}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var workspace domain.WorkspaceDB
+	err := coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&workspace)
+	if mongo.IsDuplicateKeyError(err) {
+		// A concurrent request created the workspace first
+		err = coll.FindOne(ctx, filter).Decode(&workspace)
+	}
+	if err != nil {
+		return domain.WorkspaceDB{}, err
+	}
+	return workspace, nil
+}
+
+func (s *MongoWorkspace) CreateWorkspace(ctx context.Context, name, ownerId, ownerEmail string) (domain.WorkspaceDB, error) {
+	coll := s.db.Collection("workspaces")
+
+	now := time.Now().UTC()
+	workspace := domain.WorkspaceDB{
+		ID:   primitive.NewObjectID(),
+		Name: name,
+		Members: []domain.WorkspaceMember{{
+			UserId:  ownerId,
+			Email:   ownerEmail,
+			Role:    domain.RoleOwner,
+			AddedAt: now,
+		}},
+		Invitations: []domain.WorkspaceInvitation{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if _, err := coll.InsertOne(ctx, workspace); err != nil {
+		return domain.WorkspaceDB{}, err
+	}
+	return workspace, nil
+}
+
+func (s *MongoWorkspace) RenameWorkspace(ctx context.Context, workspaceId primitive.ObjectID, name string) (domain.WorkspaceDB, error) {
+	return s.updateWorkspace(ctx, bson.M{"_id": workspaceId}, bson.M{
+		"$set": bson.M{"name": name, "updatedAt": time.Now().UTC()},
+	})
+}
+
+func (s *MongoWorkspace) DeleteWorkspace(ctx context.Context, workspaceId primitive.ObjectID) error {
+	coll := s.db.Collection("workspaces")
+
+	result, err := coll.DeleteOne(ctx, bson.M{"_id": workspaceId, "personal": false})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return domain.ErrPersonalWorkspace
+	}
+	return nil
+}
+
+func (s *MongoWorkspace) InviteMember(ctx context.Context, workspaceId primitive.ObjectID, invitation domain.WorkspaceInvitation) (domain.WorkspaceDB, error) {
+	filter := bson.M{"_id": workspaceId, "personal": false, "members.email": bson.M{"$ne": invitation.Email}}
+	// Inviting an email again replaces its pending invitation
+	update := bson.A{
+		bson.M{"$set": bson.M{
+			"invitations": bson.M{"$concatArrays": bson.A{
+				bson.M{"$filter": bson.M{
+					"input": bson.M{"$ifNull": bson.A{"$invitations", bson.A{}}},
+					"cond":  bson.M{"$ne": bson.A{"$$this.email", invitation.Email}},
+				}},
+				bson.A{invitation},
+			}},
+			"updatedAt": "$$NOW",
+		}},
+	}
+	workspace, err := s.updateWorkspace(ctx, filter, update)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return domain.WorkspaceDB{}, s.explainMiss(ctx, workspaceId, domain.ErrAlreadyMember)
+	}
+	return workspace, err
+}
+
+func (s *MongoWorkspace) CancelInvitation(ctx context.Context, workspaceId primitive.ObjectID, email string) (domain.WorkspaceDB, error) {
+	return s.updateWorkspace(ctx, bson.M{"_id": workspaceId, "invitations.email": email}, bson.M{
+		"$pull": bson.M{"invitations": bson.M{"email": email}},
+		"$set":  bson.M{"updatedAt": time.Now().UTC()},
+	})
+}
+
+func (s *MongoWorkspace) AcceptInvitation(ctx context.Context, workspaceId primitive.ObjectID, email, userId string) (domain.WorkspaceDB, error) {
+	coll := s.db.Collection("workspaces")
+
+	var pending domain.WorkspaceDB
+	err := coll.FindOne(ctx, bson.M{"_id": workspaceId, "invitations.email": email}).Decode(&pending)
+	if err != nil {
+		return domain.WorkspaceDB{}, err
+	}
+	if _, ok := pending.Role(userId); ok {
+		return domain.WorkspaceDB{}, domain.ErrAlreadyMember
+	}
+	var invitation domain.WorkspaceInvitation
+	for _, i := range pending.Invitations {
+		if i.Email == email {
+			invitation = i
+		}
+	}
+
+	// The filter makes sure the invitation was not changed or accepted in the meantime
+	filter := bson.M{
+		"_id":            workspaceId,
+		"invitations":    bson.M{"$elemMatch": bson.M{"email": email, "role": invitation.Role}},
+		"members.userId": bson.M{"$ne": userId},
+	}
+	now := time.Now().UTC()
+	update := bson.M{
+		"$pull": bson.M{"invitations": bson.M{"email": email}},
+		"$push": bson.M{"members": domain.WorkspaceMember{
+			UserId:  userId,
+			Email:   email,
+			Role:    invitation.Role,
+			AddedAt: now,
+		}},
+		"$set": bson.M{"updatedAt": now},
+	}
+	return s.updateWorkspace(ctx, filter, update)
+}
+
+func (s *MongoWorkspace) UpdateMemberRole(ctx context.Context, workspaceId primitive.ObjectID, userId string, role domain.WorkspaceRole) (domain.WorkspaceDB, error) {
+	filter := bson.M{"_id": workspaceId, "members.userId": userId}
+	if role != domain.RoleOwner {
+		filter = withAnotherOwner(filter, userId)
+	}
+	update := bson.M{
+		"$set": bson.M{"members.$[member].role": role, "updatedAt": time.Now().UTC()},
+	}
+	opts := options.FindOneAndUpdate().
+		SetArrayFilters(options.ArrayFilters{Filters: bson.A{bson.M{"member.userId": userId}}}).
+		SetReturnDocument(options.After)
+
+	coll := s.db.Collection("workspaces")
+	var workspace domain.WorkspaceDB
+	err := coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&workspace)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return domain.WorkspaceDB{}, s.explainMemberMiss(ctx, workspaceId, userId)
+	}
+	if err != nil {
+		return domain.WorkspaceDB{}, err
+	}
+	return workspace, nil
+}
+
+func (s *MongoWorkspace) RemoveMember(ctx context.Context, workspaceId primitive.ObjectID, userId string) (domain.WorkspaceDB, error) {
+	filter := withAnotherOwner(bson.M{"_id": workspaceId, "members.userId": userId}, userId)
+	workspace, err := s.updateWorkspace(ctx, filter, bson.M{
+		"$pull": bson.M{"members": bson.M{"userId": userId}},
+		"$set":  bson.M{"updatedAt": time.Now().UTC()},
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return domain.WorkspaceDB{}, s.explainMemberMiss(ctx, workspaceId, userId)
+	}
+	return workspace, err
+}
+
+// withAnotherOwner only matches workspaces with an owner other than the user, so they can not demote or remove the
+// last owner, even when members are changed concurrently
+func withAnotherOwner(filter bson.M, userId string) bson.M {
+	filter["$and"] = bson.A{
+		bson.M{"members": bson.M{"$elemMatch": bson.M{"role": domain.RoleOwner, "userId": bson.M{"$ne": userId}}}},
+	}
+	return filter
+}
+
+func (s *MongoWorkspace) updateWorkspace(ctx context.Context, filter bson.M, update interface{}) (domain.WorkspaceDB, error) {
+	coll := s.db.Collection("workspaces")
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var workspace domain.WorkspaceDB
+	err := coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&workspace)
+	if err != nil {
+		return domain.WorkspaceDB{}, err
+	}
+	return workspace, nil
+}
+
+// explainMiss returns err when the workspace exists but an update did not match it, or mongo.ErrNoDocuments otherwise
+func (s *MongoWorkspace) explainMiss(ctx context.Context, workspaceId primitive.ObjectID, err error) error {
+	count, countErr := s.db.Collection("workspaces").CountDocuments(ctx, bson.M{"_id": workspaceId})
+	if countErr != nil {
+		return countErr
+	}
+	if count == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return err
+}
+
+// explainMemberMiss tells a missing member apart from a change that would leave the workspace without an owner
+func (s *MongoWorkspace) explainMemberMiss(ctx context.Context, workspaceId primitive.ObjectID, userId string) error {
+	count, err := s.db.Collection("workspaces").CountDocuments(ctx, bson.M{"_id": workspaceId, "members.userId": userId})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return domain.ErrLastOwner
+}
@@ -0,0 +1,69 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/michalK00/halftone/internal/domain"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// heartbeatInterval keeps idle connections from being closed by load balancers, which do so after 60s by default
+	heartbeatInterval = 25 * time.Second
+	// sseRetry is how long browsers wait before reconnecting a closed stream, in milliseconds
+	sseRetry = 3000
+)
+
+// WriteSSE writes an event in the text/event-stream format, every line of data gets its own data field
+func WriteSSE(w io.Writer, id, event string, data []byte) error {
+	var b strings.Builder
+	if id != "" {
+		b.WriteString("id: " + id + "\n")
+	}
+	if event != "" {
+		b.WriteString("event: " + event + "\n")
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ServeSSE writes the events until the channel is closed or the client goes away, which shows as a failing flush
+func ServeSSE(w *bufio.Writer, events <-chan domain.Event) {
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", sseRetry); err != nil || w.Flush() != nil {
+		return
+	}
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if err := WriteSSE(w, event.ID.Hex(), string(event.Type), data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package stream
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteSSE(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteSSE(&b, "1", "order.created", []byte("{\n\"a\":1\n}")); err != nil {
+		t.Fatal(err)
+	}
+	want := "id: 1\nevent: order.created\ndata: {\ndata: \"a\":1\ndata: }\n\n"
+	if b.String() != want {
+		t.Errorf("WriteSSE() = %q, want %q", b.String(), want)
+	}
+}
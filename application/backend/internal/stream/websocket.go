@@ -0,0 +1,65 @@
+package stream
+
+import (
+	"encoding/json"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/michalK00/halftone/internal/domain"
+	"time"
+)
+
+const (
+	// maxClientPayload limits the messages read from clients, which have nothing to send on the event stream
+	maxClientPayload = 4096
+	writeTimeout     = 10 * time.Second
+)
+
+// ServeWebSocket writes the events as text messages until the channel is closed or the client goes away. Pings of
+// the client are answered by the connection, it is closed by the websocket handler once this returns.
+func ServeWebSocket(conn *websocket.Conn, events <-chan domain.Event) {
+	conn.SetReadLimit(maxClientPayload)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Reading handles the control frames and returns when the client closes the connection or breaks the protocol
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case event, ok := <-events:
+			if !ok {
+				CloseWebSocket(conn, websocket.CloseNormalClosure)
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if err := conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+				return
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// CloseWebSocket sends the close message with the code, the connection itself is closed by the websocket handler
+func CloseWebSocket(conn *websocket.Conn, code int) {
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(writeTimeout))
+}
@@ -0,0 +1,57 @@
+package stream
+
+import (
+	"errors"
+	fasthttpwebsocket "github.com/fasthttp/websocket"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/michalK00/halftone/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeWebSocket(t *testing.T) {
+	events := make(chan domain.Event, 1)
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/events", websocket.New(func(conn *websocket.Conn) {
+		ServeWebSocket(conn, events)
+	}))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = app.Listener(ln) }()
+	defer func() { _ = app.Shutdown() }()
+
+	conn, _, err := fasthttpwebsocket.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	event, err := domain.NewEvent(domain.EventOrderCreated, primitive.NewObjectID(), map[string]string{"id": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events <- event
+	messageType, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messageType != fasthttpwebsocket.TextMessage || !strings.Contains(string(data), `"order.created"`) {
+		t.Errorf("ReadMessage() = %d %s", messageType, data)
+	}
+
+	// closing the channel ends the stream with a normal close
+	close(events)
+	_, _, err = conn.ReadMessage()
+	var closeErr *fasthttpwebsocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != fasthttpwebsocket.CloseNormalClosure {
+		t.Errorf("ReadMessage() after close error = %v", err)
+	}
+}
@@ -151,3 +151,109 @@ func (c *CognitoClient) GetUser(ctx context.Context, accessToken string) (*cogni
 		AccessToken: aws.String(accessToken),
 	})
 }
+
+func (c *CognitoClient) ResendConfirmationCode(ctx context.Context, username string) (*cognitoidentityprovider.ResendConfirmationCodeOutput, error) {
+	input := &cognitoidentityprovider.ResendConfirmationCodeInput{
+		ClientId: aws.String(c.appClientID),
+		Username: aws.String(username),
+	}
+
+	secretHash := c.ComputeSecretHash(username)
+	if secretHash != "" {
+		input.SecretHash = aws.String(secretHash)
+	}
+
+	return c.client.ResendConfirmationCode(ctx, input)
+}
+
+func (c *CognitoClient) ChangePassword(ctx context.Context, accessToken, previousPassword, proposedPassword string) (*cognitoidentityprovider.ChangePasswordOutput, error) {
+	return c.client.ChangePassword(ctx, &cognitoidentityprovider.ChangePasswordInput{
+		AccessToken:      aws.String(accessToken),
+		PreviousPassword: aws.String(previousPassword),
+		ProposedPassword: aws.String(proposedPassword),
+	})
+}
+
+// GlobalSignOut invalidates all refresh tokens of the user, issued access tokens stop working at Cognito endpoints
+func (c *CognitoClient) GlobalSignOut(ctx context.Context, accessToken string) (*cognitoidentityprovider.GlobalSignOutOutput, error) {
+	return c.client.GlobalSignOut(ctx, &cognitoidentityprovider.GlobalSignOutInput{
+		AccessToken: aws.String(accessToken),
+	})
+}
+
+// RevokeToken revokes a single refresh token and the access tokens issued with it
+func (c *CognitoClient) RevokeToken(ctx context.Context, refreshToken string) (*cognitoidentityprovider.RevokeTokenOutput, error) {
+	input := &cognitoidentityprovider.RevokeTokenInput{
+		ClientId: aws.String(c.appClientID),
+		Token:    aws.String(refreshToken),
+	}
+	if c.appClientSecret != "" {
+		input.ClientSecret = aws.String(c.appClientSecret)
+	}
+
+	return c.client.RevokeToken(ctx, input)
+}
+
+// RespondToAuthChallenge answers a challenge InitiateAuth returned, responses hold the answer, e.g. the MFA code
+func (c *CognitoClient) RespondToAuthChallenge(ctx context.Context, challengeName types.ChallengeNameType, session, username string, responses map[string]string) (*cognitoidentityprovider.RespondToAuthChallengeOutput, error) {
+	challengeResponses := map[string]string{
+		"USERNAME": username,
+	}
+	for name, value := range responses {
+		challengeResponses[name] = value
+	}
+
+	secretHash := c.ComputeSecretHash(username)
+	if secretHash != "" {
+		challengeResponses["SECRET_HASH"] = secretHash
+	}
+
+	return c.client.RespondToAuthChallenge(ctx, &cognitoidentityprovider.RespondToAuthChallengeInput{
+		ClientId:           aws.String(c.appClientID),
+		ChallengeName:      challengeName,
+		Session:            aws.String(session),
+		ChallengeResponses: challengeResponses,
+	})
+}
+
+// AssociateSoftwareToken starts the TOTP setup of the signed in user, or of the user signing in with the session of an
+// MFA_SETUP challenge when the access token is empty
+func (c *CognitoClient) AssociateSoftwareToken(ctx context.Context, accessToken, session string) (*cognitoidentityprovider.AssociateSoftwareTokenOutput, error) {
+	input := &cognitoidentityprovider.AssociateSoftwareTokenInput{}
+	if accessToken != "" {
+		input.AccessToken = aws.String(accessToken)
+	} else {
+		input.Session = aws.String(session)
+	}
+
+	return c.client.AssociateSoftwareToken(ctx, input)
+}
+
+// VerifySoftwareToken completes the TOTP setup with a code of the authenticator app, like AssociateSoftwareToken it
+// works with an access token or the session of an MFA_SETUP challenge
+func (c *CognitoClient) VerifySoftwareToken(ctx context.Context, accessToken, session, code, deviceName string) (*cognitoidentityprovider.VerifySoftwareTokenOutput, error) {
+	input := &cognitoidentityprovider.VerifySoftwareTokenInput{
+		UserCode: aws.String(code),
+	}
+	if accessToken != "" {
+		input.AccessToken = aws.String(accessToken)
+	} else {
+		input.Session = aws.String(session)
+	}
+	if deviceName != "" {
+		input.FriendlyDeviceName = aws.String(deviceName)
+	}
+
+	return c.client.VerifySoftwareToken(ctx, input)
+}
+
+// SetSoftwareTokenMFA enables TOTP as the preferred MFA of the signed in user, or disables it
+func (c *CognitoClient) SetSoftwareTokenMFA(ctx context.Context, accessToken string, enabled bool) (*cognitoidentityprovider.SetUserMFAPreferenceOutput, error) {
+	return c.client.SetUserMFAPreference(ctx, &cognitoidentityprovider.SetUserMFAPreferenceInput{
+		AccessToken: aws.String(accessToken),
+		SoftwareTokenMfaSettings: &types.SoftwareTokenMfaSettingsType{
+			Enabled:      enabled,
+			PreferredMfa: enabled,
+		},
+	})
+}
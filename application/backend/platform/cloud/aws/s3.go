@@ -3,6 +3,7 @@ package aws
 import (
 	"bytes"
 	"context"
+	"io"
 	"log"
 	"os"
 	"time"
@@ -50,6 +51,22 @@ func (c *S3Client) UploadObject(ctx context.Context, object *S3Object) (*manager
 	})
 }
 
+func (c *S3Client) UploadStream(ctx context.Context, key string, body io.Reader, contentType string) (*manager.UploadOutput, error) {
+	return c.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:      &c.defaultBucket,
+		Key:         &key,
+		Body:        body,
+		ContentType: aws.String(contentType),
+	})
+}
+
+func (c *S3Client) GetObject(ctx context.Context, key string) (*s3.GetObjectOutput, error) {
+	return c.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &c.defaultBucket,
+		Key:    &key,
+	})
+}
+
 func (c *S3Client) HeadObject(ctx context.Context, key string) (*s3.HeadObjectOutput, error) {
 	out, err := c.client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: &c.defaultBucket,
@@ -76,3 +76,13 @@ output "task_definition_family" {
   value = module.ecs.task_definition_family
 }
 
+output "scheduler_task_definition_family" {
+  description = "ECS task definition family of the scheduler"
+  value = module.ecs.scheduler_task_definition_family
+}
+
+output "scheduler_service_name" {
+  description = "ECS service name of the scheduler"
+  value = module.ecs.scheduler_service_name
+}
+
@@ -126,6 +126,26 @@ resource "aws_ecs_service" "api" {
   depends_on = [aws_lb_listener.http, aws_ecs_cluster_capacity_providers.main]
 }
 
+# the scheduler is deployed by the pipeline with rolling updates, its jobs are claimed with leases so a replaced task
+# can be stopped while the new one already runs
+resource "aws_ecs_service" "scheduler" {
+  name            = "${var.environment}-scheduler"
+  cluster         = aws_ecs_cluster.main.id
+  task_definition = aws_ecs_task_definition.scheduler.arn
+  desired_count   = var.scheduler_desired_count
+
+  capacity_provider_strategy {
+    capacity_provider = aws_ecs_capacity_provider.main.name
+    weight            = 1
+  }
+
+  lifecycle {
+    ignore_changes = [task_definition]
+  }
+
+  depends_on = [aws_ecs_cluster_capacity_providers.main]
+}
+
 resource "aws_ecs_service" "client" {
   name            = "${var.environment}-client"
   cluster         = aws_ecs_cluster.main.id
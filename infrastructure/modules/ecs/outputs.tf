@@ -23,6 +23,15 @@ output "task_definition_family" {
   value = aws_ecs_task_definition.api.family
 }
 
+output "scheduler_task_definition_family" {
+  description = "ECS task definition family of the scheduler"
+  value = aws_ecs_task_definition.scheduler.family
+}
+
+output "scheduler_service_name" {
+  description = "ECS service name of the scheduler"
+  value = aws_ecs_service.scheduler.name
+}
 
 output "alb_dns_name" {
   description = "ALB DNS name"
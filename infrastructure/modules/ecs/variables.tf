@@ -67,6 +67,12 @@ variable "api_desired_count" {
   default     = 1
 }
 
+variable "scheduler_desired_count" {
+  description = "Desired number of scheduler tasks"
+  type        = number
+  default     = 1
+}
+
 variable "frontend_desired_count" {
   description = "Desired number of frontend tasks"
   type        = number